@@ -0,0 +1,136 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/apikey"
+	"github.com/appinesshq/bpi/business/data/user"
+	"github.com/appinesshq/bpi/foundation/database"
+	"github.com/appinesshq/bpi/foundation/envelope"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// APIKeys retrieves the API keys of all users from the database.
+func APIKeys(traceID string, log *log.Logger, cfg database.Config) error {
+	db, err := database.Open(cfg)
+	if err != nil {
+		return errors.Wrap(err, "connect database")
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	a := apikey.New(log, db, policy)
+
+	keys, err := a.Query(ctx, traceID)
+	if err != nil {
+		return errors.Wrap(err, "retrieve api keys")
+	}
+
+	return json.NewEncoder(os.Stdout).Encode(keys)
+}
+
+// APIKeyAdd creates an API key for the user with the specified email address.
+// The roles are a comma separated list which must be held by the user.
+func APIKeyAdd(traceID string, log *log.Logger, cfg database.Config, emails *envelope.Keyring, email string, name string, roles string, ttl string) error {
+	if email == "" || name == "" || roles == "" || ttl == "" {
+		fmt.Println("help: apikeyadd <email> <name> <roles> <ttl>")
+		fmt.Println("roles: comma separated, e.g. ADMIN,USER")
+		fmt.Println("ttl: duration, e.g. 720h")
+		return ErrHelp
+	}
+
+	d, err := time.ParseDuration(ttl)
+	if err != nil {
+		return errors.Wrap(err, "parsing ttl")
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return errors.Wrap(err, "connect database")
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Passwords are not involved, so no password hasher is needed.
+	u := user.New(log, db, nil, emails, policy)
+
+	// The call to retrieve a user requires an Admin role by the caller.
+	admin := auth.Claims{
+		Roles: []string{auth.RoleAdmin},
+	}
+
+	usr, err := u.QueryByEmail(ctx, traceID, admin, email)
+	if err != nil {
+		return errors.Wrap(err, "retrieve user")
+	}
+
+	// The key is created on behalf of the user, so it's limited to their roles.
+	claims := auth.Claims{
+		StandardClaims: jwt.StandardClaims{
+			Subject: usr.ID,
+		},
+		Roles: usr.Roles,
+	}
+
+	now := time.Now()
+	nk := apikey.NewKey{
+		Name:        name,
+		Roles:       strings.Split(roles, ","),
+		DateExpires: now.Add(d),
+	}
+
+	a := apikey.New(log, db, policy)
+
+	k, key, err := a.Create(ctx, traceID, claims, nk, now)
+	if err != nil {
+		return errors.Wrap(err, "create api key")
+	}
+
+	fmt.Printf("api key id: %s\n", k.ID)
+	fmt.Printf("api key: %s\n", key)
+	fmt.Println("the key can't be shown again, store it safely")
+	return nil
+}
+
+// APIKeyRevoke ends the use of the API key with the specified id.
+func APIKeyRevoke(traceID string, log *log.Logger, cfg database.Config, id string) error {
+	if id == "" {
+		fmt.Println("help: apikeyrevoke <id>")
+		return ErrHelp
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return errors.Wrap(err, "connect database")
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	a := apikey.New(log, db, policy)
+
+	// Revoking the key of another user requires an Admin role by the caller.
+	claims := auth.Claims{
+		Roles: []string{auth.RoleAdmin},
+	}
+
+	if err := a.Revoke(ctx, traceID, claims, id, time.Now()); err != nil {
+		return errors.Wrap(err, "revoke api key")
+	}
+
+	fmt.Println("revoked:", id)
+	return nil
+}
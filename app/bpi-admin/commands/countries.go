@@ -9,13 +9,17 @@ import (
 	"github.com/mkrou/geonames/models"
 )
 
+// CountrySeed returns the SQL for adding the GeoNames countries along with the
+// translations of their names.
 func CountrySeed() (string, error) {
 	b := bytes.Buffer{}
-	fmt.Fprint(&b, "INSERT INTO countries (gnid, country_code, name, currency_code, currency_name) VALUES")
+	fmt.Fprint(&b, "INSERT INTO countries (gnid, code, name, currency_code, currency_name) VALUES")
 
 	p := geonames.NewParser()
 
+	ids := make(map[int]string)
 	if err := p.GetCountries(func(country *models.Country) error {
+		ids[country.GeonameID] = country.Iso2Code
 		fmt.Fprintf(&b, "\n(%d, '%s', '%s', '%s', '%s'),",
 			country.GeonameID,
 			strings.Replace(country.Iso2Code, "'", "''", -1),
@@ -29,7 +33,17 @@ func CountrySeed() (string, error) {
 	}
 
 	bStr := b.String()
-	return fmt.Sprintf("%s\nON CONFLICT DO NOTHING;", bStr[:len(bStr)-1]), nil
+	seed := fmt.Sprintf("%s\nON CONFLICT DO NOTHING;", bStr[:len(bStr)-1])
+
+	names, err := translationSeed(p, "country", ids)
+	if err != nil {
+		return "", err
+	}
+	if names != "" {
+		seed += "\n\n" + names
+	}
+
+	return seed, nil
 
 	// Print all cities with a population greater than 500
 	// err := p.GetGeonames(geonames.Cities500, func(geoname *models.Geoname) error {
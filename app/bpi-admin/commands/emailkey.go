@@ -0,0 +1,51 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/appinesshq/bpi/business/data/user"
+	"github.com/appinesshq/bpi/foundation/database"
+	"github.com/appinesshq/bpi/foundation/envelope"
+	"github.com/pkg/errors"
+)
+
+// GenEmailKey prints a new key for encrypting email addresses.
+func GenEmailKey() error {
+	key, err := envelope.GenerateKey()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(key)
+	return nil
+}
+
+// RotateEmailKey encrypts the email addresses and totp secrets of all users
+// again with the active key. To rotate, add a new key next to the current one,
+// make it the active key for every service, run this command and remove the
+// old key.
+func RotateEmailKey(traceID string, log *log.Logger, cfg database.Config, emails *envelope.Keyring) error {
+	db, err := database.Open(cfg)
+	if err != nil {
+		return errors.Wrap(err, "connect database")
+	}
+	defer db.Close()
+
+	// Every user is updated, so this takes longer than other commands.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	// Passwords are not involved, so no password hasher is needed.
+	u := user.New(log, db, nil, emails, policy)
+
+	n, err := u.RotateEmailKey(ctx, traceID)
+	if err != nil {
+		return errors.Wrapf(err, "rotated %d users before failing", n)
+	}
+
+	fmt.Printf("re-encrypted the email address of %d users with key %q\n", n, emails.ActiveID())
+	return nil
+}
@@ -2,7 +2,6 @@ package commands
 
 import (
 	"context"
-	"crypto/rsa"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -11,6 +10,7 @@ import (
 	"github.com/appinesshq/bpi/business/auth"
 	"github.com/appinesshq/bpi/business/data/user"
 	"github.com/appinesshq/bpi/foundation/database"
+	"github.com/appinesshq/bpi/foundation/envelope"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/pkg/errors"
 )
@@ -18,7 +18,7 @@ import (
 var Issuer = "MB Appiness Solutions"
 
 // GenToken generates a JWT for the specified user.
-func GenToken(traceID string, log *log.Logger, cfg database.Config, id string, privateKeyFile string, algorithm string) error {
+func GenToken(traceID string, log *log.Logger, cfg database.Config, emails *envelope.Keyring, id string, privateKeyFile string, algorithm string) error {
 	if id == "" || privateKeyFile == "" || algorithm == "" {
 		fmt.Println("help: gentoken <id> <private_key_file> <algorithm>")
 		fmt.Println("algorithm: RS256, HS256")
@@ -34,7 +34,8 @@ func GenToken(traceID string, log *log.Logger, cfg database.Config, id string, p
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	u := user.New(log, db)
+	// Passwords are not involved, so no password hasher is needed.
+	u := user.New(log, db, nil, emails, policy)
 
 	// The call to retrieve a user requires an Admin role by the caller.
 	claims := auth.Claims{
@@ -60,25 +61,16 @@ func GenToken(traceID string, log *log.Logger, cfg database.Config, id string, p
 	}
 
 	// In a production system, a key id (KID) is used to retrieve the correct
-	// public key to parse a JWT for auth and claims. A key lookup function is
-	// provided to perform the task of retrieving a KID for a given public key.
-	// In this code, I am writing a lookup function that will return the public
-	// key for the private key provided with an arbitary KID.
+	// public key to parse a JWT for auth and claims. A key store is provided
+	// to perform the task of retrieving the key for a given KID. In this code,
+	// I am using an in memory key store holding the private key provided with
+	// an arbitary KID.
 	keyID := "54bb2165-71e1-41a6-af3e-7da4a0e1e2c1"
-	lookup := func(kid string) (*rsa.PublicKey, error) {
-		switch kid {
-		case keyID:
-			return &privateKey.PublicKey, nil
-		}
-		return nil, fmt.Errorf("no public key found for the specified kid: %s", kid)
-	}
 
 	// An authenticator maintains the state required to handle JWT processing.
-	// It requires the private key for generating tokens. The KID for access
-	// to the corresponding public key, the algorithms to use (RS256), and the
-	// key lookup function to perform the actual retrieve of the KID to public
-	// key lookup.
-	a, err := auth.New(algorithm, lookup, auth.Keys{keyID: privateKey})
+	// It requires the key store for generating and validating tokens, the KID
+	// of the key to sign with and the algorithms to use (RS256).
+	a, err := auth.New(algorithm, keyID, auth.Keys{keyID: privateKey})
 	if err != nil {
 		return errors.Wrap(err, "constructing auth")
 	}
@@ -17,17 +17,22 @@ func getCountryCode(divCode string) (string, error) {
 	return p[0], nil
 }
 
+// JurisdictionSeed returns the SQL for adding the GeoNames first level
+// administrative divisions as jurisdictions along with the translations of
+// their names.
 func JurisdictionSeed() (string, error) {
 	b := bytes.Buffer{}
 	fmt.Fprint(&b, "INSERT INTO jurisdictions (gnid, code, country_code, name) VALUES")
 
 	p := geonames.NewParser()
 
+	ids := make(map[int]string)
 	if err := p.GetAdminDivisions(func(d *models.AdminDivision) error {
 		countryCode, err := getCountryCode(d.Code)
 		if err != nil {
 			return err
 		}
+		ids[d.GeonameId] = d.Code
 
 		fmt.Fprintf(&b, "\n(%d, '%s', '%s', '%s'),",
 			d.GeonameId,
@@ -41,5 +46,15 @@ func JurisdictionSeed() (string, error) {
 	}
 
 	bStr := b.String()
-	return fmt.Sprintf("%s\nON CONFLICT DO NOTHING;", bStr[:len(bStr)-1]), nil
+	seed := fmt.Sprintf("%s\nON CONFLICT DO NOTHING;", bStr[:len(bStr)-1])
+
+	names, err := translationSeed(p, "jurisdiction", ids)
+	if err != nil {
+		return "", err
+	}
+	if names != "" {
+		seed += "\n\n" + names
+	}
+
+	return seed, nil
 }
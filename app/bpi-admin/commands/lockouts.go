@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/appinesshq/bpi/business/data/lockout"
+	"github.com/appinesshq/bpi/foundation/database"
+	"github.com/pkg/errors"
+)
+
+// Lockouts retrieves the accounts and addresses currently locked out from
+// the database. Lockouts of services using the memory store aren't visible.
+func Lockouts(traceID string, log *log.Logger, cfg database.Config) error {
+	db, err := database.Open(cfg)
+	if err != nil {
+		return errors.Wrap(err, "connect database")
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The policy is only used when recording failures.
+	store := lockout.NewPostgres(log, db, lockout.DefaultPolicy)
+
+	locked, err := store.Query(ctx, traceID, time.Now())
+	if err != nil {
+		return errors.Wrap(err, "retrieve lockouts")
+	}
+
+	return json.NewEncoder(os.Stdout).Encode(locked)
+}
+
+// Unlock clears the failed attempts of an account or address. The key is
+// either an email address, an ip:<address> key or an account:<hash> key as
+// listed by the lockouts command.
+func Unlock(traceID string, log *log.Logger, cfg database.Config, key string) error {
+	if key == "" {
+		fmt.Println("help: unlock <email|key>")
+		return ErrHelp
+	}
+
+	if !strings.HasPrefix(key, "ip:") && !strings.HasPrefix(key, "account:") {
+		key = lockout.AccountKey(key)
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return errors.Wrap(err, "connect database")
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The policy is only used when recording failures.
+	store := lockout.NewPostgres(log, db, lockout.DefaultPolicy)
+
+	if err := store.Clear(ctx, traceID, key, time.Now()); err != nil {
+		if err == lockout.ErrNotFound {
+			fmt.Println("no failed attempts recorded for", key)
+			return nil
+		}
+		return errors.Wrap(err, "clear lockout")
+	}
+
+	fmt.Println("unlocked:", key)
+	return nil
+}
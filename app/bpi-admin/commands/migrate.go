@@ -3,6 +3,7 @@ package commands
 import (
 	"fmt"
 
+	"github.com/appinesshq/bpi/business/auth"
 	"github.com/appinesshq/bpi/business/data/schema"
 	"github.com/appinesshq/bpi/foundation/database"
 	"github.com/pkg/errors"
@@ -11,6 +12,11 @@ import (
 // ErrHelp provides context that help was given.
 var ErrHelp = errors.New("provided help")
 
+// policy decides what commands are allowed to do. Commands act with admin
+// claims and the default grants, regardless of the permissions stored in the
+// database.
+var policy = auth.NewPolicy(auth.DefaultGrants)
+
 // Migrate creates the schema in the database.
 func Migrate(cfg database.Config) error {
 	db, err := database.Open(cfg)
@@ -0,0 +1,60 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/appinesshq/bpi/business/data/category"
+	"github.com/appinesshq/bpi/business/data/product"
+	"github.com/appinesshq/bpi/business/data/profile"
+	"github.com/appinesshq/bpi/business/data/session"
+	"github.com/appinesshq/bpi/business/data/user"
+	"github.com/appinesshq/bpi/foundation/database"
+	"github.com/pkg/errors"
+)
+
+// Purge permanently removes the users, profiles, categories and products
+// that were deleted longer than the retention period ago. Products that were
+// sold are kept along with their sales. Revoked access tokens are removed
+// once they expire, regardless of the retention period.
+func Purge(traceID string, log *log.Logger, cfg database.Config, retention time.Duration) error {
+	db, err := database.Open(cfg)
+	if err != nil {
+		return errors.Wrap(err, "connect database")
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	before := time.Now().Add(-retention)
+
+	// Purging doesn't need the hasher or the email keys of users.
+	purges := []struct {
+		name  string
+		purge func(context.Context, string, time.Time) (int, error)
+	}{
+		{"products", product.New(log, db, policy).Purge},
+		{"profiles", profile.New(log, db, policy).Purge},
+		{"categories", category.New(log, db, policy).Purge},
+		{"users", user.New(log, db, nil, nil, policy).Purge},
+	}
+
+	for _, p := range purges {
+		n, err := p.purge(ctx, traceID, before)
+		if err != nil {
+			return errors.Wrapf(err, "purge %s", p.name)
+		}
+		fmt.Printf("purged %d %s deleted before %s\n", n, p.name, before.Format(time.RFC3339))
+	}
+
+	n, err := session.New(log, db).Prune(ctx, traceID, time.Now())
+	if err != nil {
+		return errors.Wrap(err, "prune revoked tokens")
+	}
+	fmt.Printf("pruned %d expired revoked tokens\n", n)
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/appinesshq/bpi/business/data/currency"
+	"github.com/appinesshq/bpi/foundation/database"
+	"github.com/pkg/errors"
+)
+
+// Rates imports the exchange rates from a file in the format of the euro
+// foreign exchange reference rates of the European Central Bank, like
+// eurofxref-daily.xml or eurofxref-hist.xml.
+func Rates(traceID string, log *log.Logger, cfg database.Config, file string) error {
+	if file == "" {
+		fmt.Println("help: rates <file>")
+		return ErrHelp
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return errors.Wrap(err, "opening rates file")
+	}
+	defer f.Close()
+
+	rates, err := currency.ParseECB(f)
+	if err != nil {
+		return errors.Wrapf(err, "reading %s", file)
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return errors.Wrap(err, "connect database")
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	n, err := currency.New(log, db).Import(ctx, traceID, rates, time.Now())
+	if err != nil {
+		return errors.Wrap(err, "import rates")
+	}
+
+	fmt.Printf("imported %d new or changed exchange rates\n", n)
+	return nil
+}
@@ -0,0 +1,87 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mkrou/geonames"
+	"github.com/mkrou/geonames/models"
+)
+
+// translationSeed returns the SQL for adding the GeoNames alternate names of
+// the entities with the given GeoNames IDs as translations of their name. The
+// ids map a GeoNames ID onto the ID of the entity. English names are skipped,
+// the names stored with the entities are English already. An empty string is
+// returned when no alternate names are found.
+func translationSeed(p geonames.Parser, entityType string, ids map[int]string) (string, error) {
+	type alternate struct {
+		name string
+		rank int
+	}
+
+	// names maps an entity ID onto the best name found per language.
+	names := make(map[string]map[string]alternate)
+
+	if err := p.GetAlternateNames(geonames.AlternateNames, func(a *models.AlternateName) error {
+		id, ok := ids[a.GeonameId]
+		if !ok || !a.IsAlpha2() || a.IsoLanguage == "en" || a.IsHistoric || a.IsColloquial {
+			return nil
+		}
+
+		// Official names win over short names, which win over any other name.
+		rank := 0
+		if a.IsPreferred {
+			rank += 2
+		}
+		if a.IsShort {
+			rank++
+		}
+
+		if names[id] == nil {
+			names[id] = make(map[string]alternate)
+		}
+		lang := strings.ToLower(a.IsoLanguage)
+		if cur, ok := names[id][lang]; ok && cur.rank >= rank {
+			return nil
+		}
+		names[id][lang] = alternate{name: a.Name, rank: rank}
+		return nil
+	}); err != nil {
+		return "", err
+	}
+
+	if len(names) == 0 {
+		return "", nil
+	}
+
+	entities := make([]string, 0, len(names))
+	for id := range names {
+		entities = append(entities, id)
+	}
+	sort.Strings(entities)
+
+	b := bytes.Buffer{}
+	fmt.Fprint(&b, "INSERT INTO translations (entity_type, entity_id, language, field, value) VALUES")
+
+	for _, id := range entities {
+		langs := make([]string, 0, len(names[id]))
+		for lang := range names[id] {
+			langs = append(langs, lang)
+		}
+		sort.Strings(langs)
+
+		for _, lang := range langs {
+			fmt.Fprintf(&b, "\n('%s', '%s', '%s', 'name', '%s'),",
+				entityType,
+				strings.Replace(id, "'", "''", -1),
+				lang,
+				strings.Replace(names[id][lang].name, "'", "''", -1),
+			)
+		}
+	}
+
+	bStr := b.String()
+	return fmt.Sprintf("%s\nON CONFLICT (entity_type, entity_id, language, field) DO UPDATE SET\n\tvalue = EXCLUDED.value,\n\tdate_updated = NOW() AT TIME ZONE 'UTC';", bStr[:len(bStr)-1]), nil
+}
@@ -9,11 +9,13 @@ import (
 	"github.com/appinesshq/bpi/business/auth"
 	"github.com/appinesshq/bpi/business/data/user"
 	"github.com/appinesshq/bpi/foundation/database"
+	"github.com/appinesshq/bpi/foundation/envelope"
+	"github.com/appinesshq/bpi/foundation/passwd"
 	"github.com/pkg/errors"
 )
 
 // UserAdd adds new users into the database.
-func UserAdd(traceID string, log *log.Logger, cfg database.Config, email, password string) error {
+func UserAdd(traceID string, log *log.Logger, cfg database.Config, passwords *passwd.Hasher, emails *envelope.Keyring, email, password string) error {
 	if email == "" || password == "" {
 		fmt.Println("help: useradd <email> <password>")
 		return ErrHelp
@@ -28,7 +30,7 @@ func UserAdd(traceID string, log *log.Logger, cfg database.Config, email, passwo
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	u := user.New(log, db)
+	u := user.New(log, db, passwords, emails, policy)
 
 	nu := user.NewUser{
 		Email:           email,
@@ -37,7 +39,8 @@ func UserAdd(traceID string, log *log.Logger, cfg database.Config, email, passwo
 		Roles:           []string{auth.RoleAdmin, auth.RoleUser},
 	}
 
-	usr, err := u.Create(ctx, traceID, nu, time.Now())
+	// Users added with admin tooling are recorded without an actor.
+	usr, err := u.Create(ctx, traceID, auth.Claims{}, nu, time.Now())
 	if err != nil {
 		return errors.Wrap(err, "create user")
 	}
@@ -10,11 +10,12 @@ import (
 
 	"github.com/appinesshq/bpi/business/data/user"
 	"github.com/appinesshq/bpi/foundation/database"
+	"github.com/appinesshq/bpi/foundation/envelope"
 	"github.com/pkg/errors"
 )
 
 // Users retrieves all users from the database.
-func Users(traceID string, log *log.Logger, cfg database.Config, pageNumber string, rowsPerPage string) error {
+func Users(traceID string, log *log.Logger, cfg database.Config, emails *envelope.Keyring, pageNumber string, rowsPerPage string) error {
 	db, err := database.Open(cfg)
 	if err != nil {
 		return errors.Wrap(err, "connect database")
@@ -34,7 +35,8 @@ func Users(traceID string, log *log.Logger, cfg database.Config, pageNumber stri
 		return errors.Wrap(err, "converting rows per page")
 	}
 
-	u := user.New(log, db)
+	// Passwords are not involved, so no password hasher is needed.
+	u := user.New(log, db, nil, emails, policy)
 
 	users, err := u.Query(ctx, traceID, page, rows)
 	if err != nil {
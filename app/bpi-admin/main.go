@@ -6,9 +6,12 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/appinesshq/bpi/app/bpi-admin/commands"
 	"github.com/appinesshq/bpi/foundation/database"
+	"github.com/appinesshq/bpi/foundation/envelope"
+	"github.com/appinesshq/bpi/foundation/passwd"
 	"github.com/ardanlabs/conf"
 	"github.com/pkg/errors"
 )
@@ -42,6 +45,17 @@ func run(log *log.Logger) error {
 			Name       string `conf:"default:postgres"`
 			DisableTLS bool   `conf:"default:true"`
 		}
+		Passwords struct {
+			Cost   int    `conf:"default:10"`
+			Pepper string `conf:"default:joireu98ytu98grHROIHGWJREOIJOIJroJ5Y09JRATHJOIHJj5y09aeoirjroiejjrtjhJROIJIJyjHJroisjh509e5e0jte0jhreoijtkjrtrej9yg,noprint"`
+		}
+		Emails struct {
+			ActiveKeyID string            `conf:"default:1"`
+			Keys        map[string]string `conf:"noprint"`
+		}
+		Purge struct {
+			Retention time.Duration `conf:"default:720h"`
+		}
 	}
 	cfg.Version.SVN = build
 	cfg.Version.Desc = "copyright information here"
@@ -84,6 +98,24 @@ func run(log *log.Logger) error {
 		DisableTLS: cfg.DB.DisableTLS,
 	}
 
+	// Only the commands reading or writing email addresses need the keys, so
+	// a first key can be generated without having one.
+	var emails *envelope.Keyring
+	if len(cfg.Emails.Keys) > 0 {
+		var err error
+		emails, err = envelope.Parse(cfg.Emails.ActiveKeyID, cfg.Emails.Keys)
+		if err != nil {
+			return errors.Wrap(err, "configuring email encryption")
+		}
+	}
+
+	switch cfg.Args.Num(0) {
+	case "useradd", "users", "apikeyadd", "gentoken", "rotateemailkey":
+		if emails == nil {
+			return errors.New("no email encryption keys configured, set BPI_EMAILS_KEYS")
+		}
+	}
+
 	traceID := "00000000-0000-0000-0000-000000000000"
 
 	switch cfg.Args.Num(0) {
@@ -100,17 +132,53 @@ func run(log *log.Logger) error {
 	case "useradd":
 		email := cfg.Args.Num(1)
 		password := cfg.Args.Num(2)
-		if err := commands.UserAdd(traceID, log, dbConfig, email, password); err != nil {
+		alg, err := passwd.NewBcrypt(cfg.Passwords.Cost)
+		if err != nil {
+			return errors.Wrap(err, "configuring password hashing")
+		}
+		passwords := passwd.New(cfg.Passwords.Pepper, alg)
+		if err := commands.UserAdd(traceID, log, dbConfig, passwords, emails, email, password); err != nil {
 			return errors.Wrap(err, "adding user")
 		}
 
 	case "users":
 		pageNumber := cfg.Args.Num(1)
 		rowsPerPage := cfg.Args.Num(2)
-		if err := commands.Users(traceID, log, dbConfig, pageNumber, rowsPerPage); err != nil {
+		if err := commands.Users(traceID, log, dbConfig, emails, pageNumber, rowsPerPage); err != nil {
 			return errors.Wrap(err, "getting users")
 		}
 
+	case "lockouts":
+		if err := commands.Lockouts(traceID, log, dbConfig); err != nil {
+			return errors.Wrap(err, "getting lockouts")
+		}
+
+	case "unlock":
+		key := cfg.Args.Num(1)
+		if err := commands.Unlock(traceID, log, dbConfig, key); err != nil {
+			return errors.Wrap(err, "unlocking")
+		}
+
+	case "apikeys":
+		if err := commands.APIKeys(traceID, log, dbConfig); err != nil {
+			return errors.Wrap(err, "getting api keys")
+		}
+
+	case "apikeyadd":
+		email := cfg.Args.Num(1)
+		name := cfg.Args.Num(2)
+		roles := cfg.Args.Num(3)
+		ttl := cfg.Args.Num(4)
+		if err := commands.APIKeyAdd(traceID, log, dbConfig, emails, email, name, roles, ttl); err != nil {
+			return errors.Wrap(err, "adding api key")
+		}
+
+	case "apikeyrevoke":
+		id := cfg.Args.Num(1)
+		if err := commands.APIKeyRevoke(traceID, log, dbConfig, id); err != nil {
+			return errors.Wrap(err, "revoking api key")
+		}
+
 	case "genkey":
 		if err := commands.GenKey(); err != nil {
 			return errors.Wrap(err, "key generation")
@@ -120,10 +188,31 @@ func run(log *log.Logger) error {
 		id := cfg.Args.Num(1)
 		privateKeyFile := cfg.Args.Num(2)
 		algorithm := cfg.Args.Num(3)
-		if err := commands.GenToken(traceID, log, dbConfig, id, privateKeyFile, algorithm); err != nil {
+		if err := commands.GenToken(traceID, log, dbConfig, emails, id, privateKeyFile, algorithm); err != nil {
 			return errors.Wrap(err, "generating token")
 		}
 
+	case "genemailkey":
+		if err := commands.GenEmailKey(); err != nil {
+			return errors.Wrap(err, "key generation")
+		}
+
+	case "rotateemailkey":
+		if err := commands.RotateEmailKey(traceID, log, dbConfig, emails); err != nil {
+			return errors.Wrap(err, "rotating email key")
+		}
+
+	case "purge":
+		if err := commands.Purge(traceID, log, dbConfig, cfg.Purge.Retention); err != nil {
+			return errors.Wrap(err, "purging deleted records")
+		}
+
+	case "rates":
+		file := cfg.Args.Num(1)
+		if err := commands.Rates(traceID, log, dbConfig, file); err != nil {
+			return errors.Wrap(err, "importing exchange rates")
+		}
+
 	case "countries":
 		s, err := commands.CountrySeed()
 		if err != nil {
@@ -143,8 +232,19 @@ func run(log *log.Logger) error {
 		fmt.Println("seed: add data to the database")
 		fmt.Println("useradd: add a new user to the database")
 		fmt.Println("users: get a list of users from the database")
+		fmt.Println("lockouts: list the accounts and addresses locked out after failed logins")
+		fmt.Println("unlock: clear the failed logins of an account or address")
+		fmt.Println("apikeys: get a list of api keys from the database")
+		fmt.Println("apikeyadd: create an api key for a user")
+		fmt.Println("apikeyrevoke: revoke an api key")
 		fmt.Println("genkey: generate a set of private/public key files")
 		fmt.Println("gentoken: generate a JWT for a user with claims")
+		fmt.Println("genemailkey: generate a key for encrypting email addresses")
+		fmt.Println("rotateemailkey: encrypt all email addresses and totp secrets again with the active key")
+		fmt.Println("purge: remove records deleted longer than the retention period ago and expired revoked tokens")
+		fmt.Println("rates: import exchange rates from an ECB reference rates XML file")
+		fmt.Println("countries: print the SQL for adding the GeoNames countries and their translated names")
+		fmt.Println("jurisdictions: print the SQL for adding the GeoNames jurisdictions and their translated names")
 		fmt.Println("provide a command to get more help.")
 		return commands.ErrHelp
 	}
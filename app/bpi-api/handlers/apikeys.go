@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/apikey"
+	"github.com/appinesshq/bpi/foundation/web"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+type apiKeyGroup struct {
+	apikey apikey.APIKey
+}
+
+func (ag apiKeyGroup) query(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.apiKeyGroup.query")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	keys, err := ag.apikey.QueryByUser(ctx, v.TraceID, claims.Subject)
+	if err != nil {
+		return errors.Wrapf(err, "User: %s", claims.Subject)
+	}
+
+	return web.Respond(ctx, w, keys, http.StatusOK)
+}
+
+func (ag apiKeyGroup) create(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.apiKeyGroup.create")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var nk apikey.NewKey
+	if err := web.Decode(r, &nk); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	k, key, err := ag.apikey.Create(ctx, v.TraceID, claims, nk, v.Now)
+	if err != nil {
+		switch err {
+		case apikey.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
+		case apikey.ErrInvalidExpiry:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrapf(err, "API key: %+v", nk)
+		}
+	}
+
+	// The key itself is only returned here, it can't be retrieved later.
+	resp := struct {
+		apikey.Info
+		Key string `json:"key"`
+	}{
+		Info: k,
+		Key:  key,
+	}
+
+	return web.Respond(ctx, w, resp, http.StatusCreated)
+}
+
+func (ag apiKeyGroup) revoke(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.apiKeyGroup.revoke")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	params := web.Params(r)
+	if err := ag.apikey.Revoke(ctx, v.TraceID, claims, params["id"], v.Now); err != nil {
+		switch err {
+		case apikey.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case apikey.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case apikey.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "ID: %s", params["id"])
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
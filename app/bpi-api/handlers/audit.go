@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/appinesshq/bpi/business/data/audit"
+	"github.com/appinesshq/bpi/foundation/web"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+type auditGroup struct {
+	audit audit.Audit
+}
+
+// query returns a page of the audit log. Events can be filtered with the
+// actor_id, action, entity_type and entity_id query parameters, and limited
+// to a period with from and to in RFC 3339 format.
+func (ag auditGroup) query(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.auditGroup.query")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	params := web.Params(r)
+	pageNumber, err := strconv.Atoi(params["page"])
+	if err != nil {
+		return web.NewRequestError(fmt.Errorf("invalid page format: %s", params["page"]), http.StatusBadRequest)
+	}
+	rowsPerPage, err := strconv.Atoi(params["rows"])
+	if err != nil {
+		return web.NewRequestError(fmt.Errorf("invalid rows format: %s", params["rows"]), http.StatusBadRequest)
+	}
+
+	query := r.URL.Query()
+	filter := audit.Filter{
+		ActorID:    query.Get("actor_id"),
+		Action:     query.Get("action"),
+		EntityType: query.Get("entity_type"),
+		EntityID:   query.Get("entity_id"),
+	}
+	if from := query.Get("from"); from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return web.NewRequestError(fmt.Errorf("invalid from format: %s", from), http.StatusBadRequest)
+		}
+	}
+	if to := query.Get("to"); to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return web.NewRequestError(fmt.Errorf("invalid to format: %s", to), http.StatusBadRequest)
+		}
+	}
+
+	events, err := ag.audit.Query(ctx, v.TraceID, filter, pageNumber, rowsPerPage)
+	if err != nil {
+		return errors.Wrap(err, "unable to query for audit events")
+	}
+
+	return web.Respond(ctx, w, events, http.StatusOK)
+}
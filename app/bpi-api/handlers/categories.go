@@ -36,7 +36,7 @@ func (cg categoryGroup) query(ctx context.Context, w http.ResponseWriter, r *htt
 		return web.NewRequestError(fmt.Errorf("invalid rows format: %s", params["rows"]), http.StatusBadRequest)
 	}
 
-	categories, err := cg.category.Query(ctx, v.TraceID, pageNumber, rowsPerPage)
+	categories, err := cg.category.Query(ctx, v.TraceID, pageNumber, rowsPerPage, web.Language(r))
 	if err != nil {
 		return err
 	}
@@ -54,7 +54,7 @@ func (cg categoryGroup) queryByID(ctx context.Context, w http.ResponseWriter, r
 	}
 
 	params := web.Params(r)
-	cat, err := cg.category.QueryByID(ctx, v.TraceID, params["id"])
+	cat, err := cg.category.QueryByID(ctx, v.TraceID, params["id"], web.Language(r))
 	if err != nil {
 		switch err {
 		case category.ErrInvalidID:
@@ -90,7 +90,12 @@ func (cg categoryGroup) create(ctx context.Context, w http.ResponseWriter, r *ht
 
 	cat, err := cg.category.Create(ctx, v.TraceID, claims, nc, v.Now)
 	if err != nil {
-		return errors.Wrapf(err, "creating new category: %+v", nc)
+		switch err {
+		case category.ErrInvalidID, category.ErrParentNotFound:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrapf(err, "creating new category: %+v", nc)
+		}
 	}
 
 	return web.Respond(ctx, w, cat, http.StatusCreated)
@@ -124,6 +129,8 @@ func (cg categoryGroup) update(ctx context.Context, w http.ResponseWriter, r *ht
 			return web.NewRequestError(err, http.StatusNotFound)
 		case category.ErrForbidden:
 			return web.NewRequestError(err, http.StatusForbidden)
+		case category.ErrParentNotFound, category.ErrSelfParent, category.ErrCycle:
+			return web.NewRequestError(err, http.StatusBadRequest)
 		default:
 			return errors.Wrapf(err, "ID: %s  User: %+v", params["id"], &upd)
 		}
@@ -141,15 +148,273 @@ func (cg categoryGroup) delete(ctx context.Context, w http.ResponseWriter, r *ht
 		return web.NewShutdownError("web value missing from context")
 	}
 
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	params := web.Params(r)
+	if err := cg.category.Delete(ctx, v.TraceID, claims, params["id"], v.Now); err != nil {
+		switch err {
+		case category.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case category.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "ID: %s", params["id"])
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+func (cg categoryGroup) restore(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.categoryGroup.restore")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	params := web.Params(r)
+	if err := cg.category.Restore(ctx, v.TraceID, claims, params["id"], v.Now); err != nil {
+		switch err {
+		case category.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case category.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case category.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "ID: %s", params["id"])
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+func (cg categoryGroup) move(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.categoryGroup.move")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return web.NewShutdownError("claims missing from context")
+	}
+
+	var mv category.MoveCategory
+	if err := web.Decode(r, &mv); err != nil {
+		return errors.Wrapf(err, "unable to decode payload")
+	}
+
+	params := web.Params(r)
+	if err := cg.category.Move(ctx, v.TraceID, claims, params["id"], mv.ParentID, v.Now); err != nil {
+		switch err {
+		case category.ErrInvalidID, category.ErrParentNotFound, category.ErrSelfParent, category.ErrCycle:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case category.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case category.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "ID: %s  Parent: %s", params["id"], mv.ParentID)
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+func (cg categoryGroup) queryTree(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.categoryGroup.queryTree")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	tree, err := cg.category.QueryTree(ctx, v.TraceID, web.Language(r))
+	if err != nil {
+		return errors.Wrap(err, "unable to query category tree")
+	}
+
+	return web.Respond(ctx, w, tree, http.StatusOK)
+}
+
+func (cg categoryGroup) querySubtree(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.categoryGroup.querySubtree")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	params := web.Params(r)
+	node, err := cg.category.QuerySubtree(ctx, v.TraceID, params["id"], web.Language(r))
+	if err != nil {
+		switch err {
+		case category.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case category.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "ID: %s", params["id"])
+		}
+	}
+
+	return web.Respond(ctx, w, node, http.StatusOK)
+}
+
+func (cg categoryGroup) queryBreadcrumbs(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.categoryGroup.queryBreadcrumbs")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
 	params := web.Params(r)
-	if err := cg.category.Delete(ctx, v.TraceID, params["id"]); err != nil {
+	crumbs, err := cg.category.QueryBreadcrumbs(ctx, v.TraceID, params["id"], web.Language(r))
+	if err != nil {
 		switch err {
 		case category.ErrInvalidID:
 			return web.NewRequestError(err, http.StatusBadRequest)
+		case category.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "ID: %s", params["id"])
+		}
+	}
+
+	return web.Respond(ctx, w, crumbs, http.StatusOK)
+}
+
+func (cg categoryGroup) queryChildren(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.categoryGroup.queryChildren")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	params := web.Params(r)
+	children, err := cg.category.QueryChildren(ctx, v.TraceID, params["id"], web.Language(r))
+	if err != nil {
+		switch err {
+		case category.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case category.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "ID: %s", params["id"])
+		}
+	}
+
+	return web.Respond(ctx, w, children, http.StatusOK)
+}
+
+func (cg categoryGroup) queryTranslations(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.categoryGroup.queryTranslations")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	params := web.Params(r)
+	trs, err := cg.category.QueryTranslations(ctx, v.TraceID, params["id"])
+	if err != nil {
+		switch err {
+		case category.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case category.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
 		default:
 			return errors.Wrapf(err, "ID: %s", params["id"])
 		}
 	}
 
+	return web.Respond(ctx, w, trs, http.StatusOK)
+}
+
+func (cg categoryGroup) setTranslation(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.categoryGroup.setTranslation")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return web.NewShutdownError("claims missing from context")
+	}
+
+	var nt category.NewTranslation
+	if err := web.Decode(r, &nt); err != nil {
+		return errors.Wrapf(err, "unable to decode payload")
+	}
+
+	params := web.Params(r)
+	if err := cg.category.SetTranslation(ctx, v.TraceID, claims, params["id"], params["lang"], nt, v.Now); err != nil {
+		switch err {
+		case category.ErrInvalidID, category.ErrInvalidLanguage:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case category.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case category.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "ID: %s  Language: %s", params["id"], params["lang"])
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+func (cg categoryGroup) deleteTranslation(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.categoryGroup.deleteTranslation")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return web.NewShutdownError("claims missing from context")
+	}
+
+	params := web.Params(r)
+	if err := cg.category.DeleteTranslation(ctx, v.TraceID, claims, params["id"], params["lang"], v.Now); err != nil {
+		switch err {
+		case category.ErrInvalidID, category.ErrInvalidLanguage:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case category.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case category.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "ID: %s  Language: %s", params["id"], params["lang"])
+		}
+	}
+
 	return web.Respond(ctx, w, nil, http.StatusNoContent)
 }
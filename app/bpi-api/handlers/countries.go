@@ -36,7 +36,7 @@ func (cg countryGroup) query(ctx context.Context, w http.ResponseWriter, r *http
 		return web.NewRequestError(fmt.Errorf("invalid rows format: %s", params["rows"]), http.StatusBadRequest)
 	}
 
-	countries, err := cg.country.Query(ctx, v.TraceID, pageNumber, rowsPerPage)
+	countries, err := cg.country.Query(ctx, v.TraceID, pageNumber, rowsPerPage, web.Language(r))
 	if err != nil {
 		return err
 	}
@@ -94,7 +94,7 @@ func (cg countryGroup) queryByCode(ctx context.Context, w http.ResponseWriter, r
 	}
 
 	params := web.Params(r)
-	c, err := cg.country.QueryByCode(ctx, v.TraceID, claims, params["cc"])
+	c, err := cg.country.QueryByCode(ctx, v.TraceID, claims, params["cc"], web.Language(r))
 	if err != nil {
 		switch err {
 		case country.ErrInvalidID:
@@ -124,7 +124,7 @@ func (cg countryGroup) toggleActive(ctx context.Context, w http.ResponseWriter,
 	}
 
 	params := web.Params(r)
-	if err := cg.country.ToggleActive(ctx, v.TraceID, claims, params["cc"]); err != nil {
+	if err := cg.country.ToggleActive(ctx, v.TraceID, claims, params["cc"], v.Now); err != nil {
 		switch err {
 		case country.ErrInvalidID:
 			return web.NewRequestError(err, http.StatusBadRequest)
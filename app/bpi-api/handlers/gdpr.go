@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/category"
+	"github.com/appinesshq/bpi/business/data/product"
+	"github.com/appinesshq/bpi/business/data/profile"
+	"github.com/appinesshq/bpi/business/data/sale"
+	"github.com/appinesshq/bpi/business/data/user"
+	"github.com/appinesshq/bpi/foundation/web"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+// gdprGroup lets users exercise their rights to data portability and
+// erasure over their own data.
+type gdprGroup struct {
+	user     user.User
+	profile  profile.Profile
+	category category.Category
+	product  product.Product
+	sale     sale.Sale
+}
+
+// export is the bundle of all data stored about a user.
+type export struct {
+	User         user.Info       `json:"user"`
+	Profiles     []profile.Info  `json:"profiles"`
+	Categories   []category.Info `json:"categories"`
+	Products     []product.Info  `json:"products"`
+	Purchases    []sale.Info     `json:"purchases"`
+	DateExported time.Time       `json:"date_exported"`
+}
+
+func (gg gdprGroup) export(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.gdprGroup.export")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	usr, err := gg.user.QueryByID(ctx, v.TraceID, claims, claims.Subject)
+	if err != nil {
+		switch err {
+		case user.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case user.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "ID: %s", claims.Subject)
+		}
+	}
+
+	profiles, err := gg.profile.QueryByUser(ctx, v.TraceID, usr.ID)
+	if err != nil {
+		return errors.Wrap(err, "unable to query for profiles")
+	}
+	categories, err := gg.category.QueryByUser(ctx, v.TraceID, usr.ID)
+	if err != nil {
+		return errors.Wrap(err, "unable to query for categories")
+	}
+	products, err := gg.product.QueryByUser(ctx, v.TraceID, usr.ID)
+	if err != nil {
+		return errors.Wrap(err, "unable to query for products")
+	}
+	purchases, err := gg.sale.QueryByUser(ctx, v.TraceID, usr.ID)
+	if err != nil {
+		return errors.Wrap(err, "unable to query for purchases")
+	}
+
+	exp := export{
+		User:         usr,
+		Profiles:     profiles,
+		Categories:   categories,
+		Products:     products,
+		Purchases:    purchases,
+		DateExported: v.Now,
+	}
+
+	// The bundle is meant to be saved by the user, not to be cached on the way.
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "bpi-export-"+usr.ID+".json"))
+	w.Header().Set("Cache-Control", "no-store")
+
+	return web.Respond(ctx, w, exp, http.StatusOK)
+}
+
+func (gg gdprGroup) erase(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.gdprGroup.erase")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	if err := gg.user.Erase(ctx, v.TraceID, claims, v.Now); err != nil {
+		switch err {
+		case user.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case user.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "ID: %s", claims.Subject)
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
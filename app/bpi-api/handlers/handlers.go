@@ -7,15 +7,30 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/appinesshq/bpi/business/auth" // Import is removed in final PR
+	"github.com/appinesshq/bpi/business/data/apikey"
+	"github.com/appinesshq/bpi/business/data/audit"
 	"github.com/appinesshq/bpi/business/data/category"
 	"github.com/appinesshq/bpi/business/data/country"
+	"github.com/appinesshq/bpi/business/data/currency"
 	"github.com/appinesshq/bpi/business/data/jurisdiction"
+	"github.com/appinesshq/bpi/business/data/lockout"
+	"github.com/appinesshq/bpi/business/data/permission"
 	"github.com/appinesshq/bpi/business/data/product"
 	"github.com/appinesshq/bpi/business/data/profile"
+	"github.com/appinesshq/bpi/business/data/quote"
+	"github.com/appinesshq/bpi/business/data/review"
+	"github.com/appinesshq/bpi/business/data/sale"
+	"github.com/appinesshq/bpi/business/data/search"
+	"github.com/appinesshq/bpi/business/data/session"
 	"github.com/appinesshq/bpi/business/data/user"
 	"github.com/appinesshq/bpi/business/mid"
+	"github.com/appinesshq/bpi/foundation/envelope"
+	"github.com/appinesshq/bpi/foundation/mail"
+	"github.com/appinesshq/bpi/foundation/oidc"
+	"github.com/appinesshq/bpi/foundation/passwd"
 	"github.com/appinesshq/bpi/foundation/web"
 	"github.com/jmoiron/sqlx"
 )
@@ -31,13 +46,16 @@ import (
 func optionsHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	w.Header().Set("Access-Control-Allow-Origin", r.Header.Get("Origin"))
 	w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-	w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-OTP, X-API-Key")
 
 	return web.Respond(ctx, w, nil, http.StatusOK)
 }
 
 // API constructs an http.Handler with all application routes defined.
-func API(build string, shutdown chan os.Signal, log *log.Logger, a *auth.Auth, db *sqlx.DB) http.Handler {
+// Links in emails sent by the API point to publicURL. The policy decides
+// which permissions the roles of a user grant. Users can sign in with any of
+// the OpenID providers, keyed by the name used in their routes.
+func API(build string, shutdown chan os.Signal, log *log.Logger, a *auth.Auth, policy *auth.Policy, db *sqlx.DB, passwords *passwd.Hasher, emails *envelope.Keyring, lockouts lockout.Store, mailer mail.Mailer, publicURL string, providers map[string]*oidc.Provider) http.Handler {
 
 	// Construct the web.App which holds all routes as well as common Middleware.
 	app := web.NewApp(shutdown, mid.Logger(log), mid.Errors(log), mid.Metrics(), mid.Panics(log))
@@ -50,67 +68,190 @@ func API(build string, shutdown chan os.Signal, log *log.Logger, a *auth.Auth, d
 	app.HandleDebug(http.MethodGet, "/readiness", cg.readiness)
 	app.HandleDebug(http.MethodGet, "/liveness", cg.liveness)
 
+	// Register the endpoint publishing the public keys tokens are signed with.
+	kg := jwksGroup{
+		auth: a,
+	}
+	app.Handle(http.MethodGet, "/.well-known/jwks.json", kg.jwks)
+
+	// Every authenticated route checks whether its token has been revoked and
+	// accepts API keys as well.
+	ses := session.New(log, db)
+	keys := apikey.New(log, db, policy)
+	authenticate := mid.Authenticate(a, ses.IsRevoked, keys.Authenticate)
+
 	// Register user management and authentication endpoints.
 	ug := userGroup{
-		user: user.New(log, db),
-		auth: a,
+		user:      user.New(log, db, passwords, emails, policy),
+		session:   ses,
+		auth:      a,
+		mailer:    mailer,
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+		providers: providers,
+	}
+	app.Handle(http.MethodGet, "/v1/users/:page/:rows", ug.query, authenticate, mid.RequirePermission(policy, auth.Scoped(auth.PermissionUserRead, auth.ScopeAny)))
+	app.Handle(http.MethodGet, "/v1/users/token", ug.token, mid.Throttle(lockouts))
+	app.Handle(http.MethodGet, "/v1/users/token/:kid", ug.token, mid.Throttle(lockouts))
+	app.Handle(http.MethodPost, "/v1/users/token/refresh", ug.refresh)
+	app.Handle(http.MethodPost, "/v1/users/logout", ug.logout, authenticate)
+	app.Handle(http.MethodPost, "/v1/users/signup", ug.signup)
+	app.Handle(http.MethodGet, "/v1/users/verify", ug.verify)
+	app.Handle(http.MethodPost, "/v1/users/verify/resend", ug.resendVerification)
+	app.Handle(http.MethodPost, "/v1/users/password/forgot", ug.forgotPassword)
+	app.Handle(http.MethodPost, "/v1/users/password/reset", ug.resetPassword)
+	app.Handle(http.MethodGet, "/v1/users/oidc/:provider", ug.federatedLogin)
+	app.Handle(http.MethodGet, "/v1/users/oidc/:provider/callback", ug.federatedCallback)
+	app.Handle(http.MethodGet, "/v1/users/oidc/:provider/link", ug.linkIdentity, authenticate)
+	app.Handle(http.MethodPost, "/v1/users/2fa", ug.enrollTwoFactor, authenticate)
+	app.Handle(http.MethodPost, "/v1/users/2fa/confirm", ug.confirmTwoFactor, authenticate, mid.Throttle(lockouts))
+	app.Handle(http.MethodDelete, "/v1/users/2fa", ug.disableTwoFactor, authenticate, mid.Throttle(lockouts))
+	app.Handle(http.MethodPut, "/v1/roles/:role/2fa", ug.requireTwoFactor, authenticate, mid.RequirePermission(policy, auth.PermissionRoleManage))
+
+	// Register the endpoints letting users export and erase their own data.
+	gg := gdprGroup{
+		user:     ug.user,
+		profile:  profile.New(log, db, policy),
+		category: category.New(log, db, policy),
+		product:  product.New(log, db, policy),
+		sale:     sale.New(log, db, policy),
+	}
+	app.Handle(http.MethodGet, "/v1/users/me/export", gg.export, authenticate)
+	app.Handle(http.MethodDelete, "/v1/users/me", gg.erase, authenticate)
+
+	app.Handle(http.MethodGet, "/v1/users/:id", ug.queryByID, authenticate)
+	app.Handle(http.MethodGet, "/v1/users/:id/identities", ug.queryIdentities, authenticate)
+	app.Handle(http.MethodPost, "/v1/users", ug.create, authenticate, mid.RequirePermission(policy, auth.PermissionUserManage))
+	app.Handle(http.MethodPut, "/v1/users/:id", ug.update, authenticate, mid.RequirePermission(policy, auth.PermissionUserManage))
+	app.Handle(http.MethodDelete, "/v1/users/:id", ug.delete, authenticate, mid.RequirePermission(policy, auth.PermissionUserManage))
+	app.Handle(http.MethodPost, "/v1/users/:id/restore", ug.restore, authenticate)
+
+	// Register endpoints managing the permissions granted to roles.
+	peg := permissionGroup{
+		permission: permission.New(log, db),
+		policy:     policy,
+	}
+	app.Handle(http.MethodGet, "/v1/permissions", peg.query, authenticate, mid.RequirePermission(policy, auth.PermissionRoleManage))
+	app.Handle(http.MethodPut, "/v1/roles/:role/permissions/:permission", peg.grant, authenticate, mid.RequirePermission(policy, auth.PermissionRoleManage))
+	app.Handle(http.MethodDelete, "/v1/roles/:role/permissions/:permission", peg.revoke, authenticate, mid.RequirePermission(policy, auth.PermissionRoleManage))
+
+	// Register the endpoint for reading the audit log.
+	aug := auditGroup{
+		audit: audit.New(log, db),
+	}
+	app.Handle(http.MethodGet, "/v1/audit/:page/:rows", aug.query, authenticate, mid.RequirePermission(policy, auth.PermissionAuditRead))
+
+	// Register API key endpoints.
+	ag := apiKeyGroup{
+		apikey: keys,
 	}
-	app.Handle(http.MethodGet, "/v1/users/:page/:rows", ug.query, mid.Authenticate(a), mid.Authorize(auth.RoleAdmin))
-	app.Handle(http.MethodGet, "/v1/users/token/:kid", ug.token)
-	app.Handle(http.MethodGet, "/v1/users/:id", ug.queryByID, mid.Authenticate(a))
-	app.Handle(http.MethodPost, "/v1/users", ug.create, mid.Authenticate(a), mid.Authorize(auth.RoleAdmin))
-	app.Handle(http.MethodPut, "/v1/users/:id", ug.update, mid.Authenticate(a), mid.Authorize(auth.RoleAdmin))
-	app.Handle(http.MethodDelete, "/v1/users/:id", ug.delete, mid.Authenticate(a), mid.Authorize(auth.RoleAdmin))
+	app.Handle(http.MethodGet, "/v1/apikeys", ag.query, authenticate)
+	app.Handle(http.MethodPost, "/v1/apikeys", ag.create, authenticate)
+	app.Handle(http.MethodDelete, "/v1/apikeys/:id", ag.revoke, authenticate)
 
 	// Register product and sale endpoints.
 	pg := productGroup{
-		product: product.New(log, db),
+		product:  product.New(log, db, policy),
+		currency: currency.New(log, db),
 	}
-	app.Handle(http.MethodGet, "/v1/products/:page/:rows", pg.query, mid.Authenticate(a))
-	app.Handle(http.MethodGet, "/v1/products/:id", pg.queryByID, mid.Authenticate(a))
-	app.Handle(http.MethodPost, "/v1/products", pg.create, mid.Authenticate(a))
-	app.Handle(http.MethodPut, "/v1/products/:id", pg.update, mid.Authenticate(a))
-	app.Handle(http.MethodDelete, "/v1/products/:id", pg.delete, mid.Authenticate(a))
+	app.Handle(http.MethodGet, "/v1/products/:page/:rows", pg.query, authenticate)
+	app.Handle(http.MethodGet, "/v1/products/:id", pg.queryByID, authenticate)
+	app.Handle(http.MethodPost, "/v1/products", pg.create, authenticate)
+	app.Handle(http.MethodPut, "/v1/products/:id", pg.update, authenticate)
+	app.Handle(http.MethodDelete, "/v1/products/:id", pg.delete, authenticate)
+	app.Handle(http.MethodPost, "/v1/products/:id/restore", pg.restore, authenticate)
+	app.Handle(http.MethodGet, "/v1/profiles/:name/products/:page/:rows", pg.queryByProfile, authenticate)
+	app.Handle(http.MethodGet, "/v1/catalogue/:page/:rows", pg.browse, authenticate)
+
+	sag := saleGroup{
+		sale: sale.New(log, db, policy),
+	}
+	app.Handle(http.MethodPost, "/v1/products/:id/sales", sag.create, authenticate)
+	app.Handle(http.MethodGet, "/v1/products/:id/sales/:page/:rows", sag.queryByProduct, authenticate)
+
+	// Register quote request endpoints. Only the participants of a quote
+	// request get to its thread.
+	qg := quoteGroup{
+		quote: quote.New(log, db),
+	}
+	participant := mid.Participant(qg.quote.Participant)
+	app.Handle(http.MethodPost, "/v1/quotes", qg.create, authenticate)
+	app.Handle(http.MethodGet, "/v1/profiles/:name/quotes/:page/:rows", qg.inbox, authenticate)
+	app.Handle(http.MethodGet, "/v1/quotes/:id", qg.queryByID, authenticate, participant)
+	app.Handle(http.MethodGet, "/v1/quotes/:id/messages/:page/:rows", qg.queryMessages, authenticate, participant)
+	app.Handle(http.MethodPost, "/v1/quotes/:id/messages", qg.addMessage, authenticate, participant)
+	app.Handle(http.MethodPut, "/v1/quotes/:id/read", qg.markRead, authenticate, participant)
+
+	// Register review endpoints.
+	rg := reviewGroup{
+		review: review.New(log, db, policy),
+	}
+	app.Handle(http.MethodPost, "/v1/reviews", rg.create, authenticate)
+	app.Handle(http.MethodPut, "/v1/reviews/:id", rg.update, authenticate)
+	app.Handle(http.MethodPut, "/v1/reviews/:id/response", rg.respond, authenticate)
+	app.Handle(http.MethodPut, "/v1/reviews/:id/moderation", rg.moderate, authenticate, mid.RequirePermission(policy, auth.PermissionReviewModerate))
+	app.Handle(http.MethodGet, "/v1/profiles/:name/reviews/:page/:rows", rg.queryByProvider, authenticate)
+	app.Handle(http.MethodGet, "/v1/moderation/reviews/:page/:rows", rg.queue, authenticate, mid.RequirePermission(policy, auth.PermissionReviewModerate))
 
 	// Register country endpoints.
 	cog := countryGroup{
-		country: country.New(log, db),
+		country: country.New(log, db, policy),
 	}
-	app.Handle(http.MethodGet, "/v1/countries/:page/:rows", cog.query, mid.Authenticate(a))
-	app.Handle(http.MethodGet, "/v1/countries/:cc", cog.queryByCode, mid.Authenticate(a))
-	app.Handle(http.MethodPut, "/v1/countries/:cc", cog.toggleActive, mid.Authenticate(a))
+	app.Handle(http.MethodGet, "/v1/countries/:page/:rows", cog.query, authenticate)
+	app.Handle(http.MethodGet, "/v1/countries/:cc", cog.queryByCode, authenticate)
+	app.Handle(http.MethodPut, "/v1/countries/:cc", cog.toggleActive, authenticate)
 
 	// Register jurisdiction endpoints.
 	jg := jurisdictionGroup{
-		jurisdiction: jurisdiction.New(log, db),
+		jurisdiction: jurisdiction.New(log, db, policy),
 	}
-	app.Handle(http.MethodGet, "/v1/jurisdictions/:page/:rows", jg.query, mid.Authenticate(a))
-	app.Handle(http.MethodGet, "/v1/jurisdictions/:cc", jg.queryByCode, mid.Authenticate(a))
-	app.Handle(http.MethodPut, "/v1/jurisdictions/:cc", jg.toggleActive, mid.Authenticate(a))
+	app.Handle(http.MethodGet, "/v1/jurisdictions/:page/:rows", jg.query, authenticate)
+	app.Handle(http.MethodGet, "/v1/jurisdictions/:cc", jg.queryByCode, authenticate)
+	app.Handle(http.MethodPut, "/v1/jurisdictions/:cc", jg.toggleActive, authenticate)
 
 	// Register profile endpoints.
 	prg := profileGroup{
-		profile: profile.New(log, db),
+		profile: profile.New(log, db, policy),
 	}
-	app.Handle(http.MethodGet, "/v1/profiles/:page/:rows", prg.query, mid.Authenticate(a))
-	app.Handle(http.MethodGet, "/v1/profiles/:name", prg.queryByName, mid.Authenticate(a))
-	app.Handle(http.MethodPost, "/v1/profiles", prg.create, mid.Authenticate(a))
-	app.Handle(http.MethodPut, "/v1/profiles/:name", prg.update, mid.Authenticate(a))
-	app.Handle(http.MethodDelete, "/v1/profiles/:name", prg.delete, mid.Authenticate(a))
+	app.Handle(http.MethodGet, "/v1/profiles/:page/:rows", prg.query, authenticate)
+	app.Handle(http.MethodGet, "/v1/profiles/:name", prg.queryByName, authenticate)
+	app.Handle(http.MethodPost, "/v1/profiles", prg.create, authenticate)
+	app.Handle(http.MethodPut, "/v1/profiles/:name", prg.update, authenticate)
+	app.Handle(http.MethodDelete, "/v1/profiles/:name", prg.delete, authenticate)
+	app.Handle(http.MethodPost, "/v1/profiles/:name/restore", prg.restore, authenticate)
+	app.Handle(http.MethodPut, "/v1/profiles/:name/categories/:id", prg.attachCategory, authenticate)
+	app.Handle(http.MethodDelete, "/v1/profiles/:name/categories/:id", prg.detachCategory, authenticate)
+	app.Handle(http.MethodPut, "/v1/profiles/:name/jurisdictions/:code", prg.attachJurisdiction, authenticate)
+	app.Handle(http.MethodDelete, "/v1/profiles/:name/jurisdictions/:code", prg.detachJurisdiction, authenticate)
+	app.Handle(http.MethodGet, "/v1/directory/:page/:rows", prg.directory, authenticate)
 
 	// User profile
-	app.Handle(http.MethodGet, "/v1/users/profile/user/:id", prg.QueryUserProfile, mid.Authenticate(a))
-	app.Handle(http.MethodGet, "/v1/users/:id/profile", prg.QueryUserProfile, mid.Authenticate(a))
+	app.Handle(http.MethodGet, "/v1/users/profile/user/:id", prg.QueryUserProfile, authenticate)
+	app.Handle(http.MethodGet, "/v1/users/:id/profile", prg.QueryUserProfile, authenticate)
 
 	// Register category endpoints.
 	cag := categoryGroup{
-		category: category.New(log, db),
+		category: category.New(log, db, policy),
+	}
+	app.Handle(http.MethodGet, "/v1/categories/tree", cag.queryTree, authenticate)
+	app.Handle(http.MethodGet, "/v1/categories/:page/:rows", cag.query, authenticate)
+	app.Handle(http.MethodGet, "/v1/categories/:id", cag.queryByID, authenticate)
+	app.Handle(http.MethodPost, "/v1/categories", cag.create, authenticate)
+	app.Handle(http.MethodPut, "/v1/categories/:id", cag.update, authenticate)
+	app.Handle(http.MethodDelete, "/v1/categories/:id", cag.delete, authenticate)
+	app.Handle(http.MethodPost, "/v1/categories/:id/restore", cag.restore, authenticate)
+	app.Handle(http.MethodPost, "/v1/categories/:id/move", cag.move, authenticate)
+	app.Handle(http.MethodGet, "/v1/categories/:id/tree", cag.querySubtree, authenticate)
+	app.Handle(http.MethodGet, "/v1/categories/:id/breadcrumbs", cag.queryBreadcrumbs, authenticate)
+	app.Handle(http.MethodGet, "/v1/categories/:id/children", cag.queryChildren, authenticate)
+	app.Handle(http.MethodGet, "/v1/categories/:id/translations", cag.queryTranslations, authenticate)
+	app.Handle(http.MethodPut, "/v1/categories/:id/translations/:lang", cag.setTranslation, authenticate)
+	app.Handle(http.MethodDelete, "/v1/categories/:id/translations/:lang", cag.deleteTranslation, authenticate)
+
+	// Register the search endpoint.
+	sg := searchGroup{
+		search: search.New(log, db),
 	}
-	app.Handle(http.MethodGet, "/v1/categories/:page/:rows", cag.query, mid.Authenticate(a))
-	app.Handle(http.MethodGet, "/v1/categories/:id", cag.queryByID, mid.Authenticate(a))
-	app.Handle(http.MethodPost, "/v1/categories", cag.create, mid.Authenticate(a))
-	app.Handle(http.MethodPut, "/v1/categories/:id", cag.update, mid.Authenticate(a))
-	app.Handle(http.MethodDelete, "/v1/categories/:id", cag.delete, mid.Authenticate(a))
+	app.Handle(http.MethodGet, "/v1/search/:page/:rows", sg.query, authenticate)
 
 	// Register handler for pre-flight CORS requests
 	app.Handle(http.MethodOptions, "/v1/*path", optionsHandler)
@@ -36,7 +36,7 @@ func (jg jurisdictionGroup) query(ctx context.Context, w http.ResponseWriter, r
 		return web.NewRequestError(fmt.Errorf("invalid rows format: %s", params["rows"]), http.StatusBadRequest)
 	}
 
-	Jurisdictions, err := jg.jurisdiction.Query(ctx, v.TraceID, pageNumber, rowsPerPage)
+	Jurisdictions, err := jg.jurisdiction.Query(ctx, v.TraceID, pageNumber, rowsPerPage, web.Language(r))
 	if err != nil {
 		return err
 	}
@@ -59,7 +59,7 @@ func (jg jurisdictionGroup) queryByCode(ctx context.Context, w http.ResponseWrit
 	}
 
 	params := web.Params(r)
-	c, err := jg.jurisdiction.QueryByCode(ctx, v.TraceID, claims, params["cc"])
+	c, err := jg.jurisdiction.QueryByCode(ctx, v.TraceID, claims, params["cc"], web.Language(r))
 	if err != nil {
 		switch err {
 		case jurisdiction.ErrInvalidID:
@@ -89,7 +89,7 @@ func (jg jurisdictionGroup) toggleActive(ctx context.Context, w http.ResponseWri
 	}
 
 	params := web.Params(r)
-	if err := jg.jurisdiction.ToggleActive(ctx, v.TraceID, claims, params["cc"]); err != nil {
+	if err := jg.jurisdiction.ToggleActive(ctx, v.TraceID, claims, params["cc"], v.Now); err != nil {
 		switch err {
 		case jurisdiction.ErrInvalidID:
 			return web.NewRequestError(err, http.StatusBadRequest)
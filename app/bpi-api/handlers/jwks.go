@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/foundation/web"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+type jwksGroup struct {
+	auth *auth.Auth
+}
+
+// jwks publishes the public keys used to sign tokens, so clients and other
+// services can verify tokens without sharing key files.
+func (jg jwksGroup) jwks(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.jwksGroup.jwks")
+	defer span.End()
+
+	return web.Respond(ctx, w, jg.auth.JWKS(), http.StatusOK)
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/user"
+	"github.com/appinesshq/bpi/foundation/oidc"
+	"github.com/appinesshq/bpi/foundation/web"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+// federatedLogin sends the user to the provider to sign in. The provider
+// redirects back to federatedCallback.
+func (ug userGroup) federatedLogin(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.federatedLogin")
+	defer span.End()
+
+	return ug.startFederatedLogin(ctx, w, r, "")
+}
+
+// linkIdentity sends the signed in user to the provider to link their
+// account there. The provider redirects back to federatedCallback, which
+// links the account instead of signing in.
+func (ug userGroup) linkIdentity(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.linkIdentity")
+	defer span.End()
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	return ug.startFederatedLogin(ctx, w, r, claims.Subject)
+}
+
+// startFederatedLogin records a login with the provider in the request and
+// redirects to it. Logins for a user link the account at the provider to
+// that user.
+func (ug userGroup) startFederatedLogin(ctx context.Context, w http.ResponseWriter, r *http.Request, userID string) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	name := web.Params(r)["provider"]
+	provider, ok := ug.providers[name]
+	if !ok {
+		err := fmt.Errorf("unknown provider: %s", name)
+		return web.NewRequestError(err, http.StatusNotFound)
+	}
+
+	fl := user.FederatedLogin{
+		Provider: name,
+		UserID:   sql.NullString{String: userID, Valid: userID != ""},
+	}
+	for _, s := range []*string{&fl.State, &fl.Nonce, &fl.Verifier} {
+		var err error
+		if *s, err = oidc.Random(); err != nil {
+			return err
+		}
+	}
+
+	u, err := provider.AuthCodeURL(ctx, fl.State, fl.Nonce, fl.Verifier)
+	if err != nil {
+		return errors.Wrapf(err, "Provider: %s", name)
+	}
+
+	if err := ug.user.StartFederatedLogin(ctx, v.TraceID, fl, v.Now); err != nil {
+		return errors.Wrapf(err, "Provider: %s", name)
+	}
+
+	resp := struct {
+		URL string `json:"url"`
+	}{
+		URL: u,
+	}
+
+	w.Header().Set("Location", u)
+	return web.Respond(ctx, w, resp, http.StatusFound)
+}
+
+// federatedCallback completes signing in with a provider and issues tokens
+// like signing in with a password does, including the second factor of users
+// enrolled for it. Logins started to link an account link it instead.
+func (ug userGroup) federatedCallback(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.federatedCallback")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	name := web.Params(r)["provider"]
+	provider, ok := ug.providers[name]
+	if !ok {
+		err := fmt.Errorf("unknown provider: %s", name)
+		return web.NewRequestError(err, http.StatusNotFound)
+	}
+
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		err := fmt.Errorf("provider refused: %s", e)
+		return web.NewRequestError(err, http.StatusUnauthorized)
+	}
+
+	fl, err := ug.user.CompleteFederatedLogin(ctx, v.TraceID, name, q.Get("state"), v.Now)
+	if err != nil {
+		switch err {
+		case user.ErrInvalidLoginState:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrapf(err, "Provider: %s", name)
+		}
+	}
+
+	tok, err := provider.Exchange(ctx, q.Get("code"), fl.Verifier, fl.Nonce, v.Now)
+	if err != nil {
+		return web.NewRequestError(err, http.StatusUnauthorized)
+	}
+
+	ni := user.NewIdentity{
+		Provider:      name,
+		Subject:       tok.Subject,
+		Email:         tok.Email,
+		EmailVerified: tok.EmailVerified,
+	}
+
+	if fl.UserID.Valid {
+		if err := ug.user.LinkIdentity(ctx, v.TraceID, fl.UserID.String, ni, v.Now); err != nil {
+			switch err {
+			case user.ErrIdentityExists:
+				return web.NewRequestError(err, http.StatusConflict)
+			default:
+				return errors.Wrapf(err, "Provider: %s", name)
+			}
+		}
+
+		return web.Respond(ctx, w, nil, http.StatusNoContent)
+	}
+
+	// As when signing in with a password, users enrolled for two-factor
+	// authentication provide a code in a header.
+	claims, err := ug.user.AuthenticateIdentity(ctx, v.TraceID, v.Now, ni, r.Header.Get("X-OTP"))
+	if err != nil {
+		switch err {
+		case user.ErrAuthenticationFailure, user.ErrSecondFactorRequired:
+			return web.NewRequestError(err, http.StatusUnauthorized)
+		case user.ErrNotVerified:
+			return web.NewRequestError(err, http.StatusForbidden)
+		case user.ErrIdentityNotLinked:
+			return web.NewRequestError(err, http.StatusConflict)
+		default:
+			return errors.Wrapf(err, "Provider: %s", name)
+		}
+	}
+
+	tkn, err := ug.startSession(ctx, v, r, claims, "")
+	if err != nil {
+		return err
+	}
+
+	return web.Respond(ctx, w, tkn, http.StatusOK)
+}
+
+func (ug userGroup) queryIdentities(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.queryIdentities")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	params := web.Params(r)
+	ids, err := ug.user.QueryIdentities(ctx, v.TraceID, claims, params["id"])
+	if err != nil {
+		switch err {
+		case user.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case user.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "ID: %s", params["id"])
+		}
+	}
+
+	return web.Respond(ctx, w, ids, http.StatusOK)
+}
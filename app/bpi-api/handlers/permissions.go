@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/permission"
+	"github.com/appinesshq/bpi/foundation/web"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+type permissionGroup struct {
+	permission permission.Permission
+	policy     *auth.Policy
+}
+
+func (pg permissionGroup) query(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.permissionGroup.query")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	grants, err := pg.permission.Grants(ctx, v.TraceID)
+	if err != nil {
+		return err
+	}
+
+	return web.Respond(ctx, w, grants, http.StatusOK)
+}
+
+func (pg permissionGroup) grant(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.permissionGroup.grant")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	params := web.Params(r)
+	if err := pg.permission.Grant(ctx, v.TraceID, claims, params["role"], params["permission"], v.Now); err != nil {
+		switch err {
+		case permission.ErrUnknownPermission:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrapf(err, "Role: %s Permission: %s", params["role"], params["permission"])
+		}
+	}
+
+	// Other instances pick the change up when they reload the policy.
+	if err := pg.permission.Load(ctx, v.TraceID, pg.policy); err != nil {
+		return errors.Wrap(err, "reloading policy")
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+func (pg permissionGroup) revoke(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.permissionGroup.revoke")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	params := web.Params(r)
+	if err := pg.permission.Revoke(ctx, v.TraceID, claims, params["role"], params["permission"], v.Now); err != nil {
+		switch err {
+		case permission.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "Role: %s Permission: %s", params["role"], params["permission"])
+		}
+	}
+
+	// Other instances pick the change up when they reload the policy.
+	if err := pg.permission.Load(ctx, v.TraceID, pg.policy); err != nil {
+		return errors.Wrap(err, "reloading policy")
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/currency"
 	"github.com/appinesshq/bpi/business/data/product"
 	"github.com/appinesshq/bpi/foundation/web"
 	"github.com/pkg/errors"
@@ -14,7 +16,45 @@ import (
 )
 
 type productGroup struct {
-	product product.Product
+	product  product.Product
+	currency currency.Currency
+}
+
+// prepare hides the sales figures of the products the claims don't allow
+// editing and expresses the prices in the currency requested with the
+// currency query parameter, if any.
+func (pg productGroup) prepare(ctx context.Context, traceID string, r *http.Request, products ...product.Info) error {
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return web.NewShutdownError("claims missing from context")
+	}
+	pg.product.HideSales(claims, products)
+
+	code := strings.ToUpper(r.URL.Query().Get("currency"))
+	if code == "" {
+		return nil
+	}
+	if !currency.Valid(code) {
+		return web.NewRequestError(fmt.Errorf("unknown currency: %s", code), http.StatusBadRequest)
+	}
+
+	rates, err := pg.currency.QueryRates(ctx, traceID)
+	if err != nil {
+		return err
+	}
+
+	for i := range products {
+		prd, err := product.Convert(products[i], rates, code)
+		if err != nil {
+			if errors.Cause(err) == currency.ErrNoRate {
+				return web.NewRequestError(err, http.StatusBadRequest)
+			}
+			return err
+		}
+		products[i] = prd
+	}
+
+	return nil
 }
 
 func (pg productGroup) query(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
@@ -41,6 +81,91 @@ func (pg productGroup) query(ctx context.Context, w http.ResponseWriter, r *http
 		return err
 	}
 
+	if err := pg.prepare(ctx, v.TraceID, r, products...); err != nil {
+		return err
+	}
+
+	return web.Respond(ctx, w, products, http.StatusOK)
+}
+
+func (pg productGroup) queryByProfile(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.productGroup.queryByProfile")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	params := web.Params(r)
+	pageNumber, err := strconv.Atoi(params["page"])
+	if err != nil {
+		return web.NewRequestError(fmt.Errorf("invalid page format: %s", params["page"]), http.StatusBadRequest)
+	}
+	rowsPerPage, err := strconv.Atoi(params["rows"])
+	if err != nil {
+		return web.NewRequestError(fmt.Errorf("invalid rows format: %s", params["rows"]), http.StatusBadRequest)
+	}
+
+	products, err := pg.product.QueryByProfile(ctx, v.TraceID, params["name"], pageNumber, rowsPerPage)
+	if err != nil {
+		return errors.Wrapf(err, "profile: %s", params["name"])
+	}
+
+	if err := pg.prepare(ctx, v.TraceID, r, products...); err != nil {
+		return err
+	}
+
+	return web.Respond(ctx, w, products, http.StatusOK)
+}
+
+func (pg productGroup) browse(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.productGroup.browse")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	params := web.Params(r)
+	pageNumber, err := strconv.Atoi(params["page"])
+	if err != nil {
+		return web.NewRequestError(fmt.Errorf("invalid page format: %s", params["page"]), http.StatusBadRequest)
+	}
+	rowsPerPage, err := strconv.Atoi(params["rows"])
+	if err != nil {
+		return web.NewRequestError(fmt.Errorf("invalid rows format: %s", params["rows"]), http.StatusBadRequest)
+	}
+
+	query := r.URL.Query()
+	filter := product.Filter{
+		CategoryID:   query.Get("category"),
+		Jurisdiction: query.Get("jurisdiction"),
+		Country:      query.Get("country"),
+	}
+	if pricing := query.Get("pricing"); pricing != "" {
+		pr, err := product.PricingFromString(pricing)
+		if err != nil {
+			return web.NewRequestError(err, http.StatusBadRequest)
+		}
+		filter.Pricing = *pr
+	}
+
+	products, err := pg.product.Browse(ctx, v.TraceID, filter, pageNumber, rowsPerPage)
+	if err != nil {
+		switch err {
+		case product.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrap(err, "unable to browse products")
+		}
+	}
+
+	if err := pg.prepare(ctx, v.TraceID, r, products...); err != nil {
+		return err
+	}
+
 	return web.Respond(ctx, w, products, http.StatusOK)
 }
 
@@ -66,7 +191,12 @@ func (pg productGroup) queryByID(ctx context.Context, w http.ResponseWriter, r *
 		}
 	}
 
-	return web.Respond(ctx, w, prod, http.StatusOK)
+	products := []product.Info{prod}
+	if err := pg.prepare(ctx, v.TraceID, r, products...); err != nil {
+		return err
+	}
+
+	return web.Respond(ctx, w, products[0], http.StatusOK)
 }
 
 func (pg productGroup) create(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
@@ -90,7 +220,15 @@ func (pg productGroup) create(ctx context.Context, w http.ResponseWriter, r *htt
 
 	prod, err := pg.product.Create(ctx, v.TraceID, claims, np, v.Now)
 	if err != nil {
-		return errors.Wrapf(err, "creating new product: %+v", np)
+		switch err {
+		case product.ErrInvalidID, product.ErrUnknownCurrency, product.ErrUnknownProfile, product.ErrNotProvider,
+			product.ErrUnknownCategory, product.ErrUnknownJurisdiction, product.ErrInvalidPricing, product.ErrInvalidAvailability:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case product.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "creating new product: %+v", np)
+		}
 	}
 
 	return web.Respond(ctx, w, prod, http.StatusCreated)
@@ -118,12 +256,15 @@ func (pg productGroup) update(ctx context.Context, w http.ResponseWriter, r *htt
 	params := web.Params(r)
 	if err := pg.product.Update(ctx, v.TraceID, claims, params["id"], upd, v.Now); err != nil {
 		switch err {
-		case product.ErrInvalidID:
+		case product.ErrInvalidID, product.ErrUnknownCategory, product.ErrUnknownJurisdiction, product.ErrInvalidPricing,
+			product.ErrInvalidAvailability:
 			return web.NewRequestError(err, http.StatusBadRequest)
 		case product.ErrNotFound:
 			return web.NewRequestError(err, http.StatusNotFound)
 		case product.ErrForbidden:
 			return web.NewRequestError(err, http.StatusForbidden)
+		case product.ErrQuantityBelowSold:
+			return web.NewRequestError(err, http.StatusConflict)
 		default:
 			return errors.Wrapf(err, "ID: %s  User: %+v", params["id"], &upd)
 		}
@@ -141,11 +282,49 @@ func (pg productGroup) delete(ctx context.Context, w http.ResponseWriter, r *htt
 		return web.NewShutdownError("web value missing from context")
 	}
 
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	params := web.Params(r)
+	if err := pg.product.Delete(ctx, v.TraceID, claims, params["id"], v.Now); err != nil {
+		switch err {
+		case product.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case product.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "ID: %s", params["id"])
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+func (pg productGroup) restore(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.productGroup.restore")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
 	params := web.Params(r)
-	if err := pg.product.Delete(ctx, v.TraceID, params["id"]); err != nil {
+	if err := pg.product.Restore(ctx, v.TraceID, claims, params["id"], v.Now); err != nil {
 		switch err {
 		case product.ErrInvalidID:
 			return web.NewRequestError(err, http.StatusBadRequest)
+		case product.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case product.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
 		default:
 			return errors.Wrapf(err, "ID: %s", params["id"])
 		}
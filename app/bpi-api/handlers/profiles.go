@@ -115,7 +115,14 @@ func (pg profileGroup) create(ctx context.Context, w http.ResponseWriter, r *htt
 
 	prod, err := pg.profile.Create(ctx, v.TraceID, claims, np, v.Now)
 	if err != nil {
-		return errors.Wrapf(err, "creating new profile: %+v", np)
+		switch err {
+		case profile.ErrNameExists:
+			return web.NewRequestError(err, http.StatusConflict)
+		case profile.ErrUnknownJurisdiction, profile.ErrUnknownCategory:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrapf(err, "creating new profile: %+v", np)
+		}
 	}
 
 	return web.Respond(ctx, w, prod, http.StatusCreated)
@@ -149,6 +156,10 @@ func (pg profileGroup) update(ctx context.Context, w http.ResponseWriter, r *htt
 			return web.NewRequestError(err, http.StatusNotFound)
 		case profile.ErrForbidden:
 			return web.NewRequestError(err, http.StatusForbidden)
+		case profile.ErrNameExists:
+			return web.NewRequestError(err, http.StatusConflict)
+		case profile.ErrUnknownJurisdiction, profile.ErrUnknownCategory:
+			return web.NewRequestError(err, http.StatusBadRequest)
 		default:
 			return errors.Wrapf(err, "Name: %s  User: %+v", params["name"], &upd)
 		}
@@ -166,11 +177,49 @@ func (pg profileGroup) delete(ctx context.Context, w http.ResponseWriter, r *htt
 		return web.NewShutdownError("web value missing from context")
 	}
 
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	params := web.Params(r)
+	if err := pg.profile.Delete(ctx, v.TraceID, claims, params["name"], v.Now); err != nil {
+		switch err {
+		case profile.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case profile.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "Name: %s", params["name"])
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+func (pg profileGroup) restore(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.profileGroup.restore")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
 	params := web.Params(r)
-	if err := pg.profile.Delete(ctx, v.TraceID, params["name"]); err != nil {
+	if err := pg.profile.Restore(ctx, v.TraceID, claims, params["name"], v.Now); err != nil {
 		switch err {
 		case profile.ErrInvalidID:
 			return web.NewRequestError(err, http.StatusBadRequest)
+		case profile.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case profile.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
 		default:
 			return errors.Wrapf(err, "Name: %s", params["name"])
 		}
@@ -178,3 +227,176 @@ func (pg profileGroup) delete(ctx context.Context, w http.ResponseWriter, r *htt
 
 	return web.Respond(ctx, w, nil, http.StatusNoContent)
 }
+
+func (pg profileGroup) attachCategory(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.profileGroup.attachCategory")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	params := web.Params(r)
+	if err := pg.profile.AttachCategory(ctx, v.TraceID, claims, params["name"], params["id"], v.Now); err != nil {
+		switch err {
+		case profile.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case profile.ErrNotFound, profile.ErrUnknownCategory:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case profile.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "Name: %s  Category: %s", params["name"], params["id"])
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+func (pg profileGroup) detachCategory(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.profileGroup.detachCategory")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	params := web.Params(r)
+	if err := pg.profile.DetachCategory(ctx, v.TraceID, claims, params["name"], params["id"], v.Now); err != nil {
+		switch err {
+		case profile.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case profile.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case profile.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "Name: %s  Category: %s", params["name"], params["id"])
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+func (pg profileGroup) attachJurisdiction(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.profileGroup.attachJurisdiction")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	params := web.Params(r)
+	if err := pg.profile.AttachJurisdiction(ctx, v.TraceID, claims, params["name"], params["code"], v.Now); err != nil {
+		switch err {
+		case profile.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case profile.ErrNotFound, profile.ErrUnknownJurisdiction:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case profile.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "Name: %s  Jurisdiction: %s", params["name"], params["code"])
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+func (pg profileGroup) detachJurisdiction(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.profileGroup.detachJurisdiction")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	params := web.Params(r)
+	if err := pg.profile.DetachJurisdiction(ctx, v.TraceID, claims, params["name"], params["code"], v.Now); err != nil {
+		switch err {
+		case profile.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case profile.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case profile.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "Name: %s  Jurisdiction: %s", params["name"], params["code"])
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// directory returns a page of the profiles listed in the directory. Profiles
+// can be filtered with the type, category, jurisdiction and country query
+// parameters.
+func (pg profileGroup) directory(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.profileGroup.directory")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	params := web.Params(r)
+	pageNumber, err := strconv.Atoi(params["page"])
+	if err != nil {
+		return web.NewRequestError(fmt.Errorf("invalid page format: %s", params["page"]), http.StatusBadRequest)
+	}
+	rowsPerPage, err := strconv.Atoi(params["rows"])
+	if err != nil {
+		return web.NewRequestError(fmt.Errorf("invalid rows format: %s", params["rows"]), http.StatusBadRequest)
+	}
+
+	query := r.URL.Query()
+	filter := profile.Filter{
+		CategoryID:   query.Get("category"),
+		Jurisdiction: query.Get("jurisdiction"),
+		Country:      query.Get("country"),
+	}
+	if typ := query.Get("type"); typ != "" {
+		t, err := profile.TypeFromString(typ)
+		if err != nil {
+			return web.NewRequestError(err, http.StatusBadRequest)
+		}
+		filter.Type = *t
+	}
+
+	profiles, err := pg.profile.QueryDirectory(ctx, v.TraceID, filter, pageNumber, rowsPerPage)
+	if err != nil {
+		switch err {
+		case profile.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrap(err, "unable to query the directory")
+		}
+	}
+
+	return web.Respond(ctx, w, profiles, http.StatusOK)
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/quote"
+	"github.com/appinesshq/bpi/foundation/web"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+type quoteGroup struct {
+	quote quote.Quote
+}
+
+func (qg quoteGroup) create(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.quoteGroup.create")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return web.NewShutdownError("claims missing from context")
+	}
+
+	var nq quote.NewQuote
+	if err := web.Decode(r, &nq); err != nil {
+		return errors.Wrapf(err, "unable to decode payload")
+	}
+
+	qt, err := qg.quote.Create(ctx, v.TraceID, claims, nq, v.Now)
+	if err != nil {
+		switch err {
+		case quote.ErrInvalidID, quote.ErrUnknownProfile, quote.ErrUnknownProduct, quote.ErrNotBusiness, quote.ErrNotProvider,
+			quote.ErrProviderMismatch, quote.ErrOwnProvider:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case quote.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "creating new quote: %+v", nq)
+		}
+	}
+
+	return web.Respond(ctx, w, qt, http.StatusCreated)
+}
+
+func (qg quoteGroup) inbox(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.quoteGroup.inbox")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return web.NewShutdownError("claims missing from context")
+	}
+
+	params := web.Params(r)
+	pageNumber, err := strconv.Atoi(params["page"])
+	if err != nil {
+		return web.NewRequestError(fmt.Errorf("invalid page format: %s", params["page"]), http.StatusBadRequest)
+	}
+	rowsPerPage, err := strconv.Atoi(params["rows"])
+	if err != nil {
+		return web.NewRequestError(fmt.Errorf("invalid rows format: %s", params["rows"]), http.StatusBadRequest)
+	}
+
+	quotes, err := qg.quote.QueryInbox(ctx, v.TraceID, claims, params["name"], pageNumber, rowsPerPage)
+	if err != nil {
+		switch err {
+		case quote.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case quote.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "profile: %s", params["name"])
+		}
+	}
+
+	return web.Respond(ctx, w, quotes, http.StatusOK)
+}
+
+func (qg quoteGroup) queryByID(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.quoteGroup.queryByID")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	participant, ok := ctx.Value(auth.ParticipantKey).(string)
+	if !ok {
+		return web.NewShutdownError("participant missing from context")
+	}
+
+	params := web.Params(r)
+	qt, err := qg.quote.QueryByID(ctx, v.TraceID, params["id"], participant)
+	if err != nil {
+		switch err {
+		case quote.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case quote.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "ID: %s", params["id"])
+		}
+	}
+
+	return web.Respond(ctx, w, qt, http.StatusOK)
+}
+
+func (qg quoteGroup) queryMessages(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.quoteGroup.queryMessages")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	params := web.Params(r)
+	pageNumber, err := strconv.Atoi(params["page"])
+	if err != nil {
+		return web.NewRequestError(fmt.Errorf("invalid page format: %s", params["page"]), http.StatusBadRequest)
+	}
+	rowsPerPage, err := strconv.Atoi(params["rows"])
+	if err != nil {
+		return web.NewRequestError(fmt.Errorf("invalid rows format: %s", params["rows"]), http.StatusBadRequest)
+	}
+
+	messages, err := qg.quote.QueryMessages(ctx, v.TraceID, params["id"], pageNumber, rowsPerPage)
+	if err != nil {
+		switch err {
+		case quote.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrapf(err, "ID: %s", params["id"])
+		}
+	}
+
+	return web.Respond(ctx, w, messages, http.StatusOK)
+}
+
+func (qg quoteGroup) addMessage(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.quoteGroup.addMessage")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return web.NewShutdownError("claims missing from context")
+	}
+
+	participant, ok := ctx.Value(auth.ParticipantKey).(string)
+	if !ok {
+		return web.NewShutdownError("participant missing from context")
+	}
+
+	var nm quote.NewMessage
+	if err := web.Decode(r, &nm); err != nil {
+		return errors.Wrapf(err, "unable to decode payload")
+	}
+
+	params := web.Params(r)
+	m, err := qg.quote.AddMessage(ctx, v.TraceID, claims, params["id"], participant, nm, v.Now)
+	if err != nil {
+		switch err {
+		case quote.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case quote.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "ID: %s", params["id"])
+		}
+	}
+
+	return web.Respond(ctx, w, m, http.StatusCreated)
+}
+
+func (qg quoteGroup) markRead(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.quoteGroup.markRead")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	participant, ok := ctx.Value(auth.ParticipantKey).(string)
+	if !ok {
+		return web.NewShutdownError("participant missing from context")
+	}
+
+	params := web.Params(r)
+	if _, err := qg.quote.MarkRead(ctx, v.TraceID, params["id"], participant, v.Now); err != nil {
+		switch err {
+		case quote.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrapf(err, "ID: %s", params["id"])
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
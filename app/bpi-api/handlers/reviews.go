@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/review"
+	"github.com/appinesshq/bpi/foundation/web"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+type reviewGroup struct {
+	review review.Review
+}
+
+func (rg reviewGroup) create(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.reviewGroup.create")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return web.NewShutdownError("claims missing from context")
+	}
+
+	var nr review.NewReview
+	if err := web.Decode(r, &nr); err != nil {
+		return errors.Wrapf(err, "unable to decode payload")
+	}
+
+	rev, err := rg.review.Create(ctx, v.TraceID, claims, nr, v.Now)
+	if err != nil {
+		switch err {
+		case review.ErrUnknownProfile, review.ErrNotProvider, review.ErrOwnProvider:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case review.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
+		case review.ErrAlreadyReviewed:
+			return web.NewRequestError(err, http.StatusConflict)
+		default:
+			return errors.Wrapf(err, "creating new review: %+v", nr)
+		}
+	}
+
+	return web.Respond(ctx, w, rev, http.StatusCreated)
+}
+
+func (rg reviewGroup) update(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.reviewGroup.update")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return web.NewShutdownError("claims missing from context")
+	}
+
+	var upd review.UpdateReview
+	if err := web.Decode(r, &upd); err != nil {
+		return errors.Wrapf(err, "unable to decode payload")
+	}
+
+	params := web.Params(r)
+	if err := rg.review.Update(ctx, v.TraceID, claims, params["id"], upd, v.Now); err != nil {
+		switch err {
+		case review.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case review.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case review.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "ID: %s  Review: %+v", params["id"], &upd)
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+func (rg reviewGroup) respond(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.reviewGroup.respond")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return web.NewShutdownError("claims missing from context")
+	}
+
+	var resp review.Response
+	if err := web.Decode(r, &resp); err != nil {
+		return errors.Wrapf(err, "unable to decode payload")
+	}
+
+	params := web.Params(r)
+	if err := rg.review.Respond(ctx, v.TraceID, claims, params["id"], resp, v.Now); err != nil {
+		switch err {
+		case review.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case review.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case review.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "ID: %s", params["id"])
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+func (rg reviewGroup) moderate(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.reviewGroup.moderate")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return web.NewShutdownError("claims missing from context")
+	}
+
+	var m review.Moderation
+	if err := web.Decode(r, &m); err != nil {
+		return errors.Wrapf(err, "unable to decode payload")
+	}
+
+	params := web.Params(r)
+	if err := rg.review.Moderate(ctx, v.TraceID, claims, params["id"], m, v.Now); err != nil {
+		switch err {
+		case review.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case review.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case review.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "ID: %s", params["id"])
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+func (rg reviewGroup) queryByProvider(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.reviewGroup.queryByProvider")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	params := web.Params(r)
+	pageNumber, err := strconv.Atoi(params["page"])
+	if err != nil {
+		return web.NewRequestError(fmt.Errorf("invalid page format: %s", params["page"]), http.StatusBadRequest)
+	}
+	rowsPerPage, err := strconv.Atoi(params["rows"])
+	if err != nil {
+		return web.NewRequestError(fmt.Errorf("invalid rows format: %s", params["rows"]), http.StatusBadRequest)
+	}
+
+	reviews, err := rg.review.QueryByProvider(ctx, v.TraceID, params["name"], pageNumber, rowsPerPage)
+	if err != nil {
+		return errors.Wrapf(err, "profile: %s", params["name"])
+	}
+
+	return web.Respond(ctx, w, reviews, http.StatusOK)
+}
+
+func (rg reviewGroup) queue(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.reviewGroup.queue")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return web.NewShutdownError("claims missing from context")
+	}
+
+	params := web.Params(r)
+	pageNumber, err := strconv.Atoi(params["page"])
+	if err != nil {
+		return web.NewRequestError(fmt.Errorf("invalid page format: %s", params["page"]), http.StatusBadRequest)
+	}
+	rowsPerPage, err := strconv.Atoi(params["rows"])
+	if err != nil {
+		return web.NewRequestError(fmt.Errorf("invalid rows format: %s", params["rows"]), http.StatusBadRequest)
+	}
+
+	reviews, err := rg.review.QueryQueue(ctx, v.TraceID, claims, pageNumber, rowsPerPage)
+	if err != nil {
+		switch err {
+		case review.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrap(err, "unable to query for unmoderated reviews")
+		}
+	}
+
+	return web.Respond(ctx, w, reviews, http.StatusOK)
+}
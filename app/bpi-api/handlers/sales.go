@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/sale"
+	"github.com/appinesshq/bpi/foundation/web"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+type saleGroup struct {
+	sale sale.Sale
+}
+
+func (sg saleGroup) create(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.saleGroup.create")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return web.NewShutdownError("claims missing from context")
+	}
+
+	var ns sale.NewSale
+	if err := web.Decode(r, &ns); err != nil {
+		return errors.Wrapf(err, "unable to decode payload")
+	}
+
+	params := web.Params(r)
+	sl, err := sg.sale.Create(ctx, v.TraceID, claims, params["id"], ns, v.Now)
+	if err != nil {
+		switch err {
+		case sale.ErrInvalidID, sale.ErrInvalidQuantity:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case sale.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case sale.ErrInsufficientStock, sale.ErrUnavailable:
+			return web.NewRequestError(err, http.StatusConflict)
+		default:
+			return errors.Wrapf(err, "ID: %s  Sale: %+v", params["id"], &ns)
+		}
+	}
+
+	return web.Respond(ctx, w, sl, http.StatusCreated)
+}
+
+func (sg saleGroup) queryByProduct(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.saleGroup.queryByProduct")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return web.NewShutdownError("claims missing from context")
+	}
+
+	params := web.Params(r)
+	pageNumber, err := strconv.Atoi(params["page"])
+	if err != nil {
+		return web.NewRequestError(fmt.Errorf("invalid page format: %s", params["page"]), http.StatusBadRequest)
+	}
+	rowsPerPage, err := strconv.Atoi(params["rows"])
+	if err != nil {
+		return web.NewRequestError(fmt.Errorf("invalid rows format: %s", params["rows"]), http.StatusBadRequest)
+	}
+
+	sales, err := sg.sale.QueryByProduct(ctx, v.TraceID, claims, params["id"], pageNumber, rowsPerPage)
+	if err != nil {
+		switch err {
+		case sale.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case sale.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case sale.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "ID: %s", params["id"])
+		}
+	}
+
+	return web.Respond(ctx, w, sales, http.StatusOK)
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/appinesshq/bpi/business/data/search"
+	"github.com/appinesshq/bpi/foundation/web"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+type searchGroup struct {
+	search search.Search
+}
+
+// query returns a page of the profiles and categories matching the words in
+// the q query parameter, in the language of the lang parameter. Profiles can
+// be filtered with the type, country and jurisdiction query parameters.
+func (sg searchGroup) query(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.searchGroup.query")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	params := web.Params(r)
+	pageNumber, err := strconv.Atoi(params["page"])
+	if err != nil {
+		return web.NewRequestError(fmt.Errorf("invalid page format: %s", params["page"]), http.StatusBadRequest)
+	}
+	rowsPerPage, err := strconv.Atoi(params["rows"])
+	if err != nil {
+		return web.NewRequestError(fmt.Errorf("invalid rows format: %s", params["rows"]), http.StatusBadRequest)
+	}
+
+	query := r.URL.Query()
+	filter := search.Filter{
+		Text:         query.Get("q"),
+		Language:     query.Get("lang"),
+		Type:         query.Get("type"),
+		Country:      query.Get("country"),
+		Jurisdiction: query.Get("jurisdiction"),
+	}
+
+	results, err := sg.search.Query(ctx, v.TraceID, filter, pageNumber, rowsPerPage)
+	if err != nil {
+		switch err {
+		case search.ErrNoText:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrap(err, "unable to search")
+		}
+	}
+
+	return web.Respond(ctx, w, results, http.StatusOK)
+}
@@ -4,18 +4,45 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/session"
 	"github.com/appinesshq/bpi/business/data/user"
+	"github.com/appinesshq/bpi/foundation/mail"
+	"github.com/appinesshq/bpi/foundation/oidc"
 	"github.com/appinesshq/bpi/foundation/web"
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	"go.opentelemetry.io/otel/api/trace"
 )
 
 type userGroup struct {
-	user user.User
-	auth *auth.Auth
+	user      user.User
+	session   session.Session
+	auth      *auth.Auth
+	mailer    mail.Mailer
+	publicURL string
+	providers map[string]*oidc.Provider
+}
+
+// tokenResponse is the document returned when access tokens are issued.
+type tokenResponse struct {
+	Token            string `json:"token"`
+	ExpiresAt        int64  `json:"expires_at"`
+	RefreshToken     string `json:"refresh_token"`
+	RefreshExpiresAt int64  `json:"refresh_expires_at"`
+}
+
+// device identifies the device a session is started from. Clients can name
+// it explicitly, otherwise the user agent is used.
+func device(r *http.Request) string {
+	if d := r.URL.Query().Get("device"); d != "" {
+		return d
+	}
+	return r.UserAgent()
 }
 
 func (ug userGroup) query(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
@@ -86,19 +113,143 @@ func (ug userGroup) create(ctx context.Context, w http.ResponseWriter, r *http.R
 		return web.NewShutdownError("web value missing from context")
 	}
 
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
 	var nu user.NewUser
 	if err := web.Decode(r, &nu); err != nil {
 		return errors.Wrapf(err, "unable to decode payload")
 	}
 
-	usr, err := ug.user.Create(ctx, v.TraceID, nu, v.Now)
+	usr, err := ug.user.Create(ctx, v.TraceID, claims, nu, v.Now)
+	if err != nil {
+		switch err {
+		case user.ErrEmailExists:
+			return web.NewRequestError(err, http.StatusConflict)
+		default:
+			return errors.Wrapf(err, "User: %+v", &usr)
+		}
+	}
+
+	return web.Respond(ctx, w, usr, http.StatusCreated)
+}
+
+func (ug userGroup) signup(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.signup")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	var ns user.NewSignup
+	if err := web.Decode(r, &ns); err != nil {
+		return errors.Wrapf(err, "unable to decode payload")
+	}
+
+	usr, err := ug.user.Signup(ctx, v.TraceID, ns, v.Now)
 	if err != nil {
-		return errors.Wrapf(err, "User: %+v", &usr)
+		switch err {
+		case user.ErrEmailExists:
+			return web.NewRequestError(err, http.StatusConflict)
+		default:
+			return errors.Wrap(err, "signing up")
+		}
+	}
+
+	if err := ug.sendVerification(ctx, usr, ns.Email, v.Now); err != nil {
+		return err
 	}
 
 	return web.Respond(ctx, w, usr, http.StatusCreated)
 }
 
+func (ug userGroup) resendVerification(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.resendVerification")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	var rv user.ResendVerification
+	if err := web.Decode(r, &rv); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	usr, err := ug.user.QueryUnverified(ctx, v.TraceID, rv)
+	if err != nil {
+		switch err {
+		case user.ErrNotFound:
+
+			// Respond the same way as for an unverified address so the endpoint
+			// can't be used to find out which emails are in the system.
+			return web.Respond(ctx, w, nil, http.StatusAccepted)
+		default:
+			return errors.Wrap(err, "finding unverified user")
+		}
+	}
+
+	if err := ug.sendVerification(ctx, usr, rv.Email, v.Now); err != nil {
+		return err
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusAccepted)
+}
+
+// sendVerification mails the link for verifying the email address of a user.
+func (ug userGroup) sendVerification(ctx context.Context, usr user.Info, email string, now time.Time) error {
+	tkn, err := ug.auth.GenerateToken(ug.auth.ActiveKID(), user.VerificationClaims(usr, now))
+	if err != nil {
+		return errors.Wrap(err, "generating verification token")
+	}
+
+	link := fmt.Sprintf("%s/v1/users/verify?token=%s", ug.publicURL, url.QueryEscape(tkn))
+	msg := mail.Message{
+		To:      email,
+		Subject: "Please verify your email address",
+		Body:    fmt.Sprintf("Welcome!\n\nPlease verify your email address by opening the link below. The link expires in %v.\n\n%s\n", user.VerificationTTL, link),
+	}
+	if err := ug.mailer.Send(ctx, msg); err != nil {
+		return errors.Wrap(err, "sending verification mail")
+	}
+
+	return nil
+}
+
+func (ug userGroup) verify(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.verify")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, err := ug.auth.ValidateTokenFor(auth.AudienceVerifyEmail, r.URL.Query().Get("token"))
+	if err != nil {
+		err := errors.New("verification link is invalid or has expired")
+		return web.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	if err := ug.user.Verify(ctx, v.TraceID, claims.Subject, v.Now); err != nil {
+		switch err {
+		case user.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case user.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "ID: %s", claims.Subject)
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
 func (ug userGroup) update(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.update")
 	defer span.End()
@@ -126,6 +277,8 @@ func (ug userGroup) update(ctx context.Context, w http.ResponseWriter, r *http.R
 			return web.NewRequestError(err, http.StatusBadRequest)
 		case user.ErrNotFound:
 			return web.NewRequestError(err, http.StatusNotFound)
+		case user.ErrEmailExists:
+			return web.NewRequestError(err, http.StatusConflict)
 		case user.ErrForbidden:
 			return web.NewRequestError(err, http.StatusForbidden)
 		default:
@@ -145,8 +298,13 @@ func (ug userGroup) delete(ctx context.Context, w http.ResponseWriter, r *http.R
 		return web.NewShutdownError("web value missing from context")
 	}
 
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
 	params := web.Params(r)
-	err := ug.user.Delete(ctx, v.TraceID, params["id"])
+	err := ug.user.Delete(ctx, v.TraceID, claims, params["id"], v.Now)
 	if err != nil {
 		switch err {
 		case user.ErrInvalidID:
@@ -160,6 +318,252 @@ func (ug userGroup) delete(ctx context.Context, w http.ResponseWriter, r *http.R
 		}
 	}
 
+	// Deleted users can't sign in, their current sessions end as well.
+	if err := ug.session.RevokeAll(ctx, v.TraceID, params["id"], v.Now); err != nil {
+		return errors.Wrapf(err, "ID: %s", params["id"])
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+func (ug userGroup) restore(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.restore")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	params := web.Params(r)
+	if err := ug.user.Restore(ctx, v.TraceID, claims, params["id"], v.Now); err != nil {
+		switch err {
+		case user.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case user.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case user.ErrEmailExists:
+			return web.NewRequestError(err, http.StatusConflict)
+		case user.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "ID: %s", params["id"])
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+func (ug userGroup) forgotPassword(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.forgotPassword")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	var fp user.ForgotPassword
+	if err := web.Decode(r, &fp); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	tkn, err := ug.user.ForgotPassword(ctx, v.TraceID, fp, v.Now)
+	if err != nil {
+		switch err {
+		case user.ErrNotFound:
+
+			// Respond the same way as for a known address so the endpoint can't
+			// be used to find out which emails are in the system.
+			return web.Respond(ctx, w, nil, http.StatusAccepted)
+		default:
+			return errors.Wrap(err, "issuing reset token")
+		}
+	}
+
+	msg := mail.Message{
+		To:      fp.Email,
+		Subject: "Reset your password",
+		Body:    fmt.Sprintf("A password reset was requested for your account. Use the token below to choose a new password. The token expires in %v and can be used once.\n\n%s\n\nIf you did not request a password reset, you can ignore this email.\n", user.ResetTTL, tkn),
+	}
+	if err := ug.mailer.Send(ctx, msg); err != nil {
+		return errors.Wrap(err, "sending reset mail")
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusAccepted)
+}
+
+func (ug userGroup) resetPassword(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.resetPassword")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	var rp user.ResetPassword
+	if err := web.Decode(r, &rp); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	userID, err := ug.user.ResetPassword(ctx, v.TraceID, rp, v.Now)
+	if err != nil {
+		switch err {
+		case user.ErrInvalidResetToken:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrap(err, "resetting password")
+		}
+	}
+
+	// Whoever knew the old password must not stay logged in.
+	if err := ug.session.RevokeAll(ctx, v.TraceID, userID, v.Now); err != nil {
+		return errors.Wrapf(err, "revoking sessions of user %s", userID)
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+func (ug userGroup) enrollTwoFactor(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.enrollTwoFactor")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	e, err := ug.user.EnrollTwoFactor(ctx, v.TraceID, claims, v.Now)
+	if err != nil {
+		switch err {
+		case user.ErrAlreadyEnrolled:
+			return web.NewRequestError(err, http.StatusConflict)
+		default:
+			return errors.Wrap(err, "enrolling for two-factor authentication")
+		}
+	}
+
+	return web.Respond(ctx, w, e, http.StatusCreated)
+}
+
+func (ug userGroup) confirmTwoFactor(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.confirmTwoFactor")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var sf user.SecondFactor
+	if err := web.Decode(r, &sf); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	codes, err := ug.user.ConfirmTwoFactor(ctx, v.TraceID, claims, sf, v.Now)
+	if err != nil {
+		switch err {
+		case user.ErrInvalidCode:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case user.ErrNotEnrolled:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case user.ErrAlreadyEnrolled:
+			return web.NewRequestError(err, http.StatusConflict)
+		default:
+			return errors.Wrap(err, "confirming two-factor authentication")
+		}
+	}
+
+	resp := struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}{
+		RecoveryCodes: codes,
+	}
+
+	return web.Respond(ctx, w, resp, http.StatusOK)
+}
+
+func (ug userGroup) disableTwoFactor(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.disableTwoFactor")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var sf user.SecondFactor
+	if err := web.Decode(r, &sf); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	if err := ug.user.DisableTwoFactor(ctx, v.TraceID, claims, sf, v.Now); err != nil {
+		switch err {
+		case user.ErrSecondFactorSession:
+			return web.NewRequestError(err, http.StatusForbidden)
+		case user.ErrInvalidCode:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case user.ErrNotEnrolled:
+			return web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrap(err, "disabling two-factor authentication")
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+func (ug userGroup) requireTwoFactor(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.requireTwoFactor")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var rt user.RoleTwoFactor
+	if err := web.Decode(r, &rt); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	params := web.Params(r)
+	if err := ug.user.RequireTwoFactor(ctx, v.TraceID, claims, params["role"], rt, v.Now); err != nil {
+		switch err {
+		case user.ErrNotFound:
+			err := fmt.Errorf("unknown role: %s", params["role"])
+			return web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "Role: %s", params["role"])
+		}
+	}
+
 	return web.Respond(ctx, w, nil, http.StatusNoContent)
 }
 
@@ -178,27 +582,158 @@ func (ug userGroup) token(ctx context.Context, w http.ResponseWriter, r *http.Re
 		return web.NewRequestError(err, http.StatusUnauthorized)
 	}
 
-	claims, err := ug.user.Authenticate(ctx, v.TraceID, v.Now, email, pass)
+	// Users enrolled for two-factor authentication provide a code from their
+	// authenticator app or a recovery code in a header.
+	code := r.Header.Get("X-OTP")
+
+	claims, err := ug.user.Authenticate(ctx, v.TraceID, v.Now, email, pass, code)
 	if err != nil {
 		switch err {
-		case user.ErrAuthenticationFailure:
+		case user.ErrAuthenticationFailure, user.ErrSecondFactorRequired:
 			return web.NewRequestError(err, http.StatusUnauthorized)
+		case user.ErrNotVerified:
+			return web.NewRequestError(err, http.StatusForbidden)
 		default:
 			return errors.Wrap(err, "authenticating")
 		}
 	}
 
-	params := web.Params(r)
+	// Tokens are signed with the active key unless a key is asked for.
+	tkn, err := ug.startSession(ctx, v, r, claims, web.Params(r)["kid"])
+	if err != nil {
+		return err
+	}
+
+	return web.Respond(ctx, w, tkn, http.StatusOK)
+}
+
+// startSession issues an access token for the claims, signed with the key
+// identified by kid or the active key, and starts a session for refreshing it.
+func (ug userGroup) startSession(ctx context.Context, v *web.Values, r *http.Request, claims auth.Claims, kid string) (tokenResponse, error) {
 
-	var tkn struct {
-		Token     string `json:"token"`
-		ExpiresAt int64  `json:"expires_at"`
+	// Every access token gets an id so it can be revoked later on.
+	claims.Id = uuid.New().String()
+
+	if kid == "" {
+		kid = ug.auth.ActiveKID()
 	}
+
+	var err error
+	var tkn tokenResponse
 	tkn.ExpiresAt = claims.ExpiresAt
-	tkn.Token, err = ug.auth.GenerateToken(params["kid"], claims)
+	tkn.Token, err = ug.auth.GenerateToken(kid, claims)
+	if err != nil {
+		return tokenResponse{}, errors.Wrap(err, "generating token")
+	}
+
+	ns := session.NewSession{
+		UserID:   claims.Subject,
+		Device:   device(r),
+		AccessID: claims.Id,
+		AMR:      claims.AMR,
+	}
+
+	ses, refresh, err := ug.session.Create(ctx, v.TraceID, ns, v.Now)
+	if err != nil {
+		return tokenResponse{}, errors.Wrap(err, "starting session")
+	}
+	tkn.RefreshToken = refresh
+	tkn.RefreshExpiresAt = ses.DateExpires.Unix()
+
+	return tkn, nil
+}
+
+func (ug userGroup) refresh(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.refresh")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	var req struct {
+		RefreshToken string `json:"refresh_token" validate:"required"`
+		KID          string `json:"kid"`
+	}
+	if err := web.Decode(r, &req); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	// The access token is signed before the refresh token is rotated, so a
+	// failure along the way leaves the client with a refresh token it can
+	// still use.
+	ses, err := ug.session.QueryByToken(ctx, v.TraceID, req.RefreshToken, v.Now)
+	if err != nil {
+		switch err {
+		case session.ErrInvalidToken:
+			return web.NewRequestError(err, http.StatusUnauthorized)
+		default:
+			return errors.Wrap(err, "looking up refresh token")
+		}
+	}
+
+	claims, err := ug.user.Claims(ctx, v.TraceID, v.Now, ses.UserID, ses.AMR)
+	if err != nil {
+		switch err {
+		case user.ErrNotFound:
+			return web.NewRequestError(session.ErrInvalidToken, http.StatusUnauthorized)
+		default:
+			return errors.Wrap(err, "building claims")
+		}
+	}
+	claims.Id = uuid.New().String()
+
+	kid := req.KID
+	if kid == "" {
+		kid = ug.auth.ActiveKID()
+	}
+
+	var tkn tokenResponse
+	tkn.ExpiresAt = claims.ExpiresAt
+	tkn.Token, err = ug.auth.GenerateToken(kid, claims)
 	if err != nil {
 		return errors.Wrap(err, "generating token")
 	}
 
+	ses, refresh, err := ug.session.Rotate(ctx, v.TraceID, req.RefreshToken, claims.Id, v.Now)
+	if err != nil {
+		switch err {
+		case session.ErrInvalidToken:
+			return web.NewRequestError(err, http.StatusUnauthorized)
+		default:
+			return errors.Wrap(err, "rotating refresh token")
+		}
+	}
+	tkn.RefreshToken = refresh
+	tkn.RefreshExpiresAt = ses.DateExpires.Unix()
+
 	return web.Respond(ctx, w, tkn, http.StatusOK)
 }
+
+func (ug userGroup) logout(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.userGroup.logout")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	if err := ug.session.Revoke(ctx, v.TraceID, claims, v.Now); err != nil {
+		switch err {
+		case session.ErrNotFound:
+			err := errors.New("token can't be revoked")
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrap(err, "revoking token")
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
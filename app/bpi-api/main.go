@@ -2,23 +2,28 @@ package main
 
 import (
 	"context"
-	"crypto/rsa"
 	"expvar" // Register the expvar handlers
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
 	_ "net/http/pprof" // Register the pprof handlers
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/appinesshq/bpi/app/bpi-api/handlers"
 	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/lockout"
+	"github.com/appinesshq/bpi/business/data/permission"
 	"github.com/appinesshq/bpi/foundation/database"
+	"github.com/appinesshq/bpi/foundation/envelope"
+	"github.com/appinesshq/bpi/foundation/keystore"
+	"github.com/appinesshq/bpi/foundation/mail"
+	"github.com/appinesshq/bpi/foundation/oidc"
+	"github.com/appinesshq/bpi/foundation/passwd"
 	"github.com/ardanlabs/conf"
-	"github.com/dgrijalva/jwt-go"
 	"github.com/pkg/errors"
 	"go.opentelemetry.io/otel/api/global"
 	"go.opentelemetry.io/otel/exporters/trace/zipkin"
@@ -57,11 +62,24 @@ func run(log *log.Logger) error {
 			ReadTimeout     time.Duration `conf:"default:5s"`
 			WriteTimeout    time.Duration `conf:"default:5s"`
 			ShutdownTimeout time.Duration `conf:"default:5s"`
+			PublicURL       string        `conf:"default:http://localhost:5000"`
 		}
 		Auth struct {
-			KeyID          string `conf:"default:54bb2165-71e1-41a6-af3e-7da4a0e1e2c1"`
-			PrivateKeyFile string `conf:"default:/service/private.pem"`
-			Algorithm      string `conf:"default:RS256"`
+			KeysFolder string `conf:"default:/service/keys/"`
+			ActiveKID  string `conf:"default:54bb2165-71e1-41a6-af3e-7da4a0e1e2c1"`
+			Algorithm  string `conf:"default:RS256"`
+
+			// How often permissions granted in the database are reloaded, so
+			// changes made through other instances are picked up.
+			PolicyRefresh time.Duration `conf:"default:1m"`
+		}
+		Passwords struct {
+			Cost   int    `conf:"default:10"`
+			Pepper string `conf:"default:joireu98ytu98grHROIHGWJREOIJOIJroJ5Y09JRATHJOIHJj5y09aeoirjroiejjrtjhJROIJIJyjHJroisjh509e5e0jte0jhreoijtkjrtrej9yg,noprint"`
+		}
+		Emails struct {
+			ActiveKeyID string            `conf:"default:1"`
+			Keys        map[string]string `conf:"noprint"` // Pairs of id:base64 key, separated by ;
 		}
 		DB struct {
 			User       string `conf:"default:postgres"`
@@ -70,6 +88,33 @@ func run(log *log.Logger) error {
 			Name       string `conf:"default:postgres"`
 			DisableTLS bool   `conf:"default:true"`
 		}
+		Lockout struct {
+			Store     string        `conf:"default:postgres"` // Either memory or postgres.
+			Threshold int           `conf:"default:5"`
+			Delay     time.Duration `conf:"default:1s"`
+			MaxDelay  time.Duration `conf:"default:15m"`
+			Window    time.Duration `conf:"default:15m"`
+		}
+		Mail struct {
+			Host     string // Mails are logged instead of sent when empty.
+			Port     int    `conf:"default:587"`
+			User     string
+			Password string `conf:"noprint"`
+			From     string `conf:"default:no-reply@example.com"`
+		}
+		// Providers are enabled by setting their client id. The redirect URL
+		// to register is <public url>/v1/users/oidc/<provider>/callback.
+		OIDC struct {
+			GoogleClientID        string
+			GoogleClientSecret    string `conf:"noprint"`
+			MicrosoftTenant       string // Directory (tenant) id, required for Microsoft.
+			MicrosoftClientID     string
+			MicrosoftClientSecret string `conf:"noprint"`
+			GenericName           string `conf:"default:oidc"`
+			GenericIssuer         string
+			GenericClientID       string
+			GenericClientSecret   string `conf:"noprint"`
+		}
 		Zipkin struct {
 			ReporterURI string  `conf:"default:http://zipkin:9411/api/v2/spans"`
 			ServiceName string  `conf:"default:bpi-api"`
@@ -118,29 +163,37 @@ func run(log *log.Logger) error {
 
 	log.Println("main : Started : Initializing authentication support")
 
-	privatePEM, err := ioutil.ReadFile(cfg.Auth.PrivateKeyFile)
+	// Every <kid>.pem file in the keys folder is loaded. Tokens are signed
+	// with the active key, all other keys are used to verify tokens only. An
+	// active file in the keys folder overrides the configured active key.
+	ks, err := keystore.New(cfg.Auth.KeysFolder, cfg.Auth.ActiveKID)
 	if err != nil {
-		return errors.Wrap(err, "reading auth private key")
+		return errors.Wrap(err, "reading keys")
 	}
 
-	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(privatePEM)
-	if err != nil {
-		return errors.Wrap(err, "parsing auth private key")
-	}
+	// The permissions granted to roles are loaded once the database is
+	// available.
+	authz := auth.NewPolicy(nil)
 
-	lookup := func(kid string) (*rsa.PublicKey, error) {
-		switch kid {
-		case cfg.Auth.KeyID:
-			return &privateKey.PublicKey, nil
-		}
-		return nil, fmt.Errorf("no public key found for the specified kid: %s", kid)
-	}
-
-	auth, err := auth.New(cfg.Auth.Algorithm, lookup, auth.Keys{cfg.Auth.KeyID: privateKey})
+	auth, err := auth.New(cfg.Auth.Algorithm, ks.ActiveKID(), ks)
 	if err != nil {
 		return errors.Wrap(err, "constructing auth")
 	}
 
+	// Reload the keys on SIGHUP so keys can be added, retired and made active
+	// without restarting the service.
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			if err := ks.Reload(); err != nil {
+				log.Printf("main: Reloading keys : %v", err)
+				continue
+			}
+			log.Printf("main: Reloaded keys from %s, signing with %s", cfg.Auth.KeysFolder, ks.ActiveKID())
+		}
+	}()
+
 	// =========================================================================
 	// Start Database
 
@@ -161,6 +214,26 @@ func run(log *log.Logger) error {
 		db.Close()
 	}()
 
+	// =========================================================================
+	// Initialize authorization support
+
+	log.Println("main: Initializing authorization support")
+
+	permissions := permission.New(log, db)
+	if err := permissions.Load(context.Background(), "", authz); err != nil {
+		return errors.Wrap(err, "loading permissions")
+	}
+
+	go func() {
+		ticker := time.NewTicker(cfg.Auth.PolicyRefresh)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := permissions.Load(context.Background(), "", authz); err != nil {
+				log.Printf("main: Reloading permissions : %v", err)
+			}
+		}
+	}()
+
 	// =========================================================================
 	// Start Tracing Support
 
@@ -207,6 +280,112 @@ func run(log *log.Logger) error {
 		}
 	}()
 
+	// =========================================================================
+	// Initialize password hashing
+
+	// Changing the cost is safe, existing hashes are upgraded the next time
+	// their user logs in. Changing the pepper invalidates every password.
+	alg, err := passwd.NewBcrypt(cfg.Passwords.Cost)
+	if err != nil {
+		return errors.Wrap(err, "configuring password hashing")
+	}
+	passwords := passwd.New(cfg.Passwords.Pepper, alg)
+
+	// =========================================================================
+	// Initialize email encryption
+
+	// There is no default key, a key everybody knows wouldn't protect
+	// anything. Generate one with bpi-admin genemailkey.
+	if len(cfg.Emails.Keys) == 0 {
+		return errors.New("no email encryption keys configured, set BPI_EMAILS_KEYS")
+	}
+
+	// Addresses stay readable with any key in the keyring. After making a new
+	// key active, run bpi-admin rotateemailkey before removing the old one.
+	emails, err := envelope.Parse(cfg.Emails.ActiveKeyID, cfg.Emails.Keys)
+	if err != nil {
+		return errors.Wrap(err, "configuring email encryption")
+	}
+
+	// =========================================================================
+	// Initialize brute force protection
+
+	// Failed attempts kept in memory only protect a single instance. Use the
+	// postgres store when running more than one.
+	policy := lockout.Policy{
+		Threshold: cfg.Lockout.Threshold,
+		Delay:     cfg.Lockout.Delay,
+		MaxDelay:  cfg.Lockout.MaxDelay,
+		Window:    cfg.Lockout.Window,
+	}
+
+	var lockouts lockout.Store
+	switch cfg.Lockout.Store {
+	case "memory":
+		lockouts = lockout.NewMemory(policy)
+	case "postgres":
+		lockouts = lockout.NewPostgres(log, db, policy)
+	default:
+		return errors.Errorf("unknown lockout store %q", cfg.Lockout.Store)
+	}
+
+	// =========================================================================
+	// Initialize mail support
+
+	log.Println("main: Initializing mail support")
+
+	var mailer mail.Mailer = mail.NewLog(log)
+	if cfg.Mail.Host != "" {
+		mailer = mail.NewSMTP(mail.Config{
+			Host:     cfg.Mail.Host,
+			Port:     cfg.Mail.Port,
+			User:     cfg.Mail.User,
+			Password: cfg.Mail.Password,
+			From:     cfg.Mail.From,
+		})
+	}
+
+	// =========================================================================
+	// Initialize OpenID Connect support
+
+	log.Println("main: Initializing OpenID Connect support")
+
+	configs := map[string]oidc.Config{}
+	if cfg.OIDC.GoogleClientID != "" {
+		configs["google"] = oidc.Config{
+			Issuer:       "https://accounts.google.com",
+			ClientID:     cfg.OIDC.GoogleClientID,
+			ClientSecret: cfg.OIDC.GoogleClientSecret,
+		}
+	}
+	if cfg.OIDC.MicrosoftClientID != "" {
+		if cfg.OIDC.MicrosoftTenant == "" {
+			return errors.New("signing in with microsoft requires a tenant")
+		}
+		configs["microsoft"] = oidc.Config{
+			Issuer:       "https://login.microsoftonline.com/" + cfg.OIDC.MicrosoftTenant + "/v2.0",
+			ClientID:     cfg.OIDC.MicrosoftClientID,
+			ClientSecret: cfg.OIDC.MicrosoftClientSecret,
+		}
+	}
+	if cfg.OIDC.GenericClientID != "" {
+		configs[cfg.OIDC.GenericName] = oidc.Config{
+			Issuer:       cfg.OIDC.GenericIssuer,
+			ClientID:     cfg.OIDC.GenericClientID,
+			ClientSecret: cfg.OIDC.GenericClientSecret,
+		}
+	}
+
+	client := http.Client{
+		Timeout: 10 * time.Second,
+	}
+	providers := make(map[string]*oidc.Provider, len(configs))
+	for name, oc := range configs {
+		oc.RedirectURL = strings.TrimSuffix(cfg.Web.PublicURL, "/") + "/v1/users/oidc/" + name + "/callback"
+		providers[name] = oidc.New(oc, &client)
+		log.Printf("main: OpenID provider %q at %s", name, oc.Issuer)
+	}
+
 	// =========================================================================
 	// Start API Service
 
@@ -219,7 +398,7 @@ func run(log *log.Logger) error {
 
 	api := http.Server{
 		Addr:         cfg.Web.APIHost,
-		Handler:      handlers.API(build, shutdown, log, auth, db),
+		Handler:      handlers.API(build, shutdown, log, auth, authz, db, passwords, emails, lockouts, mailer, cfg.Web.PublicURL, providers),
 		ReadTimeout:  cfg.Web.ReadTimeout,
 		WriteTimeout: cfg.Web.WriteTimeout,
 	}
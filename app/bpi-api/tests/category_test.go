@@ -37,7 +37,7 @@ func TestCategorys(t *testing.T) {
 
 	shutdown := make(chan os.Signal, 1)
 	tests := CategoryTests{
-		app:       handlers.API("develop", shutdown, test.Log, test.Auth, test.DB),
+		app:       handlers.API("develop", shutdown, test.Log, test.Auth, test.Policy, test.DB, test.Passwords, test.Emails, test.Lockouts, test.Mailer, "http://localhost", nil),
 		userToken: test.Token(test.KID, "admin@example.com", "gophers"),
 	}
 
@@ -265,6 +265,7 @@ func (ct *CategoryTests) crudCategory(t *testing.T) {
 
 	ct.getCategory200(t, p.ID)
 	ct.putCategory204(t, p.ID)
+	ct.putTranslation204(t, p.ID)
 }
 
 // postCategory201 validates a category can be created with the endpoint.
@@ -419,3 +420,56 @@ func (ct *CategoryTests) putCategory204(t *testing.T, id string) {
 		}
 	}
 }
+
+// putTranslation204 validates a category name can be translated and is
+// returned in the language the client asks for.
+func (ct *CategoryTests) putTranslation204(t *testing.T, id string) {
+	body := `{"name": "Testen"}`
+	r := httptest.NewRequest(http.MethodPut, "/v1/categories/"+id+"/translations/nl", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+ct.userToken)
+	ct.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to name a category in another language.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen translating the category %s.", testID, id)
+		{
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 204 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 204 for the response.", tests.Success, testID)
+
+			tt := []struct {
+				target string
+				accept string
+				want   string
+			}{
+				{"/v1/categories/" + id, "", "Testing"},
+				{"/v1/categories/" + id, "nl-NL,nl;q=0.9,en;q=0.8", "Testen"},
+				{"/v1/categories/" + id + "?lang=nl", "de", "Testen"},
+				{"/v1/categories/" + id + "?lang=fr", "", "Testing"},
+			}
+			for _, tc := range tt {
+				r = httptest.NewRequest(http.MethodGet, tc.target, nil)
+				w = httptest.NewRecorder()
+
+				r.Header.Set("Authorization", "Bearer "+ct.userToken)
+				if tc.accept != "" {
+					r.Header.Set("Accept-Language", tc.accept)
+				}
+				ct.app.ServeHTTP(w, r)
+
+				var got category.Info
+				if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+				}
+				if got.Name != tc.want {
+					t.Fatalf("\t%s\tTest %d:\tShould get %q for %s with %q : got %q", tests.Failed, testID, tc.want, tc.target, tc.accept, got.Name)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the name in the language asked for.", tests.Success, testID)
+		}
+	}
+}
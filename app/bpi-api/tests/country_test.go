@@ -34,7 +34,7 @@ func TestCountries(t *testing.T) {
 
 	shutdown := make(chan os.Signal, 1)
 	tests := CountryTests{
-		app:       handlers.API("develop", shutdown, test.Log, test.Auth, test.DB),
+		app:       handlers.API("develop", shutdown, test.Log, test.Auth, test.Policy, test.DB, test.Passwords, test.Emails, test.Lockouts, test.Mailer, "http://localhost", nil),
 		userToken: test.Token(test.KID, "admin@example.com", "gophers"),
 	}
 
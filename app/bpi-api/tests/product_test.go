@@ -11,6 +11,8 @@ import (
 
 	"github.com/appinesshq/bpi/app/bpi-api/handlers"
 	"github.com/appinesshq/bpi/business/data/product"
+	"github.com/appinesshq/bpi/business/data/profile"
+	"github.com/appinesshq/bpi/business/data/sale"
 	"github.com/appinesshq/bpi/business/tests"
 	"github.com/appinesshq/bpi/foundation/web"
 	"github.com/google/go-cmp/cmp"
@@ -37,7 +39,7 @@ func TestProducts(t *testing.T) {
 
 	shutdown := make(chan os.Signal, 1)
 	tests := ProductTests{
-		app:       handlers.API("develop", shutdown, test.Log, test.Auth, test.DB),
+		app:       handlers.API("develop", shutdown, test.Log, test.Auth, test.Policy, test.DB, test.Passwords, test.Emails, test.Lockouts, test.Mailer, "http://localhost", nil),
 		userToken: test.Token(test.KID, "admin@example.com", "gophers"),
 	}
 
@@ -81,7 +83,9 @@ func (pt *ProductTests) postProduct400(t *testing.T) {
 				Error: "field validation error",
 				Fields: []web.FieldError{
 					{Field: "name", Error: "name is a required field"},
+					{Field: "profile", Error: "profile is a required field"},
 					{Field: "cost", Error: "cost is a required field"},
+					{Field: "currency", Error: "currency is a required field"},
 					{Field: "quantity", Error: "quantity must be 1 or greater"},
 				},
 			}
@@ -106,6 +110,7 @@ func (pt *ProductTests) postProduct401(t *testing.T) {
 	np := product.NewProduct{
 		Name:     "Comic Books",
 		Cost:     25,
+		Currency: "EUR",
 		Quantity: 60,
 	}
 
@@ -262,18 +267,51 @@ func (pt *ProductTests) putProduct404(t *testing.T) {
 
 // crudProduct performs a complete test of CRUD against the api.
 func (pt *ProductTests) crudProduct(t *testing.T) {
-	p := pt.postProduct201(t)
+	provider := pt.postProvider201(t)
+	p := pt.postProduct201(t, provider)
 	defer pt.deleteProduct204(t, p.ID)
 
 	pt.getProduct200(t, p.ID)
+	pt.getOfferings200(t, provider, p.ID)
+	pt.getProductCurrency(t, p.ID)
 	pt.putProduct204(t, p.ID)
+	pt.postSale201(t, p.ID)
+}
+
+// postProvider201 creates the service provider profile offering the product
+// under test. It returns the name of the profile.
+func (pt *ProductTests) postProvider201(t *testing.T) string {
+	np := profile.NewProfile{
+		Name:        "comics",
+		Type:        "SER",
+		DisplayName: "Comics Unlimited",
+	}
+
+	body, err := json.Marshal(&np)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/profiles", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+pt.userToken)
+	pt.app.ServeHTTP(w, r)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("\t%s\tShould be able to create the service provider : %v", tests.Failed, w.Code)
+	}
+
+	return np.Name
 }
 
 // postProduct201 validates a product can be created with the endpoint.
-func (pt *ProductTests) postProduct201(t *testing.T) product.Info {
+func (pt *ProductTests) postProduct201(t *testing.T, provider string) product.Info {
 	np := product.NewProduct{
 		Name:     "Comic Books",
+		Profile:  provider,
 		Cost:     25,
+		Currency: "EUR",
 		Quantity: 60,
 	}
 
@@ -309,7 +347,10 @@ func (pt *ProductTests) postProduct201(t *testing.T) product.Info {
 			// fields like ID and Dates so we copy p.
 			exp := got
 			exp.Name = "Comic Books"
+			exp.Profile = provider
+			exp.Pricing = product.FixedPrice
 			exp.Cost = 25
+			exp.Availability = product.Available
 			exp.Quantity = 60
 
 			if diff := cmp.Diff(got, exp); diff != "" {
@@ -322,6 +363,53 @@ func (pt *ProductTests) postProduct201(t *testing.T) product.Info {
 	return got
 }
 
+// getOfferings200 validates the product is listed with the offerings of its
+// provider and when browsing offerings across providers.
+func (pt *ProductTests) getOfferings200(t *testing.T, provider string, id string) {
+	t.Log("Given the need to find the offerings of service providers.")
+	{
+		for testID, url := range []string{
+			"/v1/profiles/" + provider + "/products/1/10",
+			"/v1/catalogue/1/10?pricing=fixed",
+		} {
+			t.Logf("\tTest %d:\tWhen listing %s.", testID, url)
+			{
+				r := httptest.NewRequest(http.MethodGet, url, nil)
+				w := httptest.NewRecorder()
+
+				r.Header.Set("Authorization", "Bearer "+pt.userToken)
+				pt.app.ServeHTTP(w, r)
+
+				if w.Code != http.StatusOK {
+					t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 200 for the response : %v", tests.Failed, testID, w.Code)
+				}
+				t.Logf("\t%s\tTest %d:\tShould receive a status code of 200 for the response.", tests.Success, testID)
+
+				var got []product.Info
+				if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+				}
+				if len(got) != 1 || got[0].ID != id || got[0].Profile != provider {
+					t.Fatalf("\t%s\tTest %d:\tShould list the offering of the provider : %+v", tests.Failed, testID, got)
+				}
+				t.Logf("\t%s\tTest %d:\tShould list the offering of the provider.", tests.Success, testID)
+			}
+		}
+
+		testID := 2
+		r := httptest.NewRequest(http.MethodGet, "/v1/catalogue/1/10?pricing=daily", nil)
+		w := httptest.NewRecorder()
+
+		r.Header.Set("Authorization", "Bearer "+pt.userToken)
+		pt.app.ServeHTTP(w, r)
+
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 400 for an unknown pricing : %v", tests.Failed, testID, w.Code)
+		}
+		t.Logf("\t%s\tTest %d:\tShould receive a status code of 400 for an unknown pricing.", tests.Success, testID)
+	}
+}
+
 // deleteProduct200 validates deleting a product that does exist.
 func (pt *ProductTests) deleteProduct204(t *testing.T, id string) {
 	r := httptest.NewRequest(http.MethodDelete, "/v1/products/"+id, nil)
@@ -382,6 +470,49 @@ func (pt *ProductTests) getProduct200(t *testing.T, id string) {
 	}
 }
 
+// getProductCurrency validates prices are only converted into currencies in
+// circulation with a known exchange rate.
+func (pt *ProductTests) getProductCurrency(t *testing.T, id string) {
+	t.Log("Given the need to get the prices of a product in another currency.")
+	{
+		for testID, tt := range []struct {
+			currency string
+			status   int
+		}{
+			{"eur", http.StatusOK},
+			{"XYZ", http.StatusBadRequest},
+			{"USD", http.StatusBadRequest},
+		} {
+			t.Logf("\tTest %d:\tWhen asking for the product %s in %s.", testID, id, tt.currency)
+			{
+				r := httptest.NewRequest(http.MethodGet, "/v1/products/"+id+"?currency="+tt.currency, nil)
+				w := httptest.NewRecorder()
+
+				r.Header.Set("Authorization", "Bearer "+pt.userToken)
+				pt.app.ServeHTTP(w, r)
+
+				if w.Code != tt.status {
+					t.Fatalf("\t%s\tTest %d:\tShould receive a status code of %d for the response : %v", tests.Failed, testID, tt.status, w.Code)
+				}
+				t.Logf("\t%s\tTest %d:\tShould receive a status code of %d for the response.", tests.Success, testID, tt.status)
+
+				if tt.status != http.StatusOK {
+					continue
+				}
+
+				var got product.Info
+				if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+				}
+				if got.Currency != "EUR" || got.Cost != 25 {
+					t.Fatalf("\t%s\tTest %d:\tShould keep the price in the currency of the product : %s %d", tests.Failed, testID, got.Currency, got.Cost)
+				}
+				t.Logf("\t%s\tTest %d:\tShould keep the price in the currency of the product.", tests.Success, testID)
+			}
+		}
+	}
+}
+
 // putProduct204 validates updating a product that does exist.
 func (pt *ProductTests) putProduct204(t *testing.T, id string) {
 	body := `{"name": "Graphic Novels", "cost": 100}`
@@ -424,3 +555,65 @@ func (pt *ProductTests) putProduct204(t *testing.T, id string) {
 		}
 	}
 }
+
+// postSale201 validates items of a product can be sold until there are none
+// left and the sales are listed for the product.
+func (pt *ProductTests) postSale201(t *testing.T, id string) {
+	body := `{"quantity": 58}`
+	r := httptest.NewRequest(http.MethodPost, "/v1/products/"+id+"/sales", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+pt.userToken)
+	pt.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to sell items of a product with the sales endpoint.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen selling items of the product %s.", testID, id)
+		{
+			if w.Code != http.StatusCreated {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 201 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 201 for the response.", tests.Success, testID)
+
+			var sl sale.Info
+			if err := json.NewDecoder(w.Body).Decode(&sl); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+			}
+			if sl.ProductID != id || sl.Quantity != 58 || sl.Paid != 5800 {
+				t.Fatalf("\t%s\tTest %d:\tShould pay the cost of the product for each item : %+v", tests.Failed, testID, sl)
+			}
+			t.Logf("\t%s\tTest %d:\tShould pay the cost of the product for each item.", tests.Success, testID)
+
+			r = httptest.NewRequest(http.MethodPost, "/v1/products/"+id+"/sales", strings.NewReader(`{"quantity": 3}`))
+			w = httptest.NewRecorder()
+
+			r.Header.Set("Authorization", "Bearer "+pt.userToken)
+			pt.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusConflict {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 409 selling more items than are left : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 409 selling more items than are left.", tests.Success, testID)
+
+			r = httptest.NewRequest(http.MethodGet, "/v1/products/"+id+"/sales/1/10", nil)
+			w = httptest.NewRecorder()
+
+			r.Header.Set("Authorization", "Bearer "+pt.userToken)
+			pt.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 200 listing the sales : %v", tests.Failed, testID, w.Code)
+			}
+
+			var sales []sale.Info
+			if err := json.NewDecoder(w.Body).Decode(&sales); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+			}
+			if len(sales) != 1 || sales[0].ID != sl.ID {
+				t.Fatalf("\t%s\tTest %d:\tShould list the sale of the product : %+v", tests.Failed, testID, sales)
+			}
+			t.Logf("\t%s\tTest %d:\tShould list the sale of the product.", tests.Success, testID)
+		}
+	}
+}
@@ -21,8 +21,9 @@ import (
 // passing dependencies for tests while still providing a convenient syntax
 // when subtests are registered.
 type ProfileTests struct {
-	app       http.Handler
-	userToken string
+	app        http.Handler
+	userToken  string
+	otherToken string
 }
 
 // TestProfiles runs a series of tests to exercise Profile behavior from the
@@ -37,8 +38,9 @@ func TestProfiles(t *testing.T) {
 
 	shutdown := make(chan os.Signal, 1)
 	tests := ProfileTests{
-		app:       handlers.API("develop", shutdown, test.Log, test.Auth, test.DB),
-		userToken: test.Token(test.KID, "admin@example.com", "gophers"),
+		app:        handlers.API("develop", shutdown, test.Log, test.Auth, test.Policy, test.DB, test.Passwords, test.Emails, test.Lockouts, test.Mailer, "http://localhost", nil),
+		userToken:  test.Token(test.KID, "admin@example.com", "gophers"),
+		otherToken: test.Token(test.KID, "user@example.com", "gophers"),
 	}
 
 	t.Run("postProfile400", tests.postProfile400)
@@ -237,6 +239,7 @@ func (pt *ProfileTests) crudProfile(t *testing.T) {
 	pt.getProfile200(t, p.Name)
 	pt.getProfileByUserID200(t, p.UserID)
 	pt.putProfile204(t, p.Name)
+	pt.deleteProfile403(t, p.Name)
 }
 
 // postProfile201 validates a profile can be created with the endpoint.
@@ -245,6 +248,9 @@ func (pt *ProfileTests) postProfile201(t *testing.T) profile.Info {
 		Name:        "test",
 		DisplayName: "Test profile",
 		Type:        "USR",
+		Bio:         "Testing all the things.",
+		Website:     "https://example.com",
+		Languages:   []string{"en", "nl", "en"},
 	}
 
 	body, err := json.Marshal(&np)
@@ -280,6 +286,9 @@ func (pt *ProfileTests) postProfile201(t *testing.T) profile.Info {
 			exp := got
 			exp.Name = "test"
 			exp.DisplayName = "Test profile"
+			exp.Bio = "Testing all the things."
+			exp.Website = "https://example.com"
+			exp.Languages = []string{"en", "nl"}
 
 			if diff := cmp.Diff(got, exp); diff != "" {
 				t.Fatalf("\t%s\tTest %d:\tShould get the expected result. Diff:\n%s", tests.Failed, testID, diff)
@@ -312,6 +321,27 @@ func (pt *ProfileTests) deleteProfile204(t *testing.T, name string) {
 	}
 }
 
+// deleteProfile403 validates a profile can't be deleted by another user.
+func (pt *ProfileTests) deleteProfile403(t *testing.T, name string) {
+	r := httptest.NewRequest(http.MethodDelete, "/v1/profiles/"+name, nil)
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+pt.otherToken)
+	pt.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to validate only owners and admins can delete a profile.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen deleting the profile %s of another user.", testID, name)
+		{
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 403 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 403 for the response.", tests.Success, testID)
+		}
+	}
+}
+
 // getProfile200 validates a profile request for an existing name.
 func (pt *ProfileTests) getProfile200(t *testing.T, name string) {
 	r := httptest.NewRequest(http.MethodGet, "/v1/profiles/"+name, nil)
@@ -0,0 +1,281 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/appinesshq/bpi/app/bpi-api/handlers"
+	"github.com/appinesshq/bpi/business/data/profile"
+	"github.com/appinesshq/bpi/business/data/quote"
+	"github.com/appinesshq/bpi/business/tests"
+)
+
+// QuoteTests holds methods for each quote subtest. This type allows passing
+// dependencies for tests while still providing a convenient syntax when
+// subtests are registered.
+type QuoteTests struct {
+	app        http.Handler
+	adminToken string
+	userToken  string
+}
+
+// TestQuotes runs a series of tests to exercise quote requests from the API
+// level. The user requests quotes on behalf of a business the admin provides
+// services to.
+func TestQuotes(t *testing.T) {
+	test := tests.NewIntegration(t)
+	t.Cleanup(test.Teardown)
+
+	shutdown := make(chan os.Signal, 1)
+	tests := QuoteTests{
+		app:        handlers.API("develop", shutdown, test.Log, test.Auth, test.Policy, test.DB, test.Passwords, test.Emails, test.Lockouts, test.Mailer, "http://localhost", nil),
+		adminToken: test.Token(test.KID, "admin@example.com", "gophers"),
+		userToken:  test.Token(test.KID, "user@example.com", "gophers"),
+	}
+
+	t.Run("postQuote400", tests.postQuote400)
+	t.Run("getQuote403", tests.getQuote403)
+	t.Run("crudQuote", tests.crudQuote)
+}
+
+// postQuote400 validates a quote can't be requested with the endpoint unless
+// a valid quote document is submitted.
+func (qt *QuoteTests) postQuote400(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/v1/quotes", strings.NewReader(`{}`))
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+qt.userToken)
+	qt.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to validate a new quote can't be requested with an invalid document.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using an incomplete quote value.", testID)
+		{
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 400 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 400 for the response.", tests.Success, testID)
+		}
+	}
+}
+
+// getQuote403 validates the thread of a quote request is not shown to users
+// who don't take part in it.
+func (qt *QuoteTests) getQuote403(t *testing.T) {
+	id := "a224a8d6-3f9e-4b11-9900-e81a25d80702"
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/quotes/"+id, nil)
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+qt.userToken)
+	qt.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to keep quote requests private to their participants.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using a quote the user doesn't take part in %s.", testID, id)
+		{
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 403 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 403 for the response.", tests.Success, testID)
+		}
+	}
+}
+
+// crudQuote performs a complete test of a quote request thread.
+func (qt *QuoteTests) crudQuote(t *testing.T) {
+	qt.postProfile201(t, qt.adminToken, profile.NewProfile{Name: "lawfirm", Type: "SER", DisplayName: "Law Firm"})
+	qt.postProfile201(t, qt.userToken, profile.NewProfile{Name: "startup", Type: "BUS", DisplayName: "Startup"})
+
+	q := qt.postQuote201(t, "startup", "lawfirm")
+	qt.postMessage201(t, q.ID)
+	qt.putRead204(t, q.ID)
+}
+
+// postProfile201 creates a profile taking part in the quote requests.
+func (qt *QuoteTests) postProfile201(t *testing.T, token string, np profile.NewProfile) {
+	body, err := json.Marshal(&np)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/profiles", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+token)
+	qt.app.ServeHTTP(w, r)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("\t%s\tShould be able to create profile %q : %v", tests.Failed, np.Name, w.Code)
+	}
+}
+
+// postQuote201 validates a business can request a quote from a service
+// provider and the request shows up in the inbox of the provider.
+func (qt *QuoteTests) postQuote201(t *testing.T, business string, provider string) quote.Info {
+	nq := quote.NewQuote{
+		Business: business,
+		Provider: provider,
+		Subject:  "Incorporation",
+		Message: quote.NewMessage{
+			Body: "Could you help us incorporate?",
+			Attachments: []quote.NewAttachment{
+				{FileName: "plan.pdf", ContentType: "application/pdf", Size: 2048, URL: "https://files.example.com/plan.pdf"},
+			},
+		},
+	}
+
+	body, err := json.Marshal(&nq)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/quotes", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+qt.userToken)
+	qt.app.ServeHTTP(w, r)
+
+	var got quote.Info
+
+	t.Log("Given the need to request a quote with the quotes endpoint.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using the declared quote value.", testID)
+		{
+			if w.Code != http.StatusCreated {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 201 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 201 for the response.", tests.Success, testID)
+
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+			}
+			if got.Business != business || got.Provider != provider || got.Messages != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould get the expected result : %+v", tests.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the expected result.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen checking the inbox of the provider.", testID)
+		{
+			r := httptest.NewRequest(http.MethodGet, "/v1/profiles/"+provider+"/quotes/1/10", nil)
+			w := httptest.NewRecorder()
+
+			r.Header.Set("Authorization", "Bearer "+qt.adminToken)
+			qt.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 200 for the response : %v", tests.Failed, testID, w.Code)
+			}
+
+			var inbox []quote.Info
+			if err := json.NewDecoder(w.Body).Decode(&inbox); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+			}
+			if len(inbox) != 1 || inbox[0].ID != got.ID || inbox[0].Unread != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould find the unread quote request : %+v", tests.Failed, testID, inbox)
+			}
+			t.Logf("\t%s\tTest %d:\tShould find the unread quote request.", tests.Success, testID)
+
+			r = httptest.NewRequest(http.MethodGet, "/v1/profiles/"+provider+"/quotes/1/10", nil)
+			w = httptest.NewRecorder()
+
+			r.Header.Set("Authorization", "Bearer "+qt.userToken)
+			qt.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT let others see the inbox : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT let others see the inbox.", tests.Success, testID)
+		}
+	}
+
+	return got
+}
+
+// postMessage201 validates the provider can reply in the thread and both
+// messages are listed, the most recent first.
+func (qt *QuoteTests) postMessage201(t *testing.T, id string) {
+	body, err := json.Marshal(quote.NewMessage{Body: "Sure, that would be 500 euro."})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/quotes/"+id+"/messages", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+qt.adminToken)
+	qt.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to reply to a quote request.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen replying to quote %s.", testID, id)
+		{
+			if w.Code != http.StatusCreated {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 201 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 201 for the response.", tests.Success, testID)
+
+			r := httptest.NewRequest(http.MethodGet, "/v1/quotes/"+id+"/messages/1/10", nil)
+			w := httptest.NewRecorder()
+
+			r.Header.Set("Authorization", "Bearer "+qt.userToken)
+			qt.app.ServeHTTP(w, r)
+
+			var messages []quote.Message
+			if err := json.NewDecoder(w.Body).Decode(&messages); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+			}
+			if len(messages) != 2 || messages[0].Sender != "lawfirm" || len(messages[1].Attachments) != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould list the reply before the request : %+v", tests.Failed, testID, messages)
+			}
+			t.Logf("\t%s\tTest %d:\tShould list the reply before the request.", tests.Success, testID)
+		}
+	}
+}
+
+// putRead204 validates the business can mark the reply read.
+func (qt *QuoteTests) putRead204(t *testing.T, id string) {
+	r := httptest.NewRequest(http.MethodPut, "/v1/quotes/"+id+"/read", nil)
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+qt.userToken)
+	qt.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to mark the messages in a thread read.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen reading quote %s.", testID, id)
+		{
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 204 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 204 for the response.", tests.Success, testID)
+
+			r := httptest.NewRequest(http.MethodGet, "/v1/quotes/"+id, nil)
+			w := httptest.NewRecorder()
+
+			r.Header.Set("Authorization", "Bearer "+qt.userToken)
+			qt.app.ServeHTTP(w, r)
+
+			var got quote.Info
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+			}
+			if got.Messages != 2 || got.Unread != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould have no unread messages left : %+v", tests.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould have no unread messages left.", tests.Success, testID)
+		}
+	}
+}
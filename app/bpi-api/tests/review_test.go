@@ -0,0 +1,291 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/appinesshq/bpi/app/bpi-api/handlers"
+	"github.com/appinesshq/bpi/business/data/profile"
+	"github.com/appinesshq/bpi/business/data/review"
+	"github.com/appinesshq/bpi/business/tests"
+)
+
+// ReviewTests holds methods for each review subtest. This type allows passing
+// dependencies for tests while still providing a convenient syntax when
+// subtests are registered.
+type ReviewTests struct {
+	app        http.Handler
+	adminToken string
+	userToken  string
+}
+
+// TestReviews runs a series of tests to exercise reviews from the API level.
+// The user reviews a service provider of the admin, who moderates reviews.
+func TestReviews(t *testing.T) {
+	test := tests.NewIntegration(t)
+	t.Cleanup(test.Teardown)
+
+	shutdown := make(chan os.Signal, 1)
+	tests := ReviewTests{
+		app:        handlers.API("develop", shutdown, test.Log, test.Auth, test.Policy, test.DB, test.Passwords, test.Emails, test.Lockouts, test.Mailer, "http://localhost", nil),
+		adminToken: test.Token(test.KID, "admin@example.com", "gophers"),
+		userToken:  test.Token(test.KID, "user@example.com", "gophers"),
+	}
+
+	t.Run("postReview400", tests.postReview400)
+	t.Run("getQueue403", tests.getQueue403)
+	t.Run("crudReview", tests.crudReview)
+}
+
+// postReview400 validates a review can't be written with the endpoint unless
+// a valid review document is submitted.
+func (rt *ReviewTests) postReview400(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/v1/reviews", strings.NewReader(`{"rating":6}`))
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+rt.userToken)
+	rt.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to validate a new review can't be written with an invalid document.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using an incomplete review value.", testID)
+		{
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 400 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 400 for the response.", tests.Success, testID)
+		}
+	}
+}
+
+// getQueue403 validates the moderation queue is only shown to moderators.
+func (rt *ReviewTests) getQueue403(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/v1/moderation/reviews/1/10", nil)
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+rt.userToken)
+	rt.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to keep the moderation queue to moderators.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using the token of a regular user.", testID)
+		{
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 403 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 403 for the response.", tests.Success, testID)
+		}
+	}
+}
+
+// crudReview performs a complete test of reviewing, responding and
+// moderating.
+func (rt *ReviewTests) crudReview(t *testing.T) {
+	rt.postProfile201(t, rt.adminToken, profile.NewProfile{Name: "consultancy", Type: "SER", DisplayName: "Consultancy"})
+	rt.postProfile201(t, rt.userToken, profile.NewProfile{Name: "client", Type: "BUS", DisplayName: "Client"})
+
+	rev := rt.postReview201(t, "consultancy", "client")
+	rt.postReviewTwice(t, "consultancy", "client")
+	rt.putResponse204(t, rev.ID)
+	rt.putModeration204(t, "consultancy", rev.ID)
+}
+
+// postProfile201 creates a profile taking part in the reviews.
+func (rt *ReviewTests) postProfile201(t *testing.T, token string, np profile.NewProfile) {
+	body, err := json.Marshal(&np)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/profiles", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+token)
+	rt.app.ServeHTTP(w, r)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("\t%s\tShould be able to create profile %q : %v", tests.Failed, np.Name, w.Code)
+	}
+}
+
+// postReview201 validates a provider can be reviewed with the endpoint, but
+// not by its owner.
+func (rt *ReviewTests) postReview201(t *testing.T, provider string, reviewer string) review.Info {
+	var got review.Info
+
+	t.Log("Given the need to review a provider with the reviews endpoint.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen reviewing a provider of another user.", testID)
+		{
+			body, err := json.Marshal(review.NewReview{Provider: provider, Reviewer: reviewer, Rating: 4, Body: "Helpful and quick."})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/reviews", bytes.NewBuffer(body))
+			w := httptest.NewRecorder()
+
+			r.Header.Set("Authorization", "Bearer "+rt.userToken)
+			rt.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusCreated {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 201 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 201 for the response.", tests.Success, testID)
+
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+			}
+			if got.Provider != provider || got.Reviewer != reviewer || got.Rating != 4 {
+				t.Fatalf("\t%s\tTest %d:\tShould get the expected result : %+v", tests.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the expected result.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen reviewing an own provider.", testID)
+		{
+			body, err := json.Marshal(review.NewReview{Provider: provider, Reviewer: provider, Rating: 5, Body: "The very best."})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/reviews", bytes.NewBuffer(body))
+			w := httptest.NewRecorder()
+
+			r.Header.Set("Authorization", "Bearer "+rt.adminToken)
+			rt.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 400 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 400 for the response.", tests.Success, testID)
+		}
+	}
+
+	return got
+}
+
+// postReviewTwice validates a user reviews a provider only once.
+func (rt *ReviewTests) postReviewTwice(t *testing.T, provider string, reviewer string) {
+	body, err := json.Marshal(review.NewReview{Provider: provider, Reviewer: reviewer, Rating: 1, Body: "Changed my mind."})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/reviews", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+rt.userToken)
+	rt.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to review a provider once per user.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen reviewing %s as %s again.", testID, provider, reviewer)
+		{
+			if w.Code != http.StatusConflict {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 409 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 409 for the response.", tests.Success, testID)
+		}
+	}
+}
+
+// putResponse204 validates the owner of the provider can respond to a review
+// and the reviewer can't.
+func (rt *ReviewTests) putResponse204(t *testing.T, id string) {
+	body, err := json.Marshal(review.Response{Body: "Thank you!"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Log("Given the need to respond to reviews.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen responding to review %s.", testID, id)
+		{
+			r := httptest.NewRequest(http.MethodPut, "/v1/reviews/"+id+"/response", bytes.NewBuffer(body))
+			w := httptest.NewRecorder()
+
+			r.Header.Set("Authorization", "Bearer "+rt.userToken)
+			rt.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT let the reviewer respond : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT let the reviewer respond.", tests.Success, testID)
+
+			r = httptest.NewRequest(http.MethodPut, "/v1/reviews/"+id+"/response", bytes.NewBuffer(body))
+			w = httptest.NewRecorder()
+
+			r.Header.Set("Authorization", "Bearer "+rt.adminToken)
+			rt.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 204 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 204 for the response.", tests.Success, testID)
+		}
+	}
+}
+
+// putModeration204 validates a moderator can hide a queued review and the
+// hidden review no longer counts for the provider.
+func (rt *ReviewTests) putModeration204(t *testing.T, provider string, id string) {
+	t.Log("Given the need to hide abusive reviews.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen hiding review %s.", testID, id)
+		{
+			r := httptest.NewRequest(http.MethodGet, "/v1/moderation/reviews/1/10", nil)
+			w := httptest.NewRecorder()
+
+			r.Header.Set("Authorization", "Bearer "+rt.adminToken)
+			rt.app.ServeHTTP(w, r)
+
+			var queue []review.Info
+			if err := json.NewDecoder(w.Body).Decode(&queue); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+			}
+			if len(queue) != 1 || queue[0].ID != id {
+				t.Fatalf("\t%s\tTest %d:\tShould find the review in the moderation queue : %+v", tests.Failed, testID, queue)
+			}
+			t.Logf("\t%s\tTest %d:\tShould find the review in the moderation queue.", tests.Success, testID)
+
+			r = httptest.NewRequest(http.MethodPut, "/v1/reviews/"+id+"/moderation", strings.NewReader(`{"hidden":true}`))
+			w = httptest.NewRecorder()
+
+			r.Header.Set("Authorization", "Bearer "+rt.adminToken)
+			rt.app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 204 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 204 for the response.", tests.Success, testID)
+
+			r = httptest.NewRequest(http.MethodGet, "/v1/profiles/"+provider, nil)
+			w = httptest.NewRecorder()
+
+			r.Header.Set("Authorization", "Bearer "+rt.userToken)
+			rt.app.ServeHTTP(w, r)
+
+			var got profile.Info
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+			}
+			if got.Reviews != 0 || got.Rating != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould leave the hidden review out of the score : %d reviews, %v", tests.Failed, testID, got.Reviews, got.Rating)
+			}
+			t.Logf("\t%s\tTest %d:\tShould leave the hidden review out of the score.", tests.Success, testID)
+		}
+	}
+}
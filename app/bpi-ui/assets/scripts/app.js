@@ -6,5 +6,4 @@ const App = {
     },
 }
 
-const app = Vue.createApp(App);
-app.mount("#app");
\ No newline at end of file
+const app = Vue.createApp(App);
\ No newline at end of file
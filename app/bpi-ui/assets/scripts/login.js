@@ -1,39 +1,43 @@
 app.component('bpi-login', {
     template: `<template>
-        <form @submit.prevent="submitForm">
+        <form method="post" action="/login" @submit="submitForm">
+            <input type="hidden" name="csrf_token" :value="csrf">
+            <input type="hidden" name="next" :value="next">
             <div class="form-control">
                 <label for="email">Email</label>
-                <input type="email" id="email" v-model.trim="email"></input>
+                <input type="email" id="email" name="email" v-model.trim="email"></input>
             </div>
             <div class="form-control">
                 <label for="password">Password</label>
-                <input type="password" id="password" v-model.trim="password"></input>
+                <input type="password" id="password" name="password" v-model="password"></input>
             </div>
+            <div class="form-control">
+                <label for="otp">Authentication code (if enabled)</label>
+                <input type="text" id="otp" name="otp" autocomplete="one-time-code" v-model.trim="otp"></input>
+            </div>
+            <p v-if="!formIsValid">Please enter your email address and password.</p>
             <button>Login</button>
         </form>
     </template>`,
     style: {},
     data() {
         return {
+            csrf: csrf_token,
+            next: next_path,
             email: '',
             password: '',
+            otp: '',
             formIsValid: true,
         };
     },
     methods: {
-        submitForm() {
-            axios.get('http://' + api_host + '/v1/users/token/54bb2165-71e1-41a6-af3e-7da4a0e1e2c1', {
-                auth: {
-                    username: 'admin@example.com',
-                    password: 'gophers'
-                }
-            })
-            .then(res => {
-                console.log(res);
-            })
-            .catch(err => {
-                console.log(err);
-            });
+        submitForm(event) {
+            // The form is posted to the ui, which signs in with the api and
+            // keeps the token in a cookie scripts can't read.
+            this.formIsValid = this.email !== '' && this.password !== '';
+            if (!this.formIsValid) {
+                event.preventDefault();
+            }
         }
     }
 });
@@ -1,13 +1,70 @@
-<template>
-    <form>
-    <div class="form-control">
-        <label for="email">Email</label>
-        <input type="email" id="email"></input>
-    </div>
-    <div class="form-control">
-        <label for="password">Password</label>
-        <input type="password" id="password"></input>
-        <base-button>Login</base-button>
-    </div>
-    </form>
-</template>
\ No newline at end of file
+app.component('bpi-signup', {
+    template: `<template>
+        <form @submit.prevent="submitForm">
+            <div class="form-control">
+                <label for="email">Email</label>
+                <input type="email" id="email" v-model.trim="email"></input>
+            </div>
+            <div class="form-control">
+                <label for="password">Password</label>
+                <input type="password" id="password" v-model.trim="password"></input>
+            </div>
+            <div class="form-control">
+                <label for="password_confirm">Confirm password</label>
+                <input type="password" id="password_confirm" v-model.trim="passwordConfirm"></input>
+            </div>
+            <p v-if="!formIsValid">Please enter a valid email address and matching passwords of at least 8 characters.</p>
+            <p v-if="submitted">Please check your email to verify your address.</p>
+            <p v-if="failed">Signing up failed. Please try again later.</p>
+            <button>Sign up</button>
+            <button type="button" v-if="submitted || failed" @click="resend">Send the verification email again</button>
+        </form>
+    </template>`,
+    style: {},
+    data() {
+        return {
+            email: '',
+            password: '',
+            passwordConfirm: '',
+            formIsValid: true,
+            submitted: false,
+            failed: false,
+        };
+    },
+    methods: {
+        submitForm() {
+            this.formIsValid = this.email !== '' && this.password.length >= 8 && this.password === this.passwordConfirm;
+            if (!this.formIsValid) {
+                return;
+            }
+
+            axios.post('http://' + api_host + '/v1/users/signup', {
+                email: this.email,
+                password: this.password,
+                password_confirm: this.passwordConfirm
+            })
+            .then(res => {
+                this.submitted = true;
+                this.failed = false;
+            })
+            .catch(err => {
+                this.failed = true;
+                console.log(err);
+            });
+        },
+        resend() {
+            // The api responds the same way whether or not the address is
+            // known, so there is nothing to report besides the request itself.
+            axios.post('http://' + api_host + '/v1/users/verify/resend', {
+                email: this.email
+            })
+            .then(res => {
+                this.submitted = true;
+                this.failed = false;
+            })
+            .catch(err => {
+                console.log(err);
+            });
+        }
+    }
+});
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// apiError is returned when the api responds with an error status.
+type apiError struct {
+	Status  int
+	Message string
+}
+
+// Error implements the error interface.
+func (ae *apiError) Error() string {
+	return fmt.Sprintf("api: %d %s", ae.Status, ae.Message)
+}
+
+// rejected reports whether the api refused the request because of what the
+// visitor provided, rather than failing itself.
+func rejected(err error) (*apiError, bool) {
+	ae, ok := errors.Cause(err).(*apiError)
+	if !ok || ae.Status >= http.StatusInternalServerError {
+		return nil, false
+	}
+	return ae, true
+}
+
+// tokenResponse is the document returned by the api when tokens are issued.
+type tokenResponse struct {
+	Token            string `json:"token"`
+	ExpiresAt        int64  `json:"expires_at"`
+	RefreshToken     string `json:"refresh_token"`
+	RefreshExpiresAt int64  `json:"refresh_expires_at"`
+}
+
+// apiClient calls the api on behalf of visitors. Tokens never reach the
+// browser, they are only used by the ui.
+type apiClient struct {
+	url    string
+	client *http.Client
+}
+
+// token signs in with the email and password of a visitor and, for users
+// enrolled for two-factor authentication, a one-time code.
+func (ac apiClient) token(ctx context.Context, email string, password string, otp string) (tokenResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ac.url+"/v1/users/token", nil)
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	req.SetBasicAuth(email, password)
+	if otp != "" {
+		req.Header.Set("X-OTP", otp)
+	}
+
+	var tkn tokenResponse
+	if err := ac.do(req, &tkn); err != nil {
+		return tokenResponse{}, err
+	}
+	return tkn, nil
+}
+
+// refresh exchanges a refresh token for new tokens.
+func (ac apiClient) refresh(ctx context.Context, refreshToken string) (tokenResponse, error) {
+	body, err := json.Marshal(map[string]string{"refresh_token": refreshToken})
+	if err != nil {
+		return tokenResponse{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ac.url+"/v1/users/token/refresh", bytes.NewReader(body))
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var tkn tokenResponse
+	if err := ac.do(req, &tkn); err != nil {
+		return tokenResponse{}, err
+	}
+	return tkn, nil
+}
+
+// logout revokes the session the token belongs to.
+func (ac apiClient) logout(ctx context.Context, token string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ac.url+"/v1/users/logout", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return ac.do(req, nil)
+}
+
+// do sends the request and decodes the response into v. Error statuses are
+// returned as an *apiError.
+func (ac apiClient) do(req *http.Request, v interface{}) error {
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := ac.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "calling api")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		var er struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&er)
+		if er.Error == "" {
+			er.Error = http.StatusText(resp.StatusCode)
+		}
+		return &apiError{Status: resp.StatusCode, Message: er.Error}
+	}
+
+	if v == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return errors.Wrap(err, "decoding api response")
+	}
+	return nil
+}
@@ -7,28 +7,33 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/appinesshq/bpi/business/mid"
+	"github.com/appinesshq/bpi/foundation/cookie"
 	"github.com/appinesshq/bpi/foundation/web"
 	"github.com/pkg/errors"
 )
 
-// Auth holds authentication details
-type Auth struct {
-	Token   string
-	Expires time.Time
-}
-
-// API constructs an http.Handler with all application routes defined.
-func API(build string, index string, apiHost string, shutdown chan os.Signal, log *log.Logger) (http.Handler, error) {
+// API constructs an http.Handler with all application routes defined. The
+// sessions of visitors are stored in cookies encrypted by the codec, tokens
+// are requested from the api at apiURL.
+func API(build string, index string, apiHost string, apiURL string, codec *cookie.Codec, secureCookies bool, shutdown chan os.Signal, log *log.Logger) (http.Handler, error) {
 
 	// Construct the web.App which holds all routes as well as common Middleware.
 	app := web.NewApp(shutdown, mid.Logger(log), mid.Errors(log), mid.Metrics(), mid.Panics(log))
 
-	auth := Auth{}
+	ses := sessions{
+		codec:  codec,
+		secure: secureCookies,
+		api: apiClient{
+			url:    strings.TrimSuffix(apiURL, "/"),
+			client: &http.Client{Timeout: 10 * time.Second},
+		},
+	}
 
-	root, err := newIndex("assets/views/"+index, apiHost, &auth)
+	root, err := newIndex("assets/views/"+index, apiHost, ses)
 	if err != nil {
 		return nil, errors.Wrap(err, "setup root")
 	}
@@ -50,11 +55,18 @@ func API(build string, index string, apiHost string, shutdown chan os.Signal, lo
 	app.HandleDebug(http.MethodGet, "/readiness", cg.readiness)
 	app.HandleDebug(http.MethodGet, "/liveness", cg.liveness)
 
-	admin, err := newIndex("assets/views/admin.tmpl", apiHost, &auth)
+	admin, err := newIndex("assets/views/admin.tmpl", apiHost, ses)
 	if err != nil {
 		return nil, errors.Wrap(err, "setup admin")
 	}
 	app.Handle(http.MethodGet, "/admin", admin.handler)
 
+	// Register the sign in and sign out forms.
+	lg := loginGroup{
+		sessions: ses,
+	}
+	app.Handle(http.MethodPost, "/login", lg.login)
+	app.Handle(http.MethodPost, "/logout", lg.logout)
+
 	return app, nil
 }
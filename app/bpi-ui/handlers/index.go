@@ -8,16 +8,17 @@ import (
 	"io/ioutil"
 	"net/http"
 
+	"github.com/appinesshq/bpi/foundation/web"
 	"github.com/pkg/errors"
 )
 
 type indexGroup struct {
-	tmpl    *template.Template
-	auth    *Auth
-	apiHost string
+	tmpl     *template.Template
+	sessions sessions
+	apiHost  string
 }
 
-func newIndex(tmpl string, apiHost string, auth *Auth) (indexGroup, error) {
+func newIndex(tmpl string, apiHost string, sessions sessions) (indexGroup, error) {
 	rawTmpl, err := ioutil.ReadFile(tmpl)
 	if err != nil {
 		return indexGroup{}, errors.Wrap(err, "reading index page")
@@ -29,24 +30,48 @@ func newIndex(tmpl string, apiHost string, auth *Auth) (indexGroup, error) {
 	}
 
 	ig := indexGroup{
-		tmpl:    t,
-		auth:    auth,
-		apiHost: apiHost,
+		tmpl:     t,
+		sessions: sessions,
+		apiHost:  apiHost,
 	}
 
 	return ig, nil
 }
 
 func (ig *indexGroup) handler(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	vis, err := ig.sessions.load(ctx, r, v.Now)
+	if err != nil {
+		return err
+	}
+
+	// Only the state of the visitor making the request is rendered. Tokens
+	// stay in the cookie, out of reach of scripts.
 	var markup bytes.Buffer
 	vars := map[string]interface{}{
-		"AuthToken": ig.auth.Token,
 		"ApiHost":   ig.apiHost,
+		"CSRFToken": vis.CSRF,
+		"SignedIn":  vis.signedIn(),
+		"UserID":    vis.UserID,
+		"Email":     vis.Email,
+		"Roles":     vis.Roles,
+		"Flash":     vis.Flash,
+		"Path":      r.URL.Path,
 	}
 	if err := ig.tmpl.Execute(&markup, vars); err != nil {
 		return errors.Wrapf(err, "executing template")
 	}
 
+	// Messages are shown once.
+	vis.Flash = ""
+	if err := ig.sessions.save(w, vis); err != nil {
+		return err
+	}
+
 	io.Copy(w, &markup)
 	return nil
 }
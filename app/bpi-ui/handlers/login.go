@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/appinesshq/bpi/foundation/web"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+type loginGroup struct {
+	sessions sessions
+}
+
+func (lg loginGroup) login(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.loginGroup.login")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	vis, err := lg.sessions.load(ctx, r, v.Now)
+	if err != nil {
+		return err
+	}
+	if err := vis.checkCSRF(r); err != nil {
+		return err
+	}
+
+	email := strings.TrimSpace(r.PostFormValue("email"))
+	tkn, err := lg.sessions.api.token(ctx, email, r.PostFormValue("password"), strings.TrimSpace(r.PostFormValue("otp")))
+	if err != nil {
+		ae, ok := rejected(err)
+		if !ok {
+			return errors.Wrap(err, "signing in")
+		}
+		vis.Flash = ae.Message
+		if err := lg.sessions.save(w, vis); err != nil {
+			return err
+		}
+		return redirect(ctx, w, r, next(r))
+	}
+
+	// A new session is started on sign in, so a CSRF token known before
+	// can't be used afterwards.
+	vis, err = newVisitor()
+	if err != nil {
+		return err
+	}
+	vis.Email = email
+	if err := vis.setTokens(tkn); err != nil {
+		return err
+	}
+	if err := lg.sessions.save(w, vis); err != nil {
+		return err
+	}
+
+	return redirect(ctx, w, r, next(r))
+}
+
+func (lg loginGroup) logout(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "handlers.loginGroup.logout")
+	defer span.End()
+
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	vis, err := lg.sessions.load(ctx, r, v.Now)
+	if err != nil {
+		return err
+	}
+	if err := vis.checkCSRF(r); err != nil {
+		return err
+	}
+
+	// Revoking the session at the api keeps the tokens from being used, even
+	// if they were copied. Tokens the api rejects are no longer usable anyway.
+	if vis.signedIn() {
+		if err := lg.sessions.api.logout(ctx, vis.Token); err != nil {
+			if _, ok := rejected(err); !ok {
+				return errors.Wrap(err, "signing out")
+			}
+		}
+	}
+
+	vis, err = newVisitor()
+	if err != nil {
+		return err
+	}
+	if err := lg.sessions.save(w, vis); err != nil {
+		return err
+	}
+
+	return redirect(ctx, w, r, next(r))
+}
+
+// next returns the page to return to after submitting a form. Only paths on
+// this site are allowed, so the form can't be used to redirect elsewhere.
+func next(r *http.Request) string {
+	n := r.PostFormValue("next")
+	if !strings.HasPrefix(n, "/") || strings.HasPrefix(n, "//") || strings.HasPrefix(n, "/\\") {
+		return "/"
+	}
+	return n
+}
+
+// redirect sends the visitor to the url after a form was submitted.
+func redirect(ctx context.Context, w http.ResponseWriter, r *http.Request, url string) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+	v.StatusCode = http.StatusSeeOther
+
+	http.Redirect(w, r, url, http.StatusSeeOther)
+	return nil
+}
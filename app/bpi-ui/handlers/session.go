@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/appinesshq/bpi/foundation/cookie"
+	"github.com/appinesshq/bpi/foundation/web"
+	"github.com/pkg/errors"
+)
+
+// sessionCookie is the name of the cookie holding the session of a visitor.
+const sessionCookie = "bpi_session"
+
+// csrfField is the name of the form field holding the CSRF token.
+const csrfField = "csrf_token"
+
+// visitor represents the session of a single visitor. It is stored encrypted
+// in a cookie, so it is never shared between visitors.
+type visitor struct {
+	CSRF             string   `json:"csrf"`
+	UserID           string   `json:"sub,omitempty"`
+	Email            string   `json:"email,omitempty"`
+	Roles            []string `json:"roles,omitempty"`
+	Token            string   `json:"tkn,omitempty"`
+	ExpiresAt        int64    `json:"exp,omitempty"`
+	RefreshToken     string   `json:"rtkn,omitempty"`
+	RefreshExpiresAt int64    `json:"rexp,omitempty"`
+	Flash            string   `json:"flash,omitempty"`
+}
+
+// newVisitor returns the session of a visitor who isn't signed in.
+func newVisitor() (visitor, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return visitor{}, errors.Wrap(err, "generating csrf token")
+	}
+	return visitor{CSRF: base64.RawURLEncoding.EncodeToString(b)}, nil
+}
+
+// signedIn reports whether the visitor is signed in.
+func (v visitor) signedIn() bool {
+	return v.Token != ""
+}
+
+// setTokens stores the tokens issued by the api, along with the user and
+// roles they were issued for.
+func (v *visitor) setTokens(tkn tokenResponse) error {
+
+	// The token comes straight from the api, so its payload is read without
+	// verifying the signature. The api verifies it on every use.
+	parts := strings.Split(tkn.Token, ".")
+	if len(parts) != 3 {
+		return errors.New("token is malformed")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return errors.Wrap(err, "decoding token payload")
+	}
+	var claims struct {
+		Subject string   `json:"sub"`
+		Roles   []string `json:"roles"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return errors.Wrap(err, "unmarshaling token payload")
+	}
+
+	v.UserID = claims.Subject
+	v.Roles = claims.Roles
+	v.Token = tkn.Token
+	v.ExpiresAt = tkn.ExpiresAt
+	v.RefreshToken = tkn.RefreshToken
+	v.RefreshExpiresAt = tkn.RefreshExpiresAt
+	return nil
+}
+
+// checkCSRF validates the CSRF token submitted with a form against the one
+// in the session.
+func (v visitor) checkCSRF(r *http.Request) error {
+	token := r.PostFormValue(csrfField)
+	if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(v.CSRF)) != 1 {
+		err := errors.New("invalid csrf token")
+		return web.NewRequestError(err, http.StatusForbidden)
+	}
+	return nil
+}
+
+// sessions loads and stores the sessions of visitors.
+type sessions struct {
+	codec  *cookie.Codec
+	secure bool
+	api    apiClient
+}
+
+// load returns the session of the visitor making the request. Visitors
+// without a valid session get a new one. Expired access tokens are refreshed,
+// and when that's no longer possible the visitor is signed out.
+func (s sessions) load(ctx context.Context, r *http.Request, now time.Time) (visitor, error) {
+	var v visitor
+	c, err := r.Cookie(sessionCookie)
+	if err != nil || s.codec.Decode(sessionCookie, c.Value, &v) != nil || v.CSRF == "" {
+		return newVisitor()
+	}
+
+	if !v.signedIn() || now.Unix() < v.ExpiresAt {
+		return v, nil
+	}
+
+	if now.Unix() < v.RefreshExpiresAt {
+		tkn, err := s.api.refresh(ctx, v.RefreshToken)
+		if err == nil {
+			if err := v.setTokens(tkn); err != nil {
+				return visitor{}, err
+			}
+			return v, nil
+		}
+		if _, ok := rejected(err); !ok {
+			return visitor{}, errors.Wrap(err, "refreshing token")
+		}
+	}
+
+	return visitor{CSRF: v.CSRF}, nil
+}
+
+// save stores the session in the cookie of the visitor. The cookie of a
+// signed in visitor lasts as long as the refresh token.
+func (s sessions) save(w http.ResponseWriter, v visitor) error {
+	value, err := s.codec.Encode(sessionCookie, v)
+	if err != nil {
+		return errors.Wrap(err, "encoding session")
+	}
+
+	c := http.Cookie{
+		Name:     sessionCookie,
+		Value:    value,
+		Path:     "/",
+		Secure:   s.secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if v.signedIn() {
+		c.Expires = time.Unix(v.RefreshExpiresAt, 0)
+	}
+	http.SetCookie(w, &c)
+
+	// Pages carry the state of a single visitor, so they must not be cached
+	// by shared caches.
+	w.Header().Set("Cache-Control", "no-store")
+
+	return nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
 	"expvar" // Register the expvar handlers
 	"fmt"
 	"log"
@@ -13,6 +14,7 @@ import (
 	"time"
 
 	"github.com/appinesshq/bpi/app/bpi-ui/handlers"
+	"github.com/appinesshq/bpi/foundation/cookie"
 	"github.com/ardanlabs/conf"
 	"github.com/pkg/errors"
 	"go.opentelemetry.io/otel/api/global"
@@ -48,6 +50,7 @@ func run(log *log.Logger) error {
 		conf.Version
 		Web struct {
 			APIHost         string        `conf:"default:0.0.0.0:3000"`
+			APIURL          string        `conf:"default:http://0.0.0.0:3000"`
 			UIHost          string        `conf:"default:0.0.0.0:80"`
 			DebugHost       string        `conf:"default:0.0.0.0:4002"`
 			ReadTimeout     time.Duration `conf:"default:5s"`
@@ -55,6 +58,10 @@ func run(log *log.Logger) error {
 			ShutdownTimeout time.Duration `conf:"default:5s"`
 			Index           string        `conf:"default:dobie.tmpl"`
 		}
+		Session struct {
+			Key           string `conf:"noprint"`
+			SecureCookies bool   `conf:"default:true"`
+		}
 		Zipkin struct {
 			ReporterURI string  `conf:"default:http://zipkin:9411/api/v2/spans"`
 			ServiceName string  `conf:"default:bpi-ui"`
@@ -98,6 +105,29 @@ func run(log *log.Logger) error {
 	}
 	log.Printf("main: Config :\n%v\n", out)
 
+	// =========================================================================
+	// Initialize sessions support
+
+	// The key encrypts the session cookies of visitors. Without a configured
+	// key, sessions don't survive a restart and can't be shared by instances.
+	var key []byte
+	switch cfg.Session.Key {
+	case "":
+		log.Println("main: No session key configured, generating one")
+		if key, err = cookie.GenerateKey(); err != nil {
+			return err
+		}
+	default:
+		if key, err = base64.StdEncoding.DecodeString(cfg.Session.Key); err != nil {
+			return errors.Wrap(err, "decoding session key")
+		}
+	}
+
+	codec, err := cookie.New(key)
+	if err != nil {
+		return errors.Wrap(err, "constructing session codec")
+	}
+
 	// =========================================================================
 	// Start Tracing Support
 
@@ -154,7 +184,7 @@ func run(log *log.Logger) error {
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 
-	handler, err := handlers.API(build, cfg.Web.Index, cfg.Web.APIHost, shutdown, log)
+	handler, err := handlers.API(build, cfg.Web.Index, cfg.Web.APIHost, cfg.Web.APIURL, codec, cfg.Session.SecureCookies, shutdown, log)
 	if err != nil {
 		return err
 	}
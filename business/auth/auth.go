@@ -2,7 +2,9 @@
 package auth
 
 import (
+	"context"
 	"crypto/rsa"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/pkg/errors"
@@ -14,16 +16,52 @@ const (
 	RoleUser  = "USER"
 )
 
+// These are the expected values for Claims.Audience. Access tokens are
+// issued for AudienceUsers. Tokens for any other audience serve a single
+// purpose and are never accepted as access tokens.
+const (
+	AudienceUsers       = "users"
+	AudienceVerifyEmail = "verify-email"
+)
+
+// These are the expected values for Claims.AMR, the methods used to
+// authenticate the user as defined by RFC 8176.
+const (
+	MethodPassword     = "pwd"
+	MethodOTP          = "otp"
+	MethodRecoveryCode = "rcv"
+	MethodMFA          = "mfa"
+
+	// MethodAPIKey and MethodFederated aren't defined by RFC 8176. They mark
+	// claims granted by an API key and by signing in with an OpenID provider.
+	MethodAPIKey    = "key"
+	MethodFederated = "fed"
+)
+
+var (
+	// ErrInvalidAPIKey occurs when an API key is unknown, expired or revoked.
+	ErrInvalidAPIKey = errors.New("api key is invalid")
+
+	// ErrNotParticipant occurs when the claims don't take part in a
+	// conversation, or the conversation doesn't exist.
+	ErrNotParticipant = errors.New("not a participant of the conversation")
+)
+
 // ctxKey represents the type of value for the context key.
 type ctxKey int
 
 // Key is used to store/retrieve a Claims value from a context.Context.
 const Key ctxKey = 1
 
+// ParticipantKey is used to store/retrieve the name of the profile the claims
+// take part in a conversation as from a context.Context.
+const ParticipantKey ctxKey = 2
+
 // Claims represents the authorization claims transmitted via a JWT.
 type Claims struct {
 	jwt.StandardClaims
 	Roles []string `json:"roles"`
+	AMR   []string `json:"amr,omitempty"`
 }
 
 // Authorized returns true if the claims has at least one of the provided roles.
@@ -38,40 +76,96 @@ func (c Claims) Authorized(roles ...string) bool {
 	return false
 }
 
-// Keys represents an in memory store of keys.
-type Keys map[string]*rsa.PrivateKey
-
-// PublicKeyLookup defines the signature of a function to lookup public keys.
+// KeyStore declares the behavior required to look up the keys used for
+// signing and verifying tokens.
 //
 // In a production system, a key id (KID) is used to retrieve the correct
-// public key to parse a JWT for auth and claims. A key lookup function is
-// provided to perform the task of retrieving a KID for a given public key.
-//
-// A key lookup function is required for creating an Authenticator.
+// public key to parse a JWT for auth and claims. A key store is provided to
+// perform the task of retrieving the key for a given KID.
 //
 // * Private keys should be rotated. During the transition period, tokens
 // signed with the old and new keys can coexist by looking up the correct
-// public key by KID.
+// public key by KID. Retired keys only need to provide a public key.
 //
 // * KID to public key resolution is usually accomplished via a public JWKS
 // endpoint. See https://auth0.com/docs/jwks for more details.
-type PublicKeyLookup func(kid string) (*rsa.PublicKey, error)
+type KeyStore interface {
+	PrivateKey(kid string) (*rsa.PrivateKey, error)
+	PublicKey(kid string) (*rsa.PublicKey, error)
+	PublicKeys() map[string]*rsa.PublicKey
+}
+
+// ActiveKeyStore is implemented by key stores that decide which key tokens
+// are signed with, so the signing key can be rotated at runtime.
+type ActiveKeyStore interface {
+	ActiveKID() string
+}
+
+// Keys represents a fixed, in memory store of keys. It must not be modified
+// after it has been handed to New.
+type Keys map[string]*rsa.PrivateKey
+
+// PrivateKey implements the KeyStore interface.
+func (k Keys) PrivateKey(kid string) (*rsa.PrivateKey, error) {
+	privateKey, ok := k[kid]
+	if !ok {
+		return nil, errors.New("kid lookup failed")
+	}
+	return privateKey, nil
+}
+
+// PublicKey implements the KeyStore interface.
+func (k Keys) PublicKey(kid string) (*rsa.PublicKey, error) {
+	privateKey, ok := k[kid]
+	if !ok {
+		return nil, errors.Errorf("no public key found for the specified kid: %s", kid)
+	}
+	return &privateKey.PublicKey, nil
+}
+
+// PublicKeys implements the KeyStore interface.
+func (k Keys) PublicKeys() map[string]*rsa.PublicKey {
+	keys := make(map[string]*rsa.PublicKey, len(k))
+	for kid, privateKey := range k {
+		keys[kid] = &privateKey.PublicKey
+	}
+	return keys
+}
+
+// RevocationLookup defines the signature of a function to check whether the
+// token with the specified id (jti) has been revoked before it expired.
+type RevocationLookup func(ctx context.Context, traceID string, jti string) (bool, error)
+
+// APIKeyLookup defines the signature of a function to find the claims granted
+// by an API key. It returns ErrInvalidAPIKey when the key can't be used.
+type APIKeyLookup func(ctx context.Context, traceID string, key string, now time.Time) (Claims, error)
+
+// ParticipantLookup defines the signature of a function to find the profile
+// the claims take part in the conversation with the specified id as. It
+// returns ErrNotParticipant when they don't take part in it.
+type ParticipantLookup func(ctx context.Context, traceID string, claims Claims, id string) (string, error)
 
 // Auth is used to authenticate clients. It can generate a token for a
 // set of user claims and recreate the claims by parsing the token.
 type Auth struct {
 	algorithm string
+	activeKID string
 	keyFunc   func(t *jwt.Token) (interface{}, error)
 	parser    *jwt.Parser
-	keys      Keys
+	store     KeyStore
 }
 
-// New creates an *Authenticator for use.
-func New(algorithm string, lookup PublicKeyLookup, keys Keys) (*Auth, error) {
+// New creates an *Authenticator for use. Tokens are signed with the key
+// identified by activeKID unless a caller asks for a specific key.
+func New(algorithm string, activeKID string, store KeyStore) (*Auth, error) {
 	if jwt.GetSigningMethod(algorithm) == nil {
 		return nil, errors.Errorf("unknown algorithm %v", algorithm)
 	}
 
+	if _, err := store.PrivateKey(activeKID); err != nil {
+		return nil, errors.Wrapf(err, "active key %s", activeKID)
+	}
+
 	keyFunc := func(t *jwt.Token) (interface{}, error) {
 		kid, ok := t.Header["kid"]
 		if !ok {
@@ -81,7 +175,7 @@ func New(algorithm string, lookup PublicKeyLookup, keys Keys) (*Auth, error) {
 		if !ok {
 			return nil, errors.New("user token key id (kid) must be string")
 		}
-		return lookup(kidID)
+		return store.PublicKey(kidID)
 	}
 
 	// Create the token parser to use. The algorithm used to sign the JWT must be
@@ -93,22 +187,25 @@ func New(algorithm string, lookup PublicKeyLookup, keys Keys) (*Auth, error) {
 
 	a := Auth{
 		algorithm: algorithm,
+		activeKID: activeKID,
 		keyFunc:   keyFunc,
 		parser:    &parser,
-		keys:      keys,
+		store:     store,
 	}
 
 	return &a, nil
 }
 
-// AddKey adds a private key and combination kid id to our local store.
-func (a *Auth) AddKey(privateKey *rsa.PrivateKey, kid string) {
-	a.keys[kid] = privateKey
-}
-
-// RemoveKey removes a private key and combination kid id to our local store.
-func (a *Auth) RemoveKey(kid string) {
-	delete(a.keys, kid)
+// ActiveKID returns the id of the key tokens are signed with by default. A
+// store implementing ActiveKeyStore decides, otherwise it is the key passed
+// to New.
+func (a *Auth) ActiveKID() string {
+	if s, ok := a.store.(ActiveKeyStore); ok {
+		if kid := s.ActiveKID(); kid != "" {
+			return kid
+		}
+	}
+	return a.activeKID
 }
 
 // GenerateToken generates a signed JWT token string representing the user Claims.
@@ -118,9 +215,9 @@ func (a *Auth) GenerateToken(kid string, claims Claims) (string, error) {
 	token := jwt.NewWithClaims(method, claims)
 	token.Header["kid"] = kid
 
-	privateKey, ok := a.keys[kid]
-	if !ok {
-		return "", errors.New("kid lookup failed")
+	privateKey, err := a.store.PrivateKey(kid)
+	if err != nil {
+		return "", errors.Wrap(err, "looking up private key")
 	}
 
 	str, err := token.SignedString(privateKey)
@@ -131,9 +228,40 @@ func (a *Auth) GenerateToken(kid string, claims Claims) (string, error) {
 	return str, nil
 }
 
-// ValidateToken recreates the Claims that were used to generate a token. It
-// verifies that the token was signed using our key.
+// ValidateToken recreates the Claims that were used to generate an access
+// token. It verifies that the token was signed using our key. Tokens without
+// an audience predate audiences and are accepted as access tokens.
 func (a *Auth) ValidateToken(tokenStr string) (Claims, error) {
+	claims, err := a.parse(tokenStr)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	if claims.Audience != "" && claims.Audience != AudienceUsers {
+		return Claims{}, errors.New("token is not an access token")
+	}
+
+	return claims, nil
+}
+
+// ValidateTokenFor recreates the Claims that were used to generate a token
+// for the specified audience. It verifies that the token was signed using our
+// key and was issued for that audience.
+func (a *Auth) ValidateTokenFor(audience string, tokenStr string) (Claims, error) {
+	claims, err := a.parse(tokenStr)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	if claims.Audience != audience {
+		return Claims{}, errors.Errorf("token is not issued for %s", audience)
+	}
+
+	return claims, nil
+}
+
+// parse parses the token and verifies its signature and time based claims.
+func (a *Auth) parse(tokenStr string) (Claims, error) {
 	var claims Claims
 	token, err := a.parser.ParseWithClaims(tokenStr, &claims, a.keyFunc)
 	if err != nil {
@@ -3,11 +3,16 @@ package auth_test
 import (
 	"crypto/rand"
 	"crypto/rsa"
-	"fmt"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/foundation/keystore"
 	"github.com/dgrijalva/jwt-go"
 )
 
@@ -29,18 +34,10 @@ func TestAuth(t *testing.T) {
 			}
 			t.Logf("\t%s\tTest %d:\tShould be able to create a private key.", success, testID)
 
-			// The key id we are stating represents the public key in the
-			// public key store.
+			// The key id we are stating represents the key in the key store.
 			const keyID = "54bb2165-71e1-41a6-af3e-7da4a0e1e2c1"
-			lookup := func(kid string) (*rsa.PublicKey, error) {
-				switch kid {
-				case keyID:
-					return &privateKey.PublicKey, nil
-				}
-				return nil, fmt.Errorf("no public key found for the specified kid: %s", kid)
-			}
 
-			a, err := auth.New("RS256", lookup, auth.Keys{keyID: privateKey})
+			a, err := auth.New("RS256", keyID, auth.Keys{keyID: privateKey})
 			if err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to create an authenticator: %v", failed, testID, err)
 			}
@@ -82,6 +79,152 @@ func TestAuth(t *testing.T) {
 				t.Fatalf("\t%s\tTest %d:\tShould have the expected roles: %v", failed, testID, err)
 			}
 			t.Logf("\t%s\tTest %d:\tShould have the expected roles.", success, testID)
+
+			claims.Audience = auth.AudienceVerifyEmail
+			token, err = a.GenerateToken(keyID, claims)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to generate a verification JWT: %v", failed, testID, err)
+			}
+
+			if _, err := a.ValidateToken(token); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT accept a verification JWT as access token.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT accept a verification JWT as access token.", success, testID)
+
+			if _, err := a.ValidateTokenFor(auth.AudienceVerifyEmail, token); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould accept a verification JWT for its audience: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould accept a verification JWT for its audience.", success, testID)
 		}
 	}
 }
+
+func TestKeyRotation(t *testing.T) {
+	t.Log("Given the need to rotate the keys tokens are signed with.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen retiring a key in favour of a new one.", testID)
+		{
+			folder, err := ioutil.TempDir("", "keys")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a keys folder: %v", failed, testID, err)
+			}
+			defer os.RemoveAll(folder)
+
+			const oldKID = "0b1cc5f4-8b3f-4bd2-9fbb-8d6bdc0d3d2c"
+			const newKID = "f2d0e7a4-5c6a-4a16-a4b8-0b0a9e1b5a77"
+
+			oldKey := writeKey(t, testID, folder, oldKID)
+
+			ks, err := keystore.New(folder, oldKID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to load the keys: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to load the keys.", success, testID)
+
+			a, err := auth.New("RS256", oldKID, ks)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create an authenticator: %v", failed, testID, err)
+			}
+
+			claims := auth.Claims{
+				StandardClaims: jwt.StandardClaims{
+					Subject:   "5cf37266-3473-4006-984f-9325122678b7",
+					ExpiresAt: time.Now().Add(time.Hour).Unix(),
+					IssuedAt:  time.Now().Unix(),
+				},
+				Roles: []string{auth.RoleUser},
+			}
+
+			oldToken, err := a.GenerateToken(oldKID, claims)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to generate a JWT: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to generate a JWT.", success, testID)
+
+			// Add the new key and retire the old one by keeping its public key only.
+			writeKey(t, testID, folder, newKID)
+			writePublicKey(t, testID, folder, oldKID, &oldKey.PublicKey)
+
+			if err := ks.Reload(); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to reload without a private key for the active key.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be able to reload without a private key for the active key.", success, testID)
+
+			if err := ioutil.WriteFile(filepath.Join(folder, keystore.ActiveFile), []byte(newKID+"\n"), 0600); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to make the new key active: %v", failed, testID, err)
+			}
+			if err := ks.Reload(); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to reload the keys: %v", failed, testID, err)
+			}
+			if a.ActiveKID() != newKID {
+				t.Fatalf("\t%s\tTest %d:\tShould sign with the new key by default: %s", failed, testID, a.ActiveKID())
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to reload the keys and sign with the new key by default.", success, testID)
+
+			if _, err := a.ValidateToken(oldToken); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to validate a token signed with a retired key: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to validate a token signed with a retired key.", success, testID)
+
+			if _, err := a.GenerateToken(oldKID, claims); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to sign with a retired key.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be able to sign with a retired key.", success, testID)
+
+			newToken, err := a.GenerateToken(newKID, claims)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to sign with the new key: %v", failed, testID, err)
+			}
+			if _, err := a.ValidateToken(newToken); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to validate a token signed with the new key: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to sign and validate with the new key.", success, testID)
+
+			jwks := a.JWKS()
+			if exp, got := 2, len(jwks.Keys); exp != got {
+				t.Logf("\t\tTest %d:\texp: %d", testID, exp)
+				t.Logf("\t\tTest %d:\tgot: %d", testID, got)
+				t.Fatalf("\t%s\tTest %d:\tShould publish every key in the JWKS.", failed, testID)
+			}
+			if jwks.Keys[0].KeyID != oldKID || jwks.Keys[0].Exponent != "AQAB" {
+				t.Fatalf("\t%s\tTest %d:\tShould publish the keys as JWKs: %+v", failed, testID, jwks.Keys[0])
+			}
+			t.Logf("\t%s\tTest %d:\tShould publish every key in the JWKS.", success, testID)
+		}
+	}
+}
+
+// writeKey generates a private key and stores it as <kid>.pem in folder.
+func writeKey(t *testing.T, testID int, folder string, kid string) *rsa.PrivateKey {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("\t%s\tTest %d:\tShould be able to create a private key: %v", failed, testID, err)
+	}
+
+	block := pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+	}
+	if err := ioutil.WriteFile(filepath.Join(folder, kid+".pem"), pem.EncodeToMemory(&block), 0600); err != nil {
+		t.Fatalf("\t%s\tTest %d:\tShould be able to write a private key: %v", failed, testID, err)
+	}
+
+	return privateKey
+}
+
+// writePublicKey stores a public key as <kid>.pem in folder.
+func writePublicKey(t *testing.T, testID int, folder string, kid string, publicKey *rsa.PublicKey) {
+	asn1Bytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatalf("\t%s\tTest %d:\tShould be able to marshal a public key: %v", failed, testID, err)
+	}
+
+	block := pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: asn1Bytes,
+	}
+	if err := ioutil.WriteFile(filepath.Join(folder, kid+".pem"), pem.EncodeToMemory(&block), 0600); err != nil {
+		t.Fatalf("\t%s\tTest %d:\tShould be able to write a public key: %v", failed, testID, err)
+	}
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"encoding/base64"
+	"math/big"
+	"sort"
+)
+
+// JWK represents a public key as a JSON Web Key (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	Modulus   string `json:"n"`
+	Exponent  string `json:"e"`
+}
+
+// JWKS represents a JSON Web Key Set, the document clients use to look up the
+// public key for the kid found in a token header.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the key store, retired keys included, so
+// tokens signed with any of them can be verified by third parties.
+func (a *Auth) JWKS() JWKS {
+	keys := a.store.PublicKeys()
+
+	kids := make([]string, 0, len(keys))
+	for kid := range keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	set := JWKS{
+		Keys: make([]JWK, 0, len(kids)),
+	}
+	for _, kid := range kids {
+		publicKey := keys[kid]
+		set.Keys = append(set.Keys, JWK{
+			KeyType:   "RSA",
+			Use:       "sig",
+			Algorithm: a.algorithm,
+			KeyID:     kid,
+			Modulus:   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+			Exponent:  base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+		})
+	}
+
+	return set
+}
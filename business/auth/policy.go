@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// These are the permissions checked by the business layer. Permissions on
+// entities with an owner are granted with a scope: ScopeOwn only applies to
+// entities owned by the user and ScopeAny to every entity.
+const (
+	PermissionCountryActivate      = "country:activate"
+	PermissionJurisdictionActivate = "jurisdiction:activate"
+	PermissionProfileEdit          = "profile:edit"
+	PermissionCategoryEdit         = "category:edit"
+	PermissionProductEdit          = "product:edit"
+	PermissionUserRead             = "user:read"
+	PermissionUserManage           = "user:manage"
+	PermissionAPIKeyRevoke         = "apikey:revoke"
+	PermissionRoleManage           = "role:manage"
+	PermissionAuditRead            = "audit:read"
+	PermissionRecordRestore        = "record:restore"
+	PermissionReviewModerate       = "review:moderate"
+)
+
+// These are the scopes of permissions on entities with an owner.
+const (
+	ScopeOwn = "own"
+	ScopeAny = "any"
+)
+
+// Scoped returns the name of a permission limited to the specified scope.
+func Scoped(permission string, scope string) string {
+	return permission + ":" + scope
+}
+
+// Known reports whether the permission is checked anywhere, so granting it
+// has an effect.
+func Known(permission string) bool {
+	switch strings.ToLower(permission) {
+	case PermissionCountryActivate,
+		PermissionJurisdictionActivate,
+		PermissionUserManage,
+		PermissionRoleManage,
+		PermissionAuditRead,
+		PermissionRecordRestore,
+		PermissionReviewModerate:
+		return true
+	}
+
+	for _, scoped := range []string{
+		PermissionProfileEdit,
+		PermissionCategoryEdit,
+		PermissionProductEdit,
+		PermissionUserRead,
+		PermissionAPIKeyRevoke,
+	} {
+		for _, scope := range []string{ScopeOwn, ScopeAny} {
+			if strings.EqualFold(permission, Scoped(scoped, scope)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// DefaultGrants maps roles to the permissions they held before permissions
+// became configurable. The database is seeded with them.
+var DefaultGrants = map[string][]string{
+	RoleAdmin: {
+		PermissionCountryActivate,
+		PermissionJurisdictionActivate,
+		Scoped(PermissionProfileEdit, ScopeAny),
+		Scoped(PermissionCategoryEdit, ScopeAny),
+		Scoped(PermissionProductEdit, ScopeAny),
+		Scoped(PermissionUserRead, ScopeAny),
+		PermissionUserManage,
+		Scoped(PermissionAPIKeyRevoke, ScopeAny),
+		PermissionRoleManage,
+		PermissionAuditRead,
+		PermissionRecordRestore,
+		PermissionReviewModerate,
+	},
+	RoleUser: {
+		Scoped(PermissionProfileEdit, ScopeOwn),
+		Scoped(PermissionCategoryEdit, ScopeOwn),
+		Scoped(PermissionProductEdit, ScopeOwn),
+		Scoped(PermissionUserRead, ScopeOwn),
+		Scoped(PermissionAPIKeyRevoke, ScopeOwn),
+	},
+}
+
+// Policy decides which permissions the roles in a set of claims grant. The
+// grants can be replaced at any time, so changes made in the database are
+// picked up without a restart.
+type Policy struct {
+	mu     sync.RWMutex
+	grants map[string]map[string]bool
+}
+
+// NewPolicy constructs a Policy from a mapping of roles to permissions.
+func NewPolicy(grants map[string][]string) *Policy {
+	var p Policy
+	p.Set(grants)
+	return &p
+}
+
+// Set replaces the mapping of roles to permissions.
+func (p *Policy) Set(grants map[string][]string) {
+	m := make(map[string]map[string]bool, len(grants))
+	for role, permissions := range grants {
+		m[role] = make(map[string]bool, len(permissions))
+		for _, permission := range permissions {
+			m[role][strings.ToLower(permission)] = true
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.grants = m
+}
+
+// Grants returns the mapping of roles to permissions.
+func (p *Policy) Grants() map[string][]string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	grants := make(map[string][]string, len(p.grants))
+	for role, permissions := range p.grants {
+		grants[role] = make([]string, 0, len(permissions))
+		for permission := range permissions {
+			grants[role] = append(grants[role], permission)
+		}
+		sort.Strings(grants[role])
+	}
+	return grants
+}
+
+// Allowed reports whether any role in the claims grants the permission.
+func (p *Policy) Allowed(claims Claims, permission string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	permission = strings.ToLower(permission)
+	for _, role := range claims.Roles {
+		if p.grants[role][permission] {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowedFor reports whether the claims grant the permission on an entity
+// owned by the specified user. Either the permission is granted for any
+// entity or for owned entities and the user in the claims is the owner.
+func (p *Policy) AllowedFor(claims Claims, permission string, ownerID string) bool {
+	if p.Allowed(claims, Scoped(permission, ScopeAny)) {
+		return true
+	}
+	return claims.Subject == ownerID && p.Allowed(claims, Scoped(permission, ScopeOwn))
+}
@@ -0,0 +1,61 @@
+package auth_test
+
+import (
+	"testing"
+
+	"github.com/appinesshq/bpi/business/auth"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestPolicy(t *testing.T) {
+	t.Log("Given the need to authorize actions by permission.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen checking the permissions of a set of claims.", testID)
+		{
+			p := auth.NewPolicy(auth.DefaultGrants)
+
+			user := auth.Claims{
+				StandardClaims: jwt.StandardClaims{
+					Subject: "45b5fbd3-755f-4379-8f07-a58d4a30fa2f",
+				},
+				Roles: []string{auth.RoleUser},
+			}
+			other := "5cf37266-3473-4006-984f-9325122678b7"
+
+			if p.Allowed(user, auth.PermissionCountryActivate) {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT allow a user to activate countries.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT allow a user to activate countries.", success, testID)
+
+			if !p.AllowedFor(user, auth.PermissionProfileEdit, user.Subject) {
+				t.Fatalf("\t%s\tTest %d:\tShould allow a user to edit their own profile.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould allow a user to edit their own profile.", success, testID)
+
+			if p.AllowedFor(user, auth.PermissionProfileEdit, other) {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT allow a user to edit the profile of someone else.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT allow a user to edit the profile of someone else.", success, testID)
+
+			admin := user
+			admin.Roles = []string{auth.RoleAdmin}
+			if !p.AllowedFor(admin, auth.PermissionProfileEdit, other) {
+				t.Fatalf("\t%s\tTest %d:\tShould allow an admin to edit any profile.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould allow an admin to edit any profile.", success, testID)
+
+			p.Set(map[string][]string{
+				auth.RoleUser: auth.DefaultGrants[auth.RoleUser],
+				"MODERATOR":   {auth.PermissionCountryActivate},
+			})
+
+			moderator := user
+			moderator.Roles = []string{auth.RoleUser, "MODERATOR"}
+			if !p.Allowed(moderator, auth.PermissionCountryActivate) {
+				t.Fatalf("\t%s\tTest %d:\tShould allow a role added later to activate countries.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould allow a role added later to activate countries.", success, testID)
+		}
+	}
+}
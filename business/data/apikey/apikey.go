@@ -0,0 +1,356 @@
+// Package apikey contains API key related CRUD functionality.
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/audit"
+	"github.com/appinesshq/bpi/foundation/database"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+// Prefix starts every API key, so leaked keys are easy to recognize.
+const Prefix = "bpi_"
+
+// MaxTTL is the longest an API key can remain valid after it was created.
+var MaxTTL = 365 * 24 * time.Hour
+
+var (
+	// ErrNotFound is used when a specific API key is requested but does not exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrInvalidID occurs when an ID is not in a valid form.
+	ErrInvalidID = errors.New("ID is not in its proper form")
+
+	// ErrForbidden occurs when a user tries to do something that is forbidden to them according to our access control policies.
+	ErrForbidden = errors.New("attempted action is not allowed")
+
+	// ErrInvalidExpiry occurs when the expiry of a new key is in the past or
+	// beyond MaxTTL.
+	ErrInvalidExpiry = errors.New("expiry is not in the allowed range")
+)
+
+// hashKey hashes an API key for storage. API keys are random values of
+// sufficient length, so an unsalted hash is enough.
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return fmt.Sprintf("%x", sum)
+}
+
+// generateKey returns a new API key together with its visible prefix.
+func generateKey() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(b)
+	prefix := Prefix + secret[:8]
+	return prefix + "_" + secret[8:], prefix, nil
+}
+
+// APIKey manages the set of API's for API key access.
+type APIKey struct {
+	log    *log.Logger
+	db     *sqlx.DB
+	policy *auth.Policy
+}
+
+// New constructs an APIKey for api access. The policy decides which
+// actions the claims passed to its methods allow.
+func New(log *log.Logger, db *sqlx.DB, policy *auth.Policy) APIKey {
+	return APIKey{
+		log:    log,
+		db:     db,
+		policy: policy,
+	}
+}
+
+// Create adds an API key for the user in the claims. The key can only be
+// scoped to roles the claims hold and keys can't create other keys. It
+// returns the key, which is only ever available here since just its hash is
+// stored.
+func (a APIKey) Create(ctx context.Context, traceID string, claims auth.Claims, nk NewKey, now time.Time) (Info, string, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.apikey.create")
+	defer span.End()
+
+	for _, method := range claims.AMR {
+		if method == auth.MethodAPIKey {
+			return Info{}, "", ErrForbidden
+		}
+	}
+
+	for _, role := range nk.Roles {
+		if !claims.Authorized(role) {
+			return Info{}, "", ErrForbidden
+		}
+	}
+
+	if !nk.DateExpires.After(now) || nk.DateExpires.After(now.Add(MaxTTL)) {
+		return Info{}, "", ErrInvalidExpiry
+	}
+
+	key, prefix, err := generateKey()
+	if err != nil {
+		return Info{}, "", errors.Wrap(err, "generating api key")
+	}
+
+	k := Info{
+		ID:          uuid.New().String(),
+		Name:        nk.Name,
+		Prefix:      prefix,
+		KeyHash:     hashKey(key),
+		UserID:      claims.Subject,
+		Roles:       nk.Roles,
+		DateCreated: now.UTC(),
+		DateExpires: nk.DateExpires.UTC(),
+	}
+
+	const q = `
+	INSERT INTO api_keys
+		(key_id, name, prefix, key_hash, user_id, roles, date_created, date_expires)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	a.log.Printf("%s: %s: %s", traceID, "apikey.Create",
+		database.Log(q, k.ID, k.Name, k.Prefix, k.KeyHash, k.UserID, k.Roles, k.DateCreated, k.DateExpires),
+	)
+
+	tx, err := a.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return Info{}, "", errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, q, k.ID, k.Name, k.Prefix, k.KeyHash, k.UserID, k.Roles, k.DateCreated, k.DateExpires); err != nil {
+		return Info{}, "", errors.Wrap(err, "inserting api key")
+	}
+
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionCreate,
+		EntityType: "apikey",
+		EntityID:   k.ID,
+		After:      k,
+	}
+	if err := audit.Record(ctx, a.log, tx, traceID, ne, now); err != nil {
+		return Info{}, "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Info{}, "", errors.Wrap(err, "committing api key")
+	}
+
+	return k, key, nil
+}
+
+// Revoke ends the use of an API key. Depending on the policy, users can
+// revoke their own keys or any key.
+func (a APIKey) Revoke(ctx context.Context, traceID string, claims auth.Claims, keyID string, now time.Time) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.apikey.revoke")
+	defer span.End()
+
+	k, err := a.QueryByID(ctx, traceID, keyID)
+	if err != nil {
+		return err
+	}
+
+	if !a.policy.AllowedFor(claims, auth.PermissionAPIKeyRevoke, k.UserID) {
+		return ErrForbidden
+	}
+
+	const q = `
+	UPDATE
+		api_keys
+	SET
+		"date_revoked" = $2
+	WHERE
+		key_id = $1 AND date_revoked IS NULL`
+
+	a.log.Printf("%s: %s: %s", traceID, "apikey.Revoke",
+		database.Log(q, keyID, now.UTC()),
+	)
+
+	tx, err := a.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, q, keyID, now.UTC())
+	if err != nil {
+		return errors.Wrapf(err, "revoking api key %s", keyID)
+	}
+
+	// Revoking a key twice changes nothing, so there's nothing to record.
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return nil
+	}
+
+	after := k
+	after.DateRevoked = sql.NullTime{Time: now.UTC(), Valid: true}
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionRevoke,
+		EntityType: "apikey",
+		EntityID:   keyID,
+		Before:     k,
+		After:      after,
+	}
+	if err := audit.Record(ctx, a.log, tx, traceID, ne, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing api key")
+	}
+
+	return nil
+}
+
+// Query retrieves the API keys of every user from the database.
+func (a APIKey) Query(ctx context.Context, traceID string) ([]Info, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.apikey.query")
+	defer span.End()
+
+	const q = `
+	SELECT
+		*
+	FROM
+		api_keys
+	ORDER BY
+		date_created`
+
+	a.log.Printf("%s: %s: %s", traceID, "apikey.Query",
+		database.Log(q),
+	)
+
+	keys := []Info{}
+	if err := a.db.SelectContext(ctx, &keys, q); err != nil {
+		return nil, errors.Wrap(err, "selecting api keys")
+	}
+
+	return keys, nil
+}
+
+// QueryByUser retrieves the API keys of the specified user from the database.
+func (a APIKey) QueryByUser(ctx context.Context, traceID string, userID string) ([]Info, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.apikey.querybyuser")
+	defer span.End()
+
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	const q = `
+	SELECT
+		*
+	FROM
+		api_keys
+	WHERE
+		user_id = $1
+	ORDER BY
+		date_created`
+
+	a.log.Printf("%s: %s: %s", traceID, "apikey.QueryByUser",
+		database.Log(q, userID),
+	)
+
+	keys := []Info{}
+	if err := a.db.SelectContext(ctx, &keys, q, userID); err != nil {
+		return nil, errors.Wrapf(err, "selecting api keys of user %q", userID)
+	}
+
+	return keys, nil
+}
+
+// QueryByID gets the specified API key from the database.
+func (a APIKey) QueryByID(ctx context.Context, traceID string, keyID string) (Info, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.apikey.querybyid")
+	defer span.End()
+
+	if _, err := uuid.Parse(keyID); err != nil {
+		return Info{}, ErrInvalidID
+	}
+
+	const q = `
+	SELECT
+		*
+	FROM
+		api_keys
+	WHERE
+		key_id = $1`
+
+	a.log.Printf("%s: %s: %s", traceID, "apikey.QueryByID",
+		database.Log(q, keyID),
+	)
+
+	var k Info
+	if err := a.db.GetContext(ctx, &k, q, keyID); err != nil {
+		if err == sql.ErrNoRows {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, errors.Wrapf(err, "selecting api key %q", keyID)
+	}
+
+	return k, nil
+}
+
+// Authenticate finds the API key and returns the claims it grants. The use
+// of the key is recorded. The roles of the key are limited to those its owner
+// still holds. Its signature matches auth.APIKeyLookup.
+func (a APIKey) Authenticate(ctx context.Context, traceID string, key string, now time.Time) (auth.Claims, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.apikey.authenticate")
+	defer span.End()
+
+	const q = `
+	UPDATE
+		api_keys AS k
+	SET
+		"date_last_used" = $2
+	FROM
+		users AS u
+	WHERE
+		k.key_hash = $1 AND k.date_revoked IS NULL AND k.date_expires > $2 AND u.user_id = k.user_id AND u.deleted_at IS NULL
+	RETURNING
+		k.key_id, k.user_id, k.date_expires,
+		ARRAY(SELECT UNNEST(k.roles) INTERSECT SELECT UNNEST(u.roles)) AS roles`
+
+	hash := hashKey(key)
+
+	a.log.Printf("%s: %s: %s", traceID, "apikey.Authenticate",
+		database.Log(q, hash, now.UTC()),
+	)
+
+	var k Info
+	if err := a.db.GetContext(ctx, &k, q, hash, now.UTC()); err != nil {
+		if err == sql.ErrNoRows {
+			return auth.Claims{}, auth.ErrInvalidAPIKey
+		}
+		return auth.Claims{}, errors.Wrap(err, "using api key")
+	}
+
+	claims := auth.Claims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   k.UserID,
+			Audience:  auth.AudienceUsers,
+			ExpiresAt: k.DateExpires.Unix(),
+			IssuedAt:  now.Unix(),
+		},
+		Roles: k.Roles,
+		AMR:   []string{auth.MethodAPIKey},
+	}
+
+	return claims, nil
+}
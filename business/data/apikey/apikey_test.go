@@ -0,0 +1,118 @@
+package apikey_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/apikey"
+	"github.com/appinesshq/bpi/business/data/schema"
+	"github.com/appinesshq/bpi/business/tests"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+func TestAPIKey(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	if err := schema.Seed(db); err != nil {
+		t.Fatalf("Couldn't seed database: %v", err)
+	}
+
+	a := apikey.New(log, db, tests.Policy())
+
+	t.Log("Given the need to work with API Key records.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen handling a single API Key.", testID)
+		{
+			ctx := tests.Context()
+			now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			claims := auth.Claims{
+				StandardClaims: jwt.StandardClaims{
+					Subject: tests.UserID,
+				},
+				Roles: []string{auth.RoleUser},
+			}
+
+			nk := apikey.NewKey{
+				Name:        "nightly import",
+				Roles:       []string{auth.RoleAdmin},
+				DateExpires: now.Add(24 * time.Hour),
+			}
+
+			if _, _, err := a.Create(ctx, traceID, claims, nk, now); errors.Cause(err) != apikey.ErrForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to scope a key to a role not held : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to scope a key to a role not held.", tests.Success, testID)
+
+			nk.Roles = []string{auth.RoleUser}
+			k, key, err := a.Create(ctx, traceID, claims, nk, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create an api key : %s.", tests.Failed, testID, err)
+			}
+			if !strings.HasPrefix(key, k.Prefix) || k.KeyHash == key {
+				t.Fatalf("\t%s\tTest %d:\tShould start the key with its prefix and only store its hash.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create an api key.", tests.Success, testID)
+
+			later := now.Add(time.Hour)
+			got, err := a.Authenticate(ctx, traceID, key, later)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to authenticate with the key : %s.", tests.Failed, testID, err)
+			}
+			if got.Subject != tests.UserID || !got.Authorized(auth.RoleUser) {
+				t.Fatalf("\t%s\tTest %d:\tShould get the claims of the key : %+v.", tests.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to authenticate with the key.", tests.Success, testID)
+
+			if _, _, err := a.Create(ctx, traceID, got, nk, later); errors.Cause(err) != apikey.ErrForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to create a key with a key : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to create a key with a key.", tests.Success, testID)
+
+			saved, err := a.QueryByID(ctx, traceID, k.ID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve the key by ID : %s.", tests.Failed, testID, err)
+			}
+			if !saved.DateLastUsed.Valid || !saved.DateLastUsed.Time.Equal(later) {
+				t.Fatalf("\t%s\tTest %d:\tShould record when the key was last used : %v.", tests.Failed, testID, saved.DateLastUsed)
+			}
+			t.Logf("\t%s\tTest %d:\tShould record when the key was last used.", tests.Success, testID)
+
+			keys, err := a.QueryByUser(ctx, traceID, tests.UserID)
+			if err != nil || len(keys) != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to list the keys of the user : %d, %v.", tests.Failed, testID, len(keys), err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to list the keys of the user.", tests.Success, testID)
+
+			if _, err := a.Authenticate(ctx, traceID, key, nk.DateExpires); errors.Cause(err) != auth.ErrInvalidAPIKey {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to use an expired key : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to use an expired key.", tests.Success, testID)
+
+			other := auth.Claims{
+				StandardClaims: jwt.StandardClaims{
+					Subject: tests.AdminID,
+				},
+				Roles: []string{auth.RoleUser},
+			}
+			if err := a.Revoke(ctx, traceID, other, k.ID, later); errors.Cause(err) != apikey.ErrForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to revoke the key of another user : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to revoke the key of another user.", tests.Success, testID)
+
+			if err := a.Revoke(ctx, traceID, claims, k.ID, later); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to revoke the key : %s.", tests.Failed, testID, err)
+			}
+			if _, err := a.Authenticate(ctx, traceID, key, later); errors.Cause(err) != auth.ErrInvalidAPIKey {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to use a revoked key : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to revoke the key.", tests.Success, testID)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package apikey
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Info represents an API key used by a machine to access the API on behalf
+// of a user.
+type Info struct {
+	ID           string         `db:"key_id" json:"id"`                     // Unique identifier.
+	Name         string         `db:"name" json:"name"`                     // Name describing what the key is used for.
+	Prefix       string         `db:"prefix" json:"prefix"`                 // Visible start of the key to recognize it by.
+	KeyHash      string         `db:"key_hash" json:"-"`                    // Hash of the key.
+	UserID       string         `db:"user_id" json:"user_id"`               // ID of the user owning the key.
+	Roles        pq.StringArray `db:"roles" json:"roles"`                   // Roles the key is scoped to.
+	DateCreated  time.Time      `db:"date_created" json:"date_created"`     // When the key was created.
+	DateExpires  time.Time      `db:"date_expires" json:"date_expires"`     // When the key expires.
+	DateLastUsed sql.NullTime   `db:"date_last_used" json:"date_last_used"` // When the key was last used.
+	DateRevoked  sql.NullTime   `db:"date_revoked" json:"date_revoked"`     // When the key was revoked.
+}
+
+// NewKey contains information needed to create a new API key.
+type NewKey struct {
+	Name        string    `json:"name" validate:"required"`
+	Roles       []string  `json:"roles" validate:"required"`
+	DateExpires time.Time `json:"date_expires" validate:"required"`
+}
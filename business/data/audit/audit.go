@@ -0,0 +1,244 @@
+// Package audit contains the log of actions performed on records, recording
+// who did what and when.
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/appinesshq/bpi/foundation/database"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+// Actions recorded in the audit log.
+const (
+	ActionCreate       = "create"
+	ActionUpdate       = "update"
+	ActionDelete       = "delete"
+	ActionRestore      = "restore"
+	ActionToggleActive = "toggle_active"
+	ActionGrant        = "grant"
+	ActionRevoke       = "revoke"
+	ActionErase        = "erase"
+)
+
+// redacted replaces the values of sensitive fields in the recorded changes.
+const redacted = "[redacted]"
+
+// Audit manages the set of API's for reading the audit log. Events are
+// written with Record by the packages performing the actions.
+type Audit struct {
+	log *log.Logger
+	db  *sqlx.DB
+}
+
+// New constructs an Audit for api access.
+func New(log *log.Logger, db *sqlx.DB) Audit {
+	return Audit{
+		log: log,
+		db:  db,
+	}
+}
+
+// Record adds an event to the audit log. It takes the transaction performing
+// the action, so the event is only recorded when the action succeeds. Events
+// without an actor were caused by admin tooling rather than a request.
+func Record(ctx context.Context, log *log.Logger, tx sqlx.ExecerContext, traceID string, ne NewEvent, now time.Time) error {
+	changes, err := Diff(ne.Before, ne.After, ne.Sensitive...)
+	if err != nil {
+		return err
+	}
+
+	ev := Info{
+		ID:          uuid.New().String(),
+		ActorID:     ne.ActorID,
+		Action:      ne.Action,
+		EntityType:  ne.EntityType,
+		EntityID:    ne.EntityID,
+		Changes:     changes,
+		TraceID:     traceID,
+		DateCreated: now.UTC(),
+	}
+
+	const q = `
+	INSERT INTO audit_events
+		(event_id, actor_id, action, entity_type, entity_id, changes, trace_id, date_created)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	log.Printf("%s: %s: %s", traceID, "audit.Record",
+		database.Log(q, ev.ID, ev.ActorID, ev.Action, ev.EntityType, ev.EntityID, string(ev.Changes), ev.TraceID, ev.DateCreated),
+	)
+
+	if _, err := tx.ExecContext(ctx, q, ev.ID, ev.ActorID, ev.Action, ev.EntityType, ev.EntityID, []byte(ev.Changes), ev.TraceID, ev.DateCreated); err != nil {
+		return errors.Wrap(err, "recording audit event")
+	}
+
+	return nil
+}
+
+// Redact removes the values from the recorded changes of the events about
+// the specified entities, like Record does for sensitive fields. The changed
+// fields and the events themselves are kept. It takes the transaction erasing
+// the entities, so the values are only removed when the erasure succeeds.
+func Redact(ctx context.Context, log *log.Logger, tx sqlx.ExecerContext, traceID string, entityType string, entityIDs []string) error {
+	if len(entityIDs) == 0 {
+		return nil
+	}
+
+	const q = `
+	UPDATE
+		audit_events
+	SET
+		"changes" = COALESCE((
+			SELECT
+				jsonb_object_agg(key, jsonb_build_object(
+					'before', CASE WHEN value->'before' = 'null' THEN value->'before' ELSE to_jsonb($3::TEXT) END,
+					'after', CASE WHEN value->'after' = 'null' THEN value->'after' ELSE to_jsonb($3::TEXT) END
+				))
+			FROM
+				jsonb_each(changes)
+		), '{}')
+	WHERE
+		entity_type = $1 AND entity_id = ANY($2)`
+
+	log.Printf("%s: %s: %s", traceID, "audit.Redact",
+		database.Log(q, entityType, entityIDs, redacted),
+	)
+
+	if _, err := tx.ExecContext(ctx, q, entityType, pq.Array(entityIDs), redacted); err != nil {
+		return errors.Wrapf(err, "redacting audit events of %s", entityType)
+	}
+
+	return nil
+}
+
+// Diff returns the fields that differ between the JSON representations of
+// two records, as an object mapping every changed field to its values before
+// and after. Either record can be nil, for records that were created or
+// deleted. The values of sensitive fields are redacted.
+func Diff(before, after interface{}, sensitive ...string) (json.RawMessage, error) {
+	b, err := fields(before)
+	if err != nil {
+		return nil, errors.Wrap(err, "encoding record before the action")
+	}
+	a, err := fields(after)
+	if err != nil {
+		return nil, errors.Wrap(err, "encoding record after the action")
+	}
+
+	hidden := make(map[string]bool, len(sensitive))
+	for _, field := range sensitive {
+		hidden[field] = true
+	}
+
+	type change struct {
+		Before json.RawMessage `json:"before"`
+		After  json.RawMessage `json:"after"`
+	}
+
+	null := json.RawMessage("null")
+	changes := make(map[string]change)
+	add := func(field string) {
+		bv, ok := b[field]
+		if !ok {
+			bv = null
+		}
+		av, ok := a[field]
+		if !ok {
+			av = null
+		}
+		if bytes.Equal(bv, av) {
+			return
+		}
+		if hidden[field] {
+			mask := json.RawMessage(`"` + redacted + `"`)
+			if before != nil {
+				bv = mask
+			}
+			if after != nil {
+				av = mask
+			}
+		}
+		changes[field] = change{Before: bv, After: av}
+	}
+	for field := range b {
+		add(field)
+	}
+	for field := range a {
+		if _, ok := b[field]; !ok {
+			add(field)
+		}
+	}
+
+	return json.Marshal(changes)
+}
+
+// fields returns the fields of the JSON representation of a record.
+func fields(record interface{}) (map[string]json.RawMessage, error) {
+	if record == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Query retrieves the events matching the filter from the audit log, most
+// recent first.
+func (a Audit) Query(ctx context.Context, traceID string, filter Filter, pageNumber int, rowsPerPage int) ([]Info, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.audit.query")
+	defer span.End()
+
+	const q = `
+	SELECT
+		*
+	FROM
+		audit_events
+	WHERE
+		($1 = '' OR actor_id = $1) AND
+		($2 = '' OR action = $2) AND
+		($3 = '' OR entity_type = $3) AND
+		($4 = '' OR entity_id = $4) AND
+		($5::TIMESTAMP IS NULL OR date_created >= $5) AND
+		($6::TIMESTAMP IS NULL OR date_created < $6)
+	ORDER BY
+		date_created DESC, event_id
+	OFFSET $7 ROWS FETCH NEXT $8 ROWS ONLY`
+
+	// Unset dates match every event.
+	var from, to interface{}
+	if !filter.From.IsZero() {
+		from = filter.From.UTC()
+	}
+	if !filter.To.IsZero() {
+		to = filter.To.UTC()
+	}
+	offset := (pageNumber - 1) * rowsPerPage
+
+	a.log.Printf("%s: %s: %s", traceID, "audit.Query",
+		database.Log(q, filter.ActorID, filter.Action, filter.EntityType, filter.EntityID, from, to, offset, rowsPerPage),
+	)
+
+	events := []Info{}
+	if err := a.db.SelectContext(ctx, &events, q, filter.ActorID, filter.Action, filter.EntityType, filter.EntityID, from, to, offset, rowsPerPage); err != nil {
+		return nil, errors.Wrap(err, "selecting audit events")
+	}
+
+	return events, nil
+}
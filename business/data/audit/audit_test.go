@@ -0,0 +1,188 @@
+package audit_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/audit"
+	"github.com/appinesshq/bpi/business/data/product"
+	"github.com/appinesshq/bpi/business/data/profile"
+	"github.com/appinesshq/bpi/business/tests"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/go-cmp/cmp"
+)
+
+// change is how a changed field is recorded.
+type change struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+func TestDiff(t *testing.T) {
+	type record struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+		Cost  int    `json:"cost"`
+	}
+
+	t.Log("Given the need to record what an action changed.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen comparing records before and after an action.", testID)
+		{
+			before := record{Name: "Comic Books", Email: "old@example.com", Cost: 10}
+			after := record{Name: "Comic Books", Email: "new@example.com", Cost: 25}
+
+			raw, err := audit.Diff(before, after, "email")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to diff records : %s.", tests.Failed, testID, err)
+			}
+
+			var got map[string]change
+			if err := json.Unmarshal(raw, &got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the diff : %s.", tests.Failed, testID, err)
+			}
+
+			exp := map[string]change{
+				"cost":  {Before: 10.0, After: 25.0},
+				"email": {Before: "[redacted]", After: "[redacted]"},
+			}
+			if diff := cmp.Diff(exp, got); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould only record changed fields, redacting sensitive ones. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould only record changed fields, redacting sensitive ones.", tests.Success, testID)
+
+			raw, err = audit.Diff(nil, after)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to diff a created record : %s.", tests.Failed, testID, err)
+			}
+			got = nil
+			if err := json.Unmarshal(raw, &got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the diff : %s.", tests.Failed, testID, err)
+			}
+			if len(got) != 3 || got["name"].Before != nil || got["name"].After != "Comic Books" {
+				t.Fatalf("\t%s\tTest %d:\tShould record every field of a created record : %+v.", tests.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould record every field of a created record.", tests.Success, testID)
+		}
+	}
+}
+
+func TestAudit(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	a := audit.New(log, db)
+	p := product.New(log, db, tests.Policy())
+
+	t.Log("Given the need to know who changed what.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen changing a Product.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000001"
+
+			claims := auth.Claims{
+				StandardClaims: jwt.StandardClaims{
+					Issuer:    "MB Appiness Solutions",
+					Subject:   "718ffbea-f4a1-4667-8ae3-b349da52675e",
+					Audience:  "users",
+					ExpiresAt: now.Add(time.Hour).Unix(),
+					IssuedAt:  now.Unix(),
+				},
+				Roles: []string{auth.RoleAdmin, auth.RoleUser},
+			}
+
+			if _, err := profile.New(log, db, tests.Policy()).Create(ctx, traceID, claims, profile.NewProfile{Name: "acme", Type: "SER", DisplayName: "Acme"}, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a provider : %s.", tests.Failed, testID, err)
+			}
+
+			prd, err := p.Create(ctx, traceID, claims, product.NewProduct{Name: "Comic Books", Profile: "acme", Cost: 10, Currency: "EUR", Quantity: 55}, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a product : %s.", tests.Failed, testID, err)
+			}
+
+			later := now.Add(time.Hour)
+			if err := p.Update(ctx, traceID, claims, prd.ID, product.UpdateProduct{Cost: tests.IntPointer(25)}, later); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to update the product : %s.", tests.Failed, testID, err)
+			}
+
+			if err := p.Delete(ctx, traceID, claims, prd.ID, later); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to delete the product : %s.", tests.Failed, testID, err)
+			}
+
+			filter := audit.Filter{
+				EntityType: "product",
+				EntityID:   prd.ID,
+			}
+			events, err := a.Query(ctx, traceID, filter, 1, 10)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to query the audit log : %s.", tests.Failed, testID, err)
+			}
+			if len(events) != 3 {
+				t.Fatalf("\t%s\tTest %d:\tShould have recorded 3 events, got %d.", tests.Failed, testID, len(events))
+			}
+			t.Logf("\t%s\tTest %d:\tShould have recorded 3 events.", tests.Success, testID)
+
+			for _, ev := range events {
+				if ev.ActorID != claims.Subject || ev.TraceID != traceID {
+					t.Fatalf("\t%s\tTest %d:\tShould record the actor and trace : %+v.", tests.Failed, testID, ev)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould record the actor and trace.", tests.Success, testID)
+
+			filter.Action = audit.ActionUpdate
+			events, err = a.Query(ctx, traceID, filter, 1, 10)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to filter the audit log : %s.", tests.Failed, testID, err)
+			}
+			if len(events) != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould find the update only, got %d events.", tests.Failed, testID, len(events))
+			}
+
+			var changes map[string]change
+			if err := json.Unmarshal(events[0].Changes, &changes); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the changes : %s.", tests.Failed, testID, err)
+			}
+			if c, ok := changes["cost"]; !ok || c.Before != 10.0 || c.After != 25.0 {
+				t.Fatalf("\t%s\tTest %d:\tShould record the changed cost : %s.", tests.Failed, testID, events[0].Changes)
+			}
+			if _, ok := changes["name"]; ok {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT record the unchanged name : %s.", tests.Failed, testID, events[0].Changes)
+			}
+			t.Logf("\t%s\tTest %d:\tShould record what the update changed.", tests.Success, testID)
+
+			filter = audit.Filter{EntityID: prd.ID, From: later.Add(time.Minute)}
+			events, err = a.Query(ctx, traceID, filter, 1, 10)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to filter the audit log by date : %s.", tests.Failed, testID, err)
+			}
+			if len(events) != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould find no events after the period, got %d.", tests.Failed, testID, len(events))
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to filter the audit log.", tests.Success, testID)
+
+			if err := audit.Redact(ctx, log, db, traceID, "product", []string{prd.ID}); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to redact the events : %s.", tests.Failed, testID, err)
+			}
+			filter = audit.Filter{EntityType: "product", EntityID: prd.ID, Action: audit.ActionUpdate}
+			events, err = a.Query(ctx, traceID, filter, 1, 10)
+			if err != nil || len(events) != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould keep the redacted events : %v.", tests.Failed, testID, err)
+			}
+			changes = nil
+			if err := json.Unmarshal(events[0].Changes, &changes); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the changes : %s.", tests.Failed, testID, err)
+			}
+			if c, ok := changes["cost"]; !ok || c.Before != "[redacted]" || c.After != "[redacted]" {
+				t.Fatalf("\t%s\tTest %d:\tShould redact the values of the changes : %s.", tests.Failed, testID, events[0].Changes)
+			}
+			t.Logf("\t%s\tTest %d:\tShould redact the values of the changes.", tests.Success, testID)
+		}
+	}
+}
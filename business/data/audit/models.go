@@ -0,0 +1,43 @@
+package audit
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Info represents an event recorded in the audit log.
+type Info struct {
+	ID          string          `db:"event_id" json:"id"`               // Unique identifier.
+	ActorID     string          `db:"actor_id" json:"actor_id"`         // ID of the user who performed the action.
+	Action      string          `db:"action" json:"action"`             // What was done, like create or delete.
+	EntityType  string          `db:"entity_type" json:"entity_type"`   // Kind of record the action was performed on.
+	EntityID    string          `db:"entity_id" json:"entity_id"`       // ID of the record the action was performed on.
+	Changes     json.RawMessage `db:"changes" json:"changes"`           // Fields changed by the action with their values before and after.
+	TraceID     string          `db:"trace_id" json:"trace_id"`         // Trace of the request performing the action.
+	DateCreated time.Time       `db:"date_created" json:"date_created"` // When the action was performed.
+}
+
+// NewEvent contains the information needed to record an event. Before and
+// After are the record as it is returned by its package, so the changes are
+// recorded the way clients see them. Before is nil for created records and
+// After is nil for deleted ones.
+type NewEvent struct {
+	ActorID    string
+	Action     string
+	EntityType string
+	EntityID   string
+	Before     interface{}
+	After      interface{}
+	Sensitive  []string // Fields recorded as changed without their values.
+}
+
+// Filter narrows down the events returned by a query. Empty fields match
+// every event.
+type Filter struct {
+	ActorID    string
+	Action     string
+	EntityType string
+	EntityID   string
+	From       time.Time // Earliest date, inclusive.
+	To         time.Time // Latest date, exclusive.
+}
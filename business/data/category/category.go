@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/audit"
 	"github.com/appinesshq/bpi/foundation/database"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
@@ -26,22 +27,31 @@ var (
 	ErrForbidden = errors.New("attempted action is not allowed")
 )
 
+// columns selects a category from categories aliased as c, with its name taken
+// from the translations aliased as tr when there is one.
+const columns = `
+		c.category_id, c.slug, COALESCE(tr.value, c.name) AS name, c.user_id,
+		c.parent_id, c.date_created, c.date_updated, c.deleted_at`
+
 // Category manages the set of API's for category access.
 type Category struct {
-	log *log.Logger
-	db  *sqlx.DB
+	log    *log.Logger
+	db     *sqlx.DB
+	policy *auth.Policy
 }
 
-// New constructs a Category for api access.
-func New(log *log.Logger, db *sqlx.DB) Category {
+// New constructs a Category for api access. The policy decides which
+// actions the claims passed to its methods allow.
+func New(log *log.Logger, db *sqlx.DB, policy *auth.Policy) Category {
 	return Category{
-		log: log,
-		db:  db,
+		log:    log,
+		db:     db,
+		policy: policy,
 	}
 }
 
 // Create adds a Category to the database. It returns the created Category with
-// fields like ID and DateCreated populated.
+// fields like ID and DateCreated populated. The parent category has to exist.
 func (p Category) Create(ctx context.Context, traceID string, claims auth.Claims, n NewCategory, now time.Time) (Info, error) {
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.category.create")
 	defer span.End()
@@ -60,9 +70,6 @@ func (p Category) Create(ctx context.Context, traceID string, claims auth.Claims
 		DateCreated: now.UTC(),
 		DateUpdated: now.UTC(),
 	}
-	// if cat.ParentID == "" {
-	// 	cat.ParentID = "00000000-0000-0000-0000-000000000000"
-	// }
 
 	const q = `
 	INSERT INTO categories
@@ -74,29 +81,55 @@ func (p Category) Create(ctx context.Context, traceID string, claims auth.Claims
 		database.Log(q, cat.ID, cat.Slug, cat.Name, cat.UserID, cat.ParentID, cat.DateCreated, cat.DateUpdated),
 	)
 
-	if _, err := p.db.ExecContext(ctx, q, cat.ID, cat.Slug, cat.Name, cat.UserID, cat.ParentID, cat.DateCreated, cat.DateUpdated); err != nil {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return Info{}, errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	if err := p.checkParent(ctx, tx, traceID, cat.ID, n.ParentID); err != nil {
+		return Info{}, err
+	}
+
+	if _, err := tx.ExecContext(ctx, q, cat.ID, cat.Slug, cat.Name, cat.UserID, cat.ParentID, cat.DateCreated, cat.DateUpdated); err != nil {
 		return Info{}, errors.Wrap(err, "inserting category")
 	}
 
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionCreate,
+		EntityType: "category",
+		EntityID:   cat.ID,
+		After:      cat,
+	}
+	if err := audit.Record(ctx, p.log, tx, traceID, ne, now); err != nil {
+		return Info{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Info{}, errors.Wrap(err, "committing category")
+	}
+
 	return cat, nil
 }
 
 // Update modifies data about a Category. It will error if the specified ID is
-// invalid or does not reference an existing Category.
+// invalid or does not reference an existing Category, or when the new parent
+// would make the category a descendant of itself.
 func (p Category) Update(ctx context.Context, traceID string, claims auth.Claims, id string, up UpdateCategory, now time.Time) error {
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.category.update")
 	defer span.End()
 
-	cat, err := p.QueryByID(ctx, traceID, id)
+	cat, err := p.QueryByID(ctx, traceID, id, "")
 	if err != nil {
 		return err
 	}
 
-	// If you are not an admin and looking to retrieve someone elses category.
-	if !claims.Authorized(auth.RoleAdmin) && cat.UserID != claims.Subject {
+	if !p.policy.AllowedFor(claims, auth.PermissionCategoryEdit, cat.UserID) {
 		return ErrForbidden
 	}
 
+	before := cat
 	if up.Slug != nil {
 		cat.Slug = *up.Slug
 	}
@@ -131,66 +164,271 @@ func (p Category) Update(ctx context.Context, traceID string, claims auth.Claims
 		database.Log(q, id, cat.Slug, cat.Name, cat.ParentID, cat.DateUpdated),
 	)
 
-	if _, err = p.db.ExecContext(ctx, q, id, cat.Slug, cat.Name, cat.ParentID, cat.DateUpdated); err != nil {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	if up.ParentID != nil {
+		if err := p.checkParent(ctx, tx, traceID, id, *up.ParentID); err != nil {
+			return err
+		}
+	}
+
+	if _, err = tx.ExecContext(ctx, q, id, cat.Slug, cat.Name, cat.ParentID, cat.DateUpdated); err != nil {
 		return errors.Wrap(err, "updating category")
 	}
 
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionUpdate,
+		EntityType: "category",
+		EntityID:   id,
+		Before:     before,
+		After:      cat,
+	}
+	if err := audit.Record(ctx, p.log, tx, traceID, ne, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing category")
+	}
+
 	return nil
 }
 
-// Delete removes the category identified by a given ID.
-func (p Category) Delete(ctx context.Context, traceID string, id string) error {
+// Delete marks the category identified by a given ID as deleted. Deleted
+// categories are left out of queries, until they are restored or purged.
+// Deleting a category that does not exist is not an error.
+func (p Category) Delete(ctx context.Context, traceID string, claims auth.Claims, id string, now time.Time) error {
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.category.delete")
 	defer span.End()
 
-	if _, err := uuid.Parse(id); err != nil {
-		return ErrInvalidID
+	cat, err := p.QueryByID(ctx, traceID, id, "")
+	if err != nil {
+		if err == ErrNotFound {
+			return nil
+		}
+		return err
+	}
+
+	if !p.policy.AllowedFor(claims, auth.PermissionCategoryEdit, cat.UserID) {
+		return ErrForbidden
 	}
 
 	const q = `
-	DELETE FROM
+	UPDATE
 		categories
+	SET
+		"deleted_at" = $2
 	WHERE
-		category_id = $1`
+		category_id = $1 AND deleted_at IS NULL`
+
+	deleted := now.UTC()
 
 	p.log.Printf("%s: %s: %s", traceID, "category.Delete",
-		database.Log(q, id),
+		database.Log(q, id, deleted),
 	)
 
-	if _, err := p.db.ExecContext(ctx, q, id); err != nil {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, q, id, deleted); err != nil {
 		return errors.Wrapf(err, "deleting category %s", id)
 	}
 
+	after := cat
+	after.DeletedAt = &deleted
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionDelete,
+		EntityType: "category",
+		EntityID:   id,
+		Before:     cat,
+		After:      after,
+	}
+	if err := audit.Record(ctx, p.log, tx, traceID, ne, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing category")
+	}
+
 	return nil
 }
 
-// Query gets all Categories from the database.
-func (p Category) Query(ctx context.Context, traceID string, pageNumber int, rowsPerPage int) ([]Info, error) {
-	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.category.query")
+// Restore undoes the deletion of a Category.
+func (p Category) Restore(ctx context.Context, traceID string, claims auth.Claims, id string, now time.Time) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.category.restore")
 	defer span.End()
 
-	const q = `
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrInvalidID
+	}
+
+	if !p.policy.Allowed(claims, auth.PermissionRecordRestore) {
+		return ErrForbidden
+	}
+
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	q := `
 	SELECT
 		*
 	FROM
 		categories
+	WHERE
+		category_id = $1 AND deleted_at IS NOT NULL
+	FOR UPDATE`
+
+	p.log.Printf("%s: %s: %s", traceID, "category.Restore",
+		database.Log(q, id),
+	)
+
+	var cat Info
+	if err := tx.GetContext(ctx, &cat, q, id); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return errors.Wrapf(err, "selecting deleted category %q", id)
+	}
+
+	q = `
+	UPDATE
+		categories
+	SET
+		"deleted_at" = NULL,
+		"date_updated" = $2
+	WHERE
+		category_id = $1`
+
+	p.log.Printf("%s: %s: %s", traceID, "category.Restore",
+		database.Log(q, id, now.UTC()),
+	)
+
+	if _, err := tx.ExecContext(ctx, q, id, now.UTC()); err != nil {
+		return errors.Wrapf(err, "restoring category %s", id)
+	}
+
+	after := cat
+	after.DeletedAt = nil
+	after.DateUpdated = now.UTC()
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionRestore,
+		EntityType: "category",
+		EntityID:   id,
+		Before:     cat,
+		After:      after,
+	}
+	if err := audit.Record(ctx, p.log, tx, traceID, ne, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing category")
+	}
+
+	return nil
+}
+
+// Purge permanently removes the categories deleted before the specified time,
+// along with their translations. It returns the number of categories removed.
+func (p Category) Purge(ctx context.Context, traceID string, before time.Time) (int, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.category.purge")
+	defer span.End()
+
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	q := `
+	DELETE FROM
+		translations AS tr
+	USING
+		categories AS c
+	WHERE
+		tr.entity_type = 'category' AND tr.entity_id = c.category_id::TEXT AND c.deleted_at < $1`
+
+	p.log.Printf("%s: %s: %s", traceID, "category.Purge",
+		database.Log(q, before.UTC()),
+	)
+
+	if _, err := tx.ExecContext(ctx, q, before.UTC()); err != nil {
+		return 0, errors.Wrap(err, "purging category translations")
+	}
+
+	q = `
+	DELETE FROM
+		categories
+	WHERE
+		deleted_at < $1`
+
+	p.log.Printf("%s: %s: %s", traceID, "category.Purge",
+		database.Log(q, before.UTC()),
+	)
+
+	res, err := tx.ExecContext(ctx, q, before.UTC())
+	if err != nil {
+		return 0, errors.Wrap(err, "purging categories")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "purging categories")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, errors.Wrap(err, "committing purge")
+	}
+
+	return int(n), nil
+}
+
+// Query gets all Categories from the database with their names in the
+// specified language. Categories without a translation keep their own name.
+func (p Category) Query(ctx context.Context, traceID string, pageNumber int, rowsPerPage int, lang string) ([]Info, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.category.query")
+	defer span.End()
+
+	const q = `
+	SELECT` + columns + `
+	FROM
+		categories AS c
+	LEFT JOIN
+		translations AS tr ON tr.entity_type = 'category' AND tr.entity_id = c.category_id::TEXT AND tr.language = $3 AND tr.field = 'name'
+	WHERE
+		c.deleted_at IS NULL
 	OFFSET $1 ROWS FETCH NEXT $2 ROWS ONLY`
 	offset := (pageNumber - 1) * rowsPerPage
 
 	p.log.Printf("%s: %s: %s", traceID, "category.Query",
-		database.Log(q, offset, rowsPerPage),
+		database.Log(q, offset, rowsPerPage, lang),
 	)
 
 	categories := []Info{}
-	if err := p.db.SelectContext(ctx, &categories, q, offset, rowsPerPage); err != nil {
+	if err := p.db.SelectContext(ctx, &categories, q, offset, rowsPerPage, lang); err != nil {
 		return nil, errors.Wrap(err, "selecting categories")
 	}
 
 	return categories, nil
 }
 
-// QueryByID finds the category identified by a given ID.
-func (p Category) QueryByID(ctx context.Context, traceID string, id string) (Info, error) {
+// QueryByID finds the category identified by a given ID with its name in the
+// specified language. An empty language gets the name as it is stored.
+func (p Category) QueryByID(ctx context.Context, traceID string, id string, lang string) (Info, error) {
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.category.querybyid")
 	defer span.End()
 
@@ -199,21 +437,20 @@ func (p Category) QueryByID(ctx context.Context, traceID string, id string) (Inf
 	}
 
 	const q = `
-	SELECT
-		*
+	SELECT` + columns + `
 	FROM
-		categories
+		categories AS c
+	LEFT JOIN
+		translations AS tr ON tr.entity_type = 'category' AND tr.entity_id = c.category_id::TEXT AND tr.language = $2 AND tr.field = 'name'
 	WHERE
-		category_id = $1
-	GROUP BY
-		category_id`
+		c.category_id = $1 AND c.deleted_at IS NULL`
 
 	p.log.Printf("%s: %s: %s", traceID, "category.QueryByID",
-		database.Log(q, id),
+		database.Log(q, id, lang),
 	)
 
 	var cat Info
-	if err := p.db.GetContext(ctx, &cat, q, id); err != nil {
+	if err := p.db.GetContext(ctx, &cat, q, id, lang); err != nil {
 		if err == sql.ErrNoRows {
 			return Info{}, ErrNotFound
 		}
@@ -222,3 +459,35 @@ func (p Category) QueryByID(ctx context.Context, traceID string, id string) (Inf
 
 	return cat, nil
 }
+
+// QueryByUser gets all categories created by the user identified by a given
+// ID, including deleted ones.
+func (p Category) QueryByUser(ctx context.Context, traceID string, userID string) ([]Info, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.category.querybyuser")
+	defer span.End()
+
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	const q = `
+	SELECT
+		*
+	FROM
+		categories
+	WHERE
+		user_id = $1
+	ORDER BY
+		slug`
+
+	p.log.Printf("%s: %s: %s", traceID, "category.QueryByUser",
+		database.Log(q, userID),
+	)
+
+	categories := []Info{}
+	if err := p.db.SelectContext(ctx, &categories, q, userID); err != nil {
+		return nil, errors.Wrapf(err, "selecting categories of user %q", userID)
+	}
+
+	return categories, nil
+}
@@ -18,7 +18,7 @@ func TestCategory(t *testing.T) {
 	log, db, teardown := tests.NewUnit(t)
 	t.Cleanup(teardown)
 
-	p := category.New(log, db)
+	p := category.New(log, db, tests.Policy())
 
 	t.Log("Given the need to work with Category records.")
 	{
@@ -51,7 +51,7 @@ func TestCategory(t *testing.T) {
 			}
 			t.Logf("\t%s\tTest %d:\tShould be able to create a category.", tests.Success, testID)
 
-			saved, err := p.QueryByID(ctx, traceID, cat.ID)
+			saved, err := p.QueryByID(ctx, traceID, cat.ID, "en")
 			if err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve category by ID: %s.", tests.Failed, testID, err)
 			}
@@ -88,7 +88,7 @@ func TestCategory(t *testing.T) {
 			}
 			t.Logf("\t%s\tTest %d:\tShould be able to update category.", tests.Success, testID)
 
-			categories, err := p.Query(ctx, traceID, 2, 1)
+			categories, err := p.Query(ctx, traceID, 2, 1, "en")
 			if err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve updated category : %s.", tests.Failed, testID, err)
 			}
@@ -115,7 +115,7 @@ func TestCategory(t *testing.T) {
 			}
 			t.Logf("\t%s\tTest %d:\tShould be able to update just some fields of category.", tests.Success, testID)
 
-			saved, err = p.QueryByID(ctx, traceID, cat.ID)
+			saved, err = p.QueryByID(ctx, traceID, cat.ID, "en")
 			if err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve updated category : %s.", tests.Failed, testID, err)
 			}
@@ -127,12 +127,20 @@ func TestCategory(t *testing.T) {
 				t.Logf("\t%s\tTest %d:\tShould be able to see updated Name field.", tests.Success, testID)
 			}
 
-			if err := p.Delete(ctx, traceID, cat.ID); err != nil {
+			otherClaims := claims
+			otherClaims.Subject = "2ab4d7c1-9e3f-4a5b-8c6d-7e8f9a0b1c2d"
+			otherClaims.Roles = []string{auth.RoleUser}
+			if err := p.Delete(ctx, traceID, otherClaims, cat.ID, now); errors.Cause(err) != category.ErrForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to delete the category of another user : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to delete the category of another user.", tests.Success, testID)
+
+			if err := p.Delete(ctx, traceID, claims, cat.ID, now); err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to delete category : %s.", tests.Failed, testID, err)
 			}
 			t.Logf("\t%s\tTest %d:\tShould be able to delete category.", tests.Success, testID)
 
-			_, err = p.QueryByID(ctx, traceID, cat.ID)
+			_, err = p.QueryByID(ctx, traceID, cat.ID, "en")
 			if errors.Cause(err) != category.ErrNotFound {
 				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to retrieve deleted category : %s.", tests.Failed, testID, err)
 			}
@@ -140,3 +148,235 @@ func TestCategory(t *testing.T) {
 		}
 	}
 }
+
+func TestCategoryTree(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	c := category.New(log, db, tests.Policy())
+
+	t.Log("Given the need to arrange categories in a tree.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen handling nested categories.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			claims := auth.Claims{
+				StandardClaims: jwt.StandardClaims{
+					Issuer:    "MB Appiness Solutions",
+					Subject:   "718ffbea-f4a1-4667-8ae3-b349da52675e",
+					Audience:  "users",
+					ExpiresAt: now.Add(time.Hour).Unix(),
+					IssuedAt:  now.Unix(),
+				},
+				Roles: []string{auth.RoleAdmin, auth.RoleUser},
+			}
+
+			create := func(slug string, parentID string) category.Info {
+				t.Helper()
+				cat, err := c.Create(ctx, traceID, claims, category.NewCategory{Slug: slug, Name: slug, ParentID: parentID}, now)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to create category %s : %s.", tests.Failed, testID, slug, err)
+				}
+				return cat
+			}
+
+			// legal
+			// ├── contracts
+			// │   └── leases
+			// └── tax
+			// finance
+			legal := create("legal", "")
+			contracts := create("contracts", legal.ID)
+			leases := create("leases", contracts.ID)
+			tax := create("tax", legal.ID)
+			finance := create("finance", "")
+			t.Logf("\t%s\tTest %d:\tShould be able to create nested categories.", tests.Success, testID)
+
+			if _, err := c.Create(ctx, traceID, claims, category.NewCategory{Slug: "orphan", Name: "orphan", ParentID: "d9e5a1e0-5a4e-4c5b-8f3a-0c6b6c1f0e2d"}, now); errors.Cause(err) != category.ErrParentNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to create a category below an unknown parent : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to create a category below an unknown parent.", tests.Success, testID)
+
+			ids := func(nodes []category.Node) []string {
+				s := []string{}
+				for _, n := range nodes {
+					s = append(s, n.Slug)
+				}
+				return s
+			}
+
+			tree, err := c.QueryTree(ctx, traceID, "en")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve the tree : %s.", tests.Failed, testID, err)
+			}
+			if diff := cmp.Diff([]string{"finance", "legal"}, ids(tree)); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get the top categories by name. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			if diff := cmp.Diff([]string{"contracts", "tax"}, ids(tree[1].Children)); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get the subcategories by name. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			if diff := cmp.Diff([]string{"leases"}, ids(tree[1].Children[0].Children)); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get nested subcategories. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to retrieve the tree.", tests.Success, testID)
+
+			sub, err := c.QuerySubtree(ctx, traceID, contracts.ID, "en")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve a subtree : %s.", tests.Failed, testID, err)
+			}
+			if sub.ID != contracts.ID || len(sub.Children) != 1 || sub.Children[0].ID != leases.ID {
+				t.Fatalf("\t%s\tTest %d:\tShould get the category with its subcategories : %+v.", tests.Failed, testID, sub)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to retrieve a subtree.", tests.Success, testID)
+
+			crumbs, err := c.QueryBreadcrumbs(ctx, traceID, leases.ID, "en")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve breadcrumbs : %s.", tests.Failed, testID, err)
+			}
+			var path []string
+			for _, cat := range crumbs {
+				path = append(path, cat.Slug)
+			}
+			if diff := cmp.Diff([]string{"legal", "contracts", "leases"}, path); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get the path from the top. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to retrieve breadcrumbs.", tests.Success, testID)
+
+			children, err := c.QueryChildren(ctx, traceID, legal.ID, "en")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve children : %s.", tests.Failed, testID, err)
+			}
+			if len(children) != 2 || children[0].ID != contracts.ID || children[1].ID != tax.ID {
+				t.Fatalf("\t%s\tTest %d:\tShould get the direct children by name : %+v.", tests.Failed, testID, children)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to retrieve children.", tests.Success, testID)
+
+			if err := c.Move(ctx, traceID, claims, legal.ID, legal.ID, now); errors.Cause(err) != category.ErrSelfParent {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to make a category its own parent : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to make a category its own parent.", tests.Success, testID)
+
+			if err := c.Move(ctx, traceID, claims, legal.ID, leases.ID, now); errors.Cause(err) != category.ErrCycle {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to move a category below its descendants : %s.", tests.Failed, testID, err)
+			}
+			upd := category.UpdateCategory{ParentID: tests.StringPointer(contracts.ID)}
+			if err := c.Update(ctx, traceID, claims, legal.ID, upd, now); errors.Cause(err) != category.ErrCycle {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to update a category below its descendants : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to create cycles.", tests.Success, testID)
+
+			if err := c.Move(ctx, traceID, claims, contracts.ID, finance.ID, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to move a subtree : %s.", tests.Failed, testID, err)
+			}
+			crumbs, err = c.QueryBreadcrumbs(ctx, traceID, leases.ID, "en")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve breadcrumbs : %s.", tests.Failed, testID, err)
+			}
+			if len(crumbs) != 3 || crumbs[0].ID != finance.ID {
+				t.Fatalf("\t%s\tTest %d:\tShould move the subcategories along : %+v.", tests.Failed, testID, crumbs)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to move a subtree.", tests.Success, testID)
+
+			if err := c.Move(ctx, traceID, claims, contracts.ID, "", now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to move a subtree to the top : %s.", tests.Failed, testID, err)
+			}
+			moved, err := c.QueryByID(ctx, traceID, contracts.ID, "en")
+			if err != nil || moved.ParentID != (sql.NullString{}) {
+				t.Fatalf("\t%s\tTest %d:\tShould have no parent after moving to the top : %+v, %v.", tests.Failed, testID, moved.ParentID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to move a subtree to the top.", tests.Success, testID)
+		}
+	}
+}
+
+func TestCategoryTranslation(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	c := category.New(log, db, tests.Policy())
+
+	t.Log("Given the need to name categories in several languages.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen translating a Category.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			claims := auth.Claims{
+				StandardClaims: jwt.StandardClaims{
+					Issuer:    "MB Appiness Solutions",
+					Subject:   "718ffbea-f4a1-4667-8ae3-b349da52675e",
+					Audience:  "users",
+					ExpiresAt: now.Add(time.Hour).Unix(),
+					IssuedAt:  now.Unix(),
+				},
+				Roles: []string{auth.RoleUser},
+			}
+
+			cat, err := c.Create(ctx, traceID, claims, category.NewCategory{Slug: "tax", Name: "Tax advice"}, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a category : %s.", tests.Failed, testID, err)
+			}
+
+			if err := c.SetTranslation(ctx, traceID, claims, cat.ID, "dutch", category.NewTranslation{Name: "Belastingadvies"}, now); errors.Cause(err) != category.ErrInvalidLanguage {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to translate into an invalid language : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to translate into an invalid language.", tests.Success, testID)
+
+			other := claims
+			other.Subject = "45b5fbd3-755f-4379-8f07-a58d4a30fa2f"
+			if err := c.SetTranslation(ctx, traceID, other, cat.ID, "nl", category.NewTranslation{Name: "Belastingadvies"}, now); errors.Cause(err) != category.ErrForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to translate the category of another user : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to translate the category of another user.", tests.Success, testID)
+
+			for lang, name := range map[string]string{"NL": "Belastingadvies", "de": "Steuerberatung"} {
+				if err := c.SetTranslation(ctx, traceID, claims, cat.ID, lang, category.NewTranslation{Name: name}, now); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to translate the category into %q : %s.", tests.Failed, testID, lang, err)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to translate the category.", tests.Success, testID)
+
+			trs, err := c.QueryTranslations(ctx, traceID, cat.ID)
+			if err != nil || len(trs) != 2 || trs[0].Language != "de" || trs[1].Language != "nl" {
+				t.Fatalf("\t%s\tTest %d:\tShould get the translations by language : %+v, %v.", tests.Failed, testID, trs, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the translations by language.", tests.Success, testID)
+
+			for lang, want := range map[string]string{"nl": "Belastingadvies", "fr": "Tax advice", "": "Tax advice"} {
+				saved, err := c.QueryByID(ctx, traceID, cat.ID, lang)
+				if err != nil || saved.Name != want {
+					t.Fatalf("\t%s\tTest %d:\tShould get %q for language %q : %q, %v.", tests.Failed, testID, want, lang, saved.Name, err)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the name in the language asked for, falling back to its own name.", tests.Success, testID)
+
+			if err := c.DeleteTranslation(ctx, traceID, claims, cat.ID, "nl", now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to delete a translation : %s.", tests.Failed, testID, err)
+			}
+			saved, err := c.QueryByID(ctx, traceID, cat.ID, "nl")
+			if err != nil || saved.Name != cat.Name {
+				t.Fatalf("\t%s\tTest %d:\tShould get its own name after deleting the translation : %q, %v.", tests.Failed, testID, saved.Name, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to delete a translation.", tests.Success, testID)
+
+			if err := c.Delete(ctx, traceID, claims, cat.ID, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to delete the category : %s.", tests.Failed, testID, err)
+			}
+			if _, err := c.Purge(ctx, traceID, now.Add(time.Second)); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to purge the category : %s.", tests.Failed, testID, err)
+			}
+			var n int
+			if err := db.GetContext(ctx, &n, `SELECT count(*) FROM translations WHERE entity_id = $1`, cat.ID); err != nil || n != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould purge the translations along with the category : %d, %v.", tests.Failed, testID, n, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould purge the translations along with the category.", tests.Success, testID)
+		}
+	}
+}
@@ -7,13 +7,14 @@ import (
 
 // Info represents an individual category.
 type Info struct {
-	ID          string         `db:"category_id" json:"id"`                // Unique identifier.
-	Slug        string         `db:"slug" json:"slug"`                     // Unique category name
-	Name        string         `db:"name" json:"name"`                     // Display name of the category.
-	UserID      string         `db:"user_id" json:"user_id"`               // User ID of the category owner.
-	ParentID    sql.NullString `db:"parent_id" json:"parent_id,omitempty"` // Parent category ID.
-	DateCreated time.Time      `db:"date_created" json:"date_created"`     // When the category was added.
-	DateUpdated time.Time      `db:"date_updated" json:"date_updated"`     // When the category record was last modified.
+	ID          string         `db:"category_id" json:"id"`                  // Unique identifier.
+	Slug        string         `db:"slug" json:"slug"`                       // Unique category name
+	Name        string         `db:"name" json:"name"`                       // Display name of the category.
+	UserID      string         `db:"user_id" json:"user_id"`                 // User ID of the category owner.
+	ParentID    sql.NullString `db:"parent_id" json:"parent_id,omitempty"`   // Parent category ID.
+	DateCreated time.Time      `db:"date_created" json:"date_created"`       // When the category was added.
+	DateUpdated time.Time      `db:"date_updated" json:"date_updated"`       // When the category record was last modified.
+	DeletedAt   *time.Time     `db:"deleted_at" json:"deleted_at,omitempty"` // When the category was deleted, until it is purged.
 }
 
 // NewCategory is what we require from clients when adding a Category.
@@ -34,3 +35,23 @@ type UpdateCategory struct {
 	Name     *string `json:"name"`      // Display name of the category.
 	ParentID *string `json:"parent_id"` // Parent category ID.
 }
+
+// MoveCategory defines where to place a Category in the tree. An empty parent
+// ID places it at the top.
+type MoveCategory struct {
+	ParentID string `json:"parent_id" validate:"omitempty,uuid"` // ID of the new parent category.
+}
+
+// Translation represents the name of a Category in a particular language.
+type Translation struct {
+	Language    string    `db:"language" json:"language"`         // ISO 639-1 code of the language.
+	Name        string    `db:"value" json:"name"`                // Name of the category in the language.
+	DateCreated time.Time `db:"date_created" json:"date_created"` // When the translation was added.
+	DateUpdated time.Time `db:"date_updated" json:"date_updated"` // When the translation was last modified.
+}
+
+// NewTranslation is what we require from clients when translating the name of
+// a Category.
+type NewTranslation struct {
+	Name string `json:"name" validate:"required"` // Name of the category in the language.
+}
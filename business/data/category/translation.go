@@ -0,0 +1,225 @@
+package category
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/audit"
+	"github.com/appinesshq/bpi/foundation/database"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+// ErrInvalidLanguage occurs when a language is not a two letter ISO 639-1 code.
+var ErrInvalidLanguage = errors.New("language is not in its proper form")
+
+// SetTranslation sets the name of the category identified by a given ID in a
+// language, replacing an earlier translation.
+func (p Category) SetTranslation(ctx context.Context, traceID string, claims auth.Claims, id string, lang string, nt NewTranslation, now time.Time) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.category.settranslation")
+	defer span.End()
+
+	lang = strings.ToLower(lang)
+	if !validLanguage(lang) {
+		return ErrInvalidLanguage
+	}
+
+	cat, err := p.QueryByID(ctx, traceID, id, "")
+	if err != nil {
+		return err
+	}
+
+	if !p.policy.AllowedFor(claims, auth.PermissionCategoryEdit, cat.UserID) {
+		return ErrForbidden
+	}
+	id = cat.ID
+
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	q := `
+	SELECT
+		language, value, date_created, date_updated
+	FROM
+		translations
+	WHERE
+		entity_type = 'category' AND entity_id = $1 AND language = $2 AND field = 'name'
+	FOR UPDATE`
+
+	p.log.Printf("%s: %s: %s", traceID, "category.SetTranslation",
+		database.Log(q, id, lang),
+	)
+
+	var before *Translation
+	var tr Translation
+	switch err := tx.GetContext(ctx, &tr, q, id, lang); err {
+	case nil:
+		before = &tr
+	case sql.ErrNoRows:
+	default:
+		return errors.Wrapf(err, "selecting translation %q of category %q", lang, id)
+	}
+
+	after := Translation{
+		Language:    lang,
+		Name:        nt.Name,
+		DateCreated: now.UTC(),
+		DateUpdated: now.UTC(),
+	}
+	if before != nil {
+		after.DateCreated = before.DateCreated
+	}
+
+	q = `
+	INSERT INTO translations
+		(entity_type, entity_id, language, field, value, date_created, date_updated)
+	VALUES
+		('category', $1, $2, 'name', $3, $4, $4)
+	ON CONFLICT (entity_type, entity_id, language, field) DO UPDATE SET
+		value = EXCLUDED.value,
+		date_updated = EXCLUDED.date_updated`
+
+	p.log.Printf("%s: %s: %s", traceID, "category.SetTranslation",
+		database.Log(q, id, lang, nt.Name, now.UTC()),
+	)
+
+	if _, err := tx.ExecContext(ctx, q, id, lang, nt.Name, now.UTC()); err != nil {
+		return errors.Wrap(err, "setting translation")
+	}
+
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionUpdate,
+		EntityType: "category_translation",
+		EntityID:   id + "/" + lang,
+		Before:     before,
+		After:      after,
+	}
+	if err := audit.Record(ctx, p.log, tx, traceID, ne, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing translation")
+	}
+
+	return nil
+}
+
+// DeleteTranslation removes the name of the category identified by a given ID
+// in a language. Deleting a translation that doesn't exist is not an error.
+func (p Category) DeleteTranslation(ctx context.Context, traceID string, claims auth.Claims, id string, lang string, now time.Time) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.category.deletetranslation")
+	defer span.End()
+
+	lang = strings.ToLower(lang)
+	if !validLanguage(lang) {
+		return ErrInvalidLanguage
+	}
+
+	cat, err := p.QueryByID(ctx, traceID, id, "")
+	if err != nil {
+		return err
+	}
+
+	if !p.policy.AllowedFor(claims, auth.PermissionCategoryEdit, cat.UserID) {
+		return ErrForbidden
+	}
+	id = cat.ID
+
+	const q = `
+	DELETE FROM
+		translations
+	WHERE
+		entity_type = 'category' AND entity_id = $1 AND language = $2 AND field = 'name'
+	RETURNING
+		language, value, date_created, date_updated`
+
+	p.log.Printf("%s: %s: %s", traceID, "category.DeleteTranslation",
+		database.Log(q, id, lang),
+	)
+
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	var tr Translation
+	if err := tx.GetContext(ctx, &tr, q, id, lang); err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return errors.Wrapf(err, "deleting translation %q of category %q", lang, id)
+	}
+
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionDelete,
+		EntityType: "category_translation",
+		EntityID:   id + "/" + lang,
+		Before:     tr,
+	}
+	if err := audit.Record(ctx, p.log, tx, traceID, ne, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing translation")
+	}
+
+	return nil
+}
+
+// QueryTranslations gets the names of the category identified by a given ID in
+// all the languages it is translated into, ordered by language.
+func (p Category) QueryTranslations(ctx context.Context, traceID string, id string) ([]Translation, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.category.querytranslations")
+	defer span.End()
+
+	cat, err := p.QueryByID(ctx, traceID, id, "")
+	if err != nil {
+		return nil, err
+	}
+	id = cat.ID
+
+	const q = `
+	SELECT
+		language, value, date_created, date_updated
+	FROM
+		translations
+	WHERE
+		entity_type = 'category' AND entity_id = $1 AND field = 'name'
+	ORDER BY
+		language`
+
+	p.log.Printf("%s: %s: %s", traceID, "category.QueryTranslations",
+		database.Log(q, id),
+	)
+
+	trs := []Translation{}
+	if err := p.db.SelectContext(ctx, &trs, q, id); err != nil {
+		return nil, errors.Wrapf(err, "selecting translations of category %q", id)
+	}
+
+	return trs, nil
+}
+
+// validLanguage reports whether lang is a lower case two letter ISO 639-1 code.
+func validLanguage(lang string) bool {
+	if len(lang) != 2 {
+		return false
+	}
+	for _, r := range lang {
+		if r < 'a' || r > 'z' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,387 @@
+package category
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/audit"
+	"github.com/appinesshq/bpi/foundation/database"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+var (
+	// ErrParentNotFound occurs when a category is placed below a category that
+	// does not exist.
+	ErrParentNotFound = errors.New("parent category not found")
+
+	// ErrSelfParent occurs when a category is placed below itself.
+	ErrSelfParent = errors.New("category can't be its own parent")
+
+	// ErrCycle occurs when a category is placed below one of its descendants.
+	ErrCycle = errors.New("category can't be placed below its descendants")
+)
+
+// treeLock is the advisory lock held by transactions changing the tree, so
+// concurrent moves can't create a cycle together.
+const treeLock = 7190419
+
+// Node represents a category along with its subcategories.
+type Node struct {
+	Info
+	Children []Node `json:"children"` // Subcategories ordered by name.
+}
+
+// Move places the category identified by a given ID, along with its
+// subcategories, below another category. An empty parent ID moves it to the
+// top of the tree.
+func (p Category) Move(ctx context.Context, traceID string, claims auth.Claims, id string, parentID string, now time.Time) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.category.move")
+	defer span.End()
+
+	cat, err := p.QueryByID(ctx, traceID, id, "")
+	if err != nil {
+		return err
+	}
+
+	if !p.policy.AllowedFor(claims, auth.PermissionCategoryEdit, cat.UserID) {
+		return ErrForbidden
+	}
+
+	before := cat
+	cat.ParentID = sql.NullString{String: parentID, Valid: parentID != ""}
+	cat.DateUpdated = now
+
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	if err := p.checkParent(ctx, tx, traceID, id, parentID); err != nil {
+		return err
+	}
+
+	const q = `
+	UPDATE
+		categories
+	SET
+		"parent_id" = $2,
+		"date_updated" = $3
+	WHERE
+		category_id = $1`
+
+	p.log.Printf("%s: %s: %s", traceID, "category.Move",
+		database.Log(q, id, cat.ParentID, cat.DateUpdated),
+	)
+
+	if _, err := tx.ExecContext(ctx, q, id, cat.ParentID, cat.DateUpdated); err != nil {
+		return errors.Wrapf(err, "moving category %s", id)
+	}
+
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionUpdate,
+		EntityType: "category",
+		EntityID:   id,
+		Before:     before,
+		After:      cat,
+	}
+	if err := audit.Record(ctx, p.log, tx, traceID, ne, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing category")
+	}
+
+	return nil
+}
+
+// QueryTree gets all categories arranged below their parents, starting with
+// the categories at the top of the tree. Deleted categories are left out along
+// with their subcategories. Names are in the specified language.
+func (p Category) QueryTree(ctx context.Context, traceID string, lang string) ([]Node, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.category.querytree")
+	defer span.End()
+
+	const q = `
+	WITH RECURSIVE tree (category_id, depth, path) AS (
+		SELECT
+			category_id, 0, ARRAY[category_id]
+		FROM
+			categories
+		WHERE
+			parent_id IS NULL AND deleted_at IS NULL
+		UNION ALL
+		SELECT
+			c.category_id, t.depth + 1, t.path || c.category_id
+		FROM
+			categories AS c
+		JOIN
+			tree AS t ON c.parent_id = t.category_id
+		WHERE
+			c.deleted_at IS NULL AND NOT c.category_id = ANY(t.path)
+	)
+	SELECT` + columns + `
+	FROM
+		tree AS t
+	JOIN
+		categories AS c ON c.category_id = t.category_id
+	LEFT JOIN
+		translations AS tr ON tr.entity_type = 'category' AND tr.entity_id = c.category_id::TEXT AND tr.language = $1 AND tr.field = 'name'
+	ORDER BY
+		t.depth, name, c.category_id`
+
+	p.log.Printf("%s: %s: %s", traceID, "category.QueryTree",
+		database.Log(q, lang),
+	)
+
+	cats := []Info{}
+	if err := p.db.SelectContext(ctx, &cats, q, lang); err != nil {
+		return nil, errors.Wrap(err, "selecting category tree")
+	}
+
+	return arrange(cats, ""), nil
+}
+
+// QuerySubtree gets the category identified by a given ID with all its
+// subcategories arranged below it. Names are in the specified language.
+func (p Category) QuerySubtree(ctx context.Context, traceID string, id string, lang string) (Node, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.category.querysubtree")
+	defer span.End()
+
+	if _, err := uuid.Parse(id); err != nil {
+		return Node{}, ErrInvalidID
+	}
+
+	const q = `
+	WITH RECURSIVE tree (category_id, depth, path) AS (
+		SELECT
+			category_id, 0, ARRAY[category_id]
+		FROM
+			categories
+		WHERE
+			category_id = $1 AND deleted_at IS NULL
+		UNION ALL
+		SELECT
+			c.category_id, t.depth + 1, t.path || c.category_id
+		FROM
+			categories AS c
+		JOIN
+			tree AS t ON c.parent_id = t.category_id
+		WHERE
+			c.deleted_at IS NULL AND NOT c.category_id = ANY(t.path)
+	)
+	SELECT` + columns + `
+	FROM
+		tree AS t
+	JOIN
+		categories AS c ON c.category_id = t.category_id
+	LEFT JOIN
+		translations AS tr ON tr.entity_type = 'category' AND tr.entity_id = c.category_id::TEXT AND tr.language = $2 AND tr.field = 'name'
+	ORDER BY
+		t.depth, name, c.category_id`
+
+	p.log.Printf("%s: %s: %s", traceID, "category.QuerySubtree",
+		database.Log(q, id, lang),
+	)
+
+	cats := []Info{}
+	if err := p.db.SelectContext(ctx, &cats, q, id, lang); err != nil {
+		return Node{}, errors.Wrapf(err, "selecting subtree of category %q", id)
+	}
+	if len(cats) == 0 {
+		return Node{}, ErrNotFound
+	}
+
+	// The category itself comes first, its parent is not part of the subtree.
+	root := Node{Info: cats[0]}
+	root.Children = arrange(cats[1:], root.ID)
+
+	return root, nil
+}
+
+// QueryBreadcrumbs gets the path from the top of the tree to the category
+// identified by a given ID, ending with the category itself. Names are in the
+// specified language.
+func (p Category) QueryBreadcrumbs(ctx context.Context, traceID string, id string, lang string) ([]Info, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.category.querybreadcrumbs")
+	defer span.End()
+
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	const q = `
+	WITH RECURSIVE crumbs (category_id, parent_id, depth, path) AS (
+		SELECT
+			category_id, parent_id, 0, ARRAY[category_id]
+		FROM
+			categories
+		WHERE
+			category_id = $1 AND deleted_at IS NULL
+		UNION ALL
+		SELECT
+			c.category_id, c.parent_id, b.depth + 1, b.path || c.category_id
+		FROM
+			categories AS c
+		JOIN
+			crumbs AS b ON c.category_id = b.parent_id
+		WHERE
+			c.deleted_at IS NULL AND NOT c.category_id = ANY(b.path)
+	)
+	SELECT` + columns + `
+	FROM
+		crumbs AS b
+	JOIN
+		categories AS c ON c.category_id = b.category_id
+	LEFT JOIN
+		translations AS tr ON tr.entity_type = 'category' AND tr.entity_id = c.category_id::TEXT AND tr.language = $2 AND tr.field = 'name'
+	ORDER BY
+		b.depth DESC`
+
+	p.log.Printf("%s: %s: %s", traceID, "category.QueryBreadcrumbs",
+		database.Log(q, id, lang),
+	)
+
+	cats := []Info{}
+	if err := p.db.SelectContext(ctx, &cats, q, id, lang); err != nil {
+		return nil, errors.Wrapf(err, "selecting breadcrumbs of category %q", id)
+	}
+	if len(cats) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return cats, nil
+}
+
+// QueryChildren gets the categories directly below the category identified by
+// a given ID, ordered by their name in the specified language.
+func (p Category) QueryChildren(ctx context.Context, traceID string, id string, lang string) ([]Info, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.category.querychildren")
+	defer span.End()
+
+	if _, err := p.QueryByID(ctx, traceID, id, ""); err != nil {
+		return nil, err
+	}
+
+	const q = `
+	SELECT` + columns + `
+	FROM
+		categories AS c
+	LEFT JOIN
+		translations AS tr ON tr.entity_type = 'category' AND tr.entity_id = c.category_id::TEXT AND tr.language = $2 AND tr.field = 'name'
+	WHERE
+		c.parent_id = $1 AND c.deleted_at IS NULL
+	ORDER BY
+		name, c.category_id`
+
+	p.log.Printf("%s: %s: %s", traceID, "category.QueryChildren",
+		database.Log(q, id, lang),
+	)
+
+	cats := []Info{}
+	if err := p.db.SelectContext(ctx, &cats, q, id, lang); err != nil {
+		return nil, errors.Wrapf(err, "selecting children of category %q", id)
+	}
+
+	return cats, nil
+}
+
+// checkParent verifies the category identified by a given ID can be placed
+// below the parent category. An empty parent ID places it at the top of the
+// tree. It takes the tree lock for the rest of the transaction.
+func (p Category) checkParent(ctx context.Context, tx *sqlx.Tx, traceID string, id string, parentID string) error {
+	if parentID == "" {
+		return nil
+	}
+	if _, err := uuid.Parse(parentID); err != nil {
+		return ErrInvalidID
+	}
+	if parentID == id {
+		return ErrSelfParent
+	}
+
+	q := `SELECT pg_advisory_xact_lock($1)`
+
+	p.log.Printf("%s: %s: %s", traceID, "category.checkParent",
+		database.Log(q, treeLock),
+	)
+
+	if _, err := tx.ExecContext(ctx, q, treeLock); err != nil {
+		return errors.Wrap(err, "locking category tree")
+	}
+
+	// Walk up from the parent. Finding the category itself on the way means
+	// the parent is one of its descendants.
+	q = `
+	WITH RECURSIVE ancestors (category_id, parent_id, path) AS (
+		SELECT
+			category_id, parent_id, ARRAY[category_id]
+		FROM
+			categories
+		WHERE
+			category_id = $1 AND deleted_at IS NULL
+		UNION ALL
+		SELECT
+			c.category_id, c.parent_id, a.path || c.category_id
+		FROM
+			categories AS c
+		JOIN
+			ancestors AS a ON c.category_id = a.parent_id
+		WHERE
+			NOT c.category_id = ANY(a.path)
+	)
+	SELECT
+		COUNT(*) > 0 AS found,
+		COALESCE(BOOL_OR(category_id = $2), FALSE) AS cycle
+	FROM
+		ancestors`
+
+	p.log.Printf("%s: %s: %s", traceID, "category.checkParent",
+		database.Log(q, parentID, id),
+	)
+
+	var res struct {
+		Found bool `db:"found"`
+		Cycle bool `db:"cycle"`
+	}
+	if err := tx.GetContext(ctx, &res, q, parentID, id); err != nil {
+		return errors.Wrapf(err, "selecting ancestors of category %q", parentID)
+	}
+
+	switch {
+	case !res.Found:
+		return ErrParentNotFound
+	case res.Cycle:
+		return ErrCycle
+	}
+
+	return nil
+}
+
+// arrange places the categories below their parents, returning the ones
+// directly below the provided parent. The categories are expected in the order
+// their children should be listed in.
+func arrange(cats []Info, parentID string) []Node {
+	children := make(map[string][]Info)
+	for _, c := range cats {
+		children[c.ParentID.String] = append(children[c.ParentID.String], c)
+	}
+
+	var nodes func(parentID string) []Node
+	nodes = func(parentID string) []Node {
+		n := make([]Node, 0, len(children[parentID]))
+		for _, c := range children[parentID] {
+			n = append(n, Node{Info: c, Children: nodes(c.ID)})
+		}
+		return n
+	}
+
+	return nodes(parentID)
+}
@@ -5,8 +5,10 @@ import (
 	"context"
 	"database/sql"
 	"log"
+	"time"
 
 	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/audit"
 	"github.com/appinesshq/bpi/foundation/database"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
@@ -26,25 +28,27 @@ var (
 
 // Country manages the set of API's for country access.
 type Country struct {
-	log *log.Logger
-	db  *sqlx.DB
+	log    *log.Logger
+	db     *sqlx.DB
+	policy *auth.Policy
 }
 
-// New constructs a Country for api access.
-func New(log *log.Logger, db *sqlx.DB) Country {
+// New constructs a Country for api access. The policy decides which
+// actions the claims passed to its methods allow.
+func New(log *log.Logger, db *sqlx.DB, policy *auth.Policy) Country {
 	return Country{
-		log: log,
-		db:  db,
+		log:    log,
+		db:     db,
+		policy: policy,
 	}
 }
 
 // ToggleActive toggles the activation state of  a country in the database.
-func (c Country) ToggleActive(ctx context.Context, traceID string, claims auth.Claims, countryCode string) error {
+func (c Country) ToggleActive(ctx context.Context, traceID string, claims auth.Claims, countryCode string, now time.Time) error {
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.country.activate")
 	defer span.End()
 
-	// Only admins should be able to do this.
-	if !claims.Authorized(auth.RoleAdmin) {
+	if !c.policy.Allowed(claims, auth.PermissionCountryActivate) {
 		return ErrForbidden
 	}
 
@@ -54,14 +58,21 @@ func (c Country) ToggleActive(ctx context.Context, traceID string, claims auth.C
 	FROM
 		countries
 	WHERE 
-		code = $1`
+		code = $1
+	FOR UPDATE`
 
 	c.log.Printf("%s: %s: %s", traceID, "country.ToggleActivate",
 		database.Log(q, countryCode),
 	)
 
+	tx, err := c.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
 	var country Info
-	if err := c.db.GetContext(ctx, &country, q, countryCode); err != nil {
+	if err := tx.GetContext(ctx, &country, q, countryCode); err != nil {
 		if err == sql.ErrNoRows {
 			return ErrNotFound
 		}
@@ -80,37 +91,59 @@ func (c Country) ToggleActive(ctx context.Context, traceID string, claims auth.C
 		database.Log(q, countryCode, !country.Active),
 	)
 
-	if _, err := c.db.ExecContext(ctx, q, countryCode, !country.Active); err != nil {
+	if _, err := tx.ExecContext(ctx, q, countryCode, !country.Active); err != nil {
 		return errors.Wrap(err, "updating country")
 	}
 
+	after := country
+	after.Active = !country.Active
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionToggleActive,
+		EntityType: "country",
+		EntityID:   countryCode,
+		Before:     country,
+		After:      after,
+	}
+	if err := audit.Record(ctx, c.log, tx, traceID, ne, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing country")
+	}
+
 	return nil
 }
 
-// Query retrieves a list of active countries from the database.
-func (c Country) Query(ctx context.Context, traceID string, pageNumber int, rowsPerPage int) ([]Info, error) {
+// Query retrieves a list of active countries from the database with their
+// names in the specified language. Countries without a translation keep their
+// English name.
+func (c Country) Query(ctx context.Context, traceID string, pageNumber int, rowsPerPage int, lang string) ([]Info, error) {
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.country.query")
 	defer span.End()
 
 	const q = `
 	SELECT
-		*
+		c.code, c.gnid, COALESCE(t.value, c.name) AS name, c.currency_code, c.currency_name, c.active
 	FROM
-		countries
+		countries AS c
+	LEFT JOIN
+		translations AS t ON t.entity_type = 'country' AND t.entity_id = c.code AND t.language = $3 AND t.field = 'name'
 	WHERE 
-		active
+		c.active
 	ORDER BY
-		code
+		c.code
 	OFFSET $1 ROWS FETCH NEXT $2 ROWS ONLY`
 
 	offset := (pageNumber - 1) * rowsPerPage
 
 	c.log.Printf("%s: %s: %s", traceID, "country.Query",
-		database.Log(q, offset, rowsPerPage),
+		database.Log(q, offset, rowsPerPage, lang),
 	)
 
 	countries := []Info{}
-	if err := c.db.SelectContext(ctx, &countries, q, offset, rowsPerPage); err != nil {
+	if err := c.db.SelectContext(ctx, &countries, q, offset, rowsPerPage, lang); err != nil {
 		return nil, errors.Wrap(err, "selecting countries")
 	}
 
@@ -145,8 +178,9 @@ func (c Country) Query(ctx context.Context, traceID string, pageNumber int, rows
 // 	return country, nil
 // }
 
-// QueryByCode gets the specified country from the database.
-func (c Country) QueryByCode(ctx context.Context, traceID string, claims auth.Claims, countryCode string) (Info, error) {
+// QueryByCode gets the specified country from the database with its name in
+// the specified language.
+func (c Country) QueryByCode(ctx context.Context, traceID string, claims auth.Claims, countryCode string, lang string) (Info, error) {
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.country.querybycode")
 	defer span.End()
 
@@ -157,18 +191,20 @@ func (c Country) QueryByCode(ctx context.Context, traceID string, claims auth.Cl
 
 	const q = `
 	SELECT
-		*
+		c.code, c.gnid, COALESCE(t.value, c.name) AS name, c.currency_code, c.currency_name, c.active
 	FROM
-		countries
+		countries AS c
+	LEFT JOIN
+		translations AS t ON t.entity_type = 'country' AND t.entity_id = c.code AND t.language = $2 AND t.field = 'name'
 	WHERE 
-		code = $1 AND active`
+		c.code = $1 AND c.active`
 
 	c.log.Printf("%s: %s: %s", traceID, "country.QueryByCode",
-		database.Log(q, countryCode),
+		database.Log(q, countryCode, lang),
 	)
 
 	var country Info
-	if err := c.db.GetContext(ctx, &country, q, countryCode); err != nil {
+	if err := c.db.GetContext(ctx, &country, q, countryCode, lang); err != nil {
 		if err == sql.ErrNoRows {
 			return Info{}, ErrNotFound
 		}
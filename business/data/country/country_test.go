@@ -17,7 +17,11 @@ func seed(db *sqlx.DB) error {
 	INSERT INTO countries (gnid, code, name, currency_code, currency_name) VALUES
 	(453733, 'EE', 'Estonia', 'EUR', 'Euro'),
 	(458258, 'LV', 'Latvia', 'EUR', 'Euro'),
-	(597427, 'LT', 'Lithuania', 'EUR', 'Euro')
+	(597427, 'LT', 'Lithuania', 'EUR', 'Euro');
+
+	INSERT INTO translations (entity_type, entity_id, language, field, value) VALUES
+	('country', 'LT', 'de', 'name', 'Litauen'),
+	('country', 'LT', 'lt', 'name', 'Lietuva')
 	`
 	if _, err := db.ExecContext(context.Background(), q); err != nil {
 		return err
@@ -34,7 +38,7 @@ func TestCountry(t *testing.T) {
 		t.Fatalf("Couldn't seed database: %v", err)
 	}
 
-	c := country.New(log, db)
+	c := country.New(log, db, tests.Policy())
 
 	t.Log("Given the need to work with Country records.")
 	{
@@ -62,13 +66,13 @@ func TestCountry(t *testing.T) {
 			// }
 			// t.Logf("\t%s\tTest %d:\tShould not be able to retrieve inactive country by ID.", tests.Success, testID)
 
-			_, err := c.QueryByCode(ctx, traceID, claims, "LT")
+			_, err := c.QueryByCode(ctx, traceID, claims, "LT", "en")
 			if err == nil {
 				t.Fatalf("\t%s\tTest %d:\tShould not be able to retrieve inactive country by Code.", tests.Failed, testID)
 			}
 			t.Logf("\t%s\tTest %d:\tShould not be able to retrieve inactive country by Code.", tests.Success, testID)
 
-			if err := c.ToggleActive(ctx, traceID, claims, "LT"); err != nil {
+			if err := c.ToggleActive(ctx, traceID, claims, "LT", now); err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to activate inactive country by Code: %s.", tests.Failed, testID, err)
 			}
 			t.Logf("\t%s\tTest %d:\tShould be able to activate inactive country by Code.", tests.Success, testID)
@@ -79,13 +83,13 @@ func TestCountry(t *testing.T) {
 			// }
 			// t.Logf("\t%s\tTest %d:\tShould be able to retrieve active country by ID.", tests.Success, testID)
 
-			_, err = c.QueryByCode(ctx, traceID, claims, "LT")
+			_, err = c.QueryByCode(ctx, traceID, claims, "LT", "en")
 			if err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve active country by Code: %s.", tests.Failed, testID, err)
 			}
 			t.Logf("\t%s\tTest %d:\tShould be able to retrieve active country by Code.", tests.Success, testID)
 
-			countries, err := c.Query(ctx, traceID, 1, 100)
+			countries, err := c.Query(ctx, traceID, 1, 100, "en")
 			if err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to query countries: %s.", tests.Failed, testID, err)
 			}
@@ -96,6 +100,23 @@ func TestCountry(t *testing.T) {
 				t.Fatalf("\t%s\tTest %d:\tShould get %d countries back, but got: %d.\n%+v", tests.Failed, testID, expected, got, countries)
 			}
 			t.Logf("\t%s\tTest %d:\tShould get %d countries back.", tests.Success, testID, expected)
+
+			if countries[0].Name != "Lithuania" {
+				t.Fatalf("\t%s\tTest %d:\tShould get the English name, but got: %q.", tests.Failed, testID, countries[0].Name)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the English name.", tests.Success, testID)
+
+			lt, err := c.QueryByCode(ctx, traceID, claims, "LT", "de")
+			if err != nil || lt.Name != "Litauen" {
+				t.Fatalf("\t%s\tTest %d:\tShould get the German name, but got: %q, %v.", tests.Failed, testID, lt.Name, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the German name.", tests.Success, testID)
+
+			lt, err = c.QueryByCode(ctx, traceID, claims, "LT", "fr")
+			if err != nil || lt.Name != "Lithuania" {
+				t.Fatalf("\t%s\tTest %d:\tShould fall back to the English name, but got: %q, %v.", tests.Failed, testID, lt.Name, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould fall back to the English name without a translation.", tests.Success, testID)
 		}
 	}
 }
@@ -0,0 +1,228 @@
+// Package currency contains exchange rate functionality for converting
+// amounts between currencies.
+package currency
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/appinesshq/bpi/business/data/audit"
+	"github.com/appinesshq/bpi/foundation/database"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+var (
+	// ErrUnknownCurrency occurs when a code is not the ISO 4217 code of a
+	// currency in circulation.
+	ErrUnknownCurrency = errors.New("unknown currency")
+
+	// ErrNoRate occurs when there is no exchange rate for a currency.
+	ErrNoRate = errors.New("no exchange rate for currency")
+)
+
+// Base is the currency the exchange rates are expressed in.
+const Base = "EUR"
+
+// Currency manages the set of API's for exchange rate access.
+type Currency struct {
+	log *log.Logger
+	db  *sqlx.DB
+}
+
+// New constructs a Currency for api access.
+func New(log *log.Logger, db *sqlx.DB) Currency {
+	return Currency{
+		log: log,
+		db:  db,
+	}
+}
+
+// Import stores the specified exchange rates, replacing the rates of the same
+// currencies on the same days. New and changed rates are recorded in the
+// audit log. Rates are imported by admin tooling, so the events have no
+// actor. It returns the number of rates added or changed, rates that were
+// already stored as they are don't count.
+func (c Currency) Import(ctx context.Context, traceID string, rates []Rate, now time.Time) (int, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.currency.import")
+	defer span.End()
+
+	// The statement returns the previous rate, which is NULL for a new rate,
+	// and nothing when the rate didn't change.
+	const q = `
+	WITH previous AS (
+		SELECT rate FROM exchange_rates WHERE currency = $1 AND date = $2
+	)
+	INSERT INTO exchange_rates
+		(currency, date, rate, date_created)
+	VALUES
+		($1, $2, $3, $4)
+	ON CONFLICT (currency, date) DO UPDATE SET
+		rate = EXCLUDED.rate,
+		date_created = EXCLUDED.date_created
+	WHERE
+		exchange_rates.rate <> EXCLUDED.rate
+	RETURNING
+		(SELECT rate::TEXT FROM previous)`
+
+	tx, err := c.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	var stored int
+	for _, r := range rates {
+		code := strings.ToUpper(r.Currency)
+		if !Valid(code) {
+			return 0, errors.Wrapf(ErrUnknownCurrency, "importing %q", r.Currency)
+		}
+
+		c.log.Printf("%s: %s: %s", traceID, "currency.Import",
+			database.Log(q, code, r.Date, r.Rate, now.UTC()),
+		)
+
+		var previous sql.NullString
+		if err := tx.GetContext(ctx, &previous, q, code, r.Date, r.Rate, now.UTC()); err != nil {
+			if err == sql.ErrNoRows {
+				continue
+			}
+			return 0, errors.Wrapf(err, "inserting rate of %s on %s", code, r.Date.Format("2006-01-02"))
+		}
+
+		ne := audit.NewEvent{
+			Action:     audit.ActionCreate,
+			EntityType: "exchange_rate",
+			EntityID:   code + "/" + r.Date.Format("2006-01-02"),
+			After:      Rate{Currency: code, Date: r.Date, Rate: r.Rate, DateCreated: now.UTC()},
+		}
+		if previous.Valid {
+			ne.Action = audit.ActionUpdate
+			ne.Before = Rate{Currency: code, Date: r.Date, Rate: previous.String}
+		}
+		if err := audit.Record(ctx, c.log, tx, traceID, ne, now); err != nil {
+			return 0, err
+		}
+		stored++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, errors.Wrap(err, "committing exchange rates")
+	}
+
+	return stored, nil
+}
+
+// QueryLatest gets the most recent exchange rate of every currency, ordered by
+// currency.
+func (c Currency) QueryLatest(ctx context.Context, traceID string) ([]Rate, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.currency.querylatest")
+	defer span.End()
+
+	const q = `
+	SELECT DISTINCT ON (currency)
+		currency, date, rate::TEXT AS rate, date_created
+	FROM
+		exchange_rates
+	ORDER BY
+		currency, date DESC`
+
+	c.log.Printf("%s: %s: %s", traceID, "currency.QueryLatest",
+		database.Log(q),
+	)
+
+	rates := []Rate{}
+	if err := c.db.SelectContext(ctx, &rates, q); err != nil {
+		return nil, errors.Wrap(err, "selecting exchange rates")
+	}
+
+	return rates, nil
+}
+
+// QueryRates gets the most recent exchange rates for converting amounts.
+func (c Currency) QueryRates(ctx context.Context, traceID string) (Rates, error) {
+	latest, err := c.QueryLatest(ctx, traceID)
+	if err != nil {
+		return nil, err
+	}
+
+	rates := Rates{Base: big.NewRat(1, 1)}
+	for _, r := range latest {
+		rat, ok := new(big.Rat).SetString(r.Rate)
+		if !ok {
+			return nil, errors.Errorf("invalid rate %q stored for %s", r.Rate, r.Currency)
+		}
+		rates[r.Currency] = rat
+	}
+
+	return rates, nil
+}
+
+// Knows reports whether the rates can convert amounts from or into the
+// specified currency.
+func (r Rates) Knows(code string) bool {
+	_, ok := r[strings.ToUpper(code)]
+	return ok
+}
+
+// Convert converts an amount in the minor unit of one currency, like cents,
+// into the minor unit of another. The result is rounded to the nearest minor
+// unit, halves away from zero.
+func (r Rates) Convert(amount int, from string, to string) (int, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+
+	fromExp, ok := Exponent(from)
+	if !ok {
+		return 0, ErrUnknownCurrency
+	}
+	toExp, ok := Exponent(to)
+	if !ok {
+		return 0, ErrUnknownCurrency
+	}
+	if from == to {
+		return amount, nil
+	}
+
+	fromRate, ok := r[from]
+	if !ok {
+		return 0, errors.Wrap(ErrNoRate, from)
+	}
+	toRate, ok := r[to]
+	if !ok {
+		return 0, errors.Wrap(ErrNoRate, to)
+	}
+
+	// amount / 10^fromExp / fromRate * toRate * 10^toExp
+	v := new(big.Rat).SetInt64(int64(amount))
+	v.Mul(v, toRate)
+	v.Quo(v, fromRate)
+	v.Mul(v, new(big.Rat).SetFrac(pow10(toExp), pow10(fromExp)))
+
+	return round(v), nil
+}
+
+// pow10 returns 10 to the power of n.
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// round rounds v to the nearest integer, halves away from zero.
+func round(v *big.Rat) int {
+	num := new(big.Int).Abs(v.Num())
+	den := v.Denom()
+
+	q, m := new(big.Int).QuoRem(num, den, new(big.Int))
+	if m.Lsh(m, 1).Cmp(den) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+	if v.Sign() < 0 {
+		q.Neg(q)
+	}
+
+	return int(q.Int64())
+}
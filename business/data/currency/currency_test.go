@@ -0,0 +1,181 @@
+package currency_test
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appinesshq/bpi/business/data/audit"
+	"github.com/appinesshq/bpi/business/data/currency"
+	"github.com/appinesshq/bpi/business/tests"
+	"github.com/pkg/errors"
+)
+
+const ecb = `<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<gesmes:subject>Reference rates</gesmes:subject>
+	<gesmes:Sender>
+		<gesmes:name>European Central Bank</gesmes:name>
+	</gesmes:Sender>
+	<Cube>
+		<Cube time="2020-11-27">
+			<Cube currency="USD" rate="1.1964"/>
+			<Cube currency="JPY" rate="124.51"/>
+			<Cube currency="GBP" rate="0.89605"/>
+		</Cube>
+		<Cube time="2020-11-26">
+			<Cube currency="USD" rate="1.1912"/>
+			<Cube currency="JPY" rate="124.04"/>
+			<Cube currency="XDR" rate="0.8345"/>
+		</Cube>
+	</Cube>
+</gesmes:Envelope>`
+
+func TestConvert(t *testing.T) {
+	rates, err := currency.ParseECB(strings.NewReader(ecb))
+	if err != nil {
+		t.Fatalf("Couldn't parse reference rates: %v", err)
+	}
+
+	t.Log("Given the need to read reference rates of the European Central Bank.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen parsing two days of rates.", testID)
+		{
+			if len(rates) != 5 {
+				t.Fatalf("\t%s\tTest %d:\tShould skip currencies that are not in circulation : got %d rates.", tests.Failed, testID, len(rates))
+			}
+			t.Logf("\t%s\tTest %d:\tShould skip currencies that are not in circulation.", tests.Success, testID)
+
+			if rates[0].Currency != "USD" || rates[0].Rate != "1.1964" || rates[0].Date.Format("2006-01-02") != "2020-11-27" {
+				t.Fatalf("\t%s\tTest %d:\tShould read the currency, rate and day : %+v.", tests.Failed, testID, rates[0])
+			}
+			t.Logf("\t%s\tTest %d:\tShould read the currency, rate and day.", tests.Success, testID)
+		}
+	}
+
+	r := currency.Rates{}
+	for _, rate := range rates[:3] {
+		r[rate.Currency] = mustRat(t, rate.Rate)
+	}
+	r[currency.Base] = mustRat(t, "1")
+	r["KWD"] = mustRat(t, "0.3627")
+	r["CZK"] = mustRat(t, "25.5")
+
+	t.Log("Given the need to convert amounts between currencies.")
+	{
+		conversions := []struct {
+			amount   int
+			from, to string
+			want     int
+		}{
+			{1000, "EUR", "EUR", 1000},
+			{1000, "EUR", "USD", 1196},   // 11.964 dollar
+			{1000, "EUR", "JPY", 1245},   // 1245.1 yen, no minor unit
+			{1000, "EUR", "KWD", 3627},   // 3.627 dinar, three digits
+			{1245, "JPY", "EUR", 1000},   // 9.9992 euro
+			{125, "eur", "usd", 150},     // 1.4955 dollar
+			{-125, "EUR", "USD", -150},   // rounds away from zero
+			{1, "EUR", "JPY", 1},         // 1.2451 yen
+			{50, "USD", "GBP", 37},       // 0.374477 pound
+			{0, "EUR", "KWD", 0},         // nothing stays nothing
+			{4, "EUR", "KWD", 15},        // 14.508 fils
+			{2, "EUR", "JPY", 2},         // 2.4902 yen
+			{20075, "GBP", "EUR", 22404}, // 224.0388 euro
+			{1, "EUR", "CZK", 26},        // 25.5 haler, halves round up
+			{-1, "EUR", "CZK", -26},      // and down below zero
+		}
+		for testID, tt := range conversions {
+			got, err := r.Convert(tt.amount, tt.from, tt.to)
+			if err != nil || got != tt.want {
+				t.Fatalf("\t%s\tTest %d:\tShould convert %d %s into %d %s : got %d, %v.", tests.Failed, testID, tt.amount, tt.from, tt.want, tt.to, got, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould convert %d %s into %d %s.", tests.Success, testID, tt.amount, tt.from, tt.want, tt.to)
+		}
+
+		testID := len(conversions)
+		if _, err := r.Convert(100, "EUR", "CHF"); errors.Cause(err) != currency.ErrNoRate {
+			t.Fatalf("\t%s\tTest %d:\tShould NOT convert into a currency without a rate : %v.", tests.Failed, testID, err)
+		}
+		t.Logf("\t%s\tTest %d:\tShould NOT convert into a currency without a rate.", tests.Success, testID)
+
+		if _, err := r.Convert(100, "EUR", "XDR"); errors.Cause(err) != currency.ErrUnknownCurrency {
+			t.Fatalf("\t%s\tTest %d:\tShould NOT convert into a currency that is not in circulation : %v.", tests.Failed, testID, err)
+		}
+		t.Logf("\t%s\tTest %d:\tShould NOT convert into a currency that is not in circulation.", tests.Success, testID)
+	}
+}
+
+func TestCurrency(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	c := currency.New(log, db)
+
+	t.Log("Given the need to maintain exchange rates.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen importing reference rates.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2020, time.November, 27, 16, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			rates, err := currency.ParseECB(strings.NewReader(ecb))
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to parse reference rates : %s.", tests.Failed, testID, err)
+			}
+
+			n, err := c.Import(ctx, traceID, rates, now)
+			if err != nil || n != len(rates) {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to import rates : %d, %v.", tests.Failed, testID, n, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to import rates.", tests.Success, testID)
+
+			n, err = c.Import(ctx, traceID, rates, now)
+			if err != nil || n != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to import rates again without counting unchanged ones : %d, %v.", tests.Failed, testID, n, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to import rates again without counting unchanged ones.", tests.Success, testID)
+
+			events, err := audit.New(log, db).Query(ctx, traceID, audit.Filter{EntityType: "exchange_rate"}, 1, 100)
+			if err != nil || len(events) != len(rates) {
+				t.Fatalf("\t%s\tTest %d:\tShould record new rates only once in the audit log : %d, %v.", tests.Failed, testID, len(events), err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould record new rates only once in the audit log.", tests.Success, testID)
+
+			latest, err := c.QueryLatest(ctx, traceID)
+			if err != nil || len(latest) != 3 {
+				t.Fatalf("\t%s\tTest %d:\tShould get one rate per currency : %+v, %v.", tests.Failed, testID, latest, err)
+			}
+			for _, l := range latest {
+				if l.Date.Format("2006-01-02") != "2020-11-27" {
+					t.Fatalf("\t%s\tTest %d:\tShould get the most recent rates : %+v.", tests.Failed, testID, l)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the most recent rate of every currency.", tests.Success, testID)
+
+			r, err := c.QueryRates(ctx, traceID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to get the rates : %s.", tests.Failed, testID, err)
+			}
+			if !r.Knows("EUR") || !r.Knows("gbp") || r.Knows("CHF") {
+				t.Fatalf("\t%s\tTest %d:\tShould know the euro and the imported currencies only : %v.", tests.Failed, testID, r)
+			}
+			if got, err := r.Convert(1000, "EUR", "USD"); err != nil || got != 1196 {
+				t.Fatalf("\t%s\tTest %d:\tShould convert with the stored rates : %d, %v.", tests.Failed, testID, got, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould convert with the stored rates.", tests.Success, testID)
+		}
+	}
+}
+
+func mustRat(t *testing.T, s string) *big.Rat {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		t.Fatalf("Couldn't parse rate %q", s)
+	}
+	return r
+}
@@ -0,0 +1,65 @@
+package currency
+
+import (
+	"encoding/xml"
+	"io"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ecbEnvelope matches the reference rate files published by the European
+// Central Bank, like eurofxref-daily.xml and eurofxref-hist.xml.
+type ecbEnvelope struct {
+	Days []struct {
+		Time  string `xml:"time,attr"`
+		Rates []struct {
+			Currency string `xml:"currency,attr"`
+			Rate     string `xml:"rate,attr"`
+		} `xml:"Cube"`
+	} `xml:"Cube>Cube"`
+}
+
+// ParseECB reads the exchange rates from a file in the format of the euro
+// foreign exchange reference rates of the European Central Bank. Rates of
+// currencies that are not in circulation are skipped.
+func ParseECB(r io.Reader) ([]Rate, error) {
+	var env ecbEnvelope
+	if err := xml.NewDecoder(r).Decode(&env); err != nil {
+		return nil, errors.Wrap(err, "decoding reference rates")
+	}
+
+	var rates []Rate
+	for _, day := range env.Days {
+		date, err := time.Parse("2006-01-02", day.Time)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing date %q", day.Time)
+		}
+
+		for _, cr := range day.Rates {
+			code := strings.ToUpper(cr.Currency)
+			if !Valid(code) {
+				continue
+			}
+
+			rat, ok := new(big.Rat).SetString(cr.Rate)
+			if !ok || rat.Sign() <= 0 {
+				return nil, errors.Errorf("invalid rate %q for %s on %s", cr.Rate, code, day.Time)
+			}
+
+			rates = append(rates, Rate{
+				Currency: code,
+				Date:     date,
+				Rate:     cr.Rate,
+			})
+		}
+	}
+
+	if len(rates) == 0 {
+		return nil, errors.New("no reference rates found")
+	}
+
+	return rates, nil
+}
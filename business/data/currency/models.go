@@ -0,0 +1,18 @@
+package currency
+
+import (
+	"math/big"
+	"time"
+)
+
+// Rate represents the reference exchange rate of a currency on a given day.
+type Rate struct {
+	Currency    string    `db:"currency" json:"currency"`         // ISO 4217 code of the currency.
+	Date        time.Time `db:"date" json:"date"`                 // Day the rate was published for.
+	Rate        string    `db:"rate" json:"rate"`                 // Units of the currency for one euro, as a decimal.
+	DateCreated time.Time `db:"date_created" json:"date_created"` // When the rate was imported.
+}
+
+// Rates maps ISO 4217 codes onto the number of units of the currency for one
+// euro. The euro itself is always known.
+type Rates map[string]*big.Rat
@@ -6,8 +6,10 @@ import (
 	"database/sql"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/audit"
 	"github.com/appinesshq/bpi/foundation/database"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
@@ -27,25 +29,27 @@ var (
 
 // Jurisdiction manages the set of API's for jurisdiction access.
 type Jurisdiction struct {
-	log *log.Logger
-	db  *sqlx.DB
+	log    *log.Logger
+	db     *sqlx.DB
+	policy *auth.Policy
 }
 
-// New constructs a Jurisdiction for api access.
-func New(log *log.Logger, db *sqlx.DB) Jurisdiction {
+// New constructs a Jurisdiction for api access. The policy decides which
+// actions the claims passed to its methods allow.
+func New(log *log.Logger, db *sqlx.DB, policy *auth.Policy) Jurisdiction {
 	return Jurisdiction{
-		log: log,
-		db:  db,
+		log:    log,
+		db:     db,
+		policy: policy,
 	}
 }
 
 // ToggleActive activates a jurisdiction in the database.
-func (j Jurisdiction) ToggleActive(ctx context.Context, traceID string, claims auth.Claims, jurisdictionCode string) error {
+func (j Jurisdiction) ToggleActive(ctx context.Context, traceID string, claims auth.Claims, jurisdictionCode string, now time.Time) error {
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.jurisdiction.activate")
 	defer span.End()
 
-	// Only admins should be able to do this.
-	if !claims.Authorized(auth.RoleAdmin) {
+	if !j.policy.Allowed(claims, auth.PermissionJurisdictionActivate) {
 		return ErrForbidden
 	}
 
@@ -59,14 +63,21 @@ func (j Jurisdiction) ToggleActive(ctx context.Context, traceID string, claims a
 	ON
 		j.country_code = c.code
 	WHERE 
-		j.code = $1 AND c.active`
+		j.code = $1 AND c.active
+	FOR UPDATE OF j`
 
 	j.log.Printf("%s: %s: %s", traceID, "jurisdiction.ToggleActivate",
 		database.Log(q, jurisdictionCode),
 	)
 
+	tx, err := j.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
 	var jurisdiction Info
-	if err := j.db.GetContext(ctx, &jurisdiction, q, jurisdictionCode); err != nil {
+	if err := tx.GetContext(ctx, &jurisdiction, q, jurisdictionCode); err != nil {
 		if err == sql.ErrNoRows {
 			return ErrNotFound
 		}
@@ -85,45 +96,68 @@ func (j Jurisdiction) ToggleActive(ctx context.Context, traceID string, claims a
 		database.Log(q, jurisdictionCode, !jurisdiction.Active),
 	)
 
-	if _, err := j.db.ExecContext(ctx, q, jurisdictionCode, !jurisdiction.Active); err != nil {
+	if _, err := tx.ExecContext(ctx, q, jurisdictionCode, !jurisdiction.Active); err != nil {
 		return errors.Wrap(err, "updating jurisdiction")
 	}
 
+	after := jurisdiction
+	after.Active = !jurisdiction.Active
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionToggleActive,
+		EntityType: "jurisdiction",
+		EntityID:   jurisdictionCode,
+		Before:     jurisdiction,
+		After:      after,
+	}
+	if err := audit.Record(ctx, j.log, tx, traceID, ne, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing jurisdiction")
+	}
+
 	return nil
 }
 
-// Query retrieves a list of active jurisdictions from the database.
-func (j Jurisdiction) Query(ctx context.Context, traceID string, pageNumber int, rowsPerPage int) ([]Info, error) {
+// Query retrieves a list of active jurisdictions from the database with their
+// names in the specified language. Jurisdictions without a translation keep
+// their English name.
+func (j Jurisdiction) Query(ctx context.Context, traceID string, pageNumber int, rowsPerPage int, lang string) ([]Info, error) {
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.jurisdiction.query")
 	defer span.End()
 
 	const q = `
 	SELECT
-		*
+		j.code, j.gnid, j.country_code, COALESCE(t.value, j.name) AS name, j.active
 	FROM
-		jurisdictions
+		jurisdictions AS j
+	LEFT JOIN
+		translations AS t ON t.entity_type = 'jurisdiction' AND t.entity_id = j.code AND t.language = $3 AND t.field = 'name'
 	WHERE 
-		active
+		j.active
 	ORDER BY
-		code
+		j.code
 	OFFSET $1 ROWS FETCH NEXT $2 ROWS ONLY`
 
 	offset := (pageNumber - 1) * rowsPerPage
 
 	j.log.Printf("%s: %s: %s", traceID, "jurisdiction.Query",
-		database.Log(q, offset, rowsPerPage),
+		database.Log(q, offset, rowsPerPage, lang),
 	)
 
 	jurisdictions := []Info{}
-	if err := j.db.SelectContext(ctx, &jurisdictions, q, offset, rowsPerPage); err != nil {
+	if err := j.db.SelectContext(ctx, &jurisdictions, q, offset, rowsPerPage, lang); err != nil {
 		return nil, errors.Wrap(err, "selecting jurisdictions")
 	}
 
 	return jurisdictions, nil
 }
 
-// QueryByjurisdictionCode gets the specified jurisdiction from the database.
-func (j Jurisdiction) QueryByCode(ctx context.Context, traceID string, claims auth.Claims, jurisdictionCode string) (Info, error) {
+// QueryByCode gets the specified jurisdiction from the database with its name
+// in the specified language.
+func (j Jurisdiction) QueryByCode(ctx context.Context, traceID string, claims auth.Claims, jurisdictionCode string, lang string) (Info, error) {
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.jurisdiction.querybycode")
 	defer span.End()
 
@@ -135,18 +169,20 @@ func (j Jurisdiction) QueryByCode(ctx context.Context, traceID string, claims au
 
 	const q = `
 	SELECT
-		*
+		j.code, j.gnid, j.country_code, COALESCE(t.value, j.name) AS name, j.active
 	FROM
-		jurisdictions
+		jurisdictions AS j
+	LEFT JOIN
+		translations AS t ON t.entity_type = 'jurisdiction' AND t.entity_id = j.code AND t.language = $2 AND t.field = 'name'
 	WHERE 
-		code = $1 AND active`
+		j.code = $1 AND j.active`
 
 	j.log.Printf("%s: %s: %s", traceID, "jurisdiction.QueryByCode",
-		database.Log(q, jurisdictionCode),
+		database.Log(q, jurisdictionCode, lang),
 	)
 
 	var jurisdiction Info
-	if err := j.db.GetContext(ctx, &jurisdiction, q, jurisdictionCode); err != nil {
+	if err := j.db.GetContext(ctx, &jurisdiction, q, jurisdictionCode, lang); err != nil {
 		if err == sql.ErrNoRows {
 			return Info{}, ErrNotFound
 		}
@@ -39,7 +39,7 @@ func TestCountry(t *testing.T) {
 		t.Fatalf("Couldn't seed database: %v", err)
 	}
 
-	c := jurisdiction.New(log, db)
+	c := jurisdiction.New(log, db, tests.Policy())
 
 	t.Log("Given the need to work with Jurisdiction records.")
 	{
@@ -61,24 +61,24 @@ func TestCountry(t *testing.T) {
 				Roles: []string{auth.RoleAdmin, auth.RoleUser},
 			}
 
-			_, err := c.QueryByCode(ctx, traceID, claims, "LT.65")
+			_, err := c.QueryByCode(ctx, traceID, claims, "LT.65", "en")
 			if err == nil {
 				t.Fatalf("\t%s\tTest %d:\tShould not be able to retrieve inactive jurisdiction by Code.", tests.Failed, testID)
 			}
 			t.Logf("\t%s\tTest %d:\tShould not be able to retrieve inactive jurisdiction by Code.", tests.Success, testID)
 
-			if err := c.ToggleActive(ctx, traceID, claims, "LT.65"); err != nil {
+			if err := c.ToggleActive(ctx, traceID, claims, "LT.65", now); err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to activate inactive jurisdiction by Code: %s.", tests.Failed, testID, err)
 			}
 			t.Logf("\t%s\tTest %d:\tShould be able to activate inactive jurisdiction by Code.", tests.Success, testID)
 
-			_, err = c.QueryByCode(ctx, traceID, claims, "LT.65")
+			_, err = c.QueryByCode(ctx, traceID, claims, "LT.65", "en")
 			if err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve inactive jurisdiction by Code: %s.", tests.Failed, testID, err)
 			}
 			t.Logf("\t%s\tTest %d:\tShould be able to retrieve inactive jurisdiction by Code.", tests.Success, testID)
 
-			jurisdictions, err := c.Query(ctx, traceID, 1, 100)
+			jurisdictions, err := c.Query(ctx, traceID, 1, 100, "en")
 			if err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to query jurisdictions: %s.", tests.Failed, testID, err)
 			}
@@ -90,7 +90,7 @@ func TestCountry(t *testing.T) {
 			}
 			t.Logf("\t%s\tTest %d:\tShould get %d jurisdictions back.", tests.Success, testID, expected)
 
-			if err := c.ToggleActive(ctx, traceID, claims, "EE.01"); err == nil {
+			if err := c.ToggleActive(ctx, traceID, claims, "EE.01", now); err == nil {
 				t.Fatalf("\t%s\tTest %d:\tShould not be able to activate jurisdiction of inactive country.", tests.Failed, testID)
 			}
 			t.Logf("\t%s\tTest %d:\tShould not be able to activate jurisdiction of inactive country.", tests.Success, testID)
@@ -0,0 +1,94 @@
+// Package lockout tracks failed authentication attempts per account and per
+// address so they can be slowed down and temporarily locked out.
+package lockout
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNotFound is used when a specific lockout is requested but does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Store declares the behavior required to record failed attempts. Stores
+// kept in memory only protect a single instance of the service, a shared
+// store is needed when running more than one.
+type Store interface {
+
+	// Get returns the attempts recorded for the key. Keys without attempts
+	// return an empty Info.
+	Get(ctx context.Context, traceID string, key string) (Info, error)
+
+	// Fail records a failed attempt for the key and locks it when the policy
+	// says so.
+	Fail(ctx context.Context, traceID string, key string, now time.Time) (Info, error)
+
+	// Clear forgets the attempts recorded for the key. Stores in the
+	// database record this in the audit log.
+	Clear(ctx context.Context, traceID string, key string, now time.Time) error
+
+	// Query returns the keys locked at the specified time.
+	Query(ctx context.Context, traceID string, now time.Time) ([]Info, error)
+}
+
+// Policy defines when and for how long keys are locked. Once Threshold
+// consecutive attempts failed, every following failure locks the key for
+// twice as long as the previous one, starting with Delay and never longer
+// than MaxDelay. Failures are forgotten once no attempt failed for Window.
+type Policy struct {
+	Threshold int
+	Delay     time.Duration
+	MaxDelay  time.Duration
+	Window    time.Duration
+}
+
+// DefaultPolicy allows a handful of typos before slowing attempts down.
+var DefaultPolicy = Policy{
+	Threshold: 5,
+	Delay:     time.Second,
+	MaxDelay:  15 * time.Minute,
+	Window:    15 * time.Minute,
+}
+
+// Expired reports whether the failures recorded in info are forgotten.
+func (p Policy) Expired(info Info, now time.Time) bool {
+	return now.Sub(info.DateUpdated) > p.Window && !info.Locked(now)
+}
+
+// LockedUntil returns when a key with the specified number of failures may be
+// used again. It returns the zero time when the key isn't locked.
+func (p Policy) LockedUntil(failures int, now time.Time) time.Time {
+	if failures < p.Threshold {
+		return time.Time{}
+	}
+
+	// Guard against overflowing the duration for large numbers of failures.
+	exp := float64(failures - p.Threshold)
+	delay := time.Duration(math.Min(float64(p.Delay)*math.Pow(2, exp), float64(p.MaxDelay)))
+
+	return now.Add(delay)
+}
+
+// AccountKey returns the key attempts for an account are recorded under. The
+// email address is hashed so it isn't stored in plain text.
+func AccountKey(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return fmt.Sprintf("account:%x", sum)
+}
+
+// UserKey returns the key attempts by a signed in user are recorded under.
+func UserKey(userID string) string {
+	return "user:" + userID
+}
+
+// AddressKey returns the key attempts from a network address are recorded
+// under.
+func AddressKey(ip string) string {
+	return "ip:" + ip
+}
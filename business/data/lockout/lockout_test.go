@@ -0,0 +1,122 @@
+package lockout_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/appinesshq/bpi/business/data/audit"
+	"github.com/appinesshq/bpi/business/data/lockout"
+	"github.com/appinesshq/bpi/business/tests"
+	"github.com/pkg/errors"
+)
+
+var policy = lockout.Policy{
+	Threshold: 3,
+	Delay:     time.Second,
+	MaxDelay:  time.Minute,
+	Window:    time.Hour,
+}
+
+func TestMemory(t *testing.T) {
+	testStore(t, lockout.NewMemory(policy))
+}
+
+func TestPostgres(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	testStore(t, lockout.NewPostgres(log, db, policy))
+
+	events, err := audit.New(log, db).Query(tests.Context(), "", audit.Filter{EntityType: "lockout", Action: audit.ActionDelete}, 1, 10)
+	if err != nil || len(events) == 0 {
+		t.Fatalf("\t%s\tShould record clearing a lockout in the audit log : %v.", tests.Failed, err)
+	}
+	t.Logf("\t%s\tShould record clearing a lockout in the audit log.", tests.Success)
+}
+
+func testStore(t *testing.T, store lockout.Store) {
+	t.Log("Given the need to lock out repeated failed attempts.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen failing to authenticate an account repeatedly.", testID)
+		{
+			ctx := tests.Context()
+			now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+			key := lockout.AccountKey("Jane@example.com")
+
+			if key != lockout.AccountKey("jane@example.com ") {
+				t.Fatalf("\t%s\tTest %d:\tShould get the same key for the same email address.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the same key for the same email address.", tests.Success, testID)
+
+			var info lockout.Info
+			for i := 0; i < policy.Threshold-1; i++ {
+				var err error
+				info, err = store.Fail(ctx, traceID, key, now)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to record a failure : %s.", tests.Failed, testID, err)
+				}
+			}
+			if info.Locked(now) {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be locked below the threshold.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be locked below the threshold.", tests.Success, testID)
+
+			info, err := store.Fail(ctx, traceID, key, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to record a failure : %s.", tests.Failed, testID, err)
+			}
+			if !info.Locked(now) || !info.LockedUntil.Time.Equal(now.Add(policy.Delay)) {
+				t.Fatalf("\t%s\tTest %d:\tShould be locked for the initial delay : %+v.", tests.Failed, testID, info)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be locked for the initial delay.", tests.Success, testID)
+
+			now = now.Add(policy.Delay)
+			info, err = store.Fail(ctx, traceID, key, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to record a failure : %s.", tests.Failed, testID, err)
+			}
+			if !info.LockedUntil.Time.Equal(now.Add(2 * policy.Delay)) {
+				t.Fatalf("\t%s\tTest %d:\tShould double the delay on the next failure : %+v.", tests.Failed, testID, info)
+			}
+			t.Logf("\t%s\tTest %d:\tShould double the delay on the next failure.", tests.Success, testID)
+
+			got, err := store.Get(ctx, traceID, key)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve the lockout : %s.", tests.Failed, testID, err)
+			}
+			if got.Failures != policy.Threshold+1 || !got.Locked(now) {
+				t.Fatalf("\t%s\tTest %d:\tShould retrieve the recorded failures : %+v.", tests.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould retrieve the recorded failures.", tests.Success, testID)
+
+			locked, err := store.Query(ctx, traceID, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to list lockouts : %s.", tests.Failed, testID, err)
+			}
+			if len(locked) != 1 || locked[0].Key != key {
+				t.Fatalf("\t%s\tTest %d:\tShould list the locked account : %+v.", tests.Failed, testID, locked)
+			}
+			t.Logf("\t%s\tTest %d:\tShould list the locked account.", tests.Success, testID)
+
+			if err := store.Clear(ctx, traceID, key, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to clear the lockout : %s.", tests.Failed, testID, err)
+			}
+			if err := store.Clear(ctx, traceID, key, now); errors.Cause(err) != lockout.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT find a cleared lockout : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to clear the lockout.", tests.Success, testID)
+
+			info, err = store.Fail(ctx, traceID, key, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to record a failure : %s.", tests.Failed, testID, err)
+			}
+			later := now.Add(policy.Window + time.Second)
+			if info, err = store.Fail(ctx, traceID, key, later); err != nil || info.Failures != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould forget failures older than the window : %+v %v.", tests.Failed, testID, info, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould forget failures older than the window.", tests.Success, testID)
+		}
+	}
+}
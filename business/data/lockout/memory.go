@@ -0,0 +1,91 @@
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Memory is a Store keeping attempts in memory.
+type Memory struct {
+	policy Policy
+
+	mu      sync.Mutex
+	entries map[string]Info
+}
+
+// NewMemory constructs a Store keeping attempts in memory.
+func NewMemory(policy Policy) *Memory {
+	return &Memory{
+		policy:  policy,
+		entries: make(map[string]Info),
+	}
+}
+
+// Get implements the Store interface.
+func (m *Memory) Get(ctx context.Context, traceID string, key string) (Info, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	info, ok := m.entries[key]
+	if !ok {
+		return Info{Key: key}, nil
+	}
+
+	return info, nil
+}
+
+// Fail implements the Store interface.
+func (m *Memory) Fail(ctx context.Context, traceID string, key string, now time.Time) (Info, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Forget expired entries so addresses that failed once don't accumulate.
+	for k, info := range m.entries {
+		if m.policy.Expired(info, now) {
+			delete(m.entries, k)
+		}
+	}
+
+	info := m.entries[key]
+	info.Key = key
+	info.Failures++
+	info.DateUpdated = now.UTC()
+	if until := m.policy.LockedUntil(info.Failures, now); !until.IsZero() {
+		info.LockedUntil = sql.NullTime{Time: until.UTC(), Valid: true}
+	}
+	m.entries[key] = info
+
+	return info, nil
+}
+
+// Clear implements the Store interface.
+func (m *Memory) Clear(ctx context.Context, traceID string, key string, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.entries[key]; !ok {
+		return ErrNotFound
+	}
+	delete(m.entries, key)
+
+	return nil
+}
+
+// Query implements the Store interface.
+func (m *Memory) Query(ctx context.Context, traceID string, now time.Time) ([]Info, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	locked := []Info{}
+	for _, info := range m.entries {
+		if info.Locked(now) {
+			locked = append(locked, info)
+		}
+	}
+	sort.Slice(locked, func(i, j int) bool { return locked[i].Key < locked[j].Key })
+
+	return locked, nil
+}
@@ -0,0 +1,19 @@
+package lockout
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Info represents the failed attempts recorded for an account or address.
+type Info struct {
+	Key         string       `db:"lockout_key" json:"key"`           // Account or address the attempts were made for.
+	Failures    int          `db:"failures" json:"failures"`         // Number of consecutive failed attempts.
+	LockedUntil sql.NullTime `db:"locked_until" json:"locked_until"` // When attempts are allowed again.
+	DateUpdated time.Time    `db:"date_updated" json:"date_updated"` // When the last failed attempt was made.
+}
+
+// Locked reports whether attempts are refused at the specified time.
+func (i Info) Locked(now time.Time) bool {
+	return i.LockedUntil.Valid && i.LockedUntil.Time.After(now)
+}
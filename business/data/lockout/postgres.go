@@ -0,0 +1,202 @@
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/appinesshq/bpi/business/data/audit"
+	"github.com/appinesshq/bpi/foundation/database"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+// Postgres is a Store keeping attempts in the database so they are shared by
+// every instance of the service.
+type Postgres struct {
+	log    *log.Logger
+	db     *sqlx.DB
+	policy Policy
+}
+
+// NewPostgres constructs a Store keeping attempts in the database.
+func NewPostgres(log *log.Logger, db *sqlx.DB, policy Policy) Postgres {
+	return Postgres{
+		log:    log,
+		db:     db,
+		policy: policy,
+	}
+}
+
+// Get implements the Store interface.
+func (p Postgres) Get(ctx context.Context, traceID string, key string) (Info, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.lockout.get")
+	defer span.End()
+
+	const q = `
+	SELECT
+		*
+	FROM
+		lockouts
+	WHERE
+		lockout_key = $1`
+
+	p.log.Printf("%s: %s: %s", traceID, "lockout.Get",
+		database.Log(q, key),
+	)
+
+	var info Info
+	if err := p.db.GetContext(ctx, &info, q, key); err != nil {
+		if err == sql.ErrNoRows {
+			return Info{Key: key}, nil
+		}
+		return Info{}, errors.Wrapf(err, "selecting lockout %q", key)
+	}
+
+	return info, nil
+}
+
+// Fail implements the Store interface.
+func (p Postgres) Fail(ctx context.Context, traceID string, key string, now time.Time) (Info, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.lockout.fail")
+	defer span.End()
+
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return Info{}, errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	// Counting restarts when the previous failure is older than the window
+	// and the key isn't locked anymore. The upsert locks the row so
+	// concurrent failures are all counted.
+	q := `
+	INSERT INTO lockouts
+		(lockout_key, failures, date_updated)
+	VALUES
+		($1, 1, $2)
+	ON CONFLICT (lockout_key) DO UPDATE SET
+		"failures" = CASE
+			WHEN lockouts.date_updated < $3 AND (lockouts.locked_until IS NULL OR lockouts.locked_until <= $2) THEN 1
+			ELSE lockouts.failures + 1
+		END,
+		"date_updated" = $2
+	RETURNING
+		*`
+
+	windowStart := now.Add(-p.policy.Window).UTC()
+
+	p.log.Printf("%s: %s: %s", traceID, "lockout.Fail",
+		database.Log(q, key, now.UTC(), windowStart),
+	)
+
+	var info Info
+	if err := tx.GetContext(ctx, &info, q, key, now.UTC(), windowStart); err != nil {
+		return Info{}, errors.Wrapf(err, "recording failure for %q", key)
+	}
+
+	if until := p.policy.LockedUntil(info.Failures, now); !until.IsZero() {
+		info.LockedUntil = sql.NullTime{Time: until.UTC(), Valid: true}
+
+		q = `
+		UPDATE
+			lockouts
+		SET
+			"locked_until" = $2
+		WHERE
+			lockout_key = $1`
+
+		p.log.Printf("%s: %s: %s", traceID, "lockout.Fail",
+			database.Log(q, key, info.LockedUntil.Time),
+		)
+
+		if _, err := tx.ExecContext(ctx, q, key, info.LockedUntil.Time); err != nil {
+			return Info{}, errors.Wrapf(err, "locking %q", key)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Info{}, errors.Wrap(err, "committing failure")
+	}
+
+	return info, nil
+}
+
+// Clear implements the Store interface. Lockouts are cleared by successful
+// attempts and by admin tooling rather than by a user, so the events have no
+// actor.
+func (p Postgres) Clear(ctx context.Context, traceID string, key string, now time.Time) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.lockout.clear")
+	defer span.End()
+
+	const q = `
+	DELETE FROM
+		lockouts
+	WHERE
+		lockout_key = $1
+	RETURNING
+		*`
+
+	p.log.Printf("%s: %s: %s", traceID, "lockout.Clear",
+		database.Log(q, key),
+	)
+
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	var info Info
+	if err := tx.GetContext(ctx, &info, q, key); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return errors.Wrapf(err, "deleting lockout %q", key)
+	}
+
+	ne := audit.NewEvent{
+		Action:     audit.ActionDelete,
+		EntityType: "lockout",
+		EntityID:   key,
+		Before:     info,
+	}
+	if err := audit.Record(ctx, p.log, tx, traceID, ne, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing lockout")
+	}
+
+	return nil
+}
+
+// Query implements the Store interface.
+func (p Postgres) Query(ctx context.Context, traceID string, now time.Time) ([]Info, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.lockout.query")
+	defer span.End()
+
+	const q = `
+	SELECT
+		*
+	FROM
+		lockouts
+	WHERE
+		locked_until > $1
+	ORDER BY
+		lockout_key`
+
+	p.log.Printf("%s: %s: %s", traceID, "lockout.Query",
+		database.Log(q, now.UTC()),
+	)
+
+	locked := []Info{}
+	if err := p.db.SelectContext(ctx, &locked, q, now.UTC()); err != nil {
+		return nil, errors.Wrap(err, "selecting lockouts")
+	}
+
+	return locked, nil
+}
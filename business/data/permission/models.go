@@ -0,0 +1,10 @@
+package permission
+
+import "time"
+
+// Info represents a permission granted to a role.
+type Info struct {
+	Role        string    `db:"role" json:"role"`                 // Role the permission is granted to.
+	Permission  string    `db:"permission" json:"permission"`     // Name of the permission.
+	DateCreated time.Time `db:"date_created" json:"date_created"` // When the permission was granted.
+}
@@ -0,0 +1,200 @@
+// Package permission contains the storage of the permissions granted to roles.
+package permission
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/audit"
+	"github.com/appinesshq/bpi/foundation/database"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+var (
+	// ErrNotFound is used when a specific grant is requested but does not exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrUnknownPermission occurs when a permission isn't checked anywhere.
+	ErrUnknownPermission = errors.New("unknown permission")
+)
+
+// Permission manages the set of API's for permission access.
+type Permission struct {
+	log *log.Logger
+	db  *sqlx.DB
+}
+
+// New constructs a Permission for api access.
+func New(log *log.Logger, db *sqlx.DB) Permission {
+	return Permission{
+		log: log,
+		db:  db,
+	}
+}
+
+// Grant allows a role the specified permission on behalf of the user in the
+// claims. Granting a permission twice is not an error.
+func (p Permission) Grant(ctx context.Context, traceID string, claims auth.Claims, role string, permission string, now time.Time) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.permission.grant")
+	defer span.End()
+
+	if !auth.Known(permission) {
+		return ErrUnknownPermission
+	}
+
+	const q = `
+	INSERT INTO role_permissions
+		(role, permission, date_created)
+	VALUES
+		($1, $2, $3)
+	ON CONFLICT DO NOTHING`
+
+	p.log.Printf("%s: %s: %s", traceID, "permission.Grant",
+		database.Log(q, role, permission, now.UTC()),
+	)
+
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, q, role, permission, now.UTC())
+	if err != nil {
+		return errors.Wrap(err, "granting permission")
+	}
+
+	// A permission granted before changes nothing, so there's nothing to
+	// record.
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return nil
+	}
+
+	grant := Info{
+		Role:        role,
+		Permission:  permission,
+		DateCreated: now.UTC(),
+	}
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionGrant,
+		EntityType: "role",
+		EntityID:   role,
+		After:      grant,
+	}
+	if err := audit.Record(ctx, p.log, tx, traceID, ne, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing permission")
+	}
+
+	return nil
+}
+
+// Revoke takes the specified permission away from a role on behalf of the
+// user in the claims.
+func (p Permission) Revoke(ctx context.Context, traceID string, claims auth.Claims, role string, permission string, now time.Time) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.permission.revoke")
+	defer span.End()
+
+	const q = `
+	DELETE FROM
+		role_permissions
+	WHERE
+		role = $1 AND permission = $2
+	RETURNING
+		*`
+
+	p.log.Printf("%s: %s: %s", traceID, "permission.Revoke",
+		database.Log(q, role, permission),
+	)
+
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	var grant Info
+	if err := tx.GetContext(ctx, &grant, q, role, permission); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return errors.Wrap(err, "revoking permission")
+	}
+
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionRevoke,
+		EntityType: "role",
+		EntityID:   role,
+		Before:     grant,
+	}
+	if err := audit.Record(ctx, p.log, tx, traceID, ne, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing permission")
+	}
+
+	return nil
+}
+
+// Query retrieves every permission granted to a role from the database.
+func (p Permission) Query(ctx context.Context, traceID string) ([]Info, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.permission.query")
+	defer span.End()
+
+	const q = `
+	SELECT
+		*
+	FROM
+		role_permissions
+	ORDER BY
+		role, permission`
+
+	p.log.Printf("%s: %s: %s", traceID, "permission.Query",
+		database.Log(q),
+	)
+
+	grants := []Info{}
+	if err := p.db.SelectContext(ctx, &grants, q); err != nil {
+		return nil, errors.Wrap(err, "selecting permissions")
+	}
+
+	return grants, nil
+}
+
+// Grants retrieves the mapping of roles to permissions a policy is built from.
+func (p Permission) Grants(ctx context.Context, traceID string) (map[string][]string, error) {
+	infos, err := p.Query(ctx, traceID)
+	if err != nil {
+		return nil, err
+	}
+
+	grants := make(map[string][]string)
+	for _, info := range infos {
+		grants[info.Role] = append(grants[info.Role], info.Permission)
+	}
+
+	return grants, nil
+}
+
+// Load replaces the grants of the policy with those stored in the database.
+func (p Permission) Load(ctx context.Context, traceID string, policy *auth.Policy) error {
+	grants, err := p.Grants(ctx, traceID)
+	if err != nil {
+		return err
+	}
+
+	policy.Set(grants)
+	return nil
+}
@@ -0,0 +1,70 @@
+package permission_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/permission"
+	"github.com/appinesshq/bpi/business/tests"
+	"github.com/pkg/errors"
+)
+
+func TestPermission(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	p := permission.New(log, db)
+
+	t.Log("Given the need to work with the permissions granted to roles.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen granting and revoking a permission.", testID)
+		{
+			ctx := tests.Context()
+			now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			policy := auth.NewPolicy(nil)
+			if err := p.Load(ctx, traceID, policy); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to load the policy : %s.", tests.Failed, testID, err)
+			}
+			admin := auth.Claims{Roles: []string{auth.RoleAdmin}}
+			if !policy.Allowed(admin, auth.PermissionCountryActivate) {
+				t.Fatalf("\t%s\tTest %d:\tShould grant the default permissions.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould grant the default permissions.", tests.Success, testID)
+
+			if err := p.Grant(ctx, traceID, admin, "MODERATOR", "country:destroy", now); errors.Cause(err) != permission.ErrUnknownPermission {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to grant an unknown permission : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to grant an unknown permission.", tests.Success, testID)
+
+			if err := p.Grant(ctx, traceID, admin, "MODERATOR", auth.PermissionCountryActivate, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to grant a permission : %s.", tests.Failed, testID, err)
+			}
+			if err := p.Load(ctx, traceID, policy); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to reload the policy : %s.", tests.Failed, testID, err)
+			}
+			moderator := auth.Claims{Roles: []string{"MODERATOR"}}
+			if !policy.Allowed(moderator, auth.PermissionCountryActivate) {
+				t.Fatalf("\t%s\tTest %d:\tShould allow the new role the permission.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to grant a permission.", tests.Success, testID)
+
+			if err := p.Revoke(ctx, traceID, admin, "MODERATOR", auth.PermissionCountryActivate, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to revoke a permission : %s.", tests.Failed, testID, err)
+			}
+			if err := p.Revoke(ctx, traceID, admin, "MODERATOR", auth.PermissionCountryActivate, now); errors.Cause(err) != permission.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to revoke a permission twice : %v.", tests.Failed, testID, err)
+			}
+			if err := p.Load(ctx, traceID, policy); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to reload the policy : %s.", tests.Failed, testID, err)
+			}
+			if policy.Allowed(moderator, auth.PermissionCountryActivate) {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT allow the role the revoked permission.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to revoke a permission.", tests.Success, testID)
+		}
+	}
+}
@@ -1,25 +1,106 @@
 package product
 
-import "time"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
-// Info represents an individual product.
+// Pricing represents the way the price of an offering is set.
+type Pricing string
+
+var (
+	// FixedPrice represents offerings sold for the price asked.
+	FixedPrice Pricing = "fixed"
+
+	// HourlyRate represents offerings billed by the hour at the price asked.
+	HourlyRate Pricing = "hourly"
+
+	// FromPrice represents offerings starting at the price asked, with the
+	// final price depending on the work involved.
+	FromPrice Pricing = "from"
+)
+
+// PricingFromString returns a pointer to the pricing from the provided string
+// or an error when an invalid pricing string is provided.
+func PricingFromString(s string) (*Pricing, error) {
+	switch strings.ToLower(s) {
+	case "fixed":
+		return &FixedPrice, nil
+	case "hourly":
+		return &HourlyRate, nil
+	case "from":
+		return &FromPrice, nil
+	default:
+		return nil, fmt.Errorf("%q is an invalid pricing", s)
+	}
+}
+
+// Availability represents whether an offering can be ordered.
+type Availability string
+
+var (
+	// Available represents offerings that can be ordered right away.
+	Available Availability = "available"
+
+	// OnRequest represents offerings the provider takes on after consultation.
+	OnRequest Availability = "on_request"
+
+	// Unavailable represents offerings the provider doesn't take on for now.
+	// They are left out when browsing offerings.
+	Unavailable Availability = "unavailable"
+)
+
+// AvailabilityFromString returns a pointer to the availability from the
+// provided string or an error when an invalid availability string is
+// provided.
+func AvailabilityFromString(s string) (*Availability, error) {
+	switch strings.ToLower(s) {
+	case "available":
+		return &Available, nil
+	case "on_request":
+		return &OnRequest, nil
+	case "unavailable":
+		return &Unavailable, nil
+	default:
+		return nil, fmt.Errorf("%q is an invalid availability", s)
+	}
+}
+
+// Info represents an individual product, a service offered by a provider.
 type Info struct {
-	ID          string    `db:"product_id" json:"id"`             // Unique identifier.
-	Name        string    `db:"name" json:"name"`                 // Display name of the product.
-	Cost        int       `db:"cost" json:"cost"`                 // Price for one item in cents.
-	Quantity    int       `db:"quantity" json:"quantity"`         // Original number of items available.
-	Sold        int       `db:"sold" json:"sold"`                 // Aggregate field showing number of items sold.
-	Revenue     int       `db:"revenue" json:"revenue"`           // Aggregate field showing total cost of sold items.
-	UserID      string    `db:"user_id" json:"user_id"`           // ID of the user who created the product.
-	DateCreated time.Time `db:"date_created" json:"date_created"` // When the product was added.
-	DateUpdated time.Time `db:"date_updated" json:"date_updated"` // When the product record was last modified.
+	ID           string       `db:"product_id" json:"id"`                   // Unique identifier.
+	Name         string       `db:"name" json:"name"`                       // Display name of the product.
+	Description  string       `db:"description" json:"description"`         // What the service includes.
+	Profile      string       `db:"profile_name" json:"profile"`            // Name of the service provider profile offering the product.
+	CategoryID   string       `db:"category_id" json:"category_id"`         // ID of the category the product is listed in, if any.
+	Jurisdiction string       `db:"jurisdiction_code" json:"jurisdiction"`  // Code of the jurisdiction the product applies to, if any.
+	Pricing      Pricing      `db:"pricing" json:"pricing"`                 // How the cost is to be read.
+	Cost         int          `db:"cost" json:"cost"`                       // Price for one item in the minor unit of the currency.
+	Currency     string       `db:"currency" json:"currency"`               // ISO 4217 code of the currency the product is priced in.
+	Availability Availability `db:"availability" json:"availability"`       // Whether the product can be ordered.
+	Quantity     int          `db:"quantity" json:"quantity"`               // Original number of items available.
+	Sold         int          `db:"sold" json:"sold"`                       // Aggregate field showing number of items sold, only shown to the owner.
+	Revenue      int          `db:"revenue" json:"revenue"`                 // Aggregate field showing total cost of sold items, only shown to the owner.
+	UserID       string       `db:"user_id" json:"user_id"`                 // ID of the user who created the product.
+	DateCreated  time.Time    `db:"date_created" json:"date_created"`       // When the product was added.
+	DateUpdated  time.Time    `db:"date_updated" json:"date_updated"`       // When the product record was last modified.
+	DeletedAt    *time.Time   `db:"deleted_at" json:"deleted_at,omitempty"` // When the product was deleted, until it is purged.
 }
 
-// NewProduct is what we require from clients when adding a Product.
+// NewProduct is what we require from clients when adding a Product. Products
+// are fixed price and available unless specified otherwise.
 type NewProduct struct {
-	Name     string `json:"name" validate:"required"`
-	Cost     int    `json:"cost" validate:"required,gte=0"`
-	Quantity int    `json:"quantity" validate:"gte=1"`
+	Name         string `json:"name" validate:"required"`
+	Description  string `json:"description" validate:"max=5000"`
+	Profile      string `json:"profile" validate:"required"`
+	CategoryID   string `json:"category_id" validate:"omitempty,uuid"`
+	Jurisdiction string `json:"jurisdiction"`
+	Pricing      string `json:"pricing"`
+	Cost         int    `json:"cost" validate:"required,gte=0"`
+	Currency     string `json:"currency" validate:"required,len=3"`
+	Availability string `json:"availability"`
+	Quantity     int    `json:"quantity" validate:"gte=1"`
 }
 
 // UpdateProduct defines what information may be provided to modify an
@@ -27,9 +108,24 @@ type NewProduct struct {
 // fields they want changed. It uses pointer fields so we can differentiate
 // between a field that was not provided and a field that was provided as
 // explicitly blank. Normally we do not want to use pointers to basic types but
-// we make exceptions around marshalling/unmarshalling.
+// we make exceptions around marshalling/unmarshalling. A blank category or
+// jurisdiction removes it from the product.
 type UpdateProduct struct {
-	Name     *string `json:"name"`
-	Cost     *int    `json:"cost" validate:"omitempty,gte=0"`
-	Quantity *int    `json:"quantity" validate:"omitempty,gte=1"`
+	Name         *string `json:"name"`
+	Description  *string `json:"description" validate:"omitempty,max=5000"`
+	CategoryID   *string `json:"category_id" validate:"omitempty,len=0|uuid"`
+	Jurisdiction *string `json:"jurisdiction"`
+	Pricing      *string `json:"pricing"`
+	Cost         *int    `json:"cost" validate:"omitempty,gte=0"`
+	Availability *string `json:"availability"`
+	Quantity     *int    `json:"quantity" validate:"omitempty,gte=1"`
+}
+
+// Filter narrows down the products browsed across providers. Empty fields
+// match any product.
+type Filter struct {
+	CategoryID   string  // ID of the category of the products, including its subcategories.
+	Jurisdiction string  // Code of the jurisdiction the products apply to.
+	Country      string  // Code of the country of the jurisdiction the products apply to.
+	Pricing      Pricing // How the products are priced.
 }
@@ -5,9 +5,13 @@ import (
 	"context"
 	"database/sql"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/audit"
+	"github.com/appinesshq/bpi/business/data/currency"
+	"github.com/appinesshq/bpi/business/data/profile"
 	"github.com/appinesshq/bpi/foundation/database"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
@@ -24,52 +28,174 @@ var (
 
 	// ErrForbidden occurs when a user tries to do something that is forbidden to them according to our access control policies.
 	ErrForbidden = errors.New("attempted action is not allowed")
+
+	// ErrUnknownCurrency occurs when a product is priced in a currency that is
+	// not in circulation.
+	ErrUnknownCurrency = errors.New("unknown currency")
+
+	// ErrUnknownProfile occurs when a product is offered by a profile that
+	// does not exist.
+	ErrUnknownProfile = errors.New("unknown profile")
+
+	// ErrNotProvider occurs when a product is offered by a profile that is not
+	// a service provider profile.
+	ErrNotProvider = errors.New("profile is not a service provider")
+
+	// ErrUnknownCategory occurs when a product is listed in a category that
+	// does not exist.
+	ErrUnknownCategory = errors.New("unknown category")
+
+	// ErrUnknownJurisdiction occurs when a product applies to a jurisdiction
+	// that does not exist.
+	ErrUnknownJurisdiction = errors.New("unknown jurisdiction")
+
+	// ErrInvalidPricing occurs when a product is priced in a way that is not
+	// supported.
+	ErrInvalidPricing = errors.New("invalid pricing")
+
+	// ErrInvalidAvailability occurs when the availability of a product is not
+	// one of the supported ones.
+	ErrInvalidAvailability = errors.New("invalid availability")
+
+	// ErrQuantityBelowSold occurs when the quantity of a product is set lower
+	// than the number of items already sold.
+	ErrQuantityBelowSold = errors.New("quantity is lower than the items sold")
 )
 
+// columns selects a product from products aliased as p, along with the number
+// of items sold and the revenue.
+const columns = `
+		p.product_id, p.name, p.description, p.cost, p.currency, p.quantity,
+		COALESCE(p.profile_name, '') AS profile_name,
+		COALESCE(p.category_id::TEXT, '') AS category_id,
+		COALESCE(p.jurisdiction_code, '') AS jurisdiction_code,
+		p.pricing, p.availability, p.user_id, p.date_created, p.date_updated,
+		p.deleted_at,
+		COALESCE((
+			SELECT SUM(s.quantity) FROM sales AS s WHERE s.product_id = p.product_id
+		), 0) AS sold,
+		COALESCE((
+			SELECT SUM(s.paid) FROM sales AS s WHERE s.product_id = p.product_id
+		), 0) AS revenue`
+
 // Product manages the set of API's for product access.
 type Product struct {
-	log *log.Logger
-	db  *sqlx.DB
+	log    *log.Logger
+	db     *sqlx.DB
+	policy *auth.Policy
 }
 
-// New constructs a Product for api access.
-func New(log *log.Logger, db *sqlx.DB) Product {
+// New constructs a Product for api access. The policy decides which
+// actions the claims passed to its methods allow.
+func New(log *log.Logger, db *sqlx.DB, policy *auth.Policy) Product {
 	return Product{
-		log: log,
-		db:  db,
+		log:    log,
+		db:     db,
+		policy: policy,
 	}
 }
 
-// Create adds a Product to the database. It returns the created Product with
-// fields like ID and DateCreated populated.
+// Create adds a Product to the database. The product is offered by the
+// service provider profile named in np, which the claims must allow editing.
+// It returns the created Product with fields like ID and DateCreated
+// populated.
 func (p Product) Create(ctx context.Context, traceID string, claims auth.Claims, np NewProduct, now time.Time) (Info, error) {
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.product.create")
 	defer span.End()
 
+	code := strings.ToUpper(np.Currency)
+	if !currency.Valid(code) {
+		return Info{}, ErrUnknownCurrency
+	}
+
+	pricing := FixedPrice
+	if np.Pricing != "" {
+		pr, err := PricingFromString(np.Pricing)
+		if err != nil {
+			return Info{}, ErrInvalidPricing
+		}
+		pricing = *pr
+	}
+
+	availability := Available
+	if np.Availability != "" {
+		a, err := AvailabilityFromString(np.Availability)
+		if err != nil {
+			return Info{}, ErrInvalidAvailability
+		}
+		availability = *a
+	}
+
+	categoryID, err := categoryID(np.CategoryID)
+	if err != nil {
+		return Info{}, err
+	}
+
 	prd := Info{
-		ID:          uuid.New().String(),
-		Name:        np.Name,
-		Cost:        np.Cost,
-		Quantity:    np.Quantity,
-		UserID:      claims.Subject,
-		DateCreated: now.UTC(),
-		DateUpdated: now.UTC(),
+		ID:           uuid.New().String(),
+		Name:         np.Name,
+		Description:  np.Description,
+		Profile:      np.Profile,
+		CategoryID:   categoryID,
+		Jurisdiction: np.Jurisdiction,
+		Pricing:      pricing,
+		Cost:         np.Cost,
+		Currency:     code,
+		Availability: availability,
+		Quantity:     np.Quantity,
+		UserID:       claims.Subject,
+		DateCreated:  now.UTC(),
+		DateUpdated:  now.UTC(),
 	}
 
 	const q = `
 	INSERT INTO products
-		(product_id, user_id, name, cost, quantity, date_created, date_updated)
+		(product_id, user_id, profile_name, category_id, jurisdiction_code, name,
+		description, pricing, cost, currency, availability, quantity, date_created,
+		date_updated)
 	VALUES
-		($1, $2, $3, $4, $5, $6, $7)`
+		($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`
+
+	args := []interface{}{prd.ID, prd.UserID, prd.Profile, nullable(prd.CategoryID), nullable(prd.Jurisdiction), prd.Name,
+		prd.Description, prd.Pricing, prd.Cost, prd.Currency, prd.Availability, prd.Quantity, prd.DateCreated,
+		prd.DateUpdated}
 
 	p.log.Printf("%s: %s: %s", traceID, "product.Create",
-		database.Log(q, prd.ID, prd.UserID, prd.Name, prd.Cost, prd.Quantity, prd.DateCreated, prd.DateUpdated),
+		database.Log(q, args...),
 	)
 
-	if _, err := p.db.ExecContext(ctx, q, prd.ID, prd.UserID, prd.Name, prd.Cost, prd.Quantity, prd.DateCreated, prd.DateUpdated); err != nil {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return Info{}, errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	if err := p.checkProvider(ctx, tx, traceID, claims, prd.Profile); err != nil {
+		return Info{}, err
+	}
+	if err := p.checkListing(ctx, tx, traceID, prd.CategoryID, prd.Jurisdiction); err != nil {
+		return Info{}, err
+	}
+
+	if _, err := tx.ExecContext(ctx, q, args...); err != nil {
 		return Info{}, errors.Wrap(err, "inserting product")
 	}
 
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionCreate,
+		EntityType: "product",
+		EntityID:   prd.ID,
+		After:      prd,
+	}
+	if err := audit.Record(ctx, p.log, tx, traceID, ne, now); err != nil {
+		return Info{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Info{}, errors.Wrap(err, "committing product")
+	}
+
 	return prd, nil
 }
 
@@ -84,17 +210,44 @@ func (p Product) Update(ctx context.Context, traceID string, claims auth.Claims,
 		return err
 	}
 
-	// If you are not an admin and looking to retrieve someone elses product.
-	if !claims.Authorized(auth.RoleAdmin) && prd.UserID != claims.Subject {
+	if !p.policy.AllowedFor(claims, auth.PermissionProductEdit, prd.UserID) {
 		return ErrForbidden
 	}
 
+	before := prd
 	if up.Name != nil {
 		prd.Name = *up.Name
 	}
+	if up.Description != nil {
+		prd.Description = *up.Description
+	}
+	if up.CategoryID != nil {
+		id, err := categoryID(*up.CategoryID)
+		if err != nil {
+			return err
+		}
+		prd.CategoryID = id
+	}
+	if up.Jurisdiction != nil {
+		prd.Jurisdiction = *up.Jurisdiction
+	}
+	if up.Pricing != nil {
+		pr, err := PricingFromString(*up.Pricing)
+		if err != nil {
+			return ErrInvalidPricing
+		}
+		prd.Pricing = *pr
+	}
 	if up.Cost != nil {
 		prd.Cost = *up.Cost
 	}
+	if up.Availability != nil {
+		a, err := AvailabilityFromString(*up.Availability)
+		if err != nil {
+			return ErrInvalidAvailability
+		}
+		prd.Availability = *a
+	}
 	if up.Quantity != nil {
 		prd.Quantity = *up.Quantity
 	}
@@ -105,67 +258,249 @@ func (p Product) Update(ctx context.Context, traceID string, claims auth.Claims,
 		products
 	SET
 		"name" = $2,
-		"cost" = $3,
-		"quantity" = $4,
-		"date_updated" = $5
+		"description" = $3,
+		"category_id" = $4,
+		"jurisdiction_code" = $5,
+		"pricing" = $6,
+		"cost" = $7,
+		"availability" = $8,
+		"quantity" = $9,
+		"date_updated" = $10
 	WHERE
 		product_id = $1`
 
+	args := []interface{}{productID, prd.Name, prd.Description, nullable(prd.CategoryID), nullable(prd.Jurisdiction),
+		prd.Pricing, prd.Cost, prd.Availability, prd.Quantity, prd.DateUpdated}
+
 	p.log.Printf("%s: %s: %s", traceID, "product.Update",
-		database.Log(q, productID, prd.Name, prd.Cost, prd.Quantity, prd.DateUpdated),
+		database.Log(q, args...),
 	)
 
-	if _, err = p.db.ExecContext(ctx, q, productID, prd.Name, prd.Cost, prd.Quantity, prd.DateUpdated); err != nil {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	if err := p.checkListing(ctx, tx, traceID, prd.CategoryID, prd.Jurisdiction); err != nil {
+		return err
+	}
+
+	if up.Quantity != nil {
+		if err := p.checkQuantity(ctx, tx, traceID, productID, prd.Quantity); err != nil {
+			return err
+		}
+	}
+
+	if _, err = tx.ExecContext(ctx, q, args...); err != nil {
 		return errors.Wrap(err, "updating product")
 	}
 
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionUpdate,
+		EntityType: "product",
+		EntityID:   productID,
+		Before:     before,
+		After:      prd,
+	}
+	if err := audit.Record(ctx, p.log, tx, traceID, ne, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing product")
+	}
+
 	return nil
 }
 
-// Delete removes the product identified by a given ID.
-func (p Product) Delete(ctx context.Context, traceID string, productID string) error {
+// Delete marks the product identified by a given ID as deleted. Deleted
+// products are left out of queries, until they are restored or purged.
+// Deleting a product that does not exist is not an error.
+func (p Product) Delete(ctx context.Context, traceID string, claims auth.Claims, productID string, now time.Time) error {
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.product.delete")
 	defer span.End()
 
-	if _, err := uuid.Parse(productID); err != nil {
-		return ErrInvalidID
+	prd, err := p.QueryByID(ctx, traceID, productID)
+	if err != nil {
+		if err == ErrNotFound {
+			return nil
+		}
+		return err
+	}
+
+	if !p.policy.AllowedFor(claims, auth.PermissionProductEdit, prd.UserID) {
+		return ErrForbidden
 	}
 
 	const q = `
-	DELETE FROM
+	UPDATE
 		products
+	SET
+		"deleted_at" = $2
 	WHERE
-		product_id = $1`
+		product_id = $1 AND deleted_at IS NULL`
+
+	deleted := now.UTC()
 
 	p.log.Printf("%s: %s: %s", traceID, "product.Delete",
-		database.Log(q, productID),
+		database.Log(q, productID, deleted),
 	)
 
-	if _, err := p.db.ExecContext(ctx, q, productID); err != nil {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, q, productID, deleted); err != nil {
 		return errors.Wrapf(err, "deleting product %s", productID)
 	}
 
+	after := prd
+	after.DeletedAt = &deleted
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionDelete,
+		EntityType: "product",
+		EntityID:   productID,
+		Before:     prd,
+		After:      after,
+	}
+	if err := audit.Record(ctx, p.log, tx, traceID, ne, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing product")
+	}
+
+	return nil
+}
+
+// Restore undoes the deletion of a Product.
+func (p Product) Restore(ctx context.Context, traceID string, claims auth.Claims, productID string, now time.Time) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.product.restore")
+	defer span.End()
+
+	if _, err := uuid.Parse(productID); err != nil {
+		return ErrInvalidID
+	}
+
+	if !p.policy.Allowed(claims, auth.PermissionRecordRestore) {
+		return ErrForbidden
+	}
+
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	q := `
+	SELECT` + columns + `
+	FROM
+		products AS p
+	WHERE
+		p.product_id = $1 AND p.deleted_at IS NOT NULL
+	FOR UPDATE`
+
+	p.log.Printf("%s: %s: %s", traceID, "product.Restore",
+		database.Log(q, productID),
+	)
+
+	var prd Info
+	if err := tx.GetContext(ctx, &prd, q, productID); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return errors.Wrapf(err, "selecting deleted product %q", productID)
+	}
+
+	q = `
+	UPDATE
+		products
+	SET
+		"deleted_at" = NULL,
+		"date_updated" = $2
+	WHERE
+		product_id = $1`
+
+	p.log.Printf("%s: %s: %s", traceID, "product.Restore",
+		database.Log(q, productID, now.UTC()),
+	)
+
+	if _, err := tx.ExecContext(ctx, q, productID, now.UTC()); err != nil {
+		return errors.Wrapf(err, "restoring product %s", productID)
+	}
+
+	after := prd
+	after.DeletedAt = nil
+	after.DateUpdated = now.UTC()
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionRestore,
+		EntityType: "product",
+		EntityID:   productID,
+		Before:     prd,
+		After:      after,
+	}
+	if err := audit.Record(ctx, p.log, tx, traceID, ne, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing product")
+	}
+
 	return nil
 }
 
+// Purge permanently removes the products deleted before the specified time.
+// Products that were sold are kept, since removing them would remove the
+// sales as well. It returns the number of products removed.
+func (p Product) Purge(ctx context.Context, traceID string, before time.Time) (int, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.product.purge")
+	defer span.End()
+
+	const q = `
+	DELETE FROM
+		products AS p
+	WHERE
+		p.deleted_at < $1 AND
+		NOT EXISTS (SELECT 1 FROM sales AS s WHERE s.product_id = p.product_id)`
+
+	p.log.Printf("%s: %s: %s", traceID, "product.Purge",
+		database.Log(q, before.UTC()),
+	)
+
+	res, err := p.db.ExecContext(ctx, q, before.UTC())
+	if err != nil {
+		return 0, errors.Wrap(err, "purging products")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "purging products")
+	}
+
+	return int(n), nil
+}
+
 // Query gets all Products from the database.
 func (p Product) Query(ctx context.Context, traceID string, pageNumber int, rowsPerPage int) ([]Info, error) {
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.product.query")
 	defer span.End()
 
 	const q = `
-	SELECT
-		p.*,
-		COALESCE(SUM(s.quantity) ,0) AS sold,
-		COALESCE(SUM(s.paid), 0) AS revenue
+	SELECT` + columns + `
 	FROM
 		products AS p
-	LEFT JOIN
-		sales AS s ON p.product_id = s.product_id
-	GROUP BY
-		p.product_id
+	WHERE
+		p.deleted_at IS NULL
 	ORDER BY
-		user_id
+		p.user_id
 	OFFSET $1 ROWS FETCH NEXT $2 ROWS ONLY`
 	offset := (pageNumber - 1) * rowsPerPage
 
@@ -191,18 +526,11 @@ func (p Product) QueryByID(ctx context.Context, traceID string, productID string
 	}
 
 	const q = `
-	SELECT
-		p.*,
-		COALESCE(SUM(s.quantity), 0) AS sold,
-		COALESCE(SUM(s.paid), 0) AS revenue
+	SELECT` + columns + `
 	FROM
 		products AS p
-	LEFT JOIN
-		sales AS s ON p.product_id = s.product_id
 	WHERE
-		p.product_id = $1
-	GROUP BY
-		p.product_id`
+		p.product_id = $1 AND p.deleted_at IS NULL`
 
 	p.log.Printf("%s: %s: %s", traceID, "product.QueryByID",
 		database.Log(q, productID),
@@ -218,3 +546,320 @@ func (p Product) QueryByID(ctx context.Context, traceID string, productID string
 
 	return prd, nil
 }
+
+// QueryByUser gets all products created by the user identified by a given ID,
+// including deleted ones.
+func (p Product) QueryByUser(ctx context.Context, traceID string, userID string) ([]Info, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.product.querybyuser")
+	defer span.End()
+
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	const q = `
+	SELECT` + columns + `
+	FROM
+		products AS p
+	WHERE
+		p.user_id = $1
+	ORDER BY
+		p.date_created`
+
+	p.log.Printf("%s: %s: %s", traceID, "product.QueryByUser",
+		database.Log(q, userID),
+	)
+
+	products := []Info{}
+	if err := p.db.SelectContext(ctx, &products, q, userID); err != nil {
+		return nil, errors.Wrapf(err, "selecting products of user %q", userID)
+	}
+
+	return products, nil
+}
+
+// QueryByProfile gets the products offered by the service provider profile
+// identified by a given name, ordered by name.
+func (p Product) QueryByProfile(ctx context.Context, traceID string, name string, pageNumber int, rowsPerPage int) ([]Info, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.product.querybyprofile")
+	defer span.End()
+
+	const q = `
+	SELECT` + columns + `
+	FROM
+		products AS p
+	WHERE
+		p.profile_name = $1 AND p.deleted_at IS NULL
+	ORDER BY
+		p.name, p.product_id
+	OFFSET $2 ROWS FETCH NEXT $3 ROWS ONLY`
+	offset := (pageNumber - 1) * rowsPerPage
+
+	p.log.Printf("%s: %s: %s", traceID, "product.QueryByProfile",
+		database.Log(q, name, offset, rowsPerPage),
+	)
+
+	products := []Info{}
+	if err := p.db.SelectContext(ctx, &products, q, name, offset, rowsPerPage); err != nil {
+		return nil, errors.Wrapf(err, "selecting products of profile %q", name)
+	}
+
+	return products, nil
+}
+
+// Browse gets the products matching the filter across all service providers,
+// ordered by name. Products that are unavailable or offered by a deleted
+// profile are left out.
+func (p Product) Browse(ctx context.Context, traceID string, filter Filter, pageNumber int, rowsPerPage int) ([]Info, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.product.browse")
+	defer span.End()
+
+	if filter.CategoryID != "" {
+		id, err := uuid.Parse(filter.CategoryID)
+		if err != nil {
+			return nil, ErrInvalidID
+		}
+		filter.CategoryID = id.String()
+	}
+
+	// The category filter includes the subcategories, guarding against cycles
+	// the way the category tree does.
+	const q = `
+	WITH RECURSIVE tree (category_id, path) AS (
+		SELECT
+			category_id, ARRAY[category_id]
+		FROM
+			categories
+		WHERE
+			category_id::TEXT = $1 AND deleted_at IS NULL
+		UNION ALL
+		SELECT
+			c.category_id, t.path || c.category_id
+		FROM
+			categories AS c
+		JOIN
+			tree AS t ON c.parent_id = t.category_id
+		WHERE
+			c.deleted_at IS NULL AND NOT c.category_id = ANY(t.path)
+	)
+	SELECT` + columns + `
+	FROM
+		products AS p
+	JOIN
+		profiles AS o ON o.name = p.profile_name
+	WHERE
+		p.deleted_at IS NULL AND o.deleted_at IS NULL AND
+		p.availability <> 'unavailable' AND
+		($1 = '' OR p.category_id IN (SELECT category_id FROM tree)) AND
+		($2 = '' OR p.jurisdiction_code = $2) AND
+		($3 = '' OR EXISTS (
+			SELECT 1 FROM jurisdictions AS j
+			WHERE j.code = p.jurisdiction_code AND j.country_code = $3
+		)) AND
+		($4 = '' OR p.pricing = $4)
+	ORDER BY
+		p.name, p.product_id
+	OFFSET $5 ROWS FETCH NEXT $6 ROWS ONLY`
+
+	offset := (pageNumber - 1) * rowsPerPage
+	country := strings.ToUpper(filter.Country)
+
+	p.log.Printf("%s: %s: %s", traceID, "product.Browse",
+		database.Log(q, filter.CategoryID, filter.Jurisdiction, country, string(filter.Pricing), offset, rowsPerPage),
+	)
+
+	products := []Info{}
+	if err := p.db.SelectContext(ctx, &products, q, filter.CategoryID, filter.Jurisdiction, country, string(filter.Pricing), offset, rowsPerPage); err != nil {
+		return nil, errors.Wrap(err, "browsing products")
+	}
+
+	return products, nil
+}
+
+// checkProvider verifies a product can be offered by the profile identified
+// by a given name. It must be a service provider profile the claims allow
+// editing. The profile is locked against deletion until the transaction ends.
+func (p Product) checkProvider(ctx context.Context, tx sqlx.QueryerContext, traceID string, claims auth.Claims, name string) error {
+	const q = `
+	SELECT
+		user_id, type
+	FROM
+		profiles
+	WHERE
+		name = $1 AND deleted_at IS NULL
+	FOR SHARE`
+
+	p.log.Printf("%s: %s: %s", traceID, "product.checkProvider",
+		database.Log(q, name),
+	)
+
+	var o struct {
+		UserID string `db:"user_id"`
+		Type   string `db:"type"`
+	}
+	if err := sqlx.GetContext(ctx, tx, &o, q, name); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrUnknownProfile
+		}
+		return errors.Wrapf(err, "selecting profile %q", name)
+	}
+
+	if o.Type != string(profile.ServiceProviderProfile) {
+		return ErrNotProvider
+	}
+	if !p.policy.AllowedFor(claims, auth.PermissionProfileEdit, o.UserID) {
+		return ErrForbidden
+	}
+
+	return nil
+}
+
+// checkListing verifies the category and jurisdiction of a product exist, if
+// it has any.
+func (p Product) checkListing(ctx context.Context, tx sqlx.QueryerContext, traceID string, categoryID string, jurisdiction string) error {
+	if categoryID != "" {
+		const q = `
+		SELECT
+			COUNT(*)
+		FROM
+			categories
+		WHERE
+			category_id = $1 AND deleted_at IS NULL`
+
+		p.log.Printf("%s: %s: %s", traceID, "product.checkListing",
+			database.Log(q, categoryID),
+		)
+
+		var n int
+		if err := sqlx.GetContext(ctx, tx, &n, q, categoryID); err != nil {
+			return errors.Wrap(err, "counting categories")
+		}
+		if n == 0 {
+			return ErrUnknownCategory
+		}
+	}
+
+	if jurisdiction != "" {
+		const q = `
+		SELECT
+			COUNT(*)
+		FROM
+			jurisdictions
+		WHERE
+			code = $1`
+
+		p.log.Printf("%s: %s: %s", traceID, "product.checkListing",
+			database.Log(q, jurisdiction),
+		)
+
+		var n int
+		if err := sqlx.GetContext(ctx, tx, &n, q, jurisdiction); err != nil {
+			return errors.Wrap(err, "counting jurisdictions")
+		}
+		if n == 0 {
+			return ErrUnknownJurisdiction
+		}
+	}
+
+	return nil
+}
+
+// checkQuantity verifies no more items of the product were sold than the
+// provided quantity. The product is locked the way sales lock it, so no
+// sale can slip in between the check and the update.
+func (p Product) checkQuantity(ctx context.Context, tx sqlx.QueryerContext, traceID string, productID string, quantity int) error {
+	q := `
+	SELECT
+		product_id
+	FROM
+		products
+	WHERE
+		product_id = $1
+	FOR UPDATE`
+
+	p.log.Printf("%s: %s: %s", traceID, "product.checkQuantity",
+		database.Log(q, productID),
+	)
+
+	var id string
+	if err := sqlx.GetContext(ctx, tx, &id, q, productID); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return errors.Wrapf(err, "locking product %q", productID)
+	}
+
+	q = `
+	SELECT
+		COALESCE(SUM(quantity), 0)
+	FROM
+		sales
+	WHERE
+		product_id = $1`
+
+	p.log.Printf("%s: %s: %s", traceID, "product.checkQuantity",
+		database.Log(q, productID),
+	)
+
+	var sold int
+	if err := sqlx.GetContext(ctx, tx, &sold, q, productID); err != nil {
+		return errors.Wrapf(err, "counting items sold of product %q", productID)
+	}
+
+	if quantity < sold {
+		return ErrQuantityBelowSold
+	}
+
+	return nil
+}
+
+// categoryID returns the provided category ID in lower case, the way it is
+// read back from the database. A blank ID stays blank.
+func categoryID(id string) (string, error) {
+	if id == "" {
+		return "", nil
+	}
+	u, err := uuid.Parse(id)
+	if err != nil {
+		return "", ErrInvalidID
+	}
+	return u.String(), nil
+}
+
+// nullable returns NULL for a blank value, for optional references to other
+// tables.
+func nullable(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// HideSales clears the number of items sold and the revenue of the products
+// the claims don't allow editing, so only their owners see them.
+func (p Product) HideSales(claims auth.Claims, products []Info) {
+	for i := range products {
+		if !p.policy.AllowedFor(claims, auth.PermissionProductEdit, products[i].UserID) {
+			products[i].Sold = 0
+			products[i].Revenue = 0
+		}
+	}
+}
+
+// Convert expresses the cost and revenue of a product in another currency,
+// using the specified exchange rates.
+func Convert(prd Info, rates currency.Rates, code string) (Info, error) {
+	code = strings.ToUpper(code)
+
+	cost, err := rates.Convert(prd.Cost, prd.Currency, code)
+	if err != nil {
+		return Info{}, errors.Wrapf(err, "converting cost of product %q", prd.ID)
+	}
+	revenue, err := rates.Convert(prd.Revenue, prd.Currency, code)
+	if err != nil {
+		return Info{}, errors.Wrapf(err, "converting revenue of product %q", prd.ID)
+	}
+
+	prd.Cost = cost
+	prd.Revenue = revenue
+	prd.Currency = code
+
+	return prd, nil
+}
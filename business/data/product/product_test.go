@@ -7,9 +7,11 @@ import (
 
 	"github.com/appinesshq/bpi/business/auth"
 	"github.com/appinesshq/bpi/business/data/product"
+	"github.com/appinesshq/bpi/business/data/profile"
 	"github.com/appinesshq/bpi/business/tests"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/google/go-cmp/cmp"
+	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 )
 
@@ -17,7 +19,8 @@ func TestProduct(t *testing.T) {
 	log, db, teardown := tests.NewUnit(t)
 	t.Cleanup(teardown)
 
-	p := product.New(log, db)
+	p := product.New(log, db, tests.Policy())
+	prf := profile.New(log, db, tests.Policy())
 
 	t.Log("Given the need to work with Product records.")
 	{
@@ -39,9 +42,15 @@ func TestProduct(t *testing.T) {
 				Roles: []string{auth.RoleAdmin, auth.RoleUser},
 			}
 
+			if _, err := prf.Create(ctx, traceID, claims, profile.NewProfile{Name: "acme", Type: "SER", DisplayName: "Acme"}, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a provider : %s.", tests.Failed, testID, err)
+			}
+
 			np := product.NewProduct{
 				Name:     "Comic Books",
+				Profile:  "acme",
 				Cost:     10,
+				Currency: "EUR",
 				Quantity: 55,
 			}
 
@@ -114,7 +123,15 @@ func TestProduct(t *testing.T) {
 				t.Logf("\t%s\tTest %d:\tShould be able to see updated Name field.", tests.Success, testID)
 			}
 
-			if err := p.Delete(ctx, traceID, prd.ID); err != nil {
+			otherClaims := claims
+			otherClaims.Subject = "2ab4d7c1-9e3f-4a5b-8c6d-7e8f9a0b1c2d"
+			otherClaims.Roles = []string{auth.RoleUser}
+			if err := p.Delete(ctx, traceID, otherClaims, prd.ID, now); errors.Cause(err) != product.ErrForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to delete the product of another user : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to delete the product of another user.", tests.Success, testID)
+
+			if err := p.Delete(ctx, traceID, claims, prd.ID, now); err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to delete product : %s.", tests.Failed, testID, err)
 			}
 			t.Logf("\t%s\tTest %d:\tShould be able to delete product.", tests.Success, testID)
@@ -124,6 +141,240 @@ func TestProduct(t *testing.T) {
 				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to retrieve deleted product : %s.", tests.Failed, testID, err)
 			}
 			t.Logf("\t%s\tTest %d:\tShould NOT be able to retrieve deleted product.", tests.Success, testID)
+
+			userClaims := claims
+			userClaims.Roles = []string{auth.RoleUser}
+			if err := p.Restore(ctx, traceID, userClaims, prd.ID, now); errors.Cause(err) != product.ErrForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to restore product as a user : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to restore product as a user.", tests.Success, testID)
+
+			if err := p.Restore(ctx, traceID, claims, prd.ID, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to restore product : %s.", tests.Failed, testID, err)
+			}
+			if _, err := p.QueryByID(ctx, traceID, prd.ID); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve restored product : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to restore product.", tests.Success, testID)
+
+			if err := p.Delete(ctx, traceID, claims, prd.ID, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to delete product again : %s.", tests.Failed, testID, err)
+			}
+
+			n, err := p.Purge(ctx, traceID, now)
+			if err != nil || n != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT purge products deleted within the period : %d, %v.", tests.Failed, testID, n, err)
+			}
+			n, err = p.Purge(ctx, traceID, now.Add(time.Second))
+			if err != nil || n != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould purge products deleted before the period : %d, %v.", tests.Failed, testID, n, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould purge products deleted before the period.", tests.Success, testID)
+
+			if err := p.Restore(ctx, traceID, claims, prd.ID, now); errors.Cause(err) != product.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to restore a purged product : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to restore a purged product.", tests.Success, testID)
+
+			sold, err := p.Create(ctx, traceID, claims, np, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a product : %s.", tests.Failed, testID, err)
+			}
+			const sale = `INSERT INTO sales (sale_id, product_id, quantity, paid, date_created) VALUES ('b5b3b5c1-6b0c-4a4e-9c1f-0e3c5d7a9b11', $1, 1, 10, $2)`
+			if _, err := db.ExecContext(ctx, sale, sold.ID, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to sell the product : %s.", tests.Failed, testID, err)
+			}
+			sold, err = p.QueryByID(ctx, traceID, sold.ID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve the sold product : %s.", tests.Failed, testID, err)
+			}
+			other := auth.Claims{
+				StandardClaims: jwt.StandardClaims{Subject: "45b5fbd3-755f-4379-8f07-a58d4a30fa2f"},
+				Roles:          []string{auth.RoleUser},
+			}
+			products = []product.Info{sold, sold}
+			p.HideSales(claims, products[:1])
+			p.HideSales(other, products[1:])
+			if products[0].Sold != 1 || products[0].Revenue != 10 || products[1].Sold != 0 || products[1].Revenue != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould only show the sales figures to the owner : %+v.", tests.Failed, testID, products)
+			}
+			t.Logf("\t%s\tTest %d:\tShould only show the sales figures to the owner.", tests.Success, testID)
+			if err := p.Delete(ctx, traceID, claims, sold.ID, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to delete the sold product : %s.", tests.Failed, testID, err)
+			}
+			n, err = p.Purge(ctx, traceID, now.Add(time.Second))
+			if err != nil || n != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT purge sold products : %d, %v.", tests.Failed, testID, n, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT purge sold products.", tests.Success, testID)
+		}
+	}
+}
+
+func seedCatalogue(db *sqlx.DB) error {
+	const q = `
+	INSERT INTO countries (gnid, code, name, currency_code, currency_name, active) VALUES
+	(2750405, 'NL', 'Netherlands', 'EUR', 'Euro', TRUE),
+	(2802361, 'BE', 'Belgium', 'EUR', 'Euro', TRUE);
+
+	INSERT INTO jurisdictions (gnid, code, country_code, name, active) VALUES
+	(2743698, 'NL.11', 'NL', 'South Holland', TRUE),
+	(3337388, 'BE.BRU', 'BE', 'Brussels Capital', TRUE);
+
+	INSERT INTO categories (category_id, slug, name, parent_id, date_created, date_updated) VALUES
+	('5cf37266-3473-4006-984f-9325122678b7', 'legal', 'Legal', NULL, NOW(), NOW()),
+	('45b5fbd3-755f-4379-8f07-a58d4a30fa2f', 'company-formation', 'Company formation', '5cf37266-3473-4006-984f-9325122678b7', NOW(), NOW()),
+	('a2b0639f-2cc6-44b8-b97b-15d69dbb511e', 'accounting', 'Accounting', NULL, NOW(), NOW());
+	`
+	_, err := db.ExecContext(context.Background(), q)
+	return err
+}
+
+func TestCatalogue(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	if err := seedCatalogue(db); err != nil {
+		t.Fatalf("Couldn't seed database: %v", err)
+	}
+
+	p := product.New(log, db, tests.Policy())
+	prf := profile.New(log, db, tests.Policy())
+
+	t.Log("Given the need to offer services of providers.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen offering services in categories and jurisdictions.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+			legal := "5cf37266-3473-4006-984f-9325122678b7"
+			formation := "45b5fbd3-755f-4379-8f07-a58d4a30fa2f"
+			accounting := "a2b0639f-2cc6-44b8-b97b-15d69dbb511e"
+
+			claims := auth.Claims{
+				StandardClaims: jwt.StandardClaims{
+					Issuer:    "MB Appiness Solutions",
+					Subject:   "718ffbea-f4a1-4667-8ae3-b349da52675e",
+					Audience:  "users",
+					ExpiresAt: now.Add(time.Hour).Unix(),
+					IssuedAt:  now.Unix(),
+				},
+				Roles: []string{auth.RoleUser},
+			}
+			other := claims
+			other.Subject = "45b5fbd3-755f-4379-8f07-a58d4a30fa2f"
+
+			nps := []profile.NewProfile{
+				{Name: "acme", Type: "SER", DisplayName: "Acme Lawyers"},
+				{Name: "numbers", Type: "SER", DisplayName: "Numbers Accountants"},
+				{Name: "shop", Type: "BUS", DisplayName: "Shop"},
+			}
+			for _, np := range nps {
+				if _, err := prf.Create(ctx, traceID, claims, np, now); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to create profile %s : %s.", tests.Failed, testID, np.Name, err)
+				}
+			}
+
+			offerings := []product.NewProduct{
+				{Name: "Dutch BV", Profile: "acme", CategoryID: formation, Jurisdiction: "NL.11", Cost: 99900, Currency: "EUR", Quantity: 10},
+				{Name: "Belgian BV", Profile: "acme", CategoryID: formation, Jurisdiction: "BE.BRU", Pricing: "from", Cost: 120000, Currency: "EUR", Quantity: 10},
+				{Name: "Legal advice", Profile: "acme", CategoryID: legal, Pricing: "hourly", Cost: 15000, Currency: "EUR", Availability: "on_request", Quantity: 100},
+				{Name: "Bookkeeping", Profile: "numbers", CategoryID: accounting, Jurisdiction: "NL.11", Pricing: "hourly", Cost: 6000, Currency: "EUR", Quantity: 100},
+				{Name: "Tax returns", Profile: "numbers", CategoryID: accounting, Cost: 25000, Currency: "EUR", Availability: "unavailable", Quantity: 10},
+			}
+			for _, np := range offerings {
+				if _, err := p.Create(ctx, traceID, claims, np, now); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to offer %s : %s.", tests.Failed, testID, np.Name, err)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to offer services.", tests.Success, testID)
+
+			invalid := []struct {
+				np     product.NewProduct
+				claims auth.Claims
+				err    error
+			}{
+				{product.NewProduct{Name: "Nothing", Profile: "nobody", Cost: 1, Currency: "EUR", Quantity: 1}, claims, product.ErrUnknownProfile},
+				{product.NewProduct{Name: "Shelves", Profile: "shop", Cost: 1, Currency: "EUR", Quantity: 1}, claims, product.ErrNotProvider},
+				{product.NewProduct{Name: "Dutch BV", Profile: "acme", Cost: 1, Currency: "EUR", Quantity: 1}, other, product.ErrForbidden},
+				{product.NewProduct{Name: "Audits", Profile: "numbers", CategoryID: claims.Subject, Cost: 1, Currency: "EUR", Quantity: 1}, claims, product.ErrUnknownCategory},
+				{product.NewProduct{Name: "Audits", Profile: "numbers", Jurisdiction: "XX.00", Cost: 1, Currency: "EUR", Quantity: 1}, claims, product.ErrUnknownJurisdiction},
+				{product.NewProduct{Name: "Audits", Profile: "numbers", Pricing: "daily", Cost: 1, Currency: "EUR", Quantity: 1}, claims, product.ErrInvalidPricing},
+				{product.NewProduct{Name: "Audits", Profile: "numbers", Availability: "soon", Cost: 1, Currency: "EUR", Quantity: 1}, claims, product.ErrInvalidAvailability},
+			}
+			for _, tt := range invalid {
+				if _, err := p.Create(ctx, traceID, tt.claims, tt.np, now); errors.Cause(err) != tt.err {
+					t.Fatalf("\t%s\tTest %d:\tShould NOT be able to offer %s by %s : %v.", tests.Failed, testID, tt.np.Name, tt.np.Profile, err)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould only offer services of providers the user manages.", tests.Success, testID)
+
+			provided, err := p.QueryByProfile(ctx, traceID, "acme", 1, 10)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to list the offerings of a provider : %s.", tests.Failed, testID, err)
+			}
+			if len(provided) != 3 || provided[0].Name != "Belgian BV" || provided[0].Pricing != product.FromPrice || provided[0].Jurisdiction != "BE.BRU" || provided[0].CategoryID != formation {
+				t.Fatalf("\t%s\tTest %d:\tShould list the offerings of the provider : %+v.", tests.Failed, testID, provided)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to list the offerings of a provider.", tests.Success, testID)
+
+			names := func(filter product.Filter) []string {
+				t.Helper()
+				prds, err := p.Browse(ctx, traceID, filter, 1, 10)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to browse offerings : %s.", tests.Failed, testID, err)
+				}
+				n := []string{}
+				for _, prd := range prds {
+					n = append(n, prd.Name)
+				}
+				return n
+			}
+
+			browse := []struct {
+				filter product.Filter
+				want   []string
+			}{
+				{product.Filter{}, []string{"Belgian BV", "Bookkeeping", "Dutch BV", "Legal advice"}},
+				{product.Filter{CategoryID: legal}, []string{"Belgian BV", "Dutch BV", "Legal advice"}},
+				{product.Filter{CategoryID: formation, Country: "nl"}, []string{"Dutch BV"}},
+				{product.Filter{Jurisdiction: "NL.11"}, []string{"Bookkeeping", "Dutch BV"}},
+				{product.Filter{Pricing: product.HourlyRate}, []string{"Bookkeeping", "Legal advice"}},
+				{product.Filter{CategoryID: accounting, Pricing: product.FixedPrice}, []string{}},
+			}
+			for _, tt := range browse {
+				if diff := cmp.Diff(tt.want, names(tt.filter)); diff != "" {
+					t.Fatalf("\t%s\tTest %d:\tShould find the available offerings matching %+v. Diff:\n%s", tests.Failed, testID, tt.filter, diff)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to browse available offerings across providers.", tests.Success, testID)
+
+			upd := product.UpdateProduct{
+				CategoryID:   tests.StringPointer(""),
+				Jurisdiction: tests.StringPointer(""),
+				Availability: tests.StringPointer("unavailable"),
+			}
+			if err := p.Update(ctx, traceID, claims, provided[0].ID, upd, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to update an offering : %s.", tests.Failed, testID, err)
+			}
+			saved, err := p.QueryByID(ctx, traceID, provided[0].ID)
+			if err != nil || saved.CategoryID != "" || saved.Jurisdiction != "" || saved.Availability != product.Unavailable {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to remove the category and jurisdiction of an offering : %+v, %v.", tests.Failed, testID, saved, err)
+			}
+			if diff := cmp.Diff([]string{"Dutch BV", "Legal advice"}, names(product.Filter{CategoryID: legal})); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT browse unavailable offerings. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to update an offering.", tests.Success, testID)
+
+			if err := prf.Delete(ctx, traceID, claims, "numbers", now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to delete a provider : %s.", tests.Failed, testID, err)
+			}
+			if diff := cmp.Diff([]string{"Dutch BV", "Legal advice"}, names(product.Filter{})); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT browse offerings of deleted providers. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT browse offerings of deleted providers.", tests.Success, testID)
 		}
 	}
 }
@@ -0,0 +1,265 @@
+package profile
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/audit"
+	"github.com/appinesshq/bpi/foundation/database"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+// AttachCategory lists the profile identified by a given name in a category.
+// Attaching a category the profile is already listed in is not an error.
+func (p Profile) AttachCategory(ctx context.Context, traceID string, claims auth.Claims, name string, categoryID string, now time.Time) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.profile.attachcategory")
+	defer span.End()
+
+	id, err := uuid.Parse(categoryID)
+	if err != nil {
+		return ErrInvalidID
+	}
+	categoryID = id.String()
+
+	const q = `
+	INSERT INTO profile_categories
+		(profile_name, category_id, date_created)
+	VALUES
+		($1, $2, $3)
+	ON CONFLICT DO NOTHING`
+
+	l := relink{
+		method: "profile.AttachCategory",
+		q:      q,
+		args:   []interface{}{name, categoryID, now.UTC()},
+		check: func(tx sqlx.QueryerContext) error {
+			return p.checkListings(ctx, tx, traceID, nil, []string{categoryID})
+		},
+		change: func(o *Info) {
+			o.Categories = ids(append(o.Categories, categoryID))
+		},
+	}
+	return p.relink(ctx, traceID, claims, name, l, now)
+}
+
+// DetachCategory removes the profile identified by a given name from a
+// category. Detaching a category the profile isn't listed in is not an error.
+func (p Profile) DetachCategory(ctx context.Context, traceID string, claims auth.Claims, name string, categoryID string, now time.Time) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.profile.detachcategory")
+	defer span.End()
+
+	id, err := uuid.Parse(categoryID)
+	if err != nil {
+		return ErrInvalidID
+	}
+	categoryID = id.String()
+
+	const q = `
+	DELETE FROM
+		profile_categories
+	WHERE
+		profile_name = $1 AND category_id = $2`
+
+	l := relink{
+		method: "profile.DetachCategory",
+		q:      q,
+		args:   []interface{}{name, categoryID},
+		change: func(o *Info) {
+			o.Categories = without(o.Categories, categoryID)
+		},
+	}
+	return p.relink(ctx, traceID, claims, name, l, now)
+}
+
+// AttachJurisdiction marks the profile identified by a given name as serving
+// a jurisdiction. Attaching a jurisdiction the profile already serves is not
+// an error.
+func (p Profile) AttachJurisdiction(ctx context.Context, traceID string, claims auth.Claims, name string, code string, now time.Time) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.profile.attachjurisdiction")
+	defer span.End()
+
+	const q = `
+	INSERT INTO profile_jurisdictions
+		(profile_name, jurisdiction_code, date_created)
+	VALUES
+		($1, $2, $3)
+	ON CONFLICT DO NOTHING`
+
+	l := relink{
+		method: "profile.AttachJurisdiction",
+		q:      q,
+		args:   []interface{}{name, code, now.UTC()},
+		check: func(tx sqlx.QueryerContext) error {
+			return p.checkListings(ctx, tx, traceID, []string{code}, nil)
+		},
+		change: func(o *Info) {
+			o.Jurisdictions = codes(append(o.Jurisdictions, code))
+		},
+	}
+	return p.relink(ctx, traceID, claims, name, l, now)
+}
+
+// DetachJurisdiction marks the profile identified by a given name as no longer
+// serving a jurisdiction. Detaching a jurisdiction the profile doesn't serve
+// is not an error.
+func (p Profile) DetachJurisdiction(ctx context.Context, traceID string, claims auth.Claims, name string, code string, now time.Time) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.profile.detachjurisdiction")
+	defer span.End()
+
+	const q = `
+	DELETE FROM
+		profile_jurisdictions
+	WHERE
+		profile_name = $1 AND jurisdiction_code = $2`
+
+	l := relink{
+		method: "profile.DetachJurisdiction",
+		q:      q,
+		args:   []interface{}{name, code},
+		change: func(o *Info) {
+			o.Jurisdictions = without(o.Jurisdictions, code)
+		},
+	}
+	return p.relink(ctx, traceID, claims, name, l, now)
+}
+
+// QueryDirectory gets the profiles matching the filter from the directory.
+// The directory only lists profiles serving an active jurisdiction of an
+// active country, ordered by display name.
+func (p Profile) QueryDirectory(ctx context.Context, traceID string, filter Filter, pageNumber int, rowsPerPage int) ([]Info, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.profile.querydirectory")
+	defer span.End()
+
+	if filter.CategoryID != "" {
+		id, err := uuid.Parse(filter.CategoryID)
+		if err != nil {
+			return nil, ErrInvalidID
+		}
+		filter.CategoryID = id.String()
+	}
+
+	const q = `
+	SELECT` + columns + `
+	FROM
+		profiles AS p
+	WHERE
+		p.deleted_at IS NULL AND
+		($1 = '' OR p.type = $1) AND
+		($2 = '' OR EXISTS (
+			SELECT 1 FROM profile_categories AS pc
+			WHERE pc.profile_name = p.name AND pc.category_id::TEXT = $2
+		)) AND
+		EXISTS (
+			SELECT 1 FROM profile_jurisdictions AS pj
+			JOIN jurisdictions AS j ON j.code = pj.jurisdiction_code
+			JOIN countries AS c ON c.code = j.country_code
+			WHERE pj.profile_name = p.name AND j.active AND c.active AND
+			($3 = '' OR j.code = $3) AND
+			($4 = '' OR c.code = $4)
+		)
+	ORDER BY
+		p.display_name, p.name
+	OFFSET $5 ROWS FETCH NEXT $6 ROWS ONLY`
+
+	offset := (pageNumber - 1) * rowsPerPage
+	country := strings.ToUpper(filter.Country)
+
+	p.log.Printf("%s: %s: %s", traceID, "profile.QueryDirectory",
+		database.Log(q, string(filter.Type), filter.CategoryID, filter.Jurisdiction, country, offset, rowsPerPage),
+	)
+
+	o := []Info{}
+	if err := p.db.SelectContext(ctx, &o, q, string(filter.Type), filter.CategoryID, filter.Jurisdiction, country, offset, rowsPerPage); err != nil {
+		return nil, errors.Wrap(err, "selecting directory profiles")
+	}
+
+	return o, nil
+}
+
+// relink describes a change to the links of a profile.
+type relink struct {
+	method string                             // Name of the method making the change, for logging.
+	q      string                             // Statement making the change.
+	args   []interface{}                      // Arguments of the statement.
+	check  func(tx sqlx.QueryerContext) error // Optional check run before the change.
+	change func(o *Info)                      // Applies the change to the profile for the audit log.
+}
+
+// relink changes the links of the profile identified by a given name, if the
+// claims allow editing the profile. Changes that don't affect any link are
+// not recorded in the audit log.
+func (p Profile) relink(ctx context.Context, traceID string, claims auth.Claims, name string, l relink, now time.Time) error {
+	o, err := p.QueryByName(ctx, traceID, name)
+	if err != nil {
+		return err
+	}
+
+	if !p.policy.AllowedFor(claims, auth.PermissionProfileEdit, o.UserID) {
+		return ErrForbidden
+	}
+
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	if l.check != nil {
+		if err := l.check(tx); err != nil {
+			return err
+		}
+	}
+
+	p.log.Printf("%s: %s: %s", traceID, l.method,
+		database.Log(l.q, l.args...),
+	)
+
+	res, err := tx.ExecContext(ctx, l.q, l.args...)
+	if err != nil {
+		return errors.Wrapf(err, "changing links of profile %s", name)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrapf(err, "changing links of profile %s", name)
+	}
+	if n == 0 {
+		return nil
+	}
+
+	after := o
+	l.change(&after)
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionUpdate,
+		EntityType: "profile",
+		EntityID:   name,
+		Before:     o,
+		After:      after,
+		Sensitive:  sensitive,
+	}
+	if err := audit.Record(ctx, p.log, tx, traceID, ne, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing profile")
+	}
+
+	return nil
+}
+
+// without returns the values other than the one provided.
+func without(values []string, value string) []string {
+	w := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != value {
+			w = append(w, v)
+		}
+	}
+	return w
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"strings"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 // Type represents a particular type of profile.
@@ -42,19 +44,38 @@ func TypeFromString(s string) (*Type, error) {
 
 // Info represents an individual profile.
 type Info struct {
-	Name        string    `db:"name" json:"name"`                 // Unique profile name
-	Type        Type      `db:"type" json:"type"`                 // Profile type
-	DisplayName string    `db:"display_name" json:"display_name"` // Display name of the profile.
-	UserID      string    `db:"user_id" json:"user_id"`           // ID of the user who created the profile.
-	DateCreated time.Time `db:"date_created" json:"date_created"` // When the profile was added.
-	DateUpdated time.Time `db:"date_updated" json:"date_updated"` // When the profile record was last modified.
+	Name          string         `db:"name" json:"name"`                       // Unique profile name
+	Type          Type           `db:"type" json:"type"`                       // Profile type
+	DisplayName   string         `db:"display_name" json:"display_name"`       // Display name of the profile.
+	Bio           string         `db:"bio" json:"bio"`                         // Description of the person or business.
+	Website       string         `db:"website" json:"website"`                 // URL of the website.
+	ContactEmail  string         `db:"contact_email" json:"contact_email"`     // Email address for contacting the profile.
+	ContactPhone  string         `db:"contact_phone" json:"contact_phone"`     // Phone number in E.164 format.
+	Languages     pq.StringArray `db:"languages" json:"languages"`             // ISO 639-1 codes of the languages spoken.
+	LogoURL       string         `db:"logo_url" json:"logo_url"`               // URL of the logo.
+	Jurisdictions pq.StringArray `db:"jurisdictions" json:"jurisdictions"`     // Codes of the jurisdictions served.
+	Categories    pq.StringArray `db:"categories" json:"categories"`           // IDs of the categories the profile is listed in.
+	Rating        float64        `db:"rating" json:"rating"`                   // Average rating of the visible reviews, 0 without any.
+	Reviews       int            `db:"reviews" json:"reviews"`                 // Number of visible reviews.
+	UserID        string         `db:"user_id" json:"user_id"`                 // ID of the user who created the profile.
+	DateCreated   time.Time      `db:"date_created" json:"date_created"`       // When the profile was added.
+	DateUpdated   time.Time      `db:"date_updated" json:"date_updated"`       // When the profile record was last modified.
+	DeletedAt     *time.Time     `db:"deleted_at" json:"deleted_at,omitempty"` // When the profile was deleted, until it is purged.
 }
 
 // NewProfile is what we require from clients when adding a Profile.
 type NewProfile struct {
-	Name        string `json:"name" validate:"required"`
-	Type        string `json:"type" validate:"required"`
-	DisplayName string `json:"display_name" validate:"required"`
+	Name          string   `json:"name" validate:"required"`
+	Type          string   `json:"type" validate:"required"`
+	DisplayName   string   `json:"display_name" validate:"required"`
+	Bio           string   `json:"bio" validate:"max=5000"`
+	Website       string   `json:"website" validate:"omitempty,url"`
+	ContactEmail  string   `json:"contact_email" validate:"omitempty,email"`
+	ContactPhone  string   `json:"contact_phone" validate:"omitempty,e164"`
+	Languages     []string `json:"languages" validate:"dive,len=2,alpha"`
+	LogoURL       string   `json:"logo_url" validate:"omitempty,url"`
+	Jurisdictions []string `json:"jurisdictions" validate:"dive,required"`
+	Categories    []string `json:"categories" validate:"dive,uuid"`
 }
 
 // UpdateProfile defines what information may be provided to modify an
@@ -62,8 +83,32 @@ type NewProfile struct {
 // fields they want changed. It uses pointer fields so we can differentiate
 // between a field that was not provided and a field that was provided as
 // explicitly blank. Normally we do not want to use pointers to basic types but
-// we make exceptions around marshalling/unmarshalling.
+// we make exceptions around marshalling/unmarshalling. Lists that are not
+// provided stay as they are, an empty list clears them.
 type UpdateProfile struct {
-	Name        *string `json:"name"`
-	DisplayName *string `json:"display_name"`
+	Name          *string  `json:"name" validate:"omitempty,min=1"`
+	DisplayName   *string  `json:"display_name" validate:"omitempty,min=1"`
+	Bio           *string  `json:"bio" validate:"omitempty,max=5000"`
+	Website       *string  `json:"website" validate:"omitempty,len=0|url"`
+	ContactEmail  *string  `json:"contact_email" validate:"omitempty,len=0|email"`
+	ContactPhone  *string  `json:"contact_phone" validate:"omitempty,len=0|e164"`
+	Languages     []string `json:"languages" validate:"dive,len=2,alpha"`
+	LogoURL       *string  `json:"logo_url" validate:"omitempty,len=0|url"`
+	Jurisdictions []string `json:"jurisdictions" validate:"dive,required"`
+	Categories    []string `json:"categories" validate:"dive,uuid"`
+}
+
+// Filter narrows down the profiles listed in the directory. Empty fields match
+// any profile.
+type Filter struct {
+	Type         Type   // Type of the profiles.
+	CategoryID   string // ID of a category the profiles are listed in.
+	Jurisdiction string // Code of a jurisdiction the profiles serve.
+	Country      string // Code of the country of a jurisdiction the profiles serve.
+}
+
+// Owner describes who owns a profile and what type of profile it is.
+type Owner struct {
+	UserID string `db:"user_id"`
+	Type   string `db:"type"`
 }
@@ -5,11 +5,16 @@ import (
 	"context"
 	"database/sql"
 	"log"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/audit"
 	"github.com/appinesshq/bpi/foundation/database"
+	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 	"go.opentelemetry.io/otel/api/trace"
 )
@@ -23,19 +28,64 @@ var (
 
 	// ErrForbidden occurs when a user tries to do something that is forbidden to them according to our access control policies.
 	ErrForbidden = errors.New("attempted action is not allowed")
+
+	// ErrUnknownJurisdiction occurs when a profile is listed in a jurisdiction
+	// that does not exist.
+	ErrUnknownJurisdiction = errors.New("unknown jurisdiction")
+
+	// ErrUnknownCategory occurs when a profile is listed in a category that
+	// does not exist.
+	ErrUnknownCategory = errors.New("unknown category")
+
+	// ErrNameExists occurs when a profile is created or renamed with a name
+	// that is already taken by another profile.
+	ErrNameExists = errors.New("profile name is already in use")
 )
 
+// sensitive lists the fields of profiles recorded in the audit log without
+// their values, so the log doesn't hold contact details in the clear.
+var sensitive = []string{"contact_email", "contact_phone"}
+
+// columns selects a profile from profiles aliased as p, along with the
+// categories and jurisdictions it is listed in and the score of its reviews.
+// Hidden reviews and reviews written as deleted profiles don't count.
+const columns = `
+		p.name, p.type, p.display_name, p.bio, p.website, p.contact_email,
+		p.contact_phone, p.languages, p.logo_url, p.user_id, p.date_created,
+		p.date_updated, p.deleted_at,
+		ARRAY(
+			SELECT pc.category_id::TEXT FROM profile_categories AS pc
+			WHERE pc.profile_name = p.name ORDER BY pc.category_id
+		) AS categories,
+		ARRAY(
+			SELECT pj.jurisdiction_code FROM profile_jurisdictions AS pj
+			WHERE pj.profile_name = p.name ORDER BY pj.jurisdiction_code COLLATE "C"
+		) AS jurisdictions,
+		(
+			SELECT COALESCE(ROUND(AVG(r.rating), 2), 0)::FLOAT8 FROM reviews AS r
+			JOIN profiles AS rp ON rp.name = r.reviewer_name
+			WHERE r.provider_name = p.name AND NOT r.hidden AND rp.deleted_at IS NULL
+		) AS rating,
+		(
+			SELECT COUNT(*) FROM reviews AS r
+			JOIN profiles AS rp ON rp.name = r.reviewer_name
+			WHERE r.provider_name = p.name AND NOT r.hidden AND rp.deleted_at IS NULL
+		) AS reviews`
+
 // Profile manages the set of API's for profile access.
 type Profile struct {
-	log *log.Logger
-	db  *sqlx.DB
+	log    *log.Logger
+	db     *sqlx.DB
+	policy *auth.Policy
 }
 
-// New constructs a Profile for api access.
-func New(log *log.Logger, db *sqlx.DB) Profile {
+// New constructs a Profile for api access. The policy decides which
+// actions the claims passed to its methods allow.
+func New(log *log.Logger, db *sqlx.DB, policy *auth.Policy) Profile {
 	return Profile{
-		log: log,
-		db:  db,
+		log:    log,
+		db:     db,
+		policy: policy,
 	}
 }
 
@@ -51,28 +101,73 @@ func (p Profile) Create(ctx context.Context, traceID string, claims auth.Claims,
 	}
 
 	n := Info{
-		Name:        np.Name,
-		DisplayName: np.DisplayName,
-		Type:        *t,
-		UserID:      claims.Subject,
-		DateCreated: now.UTC(),
-		DateUpdated: now.UTC(),
+		Name:          np.Name,
+		DisplayName:   np.DisplayName,
+		Type:          *t,
+		Bio:           np.Bio,
+		Website:       np.Website,
+		ContactEmail:  np.ContactEmail,
+		ContactPhone:  np.ContactPhone,
+		Languages:     languages(np.Languages),
+		LogoURL:       np.LogoURL,
+		Jurisdictions: codes(np.Jurisdictions),
+		Categories:    ids(np.Categories),
+		UserID:        claims.Subject,
+		DateCreated:   now.UTC(),
+		DateUpdated:   now.UTC(),
 	}
 
 	const q = `
 	INSERT INTO profiles
-		(name, user_id, display_name, type, date_created, date_updated)
+		(name, user_id, display_name, type, bio, website, contact_email, contact_phone,
+		languages, logo_url, date_created, date_updated)
 	VALUES
-		($1, $2, $3, $4, $5, $6)`
+		($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+
+	args := []interface{}{n.Name, n.UserID, n.DisplayName, n.Type, n.Bio, n.Website, n.ContactEmail, n.ContactPhone,
+		n.Languages, n.LogoURL, n.DateCreated, n.DateUpdated}
 
 	p.log.Printf("%s: %s: %s", traceID, "profile.Create",
-		database.Log(q, n.Name, n.UserID, n.DisplayName, n.Type, n.DateCreated, n.DateUpdated),
+		database.Log(q, args...),
 	)
 
-	if _, err := p.db.ExecContext(ctx, q, n.Name, n.UserID, n.DisplayName, n.Type, n.DateCreated, n.DateUpdated); err != nil {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return Info{}, errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	if err := p.checkListings(ctx, tx, traceID, n.Jurisdictions, n.Categories); err != nil {
+		return Info{}, err
+	}
+
+	if _, err := tx.ExecContext(ctx, q, args...); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			return Info{}, ErrNameExists
+		}
 		return Info{}, errors.Wrap(err, "inserting profile")
 	}
 
+	if err := p.setListings(ctx, tx, traceID, n.Name, n.Jurisdictions, n.Categories, now); err != nil {
+		return Info{}, err
+	}
+
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionCreate,
+		EntityType: "profile",
+		EntityID:   n.Name,
+		After:      n,
+		Sensitive:  sensitive,
+	}
+	if err := audit.Record(ctx, p.log, tx, traceID, ne, now); err != nil {
+		return Info{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Info{}, errors.Wrap(err, "committing profile")
+	}
+
 	return n, nil
 }
 
@@ -87,17 +182,41 @@ func (p Profile) Update(ctx context.Context, traceID string, claims auth.Claims,
 		return err
 	}
 
-	// If you are not an admin and looking to retrieve someone elses profile.
-	if !claims.Authorized(auth.RoleAdmin) && o.UserID != claims.Subject {
+	if !p.policy.AllowedFor(claims, auth.PermissionProfileEdit, o.UserID) {
 		return ErrForbidden
 	}
 
+	before := o
 	if up.Name != nil {
 		o.Name = *up.Name
 	}
 	if up.DisplayName != nil {
 		o.DisplayName = *up.DisplayName
 	}
+	if up.Bio != nil {
+		o.Bio = *up.Bio
+	}
+	if up.Website != nil {
+		o.Website = *up.Website
+	}
+	if up.ContactEmail != nil {
+		o.ContactEmail = *up.ContactEmail
+	}
+	if up.ContactPhone != nil {
+		o.ContactPhone = *up.ContactPhone
+	}
+	if up.Languages != nil {
+		o.Languages = languages(up.Languages)
+	}
+	if up.LogoURL != nil {
+		o.LogoURL = *up.LogoURL
+	}
+	if up.Jurisdictions != nil {
+		o.Jurisdictions = codes(up.Jurisdictions)
+	}
+	if up.Categories != nil {
+		o.Categories = ids(up.Categories)
+	}
 	o.DateUpdated = now
 
 	const q = `
@@ -106,50 +225,279 @@ func (p Profile) Update(ctx context.Context, traceID string, claims auth.Claims,
 	SET
 		"name" = $2,
 		"display_name" = $3,
-		"date_updated" = $4
+		"bio" = $4,
+		"website" = $5,
+		"contact_email" = $6,
+		"contact_phone" = $7,
+		"languages" = $8,
+		"logo_url" = $9,
+		"date_updated" = $10
 	WHERE
 		name = $1`
 
+	args := []interface{}{name, o.Name, o.DisplayName, o.Bio, o.Website, o.ContactEmail, o.ContactPhone,
+		o.Languages, o.LogoURL, o.DateUpdated}
+
 	p.log.Printf("%s: %s: %s", traceID, "profile.Update",
-		database.Log(q, o.Name, o.Name, o.DisplayName, o.DateUpdated),
+		database.Log(q, args...),
 	)
 
-	if _, err = p.db.ExecContext(ctx, q, o.Name, o.Name, o.DisplayName, o.DateUpdated); err != nil {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	if err := p.checkListings(ctx, tx, traceID, o.Jurisdictions, o.Categories); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, q, args...); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			return ErrNameExists
+		}
 		return errors.Wrap(err, "updating profile")
 	}
 
+	// Renaming the profile carries its links along, so they are only replaced
+	// when new lists were provided.
+	if up.Jurisdictions != nil || up.Categories != nil {
+		if err := p.setListings(ctx, tx, traceID, o.Name, o.Jurisdictions, o.Categories, now); err != nil {
+			return err
+		}
+	}
+
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionUpdate,
+		EntityType: "profile",
+		EntityID:   name,
+		Before:     before,
+		After:      o,
+		Sensitive:  sensitive,
+	}
+	if err := audit.Record(ctx, p.log, tx, traceID, ne, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing profile")
+	}
+
 	return nil
 }
 
-// Delete removes the profile identified by a given ID.
-func (p Profile) Delete(ctx context.Context, traceID string, name string) error {
+// Delete marks the profile identified by a given name as deleted. Deleted
+// profiles are left out of queries, until they are restored or purged.
+// Deleting a profile that does not exist is not an error. Only the owner of
+// a profile and admins may delete it.
+func (p Profile) Delete(ctx context.Context, traceID string, claims auth.Claims, name string, now time.Time) error {
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.profile.delete")
 	defer span.End()
 
+	o, err := p.QueryByName(ctx, traceID, name)
+	if err != nil {
+		if err == ErrNotFound {
+			return nil
+		}
+		return err
+	}
+
+	if !p.policy.AllowedFor(claims, auth.PermissionProfileEdit, o.UserID) {
+		return ErrForbidden
+	}
+
 	const q = `
-	DELETE FROM
+	UPDATE
 		profiles
+	SET
+		"deleted_at" = $2
 	WHERE
-		name = $1`
+		name = $1 AND deleted_at IS NULL`
+
+	deleted := now.UTC()
 
 	p.log.Printf("%s: %s: %s", traceID, "profile.Delete",
-		database.Log(q, name),
+		database.Log(q, name, deleted),
 	)
 
-	if _, err := p.db.ExecContext(ctx, q, name); err != nil {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, q, name, deleted); err != nil {
 		return errors.Wrapf(err, "deleting profile %s", name)
 	}
 
+	after := o
+	after.DeletedAt = &deleted
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionDelete,
+		EntityType: "profile",
+		EntityID:   name,
+		Before:     o,
+		After:      after,
+		Sensitive:  sensitive,
+	}
+	if err := audit.Record(ctx, p.log, tx, traceID, ne, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing profile")
+	}
+
 	return nil
 }
 
+// Restore undoes the deletion of a Profile.
+func (p Profile) Restore(ctx context.Context, traceID string, claims auth.Claims, name string, now time.Time) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.profile.restore")
+	defer span.End()
+
+	if !p.policy.Allowed(claims, auth.PermissionRecordRestore) {
+		return ErrForbidden
+	}
+
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	q := `
+	SELECT` + columns + `
+	FROM
+		profiles AS p
+	WHERE
+		p.name = $1 AND p.deleted_at IS NOT NULL
+	FOR UPDATE OF p`
+
+	p.log.Printf("%s: %s: %s", traceID, "profile.Restore",
+		database.Log(q, name),
+	)
+
+	var o Info
+	if err := tx.GetContext(ctx, &o, q, name); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return errors.Wrapf(err, "selecting deleted profile %q", name)
+	}
+
+	q = `
+	UPDATE
+		profiles
+	SET
+		"deleted_at" = NULL,
+		"date_updated" = $2
+	WHERE
+		name = $1`
+
+	p.log.Printf("%s: %s: %s", traceID, "profile.Restore",
+		database.Log(q, name, now.UTC()),
+	)
+
+	if _, err := tx.ExecContext(ctx, q, name, now.UTC()); err != nil {
+		return errors.Wrapf(err, "restoring profile %s", name)
+	}
+
+	after := o
+	after.DeletedAt = nil
+	after.DateUpdated = now.UTC()
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionRestore,
+		EntityType: "profile",
+		EntityID:   name,
+		Before:     o,
+		After:      after,
+		Sensitive:  sensitive,
+	}
+	if err := audit.Record(ctx, p.log, tx, traceID, ne, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing profile")
+	}
+
+	return nil
+}
+
+// Purge permanently removes the profiles deleted before the specified time,
+// along with their products. Products that were sold are kept, deleted and
+// no longer linked to the profile, since removing them would remove the sales
+// as well. It returns the number of profiles removed.
+func (p Profile) Purge(ctx context.Context, traceID string, before time.Time) (int, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.profile.purge")
+	defer span.End()
+
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	q := `
+	UPDATE
+		products AS p
+	SET
+		"profile_name" = NULL,
+		"deleted_at" = COALESCE(p.deleted_at, pr.deleted_at)
+	FROM
+		profiles AS pr
+	WHERE
+		p.profile_name = pr.name AND pr.deleted_at < $1 AND
+		EXISTS (SELECT 1 FROM sales AS s WHERE s.product_id = p.product_id)`
+
+	p.log.Printf("%s: %s: %s", traceID, "profile.Purge",
+		database.Log(q, before.UTC()),
+	)
+
+	if _, err := tx.ExecContext(ctx, q, before.UTC()); err != nil {
+		return 0, errors.Wrap(err, "detaching sold products")
+	}
+
+	q = `
+	DELETE FROM
+		profiles
+	WHERE
+		deleted_at < $1`
+
+	p.log.Printf("%s: %s: %s", traceID, "profile.Purge",
+		database.Log(q, before.UTC()),
+	)
+
+	res, err := tx.ExecContext(ctx, q, before.UTC())
+	if err != nil {
+		return 0, errors.Wrap(err, "purging profiles")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "purging profiles")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, errors.Wrap(err, "committing purge")
+	}
+
+	return int(n), nil
+}
+
 // Query gets all Profiles from the database.
 func (p Profile) Query(ctx context.Context, traceID string, pageNumber int, rowsPerPage int) ([]Info, error) {
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.profile.query")
 	defer span.End()
 
 	const q = `
-	SELECT * FROM profiles
+	SELECT` + columns + `
+	FROM profiles AS p
+	WHERE p.deleted_at IS NULL
 	OFFSET $1 ROWS FETCH NEXT $2 ROWS ONLY`
 	offset := (pageNumber - 1) * rowsPerPage
 
@@ -171,10 +519,10 @@ func (p Profile) QueryByName(ctx context.Context, traceID string, name string) (
 	defer span.End()
 
 	const q = `
-	SELECT 
-		* FROM profiles
+	SELECT` + columns + `
+	FROM profiles AS p
 	WHERE
-		name = $1
+		p.name = $1 AND p.deleted_at IS NULL
 	`
 
 	p.log.Printf("%s: %s: %s", traceID, "profile.QueryByName",
@@ -198,10 +546,10 @@ func (p Profile) QueryUserProfile(ctx context.Context, traceID string, userID st
 	defer span.End()
 
 	const q = `
-	SELECT 
-		* FROM profiles
+	SELECT` + columns + `
+	FROM profiles AS p
 	WHERE
-		user_id = $1 AND type='USR'
+		p.user_id = $1 AND p.type='USR' AND p.deleted_at IS NULL
 	`
 
 	p.log.Printf("%s: %s: %s", traceID, "profile.QueryUserProfile",
@@ -218,3 +566,188 @@ func (p Profile) QueryUserProfile(ctx context.Context, traceID string, userID st
 
 	return o, nil
 }
+
+// QueryOwner finds the owner of the profile identified by a given name, so
+// other packages can check who they act for. Deleted profiles aren't found.
+// The query runs on db, which may be a transaction of the caller.
+func QueryOwner(ctx context.Context, log *log.Logger, db sqlx.QueryerContext, traceID string, name string) (Owner, error) {
+	const q = `
+	SELECT
+		user_id, type
+	FROM
+		profiles
+	WHERE
+		name = $1 AND deleted_at IS NULL`
+
+	log.Printf("%s: %s: %s", traceID, "profile.QueryOwner",
+		database.Log(q, name),
+	)
+
+	var o Owner
+	if err := sqlx.GetContext(ctx, db, &o, q, name); err != nil {
+		if err == sql.ErrNoRows {
+			return Owner{}, ErrNotFound
+		}
+		return Owner{}, errors.Wrapf(err, "selecting owner of profile %q", name)
+	}
+
+	return o, nil
+}
+
+// QueryByUser gets all profiles created by the user identified by a given ID,
+// including deleted ones.
+func (p Profile) QueryByUser(ctx context.Context, traceID string, userID string) ([]Info, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.profile.querybyuser")
+	defer span.End()
+
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	const q = `
+	SELECT` + columns + `
+	FROM
+		profiles AS p
+	WHERE
+		p.user_id = $1
+	ORDER BY
+		p.name`
+
+	p.log.Printf("%s: %s: %s", traceID, "profile.QueryByUser",
+		database.Log(q, userID),
+	)
+
+	o := []Info{}
+	if err := p.db.SelectContext(ctx, &o, q, userID); err != nil {
+		return nil, errors.Wrapf(err, "selecting profiles of user %q", userID)
+	}
+
+	return o, nil
+}
+
+// setListings replaces the jurisdictions and categories a profile is listed
+// in.
+func (p Profile) setListings(ctx context.Context, tx sqlx.ExecerContext, traceID string, name string, jurisdictions []string, categories []string, now time.Time) error {
+	qs := []struct {
+		q    string
+		args []interface{}
+	}{
+		{`
+		DELETE FROM profile_jurisdictions WHERE profile_name = $1`, []interface{}{name}},
+		{`
+		INSERT INTO profile_jurisdictions (profile_name, jurisdiction_code, date_created)
+		SELECT $1::TEXT, UNNEST($2::TEXT[]), $3::TIMESTAMP`, []interface{}{name, pq.Array(jurisdictions), now.UTC()}},
+		{`
+		DELETE FROM profile_categories WHERE profile_name = $1`, []interface{}{name}},
+		{`
+		INSERT INTO profile_categories (profile_name, category_id, date_created)
+		SELECT $1::TEXT, UNNEST($2::UUID[]), $3::TIMESTAMP`, []interface{}{name, pq.Array(categories), now.UTC()}},
+	}
+
+	for _, q := range qs {
+		p.log.Printf("%s: %s: %s", traceID, "profile.setListings",
+			database.Log(q.q, q.args...),
+		)
+
+		if _, err := tx.ExecContext(ctx, q.q, q.args...); err != nil {
+			return errors.Wrapf(err, "listing profile %s", name)
+		}
+	}
+
+	return nil
+}
+
+// checkListings verifies the jurisdictions and categories a profile is listed
+// in exist. Both lists are expected to be free of duplicates.
+func (p Profile) checkListings(ctx context.Context, tx sqlx.QueryerContext, traceID string, jurisdictions []string, categories []string) error {
+	if len(jurisdictions) > 0 {
+		const q = `
+		SELECT
+			COUNT(*)
+		FROM
+			jurisdictions
+		WHERE
+			code = ANY($1)`
+
+		p.log.Printf("%s: %s: %s", traceID, "profile.checkListings",
+			database.Log(q, pq.Array(jurisdictions)),
+		)
+
+		var n int
+		if err := sqlx.GetContext(ctx, tx, &n, q, pq.Array(jurisdictions)); err != nil {
+			return errors.Wrap(err, "counting jurisdictions")
+		}
+		if n != len(jurisdictions) {
+			return ErrUnknownJurisdiction
+		}
+	}
+
+	if len(categories) > 0 {
+		const q = `
+		SELECT
+			COUNT(*)
+		FROM
+			categories
+		WHERE
+			category_id = ANY($1::UUID[]) AND deleted_at IS NULL`
+
+		p.log.Printf("%s: %s: %s", traceID, "profile.checkListings",
+			database.Log(q, pq.Array(categories)),
+		)
+
+		var n int
+		if err := sqlx.GetContext(ctx, tx, &n, q, pq.Array(categories)); err != nil {
+			return errors.Wrap(err, "counting categories")
+		}
+		if n != len(categories) {
+			return ErrUnknownCategory
+		}
+	}
+
+	return nil
+}
+
+// unique returns the values in the order they were provided, without
+// duplicates. It never returns nil, so the column is never set to NULL.
+func unique(values []string) pq.StringArray {
+	seen := make(map[string]bool, len(values))
+	u := make(pq.StringArray, 0, len(values))
+	for _, v := range values {
+		if seen[v] {
+			continue
+		}
+		seen[v] = true
+		u = append(u, v)
+	}
+	return u
+}
+
+// codes returns the provided jurisdiction codes sorted, the way they are
+// read back from the database.
+func codes(values []string) pq.StringArray {
+	u := unique(values)
+	sort.Strings(u)
+	return u
+}
+
+// ids returns the provided category IDs in lower case and sorted, the way
+// they are read back from the database.
+func ids(values []string) pq.StringArray {
+	lower := make([]string, len(values))
+	for i, v := range values {
+		lower[i] = strings.ToLower(v)
+	}
+	u := unique(lower)
+	sort.Strings(u)
+	return u
+}
+
+// languages returns the provided language codes in lower case, without
+// duplicates.
+func languages(codes []string) pq.StringArray {
+	lower := make([]string, len(codes))
+	for i, c := range codes {
+		lower[i] = strings.ToLower(c)
+	}
+	return unique(lower)
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/appinesshq/bpi/business/tests"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/google/go-cmp/cmp"
+	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 )
 
@@ -17,7 +18,7 @@ func TestProfile(t *testing.T) {
 	log, db, teardown := tests.NewUnit(t)
 	t.Cleanup(teardown)
 
-	p := profile.New(log, db)
+	p := profile.New(log, db, tests.Policy())
 
 	t.Log("Given the need to work with Profile records.")
 	{
@@ -40,9 +41,13 @@ func TestProfile(t *testing.T) {
 			}
 
 			np := profile.NewProfile{
-				Name:        "test",
-				Type:        "USR",
-				DisplayName: "Test profile",
+				Name:         "test",
+				Type:         "USR",
+				DisplayName:  "Test profile",
+				Bio:          "Testing all the things.",
+				ContactEmail: "test@example.com",
+				ContactPhone: "+31201234567",
+				Languages:    []string{"EN", "nl"},
 			}
 
 			prf, err := p.Create(ctx, traceID, claims, np, now)
@@ -62,6 +67,14 @@ func TestProfile(t *testing.T) {
 			}
 			t.Logf("\t%s\tTest %d:\tShould get back the same profile.", tests.Success, testID)
 
+			unknown := profile.UpdateProfile{
+				Categories: []string{"d9e5a1e0-5a4e-4c5b-8f3a-0c6b6c1f0e2d"},
+			}
+			if err := p.Update(ctx, traceID, claims, prf.Name, unknown, now); errors.Cause(err) != profile.ErrUnknownCategory {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to list the profile in an unknown category : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to list the profile in an unknown category.", tests.Success, testID)
+
 			upd := profile.UpdateProfile{
 				DisplayName: tests.StringPointer("My profile"),
 			}
@@ -89,6 +102,25 @@ func TestProfile(t *testing.T) {
 			}
 			t.Logf("\t%s\tTest %d:\tShould get back the same profile.", tests.Success, testID)
 
+			if _, err := p.Create(ctx, traceID, claims, np, now); errors.Cause(err) != profile.ErrNameExists {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to create a profile with a taken name : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to create a profile with a taken name.", tests.Success, testID)
+
+			taken := np
+			taken.Name = "other"
+			if _, err := p.Create(ctx, traceID, claims, taken, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a second profile : %s.", tests.Failed, testID, err)
+			}
+
+			rename := profile.UpdateProfile{
+				Name: tests.StringPointer(taken.Name),
+			}
+			if err := p.Update(ctx, traceID, claims, prf.Name, rename, now); errors.Cause(err) != profile.ErrNameExists {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to rename the profile to a taken name : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to rename the profile to a taken name.", tests.Success, testID)
+
 			upd = profile.UpdateProfile{
 				DisplayName: tests.StringPointer("My profile"),
 			}
@@ -110,7 +142,15 @@ func TestProfile(t *testing.T) {
 				t.Logf("\t%s\tTest %d:\tShould be able to see updated DisplayName field.", tests.Success, testID)
 			}
 
-			if err := p.Delete(ctx, traceID, prf.Name); err != nil {
+			other := claims
+			other.Subject = "45b5fbd3-755f-4379-8f07-a58d4a30fa2f"
+			other.Roles = []string{auth.RoleUser}
+			if err := p.Delete(ctx, traceID, other, prf.Name, now); errors.Cause(err) != profile.ErrForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to delete the profile of another user : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to delete the profile of another user.", tests.Success, testID)
+
+			if err := p.Delete(ctx, traceID, claims, prf.Name, now); err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to delete profile : %s.", tests.Failed, testID, err)
 			}
 			t.Logf("\t%s\tTest %d:\tShould be able to delete profile.", tests.Success, testID)
@@ -123,3 +163,140 @@ func TestProfile(t *testing.T) {
 		}
 	}
 }
+
+func seedDirectory(db *sqlx.DB) error {
+	const q = `
+	INSERT INTO countries (gnid, code, name, currency_code, currency_name, active) VALUES
+	(2750405, 'NL', 'Netherlands', 'EUR', 'Euro', TRUE),
+	(2802361, 'BE', 'Belgium', 'EUR', 'Euro', FALSE);
+
+	INSERT INTO jurisdictions (gnid, code, country_code, name, active) VALUES
+	(2743698, 'NL.11', 'NL', 'South Holland', TRUE),
+	(2744011, 'NL.10', 'NL', 'Zeeland', FALSE),
+	(3337388, 'BE.BRU', 'BE', 'Brussels Capital', TRUE);
+
+	INSERT INTO categories (category_id, slug, name, date_created, date_updated) VALUES
+	('5cf37266-3473-4006-984f-9325122678b7', 'legal', 'Legal', NOW(), NOW());
+	`
+	_, err := db.ExecContext(context.Background(), q)
+	return err
+}
+
+func TestDirectory(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	if err := seedDirectory(db); err != nil {
+		t.Fatalf("Couldn't seed database: %v", err)
+	}
+
+	p := profile.New(log, db, tests.Policy())
+
+	t.Log("Given the need to list profiles in the directory.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen listing profiles in categories and jurisdictions.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+			category := "5cf37266-3473-4006-984f-9325122678b7"
+
+			claims := auth.Claims{
+				StandardClaims: jwt.StandardClaims{
+					Issuer:    "MB Appiness Solutions",
+					Subject:   "718ffbea-f4a1-4667-8ae3-b349da52675e",
+					Audience:  "users",
+					ExpiresAt: now.Add(time.Hour).Unix(),
+					IssuedAt:  now.Unix(),
+				},
+				Roles: []string{auth.RoleUser},
+			}
+
+			nps := []profile.NewProfile{
+				{Name: "acme", Type: "SER", DisplayName: "Acme Lawyers", Categories: []string{category}, Jurisdictions: []string{"NL.11"}},
+				{Name: "shop", Type: "BUS", DisplayName: "Shop", Categories: []string{category}, Jurisdictions: []string{"NL.11"}},
+				{Name: "zeeland", Type: "SER", DisplayName: "Zeeland Lawyers", Categories: []string{category}, Jurisdictions: []string{"NL.10"}},
+				{Name: "brussels", Type: "SER", DisplayName: "Brussels Lawyers", Categories: []string{category}, Jurisdictions: []string{"BE.BRU"}},
+			}
+			for _, np := range nps {
+				if _, err := p.Create(ctx, traceID, claims, np, now); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to create profile %s : %s.", tests.Failed, testID, np.Name, err)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create profiles.", tests.Success, testID)
+
+			saved, err := p.QueryByName(ctx, traceID, "acme")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve profile : %s.", tests.Failed, testID, err)
+			}
+			if diff := cmp.Diff([]string{category}, []string(saved.Categories)); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the categories of the profile. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the categories of the profile.", tests.Success, testID)
+
+			names := func(filter profile.Filter) []string {
+				t.Helper()
+				prfs, err := p.QueryDirectory(ctx, traceID, filter, 1, 10)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to query the directory : %s.", tests.Failed, testID, err)
+				}
+				n := []string{}
+				for _, prf := range prfs {
+					n = append(n, prf.Name)
+				}
+				return n
+			}
+
+			filter := profile.Filter{Type: profile.ServiceProviderProfile, CategoryID: category, Jurisdiction: "NL.11"}
+			if diff := cmp.Diff([]string{"acme"}, names(filter)); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould find the service providers in the category and jurisdiction. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould find the service providers in the category and jurisdiction.", tests.Success, testID)
+
+			if diff := cmp.Diff([]string{"acme", "shop"}, names(profile.Filter{})); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould only list profiles in active jurisdictions of active countries. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould only list profiles in active jurisdictions of active countries.", tests.Success, testID)
+
+			if err := p.DetachJurisdiction(ctx, traceID, claims, "acme", "NL.11", now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to detach a jurisdiction : %s.", tests.Failed, testID, err)
+			}
+			if diff := cmp.Diff([]string{}, names(filter)); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT list the profile after detaching the jurisdiction. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to detach a jurisdiction.", tests.Success, testID)
+
+			if err := p.AttachJurisdiction(ctx, traceID, claims, "acme", "NL.11", now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to attach a jurisdiction : %s.", tests.Failed, testID, err)
+			}
+			if err := p.AttachJurisdiction(ctx, traceID, claims, "acme", "NL.11", now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to attach a jurisdiction twice : %s.", tests.Failed, testID, err)
+			}
+			if diff := cmp.Diff([]string{"acme"}, names(filter)); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould list the profile after attaching the jurisdiction. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to attach a jurisdiction.", tests.Success, testID)
+
+			if err := p.AttachJurisdiction(ctx, traceID, claims, "acme", "XX.00", now); errors.Cause(err) != profile.ErrUnknownJurisdiction {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to attach an unknown jurisdiction : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to attach an unknown jurisdiction.", tests.Success, testID)
+
+			if err := p.DetachCategory(ctx, traceID, claims, "acme", category, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to detach a category : %s.", tests.Failed, testID, err)
+			}
+			if diff := cmp.Diff([]string{}, names(filter)); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT list the profile after detaching the category. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to detach a category.", tests.Success, testID)
+
+			other := claims
+			other.Subject = "45b5fbd3-755f-4379-8f07-a58d4a30fa2f"
+			if err := p.AttachCategory(ctx, traceID, other, "acme", category, now); errors.Cause(err) != profile.ErrForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to attach a category to the profile of another user : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to attach a category to the profile of another user.", tests.Success, testID)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package quote
+
+import (
+	"context"
+	"time"
+
+	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/foundation/database"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+// AddMessage sends a message in the thread of the quote request identified by
+// a given ID, on behalf of the participant identified by the name of their
+// profile. It returns the sent Message with fields like ID and DateCreated
+// populated.
+func (q Quote) AddMessage(ctx context.Context, traceID string, claims auth.Claims, quoteID string, sender string, nm NewMessage, now time.Time) (Message, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.quote.addmessage")
+	defer span.End()
+
+	if _, err := uuid.Parse(quoteID); err != nil {
+		return Message{}, ErrInvalidID
+	}
+
+	tx, err := q.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return Message{}, errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	const q1 = `
+	UPDATE
+		quotes
+	SET
+		"date_updated" = $2
+	WHERE
+		quote_id = $1`
+
+	q.log.Printf("%s: %s: %s", traceID, "quote.AddMessage",
+		database.Log(q1, quoteID, now.UTC()),
+	)
+
+	res, err := tx.ExecContext(ctx, q1, quoteID, now.UTC())
+	if err != nil {
+		return Message{}, errors.Wrapf(err, "updating quote %s", quoteID)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return Message{}, errors.Wrapf(err, "updating quote %s", quoteID)
+	}
+	if n == 0 {
+		return Message{}, ErrNotFound
+	}
+
+	m, err := q.insertMessage(ctx, tx, traceID, claims, quoteID, sender, nm, now)
+	if err != nil {
+		return Message{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Message{}, errors.Wrap(err, "committing message")
+	}
+
+	return m, nil
+}
+
+// QueryMessages gets the messages in the thread of the quote request
+// identified by a given ID, the most recent first.
+func (q Quote) QueryMessages(ctx context.Context, traceID string, quoteID string, pageNumber int, rowsPerPage int) ([]Message, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.quote.querymessages")
+	defer span.End()
+
+	if _, err := uuid.Parse(quoteID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	const q1 = `
+	SELECT
+		message_id, quote_id, sender_name, body, user_id, date_created, date_read
+	FROM
+		quote_messages
+	WHERE
+		quote_id = $1
+	ORDER BY
+		date_created DESC, message_id
+	OFFSET $2 ROWS FETCH NEXT $3 ROWS ONLY`
+	offset := (pageNumber - 1) * rowsPerPage
+
+	q.log.Printf("%s: %s: %s", traceID, "quote.QueryMessages",
+		database.Log(q1, quoteID, offset, rowsPerPage),
+	)
+
+	messages := []Message{}
+	if err := q.db.SelectContext(ctx, &messages, q1, quoteID, offset, rowsPerPage); err != nil {
+		return nil, errors.Wrapf(err, "selecting messages of quote %q", quoteID)
+	}
+
+	for i := range messages {
+		messages[i].Attachments = []Attachment{}
+	}
+	if err := q.attachments(ctx, traceID, messages); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// MarkRead records that the participant identified by the name of their
+// profile read the messages the other participant sent in the thread of the
+// quote request identified by a given ID. Messages read before keep the time
+// they were first read. It returns the number of messages marked as read.
+func (q Quote) MarkRead(ctx context.Context, traceID string, quoteID string, reader string, now time.Time) (int, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.quote.markread")
+	defer span.End()
+
+	if _, err := uuid.Parse(quoteID); err != nil {
+		return 0, ErrInvalidID
+	}
+
+	const q1 = `
+	UPDATE
+		quote_messages
+	SET
+		"date_read" = $3
+	WHERE
+		quote_id = $1 AND sender_name <> $2 AND date_read IS NULL AND date_created <= $3`
+
+	q.log.Printf("%s: %s: %s", traceID, "quote.MarkRead",
+		database.Log(q1, quoteID, reader, now.UTC()),
+	)
+
+	res, err := q.db.ExecContext(ctx, q1, quoteID, reader, now.UTC())
+	if err != nil {
+		return 0, errors.Wrapf(err, "marking messages of quote %s read", quoteID)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrapf(err, "marking messages of quote %s read", quoteID)
+	}
+
+	return int(n), nil
+}
+
+// insertMessage adds a message along with its attachments to the thread of a
+// quote request.
+func (q Quote) insertMessage(ctx context.Context, tx sqlx.ExecerContext, traceID string, claims auth.Claims, quoteID string, sender string, nm NewMessage, now time.Time) (Message, error) {
+	m := Message{
+		ID:          uuid.New().String(),
+		QuoteID:     quoteID,
+		Sender:      sender,
+		Body:        nm.Body,
+		Attachments: make([]Attachment, len(nm.Attachments)),
+		UserID:      claims.Subject,
+		DateCreated: now.UTC(),
+	}
+
+	const q1 = `
+	INSERT INTO quote_messages
+		(message_id, quote_id, sender_name, user_id, body, date_created)
+	VALUES
+		($1, $2, $3, $4, $5, $6)`
+
+	q.log.Printf("%s: %s: %s", traceID, "quote.insertMessage",
+		database.Log(q1, m.ID, m.QuoteID, m.Sender, m.UserID, m.Body, m.DateCreated),
+	)
+
+	if _, err := tx.ExecContext(ctx, q1, m.ID, m.QuoteID, m.Sender, m.UserID, m.Body, m.DateCreated); err != nil {
+		return Message{}, errors.Wrap(err, "inserting message")
+	}
+
+	const q2 = `
+	INSERT INTO quote_attachments
+		(attachment_id, message_id, file_name, content_type, size, url)
+	VALUES
+		($1, $2, $3, $4, $5, $6)`
+
+	for i, na := range nm.Attachments {
+		a := Attachment{
+			ID:          uuid.New().String(),
+			MessageID:   m.ID,
+			FileName:    na.FileName,
+			ContentType: na.ContentType,
+			Size:        na.Size,
+			URL:         na.URL,
+		}
+
+		q.log.Printf("%s: %s: %s", traceID, "quote.insertMessage",
+			database.Log(q2, a.ID, a.MessageID, a.FileName, a.ContentType, a.Size, a.URL),
+		)
+
+		if _, err := tx.ExecContext(ctx, q2, a.ID, a.MessageID, a.FileName, a.ContentType, a.Size, a.URL); err != nil {
+			return Message{}, errors.Wrap(err, "inserting attachment")
+		}
+		m.Attachments[i] = a
+	}
+
+	return m, nil
+}
@@ -0,0 +1,67 @@
+package quote
+
+import "time"
+
+// Info represents a quote request of a business to a service provider, the
+// thread the two exchange messages in.
+type Info struct {
+	ID          string    `db:"quote_id" json:"id"`               // Unique identifier.
+	Business    string    `db:"business_name" json:"business"`    // Name of the business profile requesting the quote.
+	Provider    string    `db:"provider_name" json:"provider"`    // Name of the service provider profile asked for the quote.
+	ProductID   string    `db:"product_id" json:"product_id"`     // ID of the product the quote is requested for, if any.
+	Subject     string    `db:"subject" json:"subject"`           // What the quote is about.
+	Messages    int       `db:"messages" json:"messages"`         // Aggregate field showing the number of messages.
+	Unread      int       `db:"unread" json:"unread"`             // Aggregate field showing the number of messages the viewing participant hasn't read.
+	UserID      string    `db:"user_id" json:"user_id"`           // ID of the user who requested the quote.
+	DateCreated time.Time `db:"date_created" json:"date_created"` // When the quote was requested.
+	DateUpdated time.Time `db:"date_updated" json:"date_updated"` // When the last message was sent.
+}
+
+// Message represents a message sent in the thread of a quote request.
+type Message struct {
+	ID          string       `db:"message_id" json:"id"`                 // Unique identifier.
+	QuoteID     string       `db:"quote_id" json:"quote_id"`             // ID of the quote request the message is part of.
+	Sender      string       `db:"sender_name" json:"sender"`            // Name of the profile sending the message.
+	Body        string       `db:"body" json:"body"`                     // Text of the message.
+	Attachments []Attachment `db:"-" json:"attachments"`                 // Files attached to the message.
+	UserID      string       `db:"user_id" json:"user_id"`               // ID of the user who wrote the message.
+	DateCreated time.Time    `db:"date_created" json:"date_created"`     // When the message was sent.
+	DateRead    *time.Time   `db:"date_read" json:"date_read,omitempty"` // When the recipient read the message, if they did.
+}
+
+// Attachment represents the metadata of a file attached to a message. The
+// file itself is stored elsewhere, at the URL.
+type Attachment struct {
+	ID          string `db:"attachment_id" json:"id"`          // Unique identifier.
+	MessageID   string `db:"message_id" json:"-"`              // ID of the message the file is attached to.
+	FileName    string `db:"file_name" json:"file_name"`       // Name of the file.
+	ContentType string `db:"content_type" json:"content_type"` // Media type of the file.
+	Size        int64  `db:"size" json:"size"`                 // Size of the file in bytes.
+	URL         string `db:"url" json:"url"`                   // Where the file can be downloaded.
+}
+
+// NewQuote is what we require from clients when requesting a quote. The quote
+// is requested either from a provider or for one of its products, in which
+// case the provider can be left out.
+type NewQuote struct {
+	Business  string     `json:"business" validate:"required"`
+	Provider  string     `json:"provider" validate:"required_without=ProductID"`
+	ProductID string     `json:"product_id" validate:"omitempty,uuid"`
+	Subject   string     `json:"subject" validate:"required,max=200"`
+	Message   NewMessage `json:"message"`
+}
+
+// NewMessage is what we require from clients when sending a message.
+type NewMessage struct {
+	Body        string          `json:"body" validate:"required,max=10000"`
+	Attachments []NewAttachment `json:"attachments" validate:"max=10,dive"`
+}
+
+// NewAttachment is what we require from clients to attach a file to a
+// message.
+type NewAttachment struct {
+	FileName    string `json:"file_name" validate:"required,max=255"`
+	ContentType string `json:"content_type" validate:"required"`
+	Size        int64  `json:"size" validate:"gte=0"`
+	URL         string `json:"url" validate:"required,url"`
+}
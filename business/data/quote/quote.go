@@ -0,0 +1,385 @@
+// Package quote contains the quote requests businesses send to service
+// providers and the messages they exchange about them.
+package quote
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/audit"
+	"github.com/appinesshq/bpi/business/data/profile"
+	"github.com/appinesshq/bpi/foundation/database"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+var (
+	// ErrNotFound is used when a specific Quote is requested but does not exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrInvalidID occurs when an ID is not in a valid form.
+	ErrInvalidID = errors.New("ID is not in its proper form")
+
+	// ErrForbidden occurs when a user tries to do something that is forbidden to them according to our access control policies.
+	ErrForbidden = errors.New("attempted action is not allowed")
+
+	// ErrUnknownProfile occurs when a quote is requested by or from a profile
+	// that does not exist.
+	ErrUnknownProfile = errors.New("unknown profile")
+
+	// ErrUnknownProduct occurs when a quote is requested for a product that
+	// does not exist.
+	ErrUnknownProduct = errors.New("unknown product")
+
+	// ErrNotBusiness occurs when a quote is requested by a profile that is not
+	// a business profile.
+	ErrNotBusiness = errors.New("profile is not a business")
+
+	// ErrNotProvider occurs when a quote is requested from a profile that is
+	// not a service provider profile.
+	ErrNotProvider = errors.New("profile is not a service provider")
+
+	// ErrProviderMismatch occurs when a quote is requested for a product that
+	// the provider specified doesn't offer.
+	ErrProviderMismatch = errors.New("product is not offered by the provider")
+
+	// ErrOwnProvider occurs when a user requests a quote from a service
+	// provider profile of their own.
+	ErrOwnProvider = errors.New("cannot request a quote from an own provider")
+)
+
+// columns selects a quote from quotes aliased as q, along with the number of
+// messages in its thread. The number of unread messages is counted for the
+// profile passed as the first argument of the query.
+const columns = `
+		q.quote_id, q.business_name, q.provider_name,
+		COALESCE(q.product_id::TEXT, '') AS product_id,
+		q.subject, q.user_id, q.date_created, q.date_updated,
+		(
+			SELECT COUNT(*) FROM quote_messages AS m
+			WHERE m.quote_id = q.quote_id
+		) AS messages,
+		(
+			SELECT COUNT(*) FROM quote_messages AS m
+			WHERE m.quote_id = q.quote_id AND m.sender_name <> $1 AND m.date_read IS NULL
+		) AS unread`
+
+// Quote manages the set of API's for quote request access. Only the owners
+// of the two profiles involved take part in a quote request, so access
+// depends on the claims rather than on a policy.
+type Quote struct {
+	log *log.Logger
+	db  *sqlx.DB
+}
+
+// New constructs a Quote for api access.
+func New(log *log.Logger, db *sqlx.DB) Quote {
+	return Quote{
+		log: log,
+		db:  db,
+	}
+}
+
+// Create requests a quote on behalf of a business profile owned by the
+// claims, starting the thread with the message in nq. It returns the created
+// Quote with fields like ID and DateCreated populated.
+func (q Quote) Create(ctx context.Context, traceID string, claims auth.Claims, nq NewQuote, now time.Time) (Info, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.quote.create")
+	defer span.End()
+
+	if nq.ProductID != "" {
+		id, err := uuid.Parse(nq.ProductID)
+		if err != nil {
+			return Info{}, ErrInvalidID
+		}
+		nq.ProductID = id.String()
+	}
+
+	tx, err := q.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return Info{}, errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	business, err := profile.QueryOwner(ctx, q.log, tx, traceID, nq.Business)
+	if err != nil {
+		if err == profile.ErrNotFound {
+			return Info{}, ErrUnknownProfile
+		}
+		return Info{}, err
+	}
+	if business.Type != string(profile.BusinessProfile) {
+		return Info{}, ErrNotBusiness
+	}
+	if business.UserID != claims.Subject {
+		return Info{}, ErrForbidden
+	}
+
+	if nq.ProductID != "" {
+		const q1 = `
+		SELECT
+			COALESCE(profile_name, '')
+		FROM
+			products
+		WHERE
+			product_id = $1 AND deleted_at IS NULL`
+
+		q.log.Printf("%s: %s: %s", traceID, "quote.Create",
+			database.Log(q1, nq.ProductID),
+		)
+
+		var offeredBy string
+		if err := tx.GetContext(ctx, &offeredBy, q1, nq.ProductID); err != nil {
+			if err == sql.ErrNoRows {
+				return Info{}, ErrUnknownProduct
+			}
+			return Info{}, errors.Wrapf(err, "selecting product %q", nq.ProductID)
+		}
+		if offeredBy == "" {
+			return Info{}, ErrNotProvider
+		}
+		if nq.Provider != "" && nq.Provider != offeredBy {
+			return Info{}, ErrProviderMismatch
+		}
+		nq.Provider = offeredBy
+	}
+
+	provider, err := profile.QueryOwner(ctx, q.log, tx, traceID, nq.Provider)
+	if err != nil {
+		if err == profile.ErrNotFound {
+			return Info{}, ErrUnknownProfile
+		}
+		return Info{}, err
+	}
+	if provider.Type != string(profile.ServiceProviderProfile) {
+		return Info{}, ErrNotProvider
+	}
+	if provider.UserID == claims.Subject {
+		return Info{}, ErrOwnProvider
+	}
+
+	qt := Info{
+		ID:          uuid.New().String(),
+		Business:    nq.Business,
+		Provider:    nq.Provider,
+		ProductID:   nq.ProductID,
+		Subject:     nq.Subject,
+		Messages:    1,
+		UserID:      claims.Subject,
+		DateCreated: now.UTC(),
+		DateUpdated: now.UTC(),
+	}
+
+	const q2 = `
+	INSERT INTO quotes
+		(quote_id, business_name, provider_name, product_id, subject, user_id, date_created, date_updated)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	args := []interface{}{qt.ID, qt.Business, qt.Provider, sql.NullString{String: qt.ProductID, Valid: qt.ProductID != ""},
+		qt.Subject, qt.UserID, qt.DateCreated, qt.DateUpdated}
+
+	q.log.Printf("%s: %s: %s", traceID, "quote.Create",
+		database.Log(q2, args...),
+	)
+
+	if _, err := tx.ExecContext(ctx, q2, args...); err != nil {
+		return Info{}, errors.Wrap(err, "inserting quote")
+	}
+
+	if _, err := q.insertMessage(ctx, tx, traceID, claims, qt.ID, qt.Business, nq.Message, now); err != nil {
+		return Info{}, err
+	}
+
+	// Messages are private to the participants, so only the request itself is
+	// recorded.
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionCreate,
+		EntityType: "quote",
+		EntityID:   qt.ID,
+		After:      qt,
+	}
+	if err := audit.Record(ctx, q.log, tx, traceID, ne, now); err != nil {
+		return Info{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Info{}, errors.Wrap(err, "committing quote")
+	}
+
+	return qt, nil
+}
+
+// Participant finds the profile the claims take part in the quote request
+// identified by a given ID as. The claims take part as the business or the
+// provider when they own the profile and it isn't deleted. It implements
+// auth.ParticipantLookup.
+func (q Quote) Participant(ctx context.Context, traceID string, claims auth.Claims, quoteID string) (string, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.quote.participant")
+	defer span.End()
+
+	if _, err := uuid.Parse(quoteID); err != nil {
+		return "", auth.ErrNotParticipant
+	}
+
+	const q1 = `
+	SELECT
+		q.business_name,
+		CASE WHEN b.deleted_at IS NULL THEN b.user_id::TEXT ELSE '' END AS business_user_id,
+		q.provider_name,
+		CASE WHEN p.deleted_at IS NULL THEN p.user_id::TEXT ELSE '' END AS provider_user_id
+	FROM
+		quotes AS q
+	JOIN
+		profiles AS b ON b.name = q.business_name
+	JOIN
+		profiles AS p ON p.name = q.provider_name
+	WHERE
+		q.quote_id = $1`
+
+	q.log.Printf("%s: %s: %s", traceID, "quote.Participant",
+		database.Log(q1, quoteID),
+	)
+
+	var parts struct {
+		Business       string `db:"business_name"`
+		BusinessUserID string `db:"business_user_id"`
+		Provider       string `db:"provider_name"`
+		ProviderUserID string `db:"provider_user_id"`
+	}
+	if err := q.db.GetContext(ctx, &parts, q1, quoteID); err != nil {
+		if err == sql.ErrNoRows {
+			return "", auth.ErrNotParticipant
+		}
+		return "", errors.Wrapf(err, "selecting participants of quote %q", quoteID)
+	}
+
+	switch claims.Subject {
+	case parts.BusinessUserID:
+		return parts.Business, nil
+	case parts.ProviderUserID:
+		return parts.Provider, nil
+	default:
+		return "", auth.ErrNotParticipant
+	}
+}
+
+// QueryByID finds the quote request identified by a given ID, as seen by the
+// participant identified by the name of their profile.
+func (q Quote) QueryByID(ctx context.Context, traceID string, quoteID string, participant string) (Info, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.quote.querybyid")
+	defer span.End()
+
+	if _, err := uuid.Parse(quoteID); err != nil {
+		return Info{}, ErrInvalidID
+	}
+
+	const q1 = `
+	SELECT` + columns + `
+	FROM
+		quotes AS q
+	WHERE
+		q.quote_id = $2`
+
+	q.log.Printf("%s: %s: %s", traceID, "quote.QueryByID",
+		database.Log(q1, participant, quoteID),
+	)
+
+	var qt Info
+	if err := q.db.GetContext(ctx, &qt, q1, participant, quoteID); err != nil {
+		if err == sql.ErrNoRows {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, errors.Wrap(err, "selecting single quote")
+	}
+
+	return qt, nil
+}
+
+// QueryInbox gets the quote requests the profile identified by a given name
+// takes part in, the most recently active first. Only the owner of the
+// profile may see its inbox.
+func (q Quote) QueryInbox(ctx context.Context, traceID string, claims auth.Claims, name string, pageNumber int, rowsPerPage int) ([]Info, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.quote.queryinbox")
+	defer span.End()
+
+	o, err := profile.QueryOwner(ctx, q.log, q.db, traceID, name)
+	if err != nil {
+		if err == profile.ErrNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if o.UserID != claims.Subject {
+		return nil, ErrForbidden
+	}
+
+	const q1 = `
+	SELECT` + columns + `
+	FROM
+		quotes AS q
+	WHERE
+		q.business_name = $1 OR q.provider_name = $1
+	ORDER BY
+		q.date_updated DESC, q.quote_id
+	OFFSET $2 ROWS FETCH NEXT $3 ROWS ONLY`
+	offset := (pageNumber - 1) * rowsPerPage
+
+	q.log.Printf("%s: %s: %s", traceID, "quote.QueryInbox",
+		database.Log(q1, name, offset, rowsPerPage),
+	)
+
+	quotes := []Info{}
+	if err := q.db.SelectContext(ctx, &quotes, q1, name, offset, rowsPerPage); err != nil {
+		return nil, errors.Wrapf(err, "selecting quotes of profile %q", name)
+	}
+
+	return quotes, nil
+}
+
+// attachments loads the attachments of the provided messages.
+func (q Quote) attachments(ctx context.Context, traceID string, messages []Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(messages))
+	index := make(map[string]int, len(messages))
+	for i, m := range messages {
+		ids[i] = m.ID
+		index[m.ID] = i
+	}
+
+	const q1 = `
+	SELECT
+		attachment_id, message_id, file_name, content_type, size, url
+	FROM
+		quote_attachments
+	WHERE
+		message_id = ANY($1::UUID[])
+	ORDER BY
+		file_name, attachment_id`
+
+	q.log.Printf("%s: %s: %s", traceID, "quote.attachments",
+		database.Log(q1, pq.Array(ids)),
+	)
+
+	var atts []Attachment
+	if err := q.db.SelectContext(ctx, &atts, q1, pq.Array(ids)); err != nil {
+		return errors.Wrap(err, "selecting attachments")
+	}
+
+	for _, a := range atts {
+		m := &messages[index[a.MessageID]]
+		m.Attachments = append(m.Attachments, a)
+	}
+
+	return nil
+}
@@ -0,0 +1,189 @@
+package quote_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/product"
+	"github.com/appinesshq/bpi/business/data/profile"
+	"github.com/appinesshq/bpi/business/data/quote"
+	"github.com/appinesshq/bpi/business/tests"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+)
+
+func TestQuote(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	q := quote.New(log, db)
+	prf := profile.New(log, db, tests.Policy())
+	p := product.New(log, db, tests.Policy())
+
+	t.Log("Given the need to request quotes from service providers.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a business requests a quote.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			buyer := auth.Claims{
+				StandardClaims: jwt.StandardClaims{
+					Issuer:    "MB Appiness Solutions",
+					Subject:   "718ffbea-f4a1-4667-8ae3-b349da52675e",
+					Audience:  "users",
+					ExpiresAt: now.Add(time.Hour).Unix(),
+					IssuedAt:  now.Unix(),
+				},
+				Roles: []string{auth.RoleUser},
+			}
+			seller := buyer
+			seller.Subject = "45b5fbd3-755f-4379-8f07-a58d4a30fa2f"
+			stranger := buyer
+			stranger.Subject = "5cf37266-3473-4006-984f-9325122678b7"
+
+			for _, np := range []profile.NewProfile{
+				{Name: "shop", Type: "BUS", DisplayName: "Shop"},
+				{Name: "own", Type: "SER", DisplayName: "Own Lawyers"},
+			} {
+				if _, err := prf.Create(ctx, traceID, buyer, np, now); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to create profile %q : %s.", tests.Failed, testID, np.Name, err)
+				}
+			}
+			for _, np := range []profile.NewProfile{
+				{Name: "acme", Type: "SER", DisplayName: "Acme Lawyers"},
+				{Name: "numbers", Type: "SER", DisplayName: "Numbers Accountants"},
+			} {
+				if _, err := prf.Create(ctx, traceID, seller, np, now); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to create profile %q : %s.", tests.Failed, testID, np.Name, err)
+				}
+			}
+
+			prd, err := p.Create(ctx, traceID, seller, product.NewProduct{Name: "Incorporation", Profile: "acme", Cost: 50000, Currency: "EUR", Quantity: 10}, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create an offering : %s.", tests.Failed, testID, err)
+			}
+
+			message := quote.NewMessage{Body: "What would it cost?"}
+			invalid := []struct {
+				claims auth.Claims
+				nq     quote.NewQuote
+				want   error
+			}{
+				{buyer, quote.NewQuote{Business: "acme", Provider: "numbers", Subject: "Books", Message: message}, quote.ErrNotBusiness},
+				{seller, quote.NewQuote{Business: "shop", Provider: "acme", Subject: "Books", Message: message}, quote.ErrForbidden},
+				{buyer, quote.NewQuote{Business: "shop", Provider: "nobody", Subject: "Books", Message: message}, quote.ErrUnknownProfile},
+				{buyer, quote.NewQuote{Business: "shop", Provider: "own", Subject: "Books", Message: message}, quote.ErrOwnProvider},
+				{buyer, quote.NewQuote{Business: "shop", ProductID: prd.ID, Provider: "numbers", Subject: "Books", Message: message}, quote.ErrProviderMismatch},
+				{buyer, quote.NewQuote{Business: "shop", ProductID: "15f2d6f0-4b76-4bd6-b5f6-49a4bc2e6cb4", Subject: "Books", Message: message}, quote.ErrUnknownProduct},
+			}
+			for _, tt := range invalid {
+				if _, err := q.Create(ctx, traceID, tt.claims, tt.nq, now); errors.Cause(err) != tt.want {
+					t.Fatalf("\t%s\tTest %d:\tShould NOT be able to request quote %+v : got %v, want %v.", tests.Failed, testID, tt.nq, err, tt.want)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to request quotes outside a business and a foreign provider.", tests.Success, testID)
+
+			nq := quote.NewQuote{
+				Business:  "shop",
+				ProductID: prd.ID,
+				Subject:   "Incorporation in the Netherlands",
+				Message: quote.NewMessage{
+					Body: "Could you send us a quote?",
+					Attachments: []quote.NewAttachment{
+						{FileName: "statutes.pdf", ContentType: "application/pdf", Size: 1024, URL: "https://files.example.com/statutes.pdf"},
+					},
+				},
+			}
+			qt, err := q.Create(ctx, traceID, buyer, nq, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to request a quote : %s.", tests.Failed, testID, err)
+			}
+			if qt.Provider != "acme" {
+				t.Fatalf("\t%s\tTest %d:\tShould request the quote from the provider of the offering : got %q.", tests.Failed, testID, qt.Provider)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to request a quote for an offering.", tests.Success, testID)
+
+			parts := []struct {
+				claims auth.Claims
+				want   string
+			}{
+				{buyer, "shop"},
+				{seller, "acme"},
+			}
+			for _, tt := range parts {
+				name, err := q.Participant(ctx, traceID, tt.claims, qt.ID)
+				if err != nil || name != tt.want {
+					t.Fatalf("\t%s\tTest %d:\tShould take part as %q : got %q, %v.", tests.Failed, testID, tt.want, name, err)
+				}
+			}
+			if _, err := q.Participant(ctx, traceID, stranger, qt.ID); errors.Cause(err) != auth.ErrNotParticipant {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT take part as a stranger : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould only let the owners of both profiles take part.", tests.Success, testID)
+
+			saved, err := q.QueryByID(ctx, traceID, qt.ID, "shop")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve quote by ID : %s.", tests.Failed, testID, err)
+			}
+			if diff := cmp.Diff(qt, saved); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the same quote. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the same quote.", tests.Success, testID)
+
+			replied := now.Add(time.Hour)
+			reply, err := q.AddMessage(ctx, traceID, seller, qt.ID, "acme", quote.NewMessage{Body: "That would be 500 euro."}, replied)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to reply : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to reply.", tests.Success, testID)
+
+			messages, err := q.QueryMessages(ctx, traceID, qt.ID, 1, 10)
+			if err != nil || len(messages) != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould get both messages : %+v, %v.", tests.Failed, testID, messages, err)
+			}
+			if messages[0].ID != reply.ID || len(messages[1].Attachments) != 1 || messages[1].Attachments[0].FileName != "statutes.pdf" {
+				t.Fatalf("\t%s\tTest %d:\tShould get the newest message first with its attachments : %+v.", tests.Failed, testID, messages)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the newest message first with its attachments.", tests.Success, testID)
+
+			saved, err = q.QueryByID(ctx, traceID, qt.ID, "shop")
+			if err != nil || saved.Messages != 2 || saved.Unread != 1 || !saved.DateUpdated.Equal(replied) {
+				t.Fatalf("\t%s\tTest %d:\tShould count the unread reply : %+v, %v.", tests.Failed, testID, saved, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould count the unread reply.", tests.Success, testID)
+
+			read := replied.Add(time.Hour)
+			if n, err := q.MarkRead(ctx, traceID, qt.ID, "shop", read); err != nil || n != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould mark the reply read : %d, %v.", tests.Failed, testID, n, err)
+			}
+			if n, err := q.MarkRead(ctx, traceID, qt.ID, "shop", read.Add(time.Hour)); err != nil || n != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould keep the time the reply was first read : %d, %v.", tests.Failed, testID, n, err)
+			}
+			messages, err = q.QueryMessages(ctx, traceID, qt.ID, 1, 10)
+			if err != nil || messages[0].DateRead == nil || !messages[0].DateRead.Equal(read) || messages[1].DateRead != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould only mark the messages of the other side read : %+v, %v.", tests.Failed, testID, messages, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould record when the reply was read.", tests.Success, testID)
+
+			inbox, err := q.QueryInbox(ctx, traceID, seller, "acme", 1, 10)
+			if err != nil || len(inbox) != 1 || inbox[0].ID != qt.ID || inbox[0].Unread != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould find the quote in the inbox of the provider : %+v, %v.", tests.Failed, testID, inbox, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould find the quote in the inbox of the provider.", tests.Success, testID)
+
+			if _, err := q.QueryInbox(ctx, traceID, buyer, "acme", 1, 10); errors.Cause(err) != quote.ErrForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to see the inbox of another user : %v.", tests.Failed, testID, err)
+			}
+			if _, err := q.QueryInbox(ctx, traceID, buyer, "nobody", 1, 10); errors.Cause(err) != quote.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT find the inbox of an unknown profile : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould only let the owner see an inbox.", tests.Success, testID)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package review
+
+import "time"
+
+// Info represents a review of a service provider.
+type Info struct {
+	ID            string     `db:"review_id" json:"id"`                            // Unique identifier.
+	Provider      string     `db:"provider_name" json:"provider"`                  // Name of the service provider profile reviewed.
+	Reviewer      string     `db:"reviewer_name" json:"reviewer"`                  // Name of the profile the review was written as.
+	Rating        int        `db:"rating" json:"rating"`                           // Rating from 1 to 5.
+	Body          string     `db:"body" json:"body"`                               // Text of the review.
+	Response      string     `db:"response" json:"response"`                       // Response of the provider.
+	DateResponded *time.Time `db:"date_responded" json:"date_responded,omitempty"` // When the provider last responded.
+	Hidden        bool       `db:"hidden" json:"hidden"`                           // Whether a moderator hid the review.
+	DateModerated *time.Time `db:"date_moderated" json:"date_moderated,omitempty"` // When the review was last moderated.
+	UserID        string     `db:"user_id" json:"user_id"`                         // ID of the user who wrote the review.
+	DateCreated   time.Time  `db:"date_created" json:"date_created"`               // When the review was written.
+	DateUpdated   time.Time  `db:"date_updated" json:"date_updated"`               // When the review was last edited.
+}
+
+// NewReview is what we require from clients when reviewing a provider.
+type NewReview struct {
+	Provider string `json:"provider" validate:"required"`
+	Reviewer string `json:"reviewer" validate:"required"`
+	Rating   int    `json:"rating" validate:"required,min=1,max=5"`
+	Body     string `json:"body" validate:"required,max=5000"`
+}
+
+// UpdateReview defines what information may be provided to edit an existing
+// Review. All fields are optional so clients can send just the fields they
+// want changed.
+type UpdateReview struct {
+	Rating *int    `json:"rating" validate:"omitempty,min=1,max=5"`
+	Body   *string `json:"body" validate:"omitempty,min=1,max=5000"`
+}
+
+// Response is what we require from clients when a provider responds to a
+// review. An empty body withdraws the response.
+type Response struct {
+	Body string `json:"body" validate:"max=5000"`
+}
+
+// Moderation is what we require from clients when a moderator decides on a
+// review.
+type Moderation struct {
+	Hidden bool `json:"hidden"`
+}
@@ -0,0 +1,467 @@
+// Package review contains the reviews profiles write about service providers,
+// along with their moderation.
+package review
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/audit"
+	"github.com/appinesshq/bpi/business/data/profile"
+	"github.com/appinesshq/bpi/foundation/database"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+var (
+	// ErrNotFound is used when a specific Review is requested but does not exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrInvalidID occurs when an ID is not in a valid form.
+	ErrInvalidID = errors.New("ID is not in its proper form")
+
+	// ErrForbidden occurs when a user tries to do something that is forbidden to them according to our access control policies.
+	ErrForbidden = errors.New("attempted action is not allowed")
+
+	// ErrUnknownProfile occurs when a review is written about or as a profile
+	// that does not exist.
+	ErrUnknownProfile = errors.New("unknown profile")
+
+	// ErrNotProvider occurs when a review is written about a profile that is
+	// not a service provider profile.
+	ErrNotProvider = errors.New("profile is not a service provider")
+
+	// ErrOwnProvider occurs when a user reviews a service provider profile of
+	// their own.
+	ErrOwnProvider = errors.New("cannot review an own provider")
+
+	// ErrAlreadyReviewed occurs when a user reviews a provider they reviewed
+	// before, as the same or another of their profiles.
+	ErrAlreadyReviewed = errors.New("provider is already reviewed by the user")
+)
+
+// columns selects a review from reviews aliased as r.
+const columns = `
+		r.review_id, r.provider_name, r.reviewer_name, r.rating, r.body,
+		r.response, r.date_responded, r.hidden, r.date_moderated, r.user_id,
+		r.date_created, r.date_updated`
+
+// Review manages the set of API's for review access.
+type Review struct {
+	log    *log.Logger
+	db     *sqlx.DB
+	policy *auth.Policy
+}
+
+// New constructs a Review for api access. The policy decides which actions
+// the claims passed to its methods allow.
+func New(log *log.Logger, db *sqlx.DB, policy *auth.Policy) Review {
+	return Review{
+		log:    log,
+		db:     db,
+		policy: policy,
+	}
+}
+
+// Create adds a Review of a service provider, written as a profile owned by
+// the claims. A user reviews a provider once, whichever of their profiles
+// they write as, and nobody reviews their own providers. It returns the
+// created Review with fields like ID and DateCreated populated.
+func (rv Review) Create(ctx context.Context, traceID string, claims auth.Claims, nr NewReview, now time.Time) (Info, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.review.create")
+	defer span.End()
+
+	tx, err := rv.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return Info{}, errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	reviewer, err := profile.QueryOwner(ctx, rv.log, tx, traceID, nr.Reviewer)
+	if err != nil {
+		if err == profile.ErrNotFound {
+			return Info{}, ErrUnknownProfile
+		}
+		return Info{}, err
+	}
+	if reviewer.UserID != claims.Subject {
+		return Info{}, ErrForbidden
+	}
+
+	provider, err := profile.QueryOwner(ctx, rv.log, tx, traceID, nr.Provider)
+	if err != nil {
+		if err == profile.ErrNotFound {
+			return Info{}, ErrUnknownProfile
+		}
+		return Info{}, err
+	}
+	if provider.Type != string(profile.ServiceProviderProfile) {
+		return Info{}, ErrNotProvider
+	}
+	if provider.UserID == claims.Subject {
+		return Info{}, ErrOwnProvider
+	}
+
+	r := Info{
+		ID:          uuid.New().String(),
+		Provider:    nr.Provider,
+		Reviewer:    nr.Reviewer,
+		Rating:      nr.Rating,
+		Body:        nr.Body,
+		UserID:      claims.Subject,
+		DateCreated: now.UTC(),
+		DateUpdated: now.UTC(),
+	}
+
+	const q = `
+	INSERT INTO reviews
+		(review_id, provider_name, reviewer_name, rating, body, user_id, date_created, date_updated)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	args := []interface{}{r.ID, r.Provider, r.Reviewer, r.Rating, r.Body, r.UserID, r.DateCreated, r.DateUpdated}
+
+	rv.log.Printf("%s: %s: %s", traceID, "review.Create",
+		database.Log(q, args...),
+	)
+
+	if _, err := tx.ExecContext(ctx, q, args...); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			return Info{}, ErrAlreadyReviewed
+		}
+		return Info{}, errors.Wrap(err, "inserting review")
+	}
+
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionCreate,
+		EntityType: "review",
+		EntityID:   r.ID,
+		After:      r,
+	}
+	if err := audit.Record(ctx, rv.log, tx, traceID, ne, now); err != nil {
+		return Info{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Info{}, errors.Wrap(err, "committing review")
+	}
+
+	return r, nil
+}
+
+// Update edits the review identified by a given ID. Only the owner of the
+// reviewer profile may edit a review. An edited review goes back into the
+// moderation queue.
+func (rv Review) Update(ctx context.Context, traceID string, claims auth.Claims, reviewID string, ur UpdateReview, now time.Time) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.review.update")
+	defer span.End()
+
+	r, err := rv.QueryByID(ctx, traceID, reviewID)
+	if err != nil {
+		return err
+	}
+
+	reviewer, err := profile.QueryOwner(ctx, rv.log, rv.db, traceID, r.Reviewer)
+	if err != nil {
+		if err == profile.ErrNotFound {
+			return ErrForbidden
+		}
+		return err
+	}
+	if reviewer.UserID != claims.Subject {
+		return ErrForbidden
+	}
+
+	before := r
+	if ur.Rating != nil {
+		r.Rating = *ur.Rating
+	}
+	if ur.Body != nil {
+		r.Body = *ur.Body
+	}
+	r.DateModerated = nil
+	r.DateUpdated = now
+
+	const q = `
+	UPDATE
+		reviews
+	SET
+		"rating" = $2,
+		"body" = $3,
+		"date_moderated" = NULL,
+		"date_updated" = $4
+	WHERE
+		review_id = $1`
+
+	rv.log.Printf("%s: %s: %s", traceID, "review.Update",
+		database.Log(q, reviewID, r.Rating, r.Body, r.DateUpdated),
+	)
+
+	tx, err := rv.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, q, reviewID, r.Rating, r.Body, r.DateUpdated); err != nil {
+		return errors.Wrap(err, "updating review")
+	}
+
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionUpdate,
+		EntityType: "review",
+		EntityID:   reviewID,
+		Before:     before,
+		After:      r,
+	}
+	if err := audit.Record(ctx, rv.log, tx, traceID, ne, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing review")
+	}
+
+	return nil
+}
+
+// Respond sets the response of the provider to the review identified by a
+// given ID. The response is part of the provider profile, so the claims need
+// to allow editing it.
+func (rv Review) Respond(ctx context.Context, traceID string, claims auth.Claims, reviewID string, resp Response, now time.Time) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.review.respond")
+	defer span.End()
+
+	r, err := rv.QueryByID(ctx, traceID, reviewID)
+	if err != nil {
+		return err
+	}
+
+	provider, err := profile.QueryOwner(ctx, rv.log, rv.db, traceID, r.Provider)
+	if err != nil {
+		if err == profile.ErrNotFound {
+			return ErrForbidden
+		}
+		return err
+	}
+	if !rv.policy.AllowedFor(claims, auth.PermissionProfileEdit, provider.UserID) {
+		return ErrForbidden
+	}
+
+	before := r
+	r.Response = resp.Body
+	r.DateResponded = nil
+	if resp.Body != "" {
+		responded := now.UTC()
+		r.DateResponded = &responded
+	}
+
+	const q = `
+	UPDATE
+		reviews
+	SET
+		"response" = $2,
+		"date_responded" = $3
+	WHERE
+		review_id = $1`
+
+	rv.log.Printf("%s: %s: %s", traceID, "review.Respond",
+		database.Log(q, reviewID, r.Response, r.DateResponded),
+	)
+
+	tx, err := rv.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, q, reviewID, r.Response, r.DateResponded); err != nil {
+		return errors.Wrap(err, "responding to review")
+	}
+
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionUpdate,
+		EntityType: "review",
+		EntityID:   reviewID,
+		Before:     before,
+		After:      r,
+	}
+	if err := audit.Record(ctx, rv.log, tx, traceID, ne, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing review")
+	}
+
+	return nil
+}
+
+// Moderate records the decision of a moderator on the review identified by a
+// given ID, taking it out of the moderation queue. Hidden reviews are left
+// out of the reviews of the provider and its score.
+func (rv Review) Moderate(ctx context.Context, traceID string, claims auth.Claims, reviewID string, m Moderation, now time.Time) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.review.moderate")
+	defer span.End()
+
+	if !rv.policy.Allowed(claims, auth.PermissionReviewModerate) {
+		return ErrForbidden
+	}
+
+	r, err := rv.QueryByID(ctx, traceID, reviewID)
+	if err != nil {
+		return err
+	}
+
+	before := r
+	moderated := now.UTC()
+	r.Hidden = m.Hidden
+	r.DateModerated = &moderated
+
+	const q = `
+	UPDATE
+		reviews
+	SET
+		"hidden" = $2,
+		"date_moderated" = $3
+	WHERE
+		review_id = $1`
+
+	rv.log.Printf("%s: %s: %s", traceID, "review.Moderate",
+		database.Log(q, reviewID, r.Hidden, moderated),
+	)
+
+	tx, err := rv.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, q, reviewID, r.Hidden, moderated); err != nil {
+		return errors.Wrap(err, "moderating review")
+	}
+
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionUpdate,
+		EntityType: "review",
+		EntityID:   reviewID,
+		Before:     before,
+		After:      r,
+	}
+	if err := audit.Record(ctx, rv.log, tx, traceID, ne, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing review")
+	}
+
+	return nil
+}
+
+// QueryByID gets the specified review from the database, whether it is hidden
+// or not.
+func (rv Review) QueryByID(ctx context.Context, traceID string, reviewID string) (Info, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.review.querybyid")
+	defer span.End()
+
+	if _, err := uuid.Parse(reviewID); err != nil {
+		return Info{}, ErrInvalidID
+	}
+
+	const q = `
+	SELECT` + columns + `
+	FROM
+		reviews AS r
+	WHERE
+		r.review_id = $1`
+
+	rv.log.Printf("%s: %s: %s", traceID, "review.QueryByID",
+		database.Log(q, reviewID),
+	)
+
+	var r Info
+	if err := rv.db.GetContext(ctx, &r, q, reviewID); err != nil {
+		if err == sql.ErrNoRows {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, errors.Wrap(err, "selecting single review")
+	}
+
+	return r, nil
+}
+
+// QueryByProvider gets the reviews of the provider identified by a given
+// name, the most recent first. Hidden reviews and reviews written as deleted
+// profiles are left out, as they are from the score of the provider.
+func (rv Review) QueryByProvider(ctx context.Context, traceID string, name string, pageNumber int, rowsPerPage int) ([]Info, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.review.querybyprovider")
+	defer span.End()
+
+	const q = `
+	SELECT` + columns + `
+	FROM
+		reviews AS r
+	JOIN
+		profiles AS p ON p.name = r.reviewer_name
+	WHERE
+		r.provider_name = $1 AND NOT r.hidden AND p.deleted_at IS NULL
+	ORDER BY
+		r.date_created DESC, r.review_id
+	OFFSET $2 ROWS FETCH NEXT $3 ROWS ONLY`
+	offset := (pageNumber - 1) * rowsPerPage
+
+	rv.log.Printf("%s: %s: %s", traceID, "review.QueryByProvider",
+		database.Log(q, name, offset, rowsPerPage),
+	)
+
+	reviews := []Info{}
+	if err := rv.db.SelectContext(ctx, &reviews, q, name, offset, rowsPerPage); err != nil {
+		return nil, errors.Wrapf(err, "selecting reviews of provider %q", name)
+	}
+
+	return reviews, nil
+}
+
+// QueryQueue gets the reviews waiting for a moderator, the longest waiting
+// first. New and edited reviews wait until a moderator decides on them.
+func (rv Review) QueryQueue(ctx context.Context, traceID string, claims auth.Claims, pageNumber int, rowsPerPage int) ([]Info, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.review.queryqueue")
+	defer span.End()
+
+	if !rv.policy.Allowed(claims, auth.PermissionReviewModerate) {
+		return nil, ErrForbidden
+	}
+
+	const q = `
+	SELECT` + columns + `
+	FROM
+		reviews AS r
+	WHERE
+		r.date_moderated IS NULL
+	ORDER BY
+		r.date_updated, r.review_id
+	OFFSET $1 ROWS FETCH NEXT $2 ROWS ONLY`
+	offset := (pageNumber - 1) * rowsPerPage
+
+	rv.log.Printf("%s: %s: %s", traceID, "review.QueryQueue",
+		database.Log(q, offset, rowsPerPage),
+	)
+
+	reviews := []Info{}
+	if err := rv.db.SelectContext(ctx, &reviews, q, offset, rowsPerPage); err != nil {
+		return nil, errors.Wrap(err, "selecting unmoderated reviews")
+	}
+
+	return reviews, nil
+}
@@ -0,0 +1,175 @@
+package review_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/profile"
+	"github.com/appinesshq/bpi/business/data/review"
+	"github.com/appinesshq/bpi/business/tests"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+)
+
+func TestReview(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	rv := review.New(log, db, tests.Policy())
+	prf := profile.New(log, db, tests.Policy())
+
+	t.Log("Given the need to review service providers.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen reviewing a provider.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			customer := auth.Claims{
+				StandardClaims: jwt.StandardClaims{
+					Issuer:    "MB Appiness Solutions",
+					Subject:   "718ffbea-f4a1-4667-8ae3-b349da52675e",
+					Audience:  "users",
+					ExpiresAt: now.Add(time.Hour).Unix(),
+					IssuedAt:  now.Unix(),
+				},
+				Roles: []string{auth.RoleUser},
+			}
+			seller := customer
+			seller.Subject = "45b5fbd3-755f-4379-8f07-a58d4a30fa2f"
+			neighbour := customer
+			neighbour.Subject = "9e1a6b6e-2f0c-4c8d-8a4b-3d6f1c2e7a90"
+			admin := customer
+			admin.Subject = "5cf37266-3473-4006-984f-9325122678b7"
+			admin.Roles = []string{auth.RoleAdmin, auth.RoleUser}
+
+			for _, np := range []profile.NewProfile{
+				{Name: "shop", Type: "BUS", DisplayName: "Shop"},
+				{Name: "jane", Type: "USR", DisplayName: "Jane"},
+			} {
+				if _, err := prf.Create(ctx, traceID, customer, np, now); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to create profile %q : %s.", tests.Failed, testID, np.Name, err)
+				}
+			}
+			for _, np := range []profile.NewProfile{
+				{Name: "acme", Type: "SER", DisplayName: "Acme Lawyers"},
+				{Name: "acmeshop", Type: "BUS", DisplayName: "Acme Shop"},
+			} {
+				if _, err := prf.Create(ctx, traceID, seller, np, now); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to create profile %q : %s.", tests.Failed, testID, np.Name, err)
+				}
+			}
+			if _, err := prf.Create(ctx, traceID, neighbour, profile.NewProfile{Name: "joe", Type: "USR", DisplayName: "Joe"}, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create profile %q : %s.", tests.Failed, testID, "joe", err)
+			}
+
+			invalid := []struct {
+				claims auth.Claims
+				nr     review.NewReview
+				want   error
+			}{
+				{seller, review.NewReview{Provider: "acme", Reviewer: "acmeshop", Rating: 5, Body: "The best."}, review.ErrOwnProvider},
+				{seller, review.NewReview{Provider: "acme", Reviewer: "shop", Rating: 5, Body: "The best."}, review.ErrForbidden},
+				{customer, review.NewReview{Provider: "acmeshop", Reviewer: "shop", Rating: 5, Body: "The best."}, review.ErrNotProvider},
+				{customer, review.NewReview{Provider: "nobody", Reviewer: "shop", Rating: 5, Body: "The best."}, review.ErrUnknownProfile},
+			}
+			for _, tt := range invalid {
+				if _, err := rv.Create(ctx, traceID, tt.claims, tt.nr, now); errors.Cause(err) != tt.want {
+					t.Fatalf("\t%s\tTest %d:\tShould NOT be able to write review %+v : got %v, want %v.", tests.Failed, testID, tt.nr, err, tt.want)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to review own providers or as profiles of others.", tests.Success, testID)
+
+			r, err := rv.Create(ctx, traceID, customer, review.NewReview{Provider: "acme", Reviewer: "shop", Rating: 4, Body: "Quick and clear."}, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to review a provider : %s.", tests.Failed, testID, err)
+			}
+			if _, err := rv.Create(ctx, traceID, customer, review.NewReview{Provider: "acme", Reviewer: "shop", Rating: 1, Body: "Again."}, now); errors.Cause(err) != review.ErrAlreadyReviewed {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to review a provider twice as the same profile : %v.", tests.Failed, testID, err)
+			}
+			if _, err := rv.Create(ctx, traceID, customer, review.NewReview{Provider: "acme", Reviewer: "jane", Rating: 1, Body: "Again."}, now); errors.Cause(err) != review.ErrAlreadyReviewed {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to review a provider twice as another profile : %v.", tests.Failed, testID, err)
+			}
+			abuse, err := rv.Create(ctx, traceID, neighbour, review.NewReview{Provider: "acme", Reviewer: "joe", Rating: 1, Body: "Abuse."}, now.Add(time.Minute))
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to review a provider as another user : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to review a provider once per user.", tests.Success, testID)
+
+			saved, err := rv.QueryByID(ctx, traceID, r.ID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve review by ID : %s.", tests.Failed, testID, err)
+			}
+			if diff := cmp.Diff(r, saved); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the same review. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the same review.", tests.Success, testID)
+
+			p, err := prf.QueryByName(ctx, traceID, "acme")
+			if err != nil || p.Reviews != 2 || p.Rating != 2.5 {
+				t.Fatalf("\t%s\tTest %d:\tShould score the provider : %d reviews, %v, %v.", tests.Failed, testID, p.Reviews, p.Rating, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould score the provider.", tests.Success, testID)
+
+			if err := rv.Respond(ctx, traceID, customer, r.ID, review.Response{Body: "Thanks!"}, now); errors.Cause(err) != review.ErrForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to respond on behalf of the provider : %v.", tests.Failed, testID, err)
+			}
+			if err := rv.Respond(ctx, traceID, seller, r.ID, review.Response{Body: "Thanks!"}, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to respond as the provider : %s.", tests.Failed, testID, err)
+			}
+			saved, err = rv.QueryByID(ctx, traceID, r.ID)
+			if err != nil || saved.Response != "Thanks!" || saved.DateResponded == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould see the response : %+v, %v.", tests.Failed, testID, saved, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould only let the provider respond.", tests.Success, testID)
+
+			queue, err := rv.QueryQueue(ctx, traceID, admin, 1, 10)
+			if err != nil || len(queue) != 2 || queue[0].ID != r.ID {
+				t.Fatalf("\t%s\tTest %d:\tShould queue the new reviews for moderation : %+v, %v.", tests.Failed, testID, queue, err)
+			}
+			if _, err := rv.QueryQueue(ctx, traceID, customer, 1, 10); errors.Cause(err) != review.ErrForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT show the queue to users : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould queue the new reviews for moderators.", tests.Success, testID)
+
+			if err := rv.Moderate(ctx, traceID, seller, abuse.ID, review.Moderation{Hidden: true}, now); errors.Cause(err) != review.ErrForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT let users hide reviews : %v.", tests.Failed, testID, err)
+			}
+			if err := rv.Moderate(ctx, traceID, admin, abuse.ID, review.Moderation{Hidden: true}, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to hide a review : %s.", tests.Failed, testID, err)
+			}
+			if err := rv.Moderate(ctx, traceID, admin, r.ID, review.Moderation{}, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to approve a review : %s.", tests.Failed, testID, err)
+			}
+			if queue, err := rv.QueryQueue(ctx, traceID, admin, 1, 10); err != nil || len(queue) != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould empty the queue : %+v, %v.", tests.Failed, testID, queue, err)
+			}
+			reviews, err := rv.QueryByProvider(ctx, traceID, "acme", 1, 10)
+			if err != nil || len(reviews) != 1 || reviews[0].ID != r.ID {
+				t.Fatalf("\t%s\tTest %d:\tShould leave hidden reviews out : %+v, %v.", tests.Failed, testID, reviews, err)
+			}
+			p, err = prf.QueryByName(ctx, traceID, "acme")
+			if err != nil || p.Reviews != 1 || p.Rating != 4 {
+				t.Fatalf("\t%s\tTest %d:\tShould leave hidden reviews out of the score : %d reviews, %v, %v.", tests.Failed, testID, p.Reviews, p.Rating, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould leave hidden reviews out.", tests.Success, testID)
+
+			if err := rv.Update(ctx, traceID, seller, r.ID, review.UpdateReview{Rating: tests.IntPointer(1)}, now); errors.Cause(err) != review.ErrForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to edit the review of another user : %v.", tests.Failed, testID, err)
+			}
+			if err := rv.Update(ctx, traceID, customer, r.ID, review.UpdateReview{Rating: tests.IntPointer(5)}, now.Add(time.Hour)); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to edit a review : %s.", tests.Failed, testID, err)
+			}
+			queue, err = rv.QueryQueue(ctx, traceID, admin, 1, 10)
+			if err != nil || len(queue) != 1 || queue[0].Rating != 5 || queue[0].Body != r.Body {
+				t.Fatalf("\t%s\tTest %d:\tShould queue the edited review again : %+v, %v.", tests.Failed, testID, queue, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould queue an edited review again.", tests.Success, testID)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package sale
+
+import "time"
+
+// Info represents an individual sale of a product.
+type Info struct {
+	ID          string    `db:"sale_id" json:"id"`                // Unique identifier.
+	ProductID   string    `db:"product_id" json:"product_id"`     // ID of the product sold.
+	UserID      string    `db:"user_id" json:"user_id"`           // ID of the user who bought the items.
+	Quantity    int       `db:"quantity" json:"quantity"`         // Number of items sold.
+	Paid        int       `db:"paid" json:"paid"`                 // Total paid for the items in the minor unit of the currency.
+	Currency    string    `db:"currency" json:"currency"`         // ISO 4217 code of the currency paid in.
+	DateCreated time.Time `db:"date_created" json:"date_created"` // When the sale was recorded.
+}
+
+// NewSale is what we require from clients when buying a Product. The price
+// paid follows from the cost of the product at the time of the sale.
+type NewSale struct {
+	Quantity int `json:"quantity" validate:"gte=1"`
+}
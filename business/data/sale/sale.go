@@ -0,0 +1,262 @@
+// Package sale contains the functionality for selling products.
+package sale
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/audit"
+	"github.com/appinesshq/bpi/business/data/product"
+	"github.com/appinesshq/bpi/foundation/database"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+var (
+	// ErrNotFound is used when the product of a sale does not exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrInvalidID occurs when an ID is not in a valid form.
+	ErrInvalidID = errors.New("ID is not in its proper form")
+
+	// ErrForbidden occurs when a user tries to do something that is forbidden to them according to our access control policies.
+	ErrForbidden = errors.New("attempted action is not allowed")
+
+	// ErrInvalidQuantity occurs when a sale is for less than one item.
+	ErrInvalidQuantity = errors.New("quantity must be at least one")
+
+	// ErrInsufficientStock occurs when a product has fewer items left than a
+	// sale asks for.
+	ErrInsufficientStock = errors.New("not enough items in stock")
+
+	// ErrUnavailable occurs when a product is sold that its provider doesn't
+	// offer for now.
+	ErrUnavailable = errors.New("product is unavailable")
+)
+
+// Sale manages the set of API's for sale access.
+type Sale struct {
+	log    *log.Logger
+	db     *sqlx.DB
+	policy *auth.Policy
+}
+
+// New constructs a Sale for api access. The policy decides which
+// actions the claims passed to its methods allow.
+func New(log *log.Logger, db *sqlx.DB, policy *auth.Policy) Sale {
+	return Sale{
+		log:    log,
+		db:     db,
+		policy: policy,
+	}
+}
+
+// Create sells items of the product identified by a given ID to the user of
+// the claims. It returns the recorded Sale with the price paid. The sale fails
+// when the product is unavailable or fewer items are left than asked for.
+func (s Sale) Create(ctx context.Context, traceID string, claims auth.Claims, productID string, ns NewSale, now time.Time) (Info, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.sale.create")
+	defer span.End()
+
+	if _, err := uuid.Parse(productID); err != nil {
+		return Info{}, ErrInvalidID
+	}
+	if ns.Quantity < 1 {
+		return Info{}, ErrInvalidQuantity
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return Info{}, errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	// Locking the product makes concurrent sales of it wait for each other, so
+	// the items sold are counted only once the previous sale is committed.
+	q := `
+	SELECT
+		product_id, cost, currency, quantity, availability
+	FROM
+		products
+	WHERE
+		product_id = $1 AND deleted_at IS NULL
+	FOR UPDATE`
+
+	s.log.Printf("%s: %s: %s", traceID, "sale.Create",
+		database.Log(q, productID),
+	)
+
+	var prd struct {
+		ID           string               `db:"product_id"`
+		Cost         int                  `db:"cost"`
+		Currency     string               `db:"currency"`
+		Quantity     int                  `db:"quantity"`
+		Availability product.Availability `db:"availability"`
+	}
+	if err := tx.GetContext(ctx, &prd, q, productID); err != nil {
+		if err == sql.ErrNoRows {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, errors.Wrapf(err, "selecting product %q", productID)
+	}
+	if prd.Availability == product.Unavailable {
+		return Info{}, ErrUnavailable
+	}
+
+	q = `
+	SELECT
+		COALESCE(SUM(quantity), 0)
+	FROM
+		sales
+	WHERE
+		product_id = $1`
+
+	s.log.Printf("%s: %s: %s", traceID, "sale.Create",
+		database.Log(q, prd.ID),
+	)
+
+	var sold int
+	if err := tx.GetContext(ctx, &sold, q, prd.ID); err != nil {
+		return Info{}, errors.Wrapf(err, "counting items sold of product %q", prd.ID)
+	}
+
+	if prd.Quantity-sold < ns.Quantity {
+		return Info{}, ErrInsufficientStock
+	}
+
+	sl := Info{
+		ID:          uuid.New().String(),
+		ProductID:   prd.ID,
+		UserID:      claims.Subject,
+		Quantity:    ns.Quantity,
+		Paid:        ns.Quantity * prd.Cost,
+		Currency:    prd.Currency,
+		DateCreated: now.UTC(),
+	}
+
+	q = `
+	INSERT INTO sales
+		(sale_id, product_id, user_id, quantity, paid, currency, date_created)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7)`
+
+	s.log.Printf("%s: %s: %s", traceID, "sale.Create",
+		database.Log(q, sl.ID, sl.ProductID, sl.UserID, sl.Quantity, sl.Paid, sl.Currency, sl.DateCreated),
+	)
+
+	if _, err := tx.ExecContext(ctx, q, sl.ID, sl.ProductID, sl.UserID, sl.Quantity, sl.Paid, sl.Currency, sl.DateCreated); err != nil {
+		return Info{}, errors.Wrap(err, "inserting sale")
+	}
+
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionCreate,
+		EntityType: "sale",
+		EntityID:   sl.ID,
+		After:      sl,
+	}
+	if err := audit.Record(ctx, s.log, tx, traceID, ne, now); err != nil {
+		return Info{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Info{}, errors.Wrap(err, "committing sale")
+	}
+
+	return sl, nil
+}
+
+// QueryByProduct gets the sales of the product identified by a given ID, the
+// most recent first. Only the owner of the product may see its sales.
+func (s Sale) QueryByProduct(ctx context.Context, traceID string, claims auth.Claims, productID string, pageNumber int, rowsPerPage int) ([]Info, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.sale.querybyproduct")
+	defer span.End()
+
+	if _, err := uuid.Parse(productID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	q := `
+	SELECT
+		user_id
+	FROM
+		products
+	WHERE
+		product_id = $1 AND deleted_at IS NULL`
+
+	s.log.Printf("%s: %s: %s", traceID, "sale.QueryByProduct",
+		database.Log(q, productID),
+	)
+
+	var ownerID string
+	if err := s.db.GetContext(ctx, &ownerID, q, productID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, errors.Wrapf(err, "selecting product %q", productID)
+	}
+
+	if !s.policy.AllowedFor(claims, auth.PermissionProductEdit, ownerID) {
+		return nil, ErrForbidden
+	}
+
+	q = `
+	SELECT
+		*
+	FROM
+		sales
+	WHERE
+		product_id = $1
+	ORDER BY
+		date_created DESC, sale_id
+	OFFSET $2 ROWS FETCH NEXT $3 ROWS ONLY`
+	offset := (pageNumber - 1) * rowsPerPage
+
+	s.log.Printf("%s: %s: %s", traceID, "sale.QueryByProduct",
+		database.Log(q, productID, offset, rowsPerPage),
+	)
+
+	sales := []Info{}
+	if err := s.db.SelectContext(ctx, &sales, q, productID, offset, rowsPerPage); err != nil {
+		return nil, errors.Wrapf(err, "selecting sales of product %q", productID)
+	}
+
+	return sales, nil
+}
+
+// QueryByUser gets all purchases of the user identified by a given ID, the
+// oldest first.
+func (s Sale) QueryByUser(ctx context.Context, traceID string, userID string) ([]Info, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.sale.querybyuser")
+	defer span.End()
+
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	const q = `
+	SELECT
+		*
+	FROM
+		sales
+	WHERE
+		user_id = $1
+	ORDER BY
+		date_created`
+
+	s.log.Printf("%s: %s: %s", traceID, "sale.QueryByUser",
+		database.Log(q, userID),
+	)
+
+	sales := []Info{}
+	if err := s.db.SelectContext(ctx, &sales, q, userID); err != nil {
+		return nil, errors.Wrapf(err, "selecting sales of user %q", userID)
+	}
+
+	return sales, nil
+}
@@ -0,0 +1,151 @@
+package sale_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/product"
+	"github.com/appinesshq/bpi/business/data/profile"
+	"github.com/appinesshq/bpi/business/data/sale"
+	"github.com/appinesshq/bpi/business/tests"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+func TestSale(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	p := product.New(log, db, tests.Policy())
+	s := sale.New(log, db, tests.Policy())
+
+	t.Log("Given the need to sell Products.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen selling items of a single Product.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			owner := auth.Claims{
+				StandardClaims: jwt.StandardClaims{
+					Issuer:    "MB Appiness Solutions",
+					Subject:   "718ffbea-f4a1-4667-8ae3-b349da52675e",
+					Audience:  "users",
+					ExpiresAt: now.Add(time.Hour).Unix(),
+					IssuedAt:  now.Unix(),
+				},
+				Roles: []string{auth.RoleUser},
+			}
+			buyer := owner
+			buyer.Subject = "45b5fbd3-755f-4379-8f07-a58d4a30fa2f"
+
+			if _, err := profile.New(log, db, tests.Policy()).Create(ctx, traceID, owner, profile.NewProfile{Name: "acme", Type: "SER", DisplayName: "Acme"}, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a provider : %s.", tests.Failed, testID, err)
+			}
+
+			prd, err := p.Create(ctx, traceID, owner, product.NewProduct{Name: "Comic Books", Profile: "acme", Cost: 25, Currency: "EUR", Quantity: 10}, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a product : %s.", tests.Failed, testID, err)
+			}
+
+			sl, err := s.Create(ctx, traceID, buyer, prd.ID, sale.NewSale{Quantity: 3}, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to sell items : %s.", tests.Failed, testID, err)
+			}
+			if sl.Paid != 75 || sl.UserID != buyer.Subject || sl.ProductID != prd.ID {
+				t.Fatalf("\t%s\tTest %d:\tShould record the buyer and the price paid : %+v.", tests.Failed, testID, sl)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to sell items.", tests.Success, testID)
+
+			if _, err := s.Create(ctx, traceID, buyer, prd.ID, sale.NewSale{Quantity: 8}, now); errors.Cause(err) != sale.ErrInsufficientStock {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to sell more items than are left : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to sell more items than are left.", tests.Success, testID)
+
+			if _, err := s.Create(ctx, traceID, buyer, prd.ID, sale.NewSale{Quantity: -2}, now); errors.Cause(err) != sale.ErrInvalidQuantity {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to sell a negative number of items : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to sell a negative number of items.", tests.Success, testID)
+
+			// Race more buyers than there are items left, one item each.
+			var wg sync.WaitGroup
+			results := make(chan error, 12)
+			for i := 0; i < 12; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, err := s.Create(ctx, traceID, buyer, prd.ID, sale.NewSale{Quantity: 1}, now)
+					results <- err
+				}()
+			}
+			wg.Wait()
+			close(results)
+
+			var sold, refused int
+			for err := range results {
+				switch errors.Cause(err) {
+				case nil:
+					sold++
+				case sale.ErrInsufficientStock:
+					refused++
+				default:
+					t.Fatalf("\t%s\tTest %d:\tShould either sell or refuse concurrent sales : %s.", tests.Failed, testID, err)
+				}
+			}
+			if sold != 7 || refused != 5 {
+				t.Fatalf("\t%s\tTest %d:\tShould sell exactly the items left to concurrent buyers : sold %d, refused %d.", tests.Failed, testID, sold, refused)
+			}
+			t.Logf("\t%s\tTest %d:\tShould never sell more items than are left to concurrent buyers.", tests.Success, testID)
+
+			saved, err := p.QueryByID(ctx, traceID, prd.ID)
+			if err != nil || saved.Sold != saved.Quantity || saved.Revenue != 250 {
+				t.Fatalf("\t%s\tTest %d:\tShould see all items sold on the product : %+v, %v.", tests.Failed, testID, saved, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould see all items sold on the product.", tests.Success, testID)
+
+			if err := p.Update(ctx, traceID, owner, prd.ID, product.UpdateProduct{Quantity: tests.IntPointer(5)}, now); errors.Cause(err) != product.ErrQuantityBelowSold {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to lower the quantity below the items sold : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to lower the quantity below the items sold.", tests.Success, testID)
+
+			up := product.UpdateProduct{Quantity: tests.IntPointer(20), Availability: tests.StringPointer("unavailable")}
+			if err := p.Update(ctx, traceID, owner, prd.ID, up, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to raise the quantity : %s.", tests.Failed, testID, err)
+			}
+			if _, err := s.Create(ctx, traceID, buyer, prd.ID, sale.NewSale{Quantity: 1}, now); errors.Cause(err) != sale.ErrUnavailable {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to sell an unavailable product : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to sell an unavailable product.", tests.Success, testID)
+
+			if _, err := s.QueryByProduct(ctx, traceID, buyer, prd.ID, 1, 100); errors.Cause(err) != sale.ErrForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to list the sales of another user's product : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to list the sales of another user's product.", tests.Success, testID)
+
+			sales, err := s.QueryByProduct(ctx, traceID, owner, prd.ID, 1, 100)
+			if err != nil || len(sales) != 8 {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to list the sales of the product : %d, %v.", tests.Failed, testID, len(sales), err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to list the sales of the product.", tests.Success, testID)
+
+			purchases, err := s.QueryByUser(ctx, traceID, buyer.Subject)
+			if err != nil || len(purchases) != 8 {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to list the purchases of the buyer : %d, %v.", tests.Failed, testID, len(purchases), err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to list the purchases of the buyer.", tests.Success, testID)
+
+			if err := p.Delete(ctx, traceID, owner, prd.ID, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to delete the product : %s.", tests.Failed, testID, err)
+			}
+			if _, err := s.Create(ctx, traceID, buyer, prd.ID, sale.NewSale{Quantity: 1}, now); errors.Cause(err) != sale.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to sell a deleted product : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to sell a deleted product.", tests.Success, testID)
+		}
+	}
+}
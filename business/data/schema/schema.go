@@ -132,4 +132,498 @@ CREATE TABLE sales (
 	FOREIGN KEY (product_id) REFERENCES products(product_id) ON DELETE CASCADE
 );`,
 	},
+	{
+		Version:     2.3,
+		Description: "Create table sessions",
+		Script: `
+CREATE TABLE sessions (
+	session_id    UUID,
+	user_id       UUID,
+	device        TEXT,
+	token_hash    TEXT UNIQUE,
+	access_jti    TEXT,
+	date_created  TIMESTAMP,
+	date_updated  TIMESTAMP,
+	date_expires  TIMESTAMP,
+	date_revoked  TIMESTAMP,
+
+	PRIMARY KEY (session_id),
+	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);`,
+	},
+	{
+		Version:     2.4,
+		Description: "Create table revoked_tokens",
+		Script: `
+CREATE TABLE revoked_tokens (
+	jti           TEXT,
+	user_id       UUID,
+	date_expires  TIMESTAMP,
+	date_revoked  TIMESTAMP,
+
+	PRIMARY KEY (jti)
+);`,
+	},
+	{
+		Version:     2.5,
+		Description: "Add email verification to users",
+		Script: `
+ALTER TABLE users ADD COLUMN verified BOOLEAN DEFAULT TRUE;`,
+	},
+	{
+		Version:     2.6,
+		Description: "Create table password_resets",
+		Script: `
+CREATE TABLE password_resets (
+	reset_id      UUID,
+	user_id       UUID,
+	token_hash    TEXT UNIQUE,
+	date_created  TIMESTAMP,
+	date_expires  TIMESTAMP,
+	date_used     TIMESTAMP,
+
+	PRIMARY KEY (reset_id),
+	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);`,
+	},
+	{
+		Version:     2.7,
+		Description: "Create table lockouts",
+		Script: `
+CREATE TABLE lockouts (
+	lockout_key   TEXT,
+	failures      INT,
+	locked_until  TIMESTAMP,
+	date_updated  TIMESTAMP,
+
+	PRIMARY KEY (lockout_key)
+);`,
+	},
+	{
+		Version:     2.8,
+		Description: "Create tables for two-factor authentication",
+		Script: `
+CREATE TABLE user_totp (
+	user_id         UUID,
+	secret          TEXT,
+	last_step       BIGINT DEFAULT 0,
+	date_created    TIMESTAMP,
+	date_confirmed  TIMESTAMP,
+
+	PRIMARY KEY (user_id),
+	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+CREATE TABLE recovery_codes (
+	code_hash     TEXT,
+	user_id       UUID,
+	date_created  TIMESTAMP,
+	date_used     TIMESTAMP,
+
+	PRIMARY KEY (code_hash),
+	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);`,
+	},
+	{
+		Version:     2.9,
+		Description: "Create table role_settings and record authentication methods of sessions",
+		Script: `
+CREATE TABLE role_settings (
+	role          TEXT,
+	require_2fa   BOOLEAN DEFAULT FALSE,
+	date_updated  TIMESTAMP,
+
+	PRIMARY KEY (role)
+);
+
+ALTER TABLE sessions ADD COLUMN amr TEXT[];`,
+	},
+	{
+		Version:     3.1,
+		Description: "Create table api_keys",
+		Script: `
+CREATE TABLE api_keys (
+	key_id          UUID,
+	name            TEXT,
+	prefix          TEXT,
+	key_hash        TEXT UNIQUE,
+	user_id         UUID,
+	roles           TEXT[],
+	date_created    TIMESTAMP,
+	date_expires    TIMESTAMP,
+	date_last_used  TIMESTAMP,
+	date_revoked    TIMESTAMP,
+
+	PRIMARY KEY (key_id),
+	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);`,
+	},
+	{
+		Version:     3.2,
+		Description: "Create table role_permissions",
+		Script: `
+CREATE TABLE role_permissions (
+	role          TEXT,
+	permission    TEXT,
+	date_created  TIMESTAMP,
+
+	PRIMARY KEY (role, permission)
+);
+
+INSERT INTO role_permissions (role, permission, date_created) VALUES
+	('ADMIN', 'country:activate', NOW()),
+	('ADMIN', 'jurisdiction:activate', NOW()),
+	('ADMIN', 'profile:edit:any', NOW()),
+	('ADMIN', 'category:edit:any', NOW()),
+	('ADMIN', 'product:edit:any', NOW()),
+	('ADMIN', 'user:read:any', NOW()),
+	('ADMIN', 'user:manage', NOW()),
+	('ADMIN', 'apikey:revoke:any', NOW()),
+	('ADMIN', 'role:manage', NOW()),
+	('USER', 'profile:edit:own', NOW()),
+	('USER', 'category:edit:own', NOW()),
+	('USER', 'product:edit:own', NOW()),
+	('USER', 'user:read:own', NOW()),
+	('USER', 'apikey:revoke:own', NOW());`,
+	},
+	{
+		Version:     3.3,
+		Description: "Create tables for signing in with OpenID providers",
+		Script: `
+CREATE TABLE user_identities (
+	provider      TEXT,
+	subject       TEXT,
+	user_id       UUID,
+	date_created  TIMESTAMP,
+
+	PRIMARY KEY (provider, subject),
+	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+CREATE TABLE federated_logins (
+	state         TEXT,
+	provider      TEXT,
+	nonce         TEXT,
+	verifier      TEXT,
+	date_expires  TIMESTAMP,
+
+	PRIMARY KEY (state)
+);`,
+	},
+	{
+		Version:     3.4,
+		Description: "Add encrypted email addresses to users",
+		Script: `
+ALTER TABLE users
+	ADD COLUMN email_key_id TEXT NOT NULL DEFAULT '',
+	ADD COLUMN email_key BYTEA,
+	ADD COLUMN email_ciphertext BYTEA;`,
+	},
+	{
+		Version:     3.5,
+		Description: "Create table audit_events",
+		Script: `
+CREATE TABLE audit_events (
+	event_id      UUID,
+	actor_id      TEXT,
+	action        TEXT,
+	entity_type   TEXT,
+	entity_id     TEXT,
+	trace_id      TEXT,
+	date_created  TIMESTAMP,
+
+	PRIMARY KEY (event_id)
+);`,
+	},
+	{
+		Version:     3.6,
+		Description: "Record changes in the audit log and grant reading it",
+		Script: `
+ALTER TABLE audit_events ADD COLUMN changes JSONB NOT NULL DEFAULT '{}';
+
+CREATE INDEX audit_events_date_created_idx ON audit_events (date_created);
+CREATE INDEX audit_events_actor_id_idx ON audit_events (actor_id);
+CREATE INDEX audit_events_entity_idx ON audit_events (entity_type, entity_id);
+
+INSERT INTO role_permissions (role, permission, date_created) VALUES
+	('ADMIN', 'audit:read', NOW());`,
+	},
+	{
+		Version:     3.7,
+		Description: "Soft delete users, profiles, categories and products",
+		Script: `
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE profiles ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE categories ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE products ADD COLUMN deleted_at TIMESTAMP;
+
+INSERT INTO role_permissions (role, permission, date_created) VALUES
+	('ADMIN', 'record:restore', NOW());`,
+	},
+	{
+		Version:     3.8,
+		Description: "Add directory listing fields to profiles",
+		Script: `
+ALTER TABLE profiles
+	ADD COLUMN bio           TEXT   NOT NULL DEFAULT '',
+	ADD COLUMN website       TEXT   NOT NULL DEFAULT '',
+	ADD COLUMN contact_email TEXT   NOT NULL DEFAULT '',
+	ADD COLUMN contact_phone TEXT   NOT NULL DEFAULT '',
+	ADD COLUMN languages     TEXT[] NOT NULL DEFAULT '{}',
+	ADD COLUMN logo_url      TEXT   NOT NULL DEFAULT '',
+	ADD COLUMN jurisdictions TEXT[] NOT NULL DEFAULT '{}',
+	ADD COLUMN categories    UUID[] NOT NULL DEFAULT '{}';`,
+	},
+	{
+		Version:     3.9,
+		Description: "Link profiles to categories and jurisdictions",
+		Script: `
+CREATE TABLE profile_categories (
+	profile_name  TEXT,
+	category_id   UUID,
+	date_created  TIMESTAMP,
+
+	PRIMARY KEY (profile_name, category_id),
+	FOREIGN KEY (profile_name) REFERENCES profiles(name) ON DELETE CASCADE ON UPDATE CASCADE,
+	FOREIGN KEY (category_id) REFERENCES categories(category_id) ON DELETE CASCADE
+);
+CREATE INDEX profile_categories_category_id_idx ON profile_categories (category_id);
+
+CREATE TABLE profile_jurisdictions (
+	profile_name       TEXT,
+	jurisdiction_code  TEXT,
+	date_created       TIMESTAMP,
+
+	PRIMARY KEY (profile_name, jurisdiction_code),
+	FOREIGN KEY (profile_name) REFERENCES profiles(name) ON DELETE CASCADE ON UPDATE CASCADE,
+	FOREIGN KEY (jurisdiction_code) REFERENCES jurisdictions(code) ON DELETE CASCADE
+);
+CREATE INDEX profile_jurisdictions_jurisdiction_code_idx ON profile_jurisdictions (jurisdiction_code);
+
+INSERT INTO profile_categories (profile_name, category_id, date_created)
+	SELECT p.name, c.category_id, p.date_updated
+	FROM profiles AS p
+	JOIN categories AS c ON c.category_id = ANY(p.categories);
+
+INSERT INTO profile_jurisdictions (profile_name, jurisdiction_code, date_created)
+	SELECT p.name, j.code, p.date_updated
+	FROM profiles AS p
+	JOIN jurisdictions AS j ON j.code = ANY(p.jurisdictions);
+
+ALTER TABLE profiles
+	DROP COLUMN categories,
+	DROP COLUMN jurisdictions;`,
+	},
+	{
+		Version:     4.1,
+		Description: "Search profiles and categories",
+		Script: `
+ALTER TABLE profiles ADD COLUMN search TSVECTOR GENERATED ALWAYS AS (
+	setweight(to_tsvector('simple', name || ' ' || coalesce(display_name, '')), 'A') ||
+	setweight(to_tsvector(
+		CASE languages[1]
+			WHEN 'da' THEN 'danish'::REGCONFIG
+			WHEN 'de' THEN 'german'::REGCONFIG
+			WHEN 'en' THEN 'english'::REGCONFIG
+			WHEN 'es' THEN 'spanish'::REGCONFIG
+			WHEN 'fi' THEN 'finnish'::REGCONFIG
+			WHEN 'fr' THEN 'french'::REGCONFIG
+			WHEN 'hu' THEN 'hungarian'::REGCONFIG
+			WHEN 'it' THEN 'italian'::REGCONFIG
+			WHEN 'nl' THEN 'dutch'::REGCONFIG
+			WHEN 'no' THEN 'norwegian'::REGCONFIG
+			WHEN 'pt' THEN 'portuguese'::REGCONFIG
+			WHEN 'ro' THEN 'romanian'::REGCONFIG
+			WHEN 'ru' THEN 'russian'::REGCONFIG
+			WHEN 'sv' THEN 'swedish'::REGCONFIG
+			WHEN 'tr' THEN 'turkish'::REGCONFIG
+			ELSE 'simple'::REGCONFIG
+		END, coalesce(display_name, '') || ' ' || bio), 'B') ||
+	setweight(to_tsvector('simple', bio), 'D')
+) STORED;
+CREATE INDEX profiles_search_idx ON profiles USING GIN (search);
+
+CREATE INDEX categories_search_idx ON categories USING GIN (
+	to_tsvector('simple', coalesce(name, '') || ' ' || replace(slug, '-', ' '))
+);`,
+	},
+	{
+		Version:     4.2,
+		Description: "Create table translations",
+		Script: `
+CREATE TABLE translations (
+	entity_type   TEXT,
+	entity_id     TEXT,
+	language      TEXT,
+	field         TEXT,
+	value         TEXT NOT NULL,
+	date_created  TIMESTAMP DEFAULT (NOW() AT TIME ZONE 'UTC'),
+	date_updated  TIMESTAMP DEFAULT (NOW() AT TIME ZONE 'UTC'),
+
+	PRIMARY KEY (entity_type, entity_id, language, field)
+);`,
+	},
+	{
+		Version:     4.3,
+		Description: "Record the buyer of a sale",
+		Script: `
+ALTER TABLE sales ADD COLUMN user_id UUID DEFAULT '00000000-0000-0000-0000-000000000000';
+CREATE INDEX sales_product_id_idx ON sales (product_id);
+CREATE INDEX sales_user_id_idx ON sales (user_id);`,
+	},
+	{
+		Version:     4.4,
+		Description: "Price products in a currency and create table exchange_rates",
+		Script: `
+ALTER TABLE products ADD COLUMN currency TEXT NOT NULL DEFAULT 'EUR';
+ALTER TABLE sales ADD COLUMN currency TEXT NOT NULL DEFAULT 'EUR';
+
+CREATE TABLE exchange_rates (
+	currency      TEXT,
+	date          DATE,
+	rate          NUMERIC NOT NULL,
+	date_created  TIMESTAMP,
+
+	PRIMARY KEY (currency, date)
+);`,
+	},
+	{
+		Version:     4.5,
+		Description: "Offer products as services of provider profiles",
+		Script: `
+ALTER TABLE products
+	ADD COLUMN profile_name      TEXT,
+	ADD COLUMN category_id       UUID,
+	ADD COLUMN jurisdiction_code TEXT,
+	ADD COLUMN description       TEXT NOT NULL DEFAULT '',
+	ADD COLUMN pricing           TEXT NOT NULL DEFAULT 'fixed',
+	ADD COLUMN availability      TEXT NOT NULL DEFAULT 'available',
+	ADD FOREIGN KEY (profile_name) REFERENCES profiles(name) ON DELETE CASCADE ON UPDATE CASCADE,
+	ADD FOREIGN KEY (category_id) REFERENCES categories(category_id) ON DELETE SET NULL,
+	ADD FOREIGN KEY (jurisdiction_code) REFERENCES jurisdictions(code) ON DELETE SET NULL;
+
+CREATE INDEX products_profile_name_idx ON products (profile_name);
+CREATE INDEX products_category_id_idx ON products (category_id);
+CREATE INDEX products_jurisdiction_code_idx ON products (jurisdiction_code);`,
+	},
+	{
+		Version:     4.6,
+		Description: "Create tables for quote requests and their messages",
+		Script: `
+CREATE TABLE quotes (
+	quote_id       UUID,
+	business_name  TEXT NOT NULL,
+	provider_name  TEXT NOT NULL,
+	product_id     UUID,
+	subject        TEXT NOT NULL,
+	user_id        UUID,
+	date_created   TIMESTAMP,
+	date_updated   TIMESTAMP,
+
+	PRIMARY KEY (quote_id),
+	FOREIGN KEY (business_name) REFERENCES profiles(name) ON DELETE CASCADE ON UPDATE CASCADE,
+	FOREIGN KEY (provider_name) REFERENCES profiles(name) ON DELETE CASCADE ON UPDATE CASCADE,
+	FOREIGN KEY (product_id) REFERENCES products(product_id) ON DELETE SET NULL
+);
+CREATE INDEX quotes_business_name_idx ON quotes (business_name, date_updated);
+CREATE INDEX quotes_provider_name_idx ON quotes (provider_name, date_updated);
+
+CREATE TABLE quote_messages (
+	message_id     UUID,
+	quote_id       UUID NOT NULL,
+	sender_name    TEXT NOT NULL,
+	user_id        UUID,
+	body           TEXT NOT NULL,
+	date_created   TIMESTAMP,
+	date_read      TIMESTAMP,
+
+	PRIMARY KEY (message_id),
+	FOREIGN KEY (quote_id) REFERENCES quotes(quote_id) ON DELETE CASCADE,
+	FOREIGN KEY (sender_name) REFERENCES profiles(name) ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE INDEX quote_messages_quote_id_idx ON quote_messages (quote_id, date_created);
+
+CREATE TABLE quote_attachments (
+	attachment_id  UUID,
+	message_id     UUID NOT NULL,
+	file_name      TEXT NOT NULL,
+	content_type   TEXT NOT NULL,
+	size           BIGINT NOT NULL,
+	url            TEXT NOT NULL,
+
+	PRIMARY KEY (attachment_id),
+	FOREIGN KEY (message_id) REFERENCES quote_messages(message_id) ON DELETE CASCADE
+);
+CREATE INDEX quote_attachments_message_id_idx ON quote_attachments (message_id);`,
+	},
+	{
+		Version:     4.7,
+		Description: "Create table for reviews of service providers and grant moderating them",
+		Script: `
+CREATE TABLE reviews (
+	review_id       UUID,
+	provider_name   TEXT NOT NULL,
+	reviewer_name   TEXT NOT NULL,
+	rating          INT NOT NULL CHECK (rating BETWEEN 1 AND 5),
+	body            TEXT NOT NULL,
+	response        TEXT NOT NULL DEFAULT '',
+	date_responded  TIMESTAMP,
+	hidden          BOOLEAN NOT NULL DEFAULT FALSE,
+	date_moderated  TIMESTAMP,
+	user_id         UUID,
+	date_created    TIMESTAMP,
+	date_updated    TIMESTAMP,
+
+	PRIMARY KEY (review_id),
+	UNIQUE (provider_name, reviewer_name),
+	FOREIGN KEY (provider_name) REFERENCES profiles(name) ON DELETE CASCADE ON UPDATE CASCADE,
+	FOREIGN KEY (reviewer_name) REFERENCES profiles(name) ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE INDEX reviews_provider_name_idx ON reviews (provider_name, date_created);
+CREATE INDEX reviews_unmoderated_idx ON reviews (date_updated) WHERE date_moderated IS NULL;
+
+INSERT INTO role_permissions (role, permission, date_created) VALUES
+	('ADMIN', 'review:moderate', NOW());`,
+	},
+	{
+		Version:     4.8,
+		Description: "Encrypt authenticator app secrets and add settings for the default roles",
+		Script: `
+ALTER TABLE user_totp
+	ADD COLUMN secret_key_id TEXT NOT NULL DEFAULT '',
+	ADD COLUMN secret_key BYTEA,
+	ADD COLUMN secret_ciphertext BYTEA;
+
+INSERT INTO role_settings (role, require_2fa, date_updated) VALUES
+	('ADMIN', FALSE, NOW()),
+	('USER', FALSE, NOW())
+ON CONFLICT (role) DO NOTHING;`,
+	},
+	{
+		Version:     4.9,
+		Description: "Add the user linking an identity to federated logins",
+		Script: `
+ALTER TABLE federated_logins
+	ADD COLUMN user_id UUID REFERENCES users(user_id) ON DELETE CASCADE;`,
+	},
+	{
+		Version:     5.1,
+		Description: "Allow one review of a provider per user",
+		Script: `
+DELETE FROM reviews AS r
+WHERE EXISTS (
+	SELECT 1 FROM reviews AS o
+	WHERE o.provider_name = r.provider_name AND o.user_id = r.user_id AND
+	(o.date_created, o.review_id) < (r.date_created, r.review_id)
+);
+
+ALTER TABLE reviews ADD UNIQUE (provider_name, user_id);`,
+	},
+	{
+		Version:     5.2,
+		Description: "Release the email addresses of deleted users",
+		Script: `
+ALTER TABLE users DROP CONSTRAINT users_email_key;
+CREATE UNIQUE INDEX users_email_key ON users (email) WHERE deleted_at IS NULL;`,
+	},
 }
@@ -4258,6 +4258,21 @@ func DeleteAll(db *sqlx.DB) error {
 
 // deleteAll is used to clean the database between tests.
 const deleteAll = `
+DELETE FROM audit_events;
+DELETE FROM translations;
+DELETE FROM quotes;
+DELETE FROM reviews;
+DELETE FROM federated_logins;
+DELETE FROM user_identities;
+DELETE FROM api_keys;
+UPDATE role_settings SET require_2fa = FALSE;
+DELETE FROM recovery_codes;
+DELETE FROM user_totp;
+DELETE FROM lockouts;
+DELETE FROM password_resets;
+DELETE FROM revoked_tokens;
+DELETE FROM exchange_rates;
+DELETE FROM sessions;
 DELETE FROM sales;
 DELETE FROM products;
 DELETE FROM users;
@@ -0,0 +1,27 @@
+package search
+
+// Kinds of records found by a search.
+const (
+	KindProfile  = "profile"
+	KindCategory = "category"
+)
+
+// Result represents a record matching a search.
+type Result struct {
+	Kind    string  `db:"kind" json:"kind"`           // Kind of record found.
+	ID      string  `db:"id" json:"id"`               // Name of the profile or ID of the category.
+	Title   string  `db:"title" json:"title"`         // Display name of the profile or name of the category.
+	Type    string  `db:"type" json:"type,omitempty"` // Type of the profile.
+	Snippet string  `db:"snippet" json:"snippet"`     // HTML escaped part of the text with the matching words in mark elements.
+	Rank    float64 `db:"rank" json:"rank"`           // How well the record matches, higher is better.
+}
+
+// Filter defines what to search for. Filtering by profile type, country or
+// jurisdiction only finds profiles.
+type Filter struct {
+	Text         string // Words to find, the last one may be incomplete.
+	Language     string // ISO 639-1 code of the language of the words.
+	Type         string // Type of the profiles.
+	Country      string // Code of the country of a jurisdiction the profiles serve.
+	Jurisdiction string // Code of a jurisdiction the profiles serve.
+}
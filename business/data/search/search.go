@@ -0,0 +1,163 @@
+// Package search contains full-text search over profiles and categories.
+package search
+
+import (
+	"context"
+	"log"
+	"strings"
+	"unicode"
+
+	"github.com/appinesshq/bpi/foundation/database"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+// ErrNoText occurs when a search doesn't contain any words to find.
+var ErrNoText = errors.New("search text is required")
+
+// configs maps ISO 639-1 language codes to the text search configurations
+// stemming words in the language. Profiles are indexed with the configuration
+// of their first language, see the search migration.
+var configs = map[string]string{
+	"da": "danish",
+	"de": "german",
+	"en": "english",
+	"es": "spanish",
+	"fi": "finnish",
+	"fr": "french",
+	"hu": "hungarian",
+	"it": "italian",
+	"nl": "dutch",
+	"no": "norwegian",
+	"pt": "portuguese",
+	"ro": "romanian",
+	"ru": "russian",
+	"sv": "swedish",
+	"tr": "turkish",
+}
+
+// Search manages the set of API's for searching.
+type Search struct {
+	log *log.Logger
+	db  *sqlx.DB
+}
+
+// New constructs a Search for api access.
+func New(log *log.Logger, db *sqlx.DB) Search {
+	return Search{
+		log: log,
+		db:  db,
+	}
+}
+
+// Query finds the profiles and categories matching the filter, best matches
+// first. Words match as prefixes, both as written and stemmed in the language
+// of the filter. Searches without a language are taken to be in English.
+func (s Search) Query(ctx context.Context, traceID string, filter Filter, pageNumber int, rowsPerPage int) ([]Result, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.search.query")
+	defer span.End()
+
+	terms := Terms(filter.Text)
+	if terms == "" {
+		return nil, ErrNoText
+	}
+
+	config := "english"
+	if filter.Language != "" {
+		var ok bool
+		if config, ok = configs[strings.ToLower(filter.Language)]; !ok {
+			config = "simple"
+		}
+	}
+
+	// The text is HTML escaped before highlighting, so the only markup in a
+	// snippet is the mark elements around the matching words.
+	const q = `
+	WITH
+		q AS (
+			SELECT to_tsquery('simple', $1) || to_tsquery($2::REGCONFIG, $1) AS query
+		),
+		results AS (
+			SELECT
+				'profile' AS kind,
+				p.name AS id,
+				coalesce(p.display_name, '') AS title,
+				p.type AS type,
+				coalesce(p.display_name, '') || ' ' || p.bio AS body,
+				ts_rank_cd(p.search, q.query) AS rank
+			FROM
+				profiles AS p, q
+			WHERE
+				p.search @@ q.query AND
+				p.deleted_at IS NULL AND
+				($3 = '' OR p.type = $3) AND
+				(($4 = '' AND $5 = '') OR EXISTS (
+					SELECT 1 FROM profile_jurisdictions AS pj
+					JOIN jurisdictions AS j ON j.code = pj.jurisdiction_code
+					JOIN countries AS c ON c.code = j.country_code
+					WHERE pj.profile_name = p.name AND j.active AND c.active AND
+					($4 = '' OR c.code = $4) AND
+					($5 = '' OR j.code = $5)
+				))
+			UNION ALL
+			SELECT
+				'category',
+				c.category_id::TEXT,
+				coalesce(c.name, ''),
+				'',
+				coalesce(c.name, ''),
+				ts_rank_cd(to_tsvector('simple', coalesce(c.name, '') || ' ' || replace(c.slug, '-', ' ')), q.query)
+			FROM
+				categories AS c, q
+			WHERE
+				to_tsvector('simple', coalesce(c.name, '') || ' ' || replace(c.slug, '-', ' ')) @@ q.query AND
+				c.deleted_at IS NULL AND
+				$3 = '' AND $4 = '' AND $5 = ''
+		),
+		page AS (
+			SELECT * FROM results
+			ORDER BY rank DESC, title, id
+			OFFSET $6 ROWS FETCH NEXT $7 ROWS ONLY
+		)
+	SELECT
+		page.kind, page.id, page.title, page.type, page.rank,
+		ts_headline($2::REGCONFIG, replace(replace(replace(replace(replace(page.body,
+			'&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'), '''', '&#39;'),
+			q.query, 'StartSel=<mark>, StopSel=</mark>, MinWords=15, MaxWords=35') AS snippet
+	FROM
+		page, q
+	ORDER BY
+		page.rank DESC, page.title, page.id`
+
+	offset := (pageNumber - 1) * rowsPerPage
+	typ := strings.ToUpper(filter.Type)
+	country := strings.ToUpper(filter.Country)
+
+	s.log.Printf("%s: %s: %s", traceID, "search.Query",
+		database.Log(q, terms, config, typ, country, filter.Jurisdiction, offset, rowsPerPage),
+	)
+
+	results := []Result{}
+	if err := s.db.SelectContext(ctx, &results, q, terms, config, typ, country, filter.Jurisdiction, offset, rowsPerPage); err != nil {
+		return nil, errors.Wrap(err, "searching")
+	}
+
+	return results, nil
+}
+
+// Terms turns text into a query matching all its words as prefixes. Anything
+// but letters and digits separates words, so the text can't change the
+// meaning of the query. It returns an empty string when there are no words.
+func Terms(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := make([]string, len(words))
+	for i, w := range words {
+		terms[i] = strings.ToLower(w) + ":*"
+	}
+
+	return strings.Join(terms, " & ")
+}
@@ -0,0 +1,142 @@
+package search_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/profile"
+	"github.com/appinesshq/bpi/business/data/search"
+	"github.com/appinesshq/bpi/business/tests"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+func TestTerms(t *testing.T) {
+	tt := []struct {
+		text string
+		exp  string
+	}{
+		{"", ""},
+		{"  ", ""},
+		{"Lawyer", "lawyer:*"},
+		{"tax advis", "tax:* & advis:*"},
+		{"a' | !b & (c:*)", "a:* & b:* & c:*"},
+		{"Köln-Süd", "köln:* & süd:*"},
+	}
+
+	t.Log("Given the need to turn search text into a query.")
+	{
+		for testID, tc := range tt {
+			t.Logf("\tTest %d:\tWhen searching for %q.", testID, tc.text)
+			{
+				if got := search.Terms(tc.text); got != tc.exp {
+					t.Fatalf("\t%s\tTest %d:\tShould get %q : got %q.", tests.Failed, testID, tc.exp, got)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get %q.", tests.Success, testID, tc.exp)
+			}
+		}
+	}
+}
+
+func seed(db *sqlx.DB) error {
+	const q = `
+	INSERT INTO countries (gnid, code, name, currency_code, currency_name, active) VALUES
+	(2750405, 'NL', 'Netherlands', 'EUR', 'Euro', TRUE);
+
+	INSERT INTO jurisdictions (gnid, code, country_code, name, active) VALUES
+	(2743698, 'NL.11', 'NL', 'South Holland', TRUE),
+	(2744011, 'NL.10', 'NL', 'Zeeland', TRUE);
+
+	INSERT INTO categories (category_id, slug, name, date_created, date_updated) VALUES
+	('5cf37266-3473-4006-984f-9325122678b7', 'tax-advice', 'Tax advice', NOW(), NOW());
+	`
+	_, err := db.ExecContext(context.Background(), q)
+	return err
+}
+
+func TestSearch(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	if err := seed(db); err != nil {
+		t.Fatalf("Couldn't seed database: %v", err)
+	}
+
+	s := search.New(log, db)
+	p := profile.New(log, db, tests.Policy())
+
+	t.Log("Given the need to search profiles and categories.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen searching a few profiles.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			claims := auth.Claims{
+				StandardClaims: jwt.StandardClaims{
+					Issuer:    "MB Appiness Solutions",
+					Subject:   "718ffbea-f4a1-4667-8ae3-b349da52675e",
+					Audience:  "users",
+					ExpiresAt: now.Add(time.Hour).Unix(),
+					IssuedAt:  now.Unix(),
+				},
+				Roles: []string{auth.RoleUser},
+			}
+
+			nps := []profile.NewProfile{
+				{Name: "taxpros", Type: "SER", DisplayName: "Tax Pros", Bio: "We advise companies on their taxes.", Languages: []string{"en"}, Jurisdictions: []string{"NL.11"}},
+				{Name: "belastingadvies", Type: "SER", DisplayName: "Belastingadvies Zeeland", Bio: "Wij adviseren bedrijven over <script>belastingen</script>.", Languages: []string{"nl"}, Jurisdictions: []string{"NL.10"}},
+				{Name: "shop", Type: "BUS", DisplayName: "Shop", Bio: "A shop looking for tax advice.", Languages: []string{"en"}},
+			}
+			for _, np := range nps {
+				if _, err := p.Create(ctx, traceID, claims, np, now); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to create profile %s : %s.", tests.Failed, testID, np.Name, err)
+				}
+			}
+
+			if _, err := s.Query(ctx, traceID, search.Filter{Text: " ! "}, 1, 10); errors.Cause(err) != search.ErrNoText {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to search without words : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to search without words.", tests.Success, testID)
+
+			results, err := s.Query(ctx, traceID, search.Filter{Text: "tax"}, 1, 10)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to search : %s.", tests.Failed, testID, err)
+			}
+			if len(results) != 3 {
+				t.Fatalf("\t%s\tTest %d:\tShould find two profiles and a category, got %+v.", tests.Failed, testID, results)
+			}
+			if results[0].Kind != search.KindProfile || results[0].ID != "taxpros" {
+				t.Fatalf("\t%s\tTest %d:\tShould rank the profile with the word in its name first, got %+v.", tests.Failed, testID, results[0])
+			}
+			t.Logf("\t%s\tTest %d:\tShould find profiles and categories, best match first.", tests.Success, testID)
+
+			results, err = s.Query(ctx, traceID, search.Filter{Text: "advis", Type: "SER", Jurisdiction: "NL.11"}, 1, 10)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to search with filters : %s.", tests.Failed, testID, err)
+			}
+			if len(results) != 1 || results[0].ID != "taxpros" {
+				t.Fatalf("\t%s\tTest %d:\tShould only find matching service providers, got %+v.", tests.Failed, testID, results)
+			}
+			t.Logf("\t%s\tTest %d:\tShould only find matching service providers.", tests.Success, testID)
+
+			results, err = s.Query(ctx, traceID, search.Filter{Text: "belasting", Language: "nl", Country: "nl"}, 1, 10)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to search in Dutch : %s.", tests.Failed, testID, err)
+			}
+			if len(results) != 1 || results[0].ID != "belastingadvies" {
+				t.Fatalf("\t%s\tTest %d:\tShould find the Dutch profile, got %+v.", tests.Failed, testID, results)
+			}
+			if !strings.Contains(results[0].Snippet, "<mark>") || strings.Contains(results[0].Snippet, "<script>") {
+				t.Fatalf("\t%s\tTest %d:\tShould highlight the matching words in escaped text, got %q.", tests.Failed, testID, results[0].Snippet)
+			}
+			t.Logf("\t%s\tTest %d:\tShould find the Dutch profile.", tests.Success, testID)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package session
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Info represents a refresh token session of a user on a device.
+type Info struct {
+	ID          string         `db:"session_id" json:"id"`             // Unique identifier.
+	UserID      string         `db:"user_id" json:"user_id"`           // ID of the user owning the session.
+	Device      string         `db:"device" json:"device"`             // Device the session was started from.
+	TokenHash   string         `db:"token_hash" json:"-"`              // Hash of the current refresh token.
+	AccessID    string         `db:"access_jti" json:"-"`              // ID (jti) of the last access token issued.
+	DateCreated time.Time      `db:"date_created" json:"date_created"` // When the session was started.
+	DateUpdated time.Time      `db:"date_updated" json:"date_updated"` // When the refresh token was last rotated.
+	DateExpires time.Time      `db:"date_expires" json:"date_expires"` // When the current refresh token expires.
+	DateRevoked sql.NullTime   `db:"date_revoked" json:"-"`            // When the session was revoked.
+	AMR         pq.StringArray `db:"amr" json:"amr"`                   // Methods used to authenticate when the session started.
+}
+
+// NewSession contains information needed to start a new Session.
+type NewSession struct {
+	UserID   string
+	Device   string
+	AccessID string
+	AMR      []string
+}
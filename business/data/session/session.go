@@ -0,0 +1,432 @@
+// Package session contains refresh token and token revocation functionality.
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/foundation/database"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+// TTL is how long a refresh token remains valid after it was issued.
+var TTL = 30 * 24 * time.Hour
+
+var (
+	// ErrNotFound is used when a specific Session is requested but does not exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrInvalidID occurs when an ID is not in a valid form.
+	ErrInvalidID = errors.New("ID is not in its proper form")
+
+	// ErrInvalidToken occurs when a refresh token is unknown, expired or revoked.
+	ErrInvalidToken = errors.New("refresh token is invalid")
+)
+
+// hashToken hashes a refresh token for storage. Refresh tokens are random
+// values of sufficient length, so an unsalted hash is enough.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return fmt.Sprintf("%x", sum)
+}
+
+// generateToken returns a new opaque refresh token.
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Session manages the set of API's for session access.
+type Session struct {
+	log *log.Logger
+	db  *sqlx.DB
+}
+
+// New constructs a Session for api access.
+func New(log *log.Logger, db *sqlx.DB) Session {
+	return Session{
+		log: log,
+		db:  db,
+	}
+}
+
+// Create starts a new session for a user and device. It returns the session
+// together with the refresh token, which is only ever available here since
+// just its hash is stored.
+func (s Session) Create(ctx context.Context, traceID string, ns NewSession, now time.Time) (Info, string, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.session.create")
+	defer span.End()
+
+	token, err := generateToken()
+	if err != nil {
+		return Info{}, "", errors.Wrap(err, "generating refresh token")
+	}
+
+	ses := Info{
+		ID:          uuid.New().String(),
+		UserID:      ns.UserID,
+		Device:      ns.Device,
+		TokenHash:   hashToken(token),
+		AccessID:    ns.AccessID,
+		DateCreated: now.UTC(),
+		DateUpdated: now.UTC(),
+		DateExpires: now.Add(TTL).UTC(),
+		AMR:         ns.AMR,
+	}
+
+	const q = `
+	INSERT INTO sessions
+		(session_id, user_id, device, token_hash, access_jti, date_created, date_updated, date_expires, amr)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+	s.log.Printf("%s: %s: %s", traceID, "session.Create",
+		database.Log(q, ses.ID, ses.UserID, ses.Device, ses.TokenHash, ses.AccessID, ses.DateCreated, ses.DateUpdated, ses.DateExpires, ses.AMR),
+	)
+
+	if _, err := s.db.ExecContext(ctx, q, ses.ID, ses.UserID, ses.Device, ses.TokenHash, ses.AccessID, ses.DateCreated, ses.DateUpdated, ses.DateExpires, ses.AMR); err != nil {
+		return Info{}, "", errors.Wrap(err, "inserting session")
+	}
+
+	return ses, token, nil
+}
+
+// Rotate exchanges a valid refresh token for a new one and records the id of
+// the access token issued alongside it. The old refresh token can't be used
+// again afterwards, and the access token issued with it is revoked, so a
+// session only ever has its latest access token in use.
+func (s Session) Rotate(ctx context.Context, traceID string, token string, accessID string, now time.Time) (Info, string, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.session.rotate")
+	defer span.End()
+
+	next, err := generateToken()
+	if err != nil {
+		return Info{}, "", errors.Wrap(err, "generating refresh token")
+	}
+
+	hash := hashToken(token)
+	nextHash := hashToken(next)
+	expires := now.Add(TTL).UTC()
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return Info{}, "", errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	// The session is locked, so two requests racing with the same refresh
+	// token can't both succeed.
+	q := `
+	SELECT
+		*
+	FROM
+		sessions
+	WHERE
+		token_hash = $1 AND date_revoked IS NULL AND date_expires > $2
+	FOR UPDATE`
+
+	s.log.Printf("%s: %s: %s", traceID, "session.Rotate",
+		database.Log(q, hash, now.UTC()),
+	)
+
+	var prev Info
+	if err := tx.GetContext(ctx, &prev, q, hash, now.UTC()); err != nil {
+		if err == sql.ErrNoRows {
+			return Info{}, "", ErrInvalidToken
+		}
+		return Info{}, "", errors.Wrap(err, "selecting session")
+	}
+
+	q = `
+	UPDATE
+		sessions
+	SET
+		"token_hash" = $2,
+		"access_jti" = $3,
+		"date_updated" = $4,
+		"date_expires" = $5
+	WHERE
+		session_id = $1
+	RETURNING
+		*`
+
+	s.log.Printf("%s: %s: %s", traceID, "session.Rotate",
+		database.Log(q, prev.ID, nextHash, accessID, now.UTC(), expires),
+	)
+
+	var ses Info
+	if err := tx.GetContext(ctx, &ses, q, prev.ID, nextHash, accessID, now.UTC(), expires); err != nil {
+		return Info{}, "", errors.Wrap(err, "rotating refresh token")
+	}
+
+	// Access tokens never outlive the session they were issued for, so the
+	// expiry of the session is a safe upper bound for the previous one.
+	if prev.AccessID != "" {
+		q = `
+		INSERT INTO revoked_tokens
+			(jti, user_id, date_expires, date_revoked)
+		VALUES
+			($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING`
+
+		s.log.Printf("%s: %s: %s", traceID, "session.Rotate",
+			database.Log(q, prev.AccessID, prev.UserID, prev.DateExpires, now.UTC()),
+		)
+
+		if _, err := tx.ExecContext(ctx, q, prev.AccessID, prev.UserID, prev.DateExpires, now.UTC()); err != nil {
+			return Info{}, "", errors.Wrap(err, "revoking previous access token")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Info{}, "", errors.Wrap(err, "committing rotation")
+	}
+
+	return ses, next, nil
+}
+
+// Revoke ends the session the access token in claims was issued for and
+// revokes that access token until it expires.
+func (s Session) Revoke(ctx context.Context, traceID string, claims auth.Claims, now time.Time) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.session.revoke")
+	defer span.End()
+
+	if claims.Id == "" {
+		return ErrNotFound
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	q := `
+	UPDATE
+		sessions
+	SET
+		"date_revoked" = $3
+	WHERE
+		access_jti = $1 AND user_id = $2 AND date_revoked IS NULL`
+
+	s.log.Printf("%s: %s: %s", traceID, "session.Revoke",
+		database.Log(q, claims.Id, claims.Subject, now.UTC()),
+	)
+
+	if _, err := tx.ExecContext(ctx, q, claims.Id, claims.Subject, now.UTC()); err != nil {
+		return errors.Wrap(err, "revoking session")
+	}
+
+	q = `
+	INSERT INTO revoked_tokens
+		(jti, user_id, date_expires, date_revoked)
+	VALUES
+		($1, $2, $3, $4)
+	ON CONFLICT DO NOTHING`
+
+	expires := time.Unix(claims.ExpiresAt, 0).UTC()
+
+	s.log.Printf("%s: %s: %s", traceID, "session.Revoke",
+		database.Log(q, claims.Id, claims.Subject, expires, now.UTC()),
+	)
+
+	if _, err := tx.ExecContext(ctx, q, claims.Id, claims.Subject, expires, now.UTC()); err != nil {
+		return errors.Wrap(err, "revoking access token")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing revocation")
+	}
+
+	return nil
+}
+
+// RevokeAll ends every session of the user and revokes the access tokens
+// last issued for them. Earlier access tokens were revoked when their
+// session was rotated, so none of the user's access tokens remain valid.
+func (s Session) RevokeAll(ctx context.Context, traceID string, userID string, now time.Time) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.session.revokeall")
+	defer span.End()
+
+	if _, err := uuid.Parse(userID); err != nil {
+		return ErrInvalidID
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	// Access tokens never outlive the session they were issued for, so the
+	// expiry of the session is a safe upper bound for them.
+	q := `
+	INSERT INTO revoked_tokens
+		(jti, user_id, date_expires, date_revoked)
+	SELECT
+		access_jti, user_id, date_expires, $2
+	FROM
+		sessions
+	WHERE
+		user_id = $1 AND date_revoked IS NULL AND access_jti <> ''
+	ON CONFLICT DO NOTHING`
+
+	s.log.Printf("%s: %s: %s", traceID, "session.RevokeAll",
+		database.Log(q, userID, now.UTC()),
+	)
+
+	if _, err := tx.ExecContext(ctx, q, userID, now.UTC()); err != nil {
+		return errors.Wrap(err, "revoking access tokens")
+	}
+
+	q = `
+	UPDATE
+		sessions
+	SET
+		"date_revoked" = $2
+	WHERE
+		user_id = $1 AND date_revoked IS NULL`
+
+	s.log.Printf("%s: %s: %s", traceID, "session.RevokeAll",
+		database.Log(q, userID, now.UTC()),
+	)
+
+	if _, err := tx.ExecContext(ctx, q, userID, now.UTC()); err != nil {
+		return errors.Wrap(err, "revoking sessions")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing revocation")
+	}
+
+	return nil
+}
+
+// IsRevoked reports whether the access token with the specified id (jti) has
+// been revoked. Its signature matches auth.RevocationLookup.
+func (s Session) IsRevoked(ctx context.Context, traceID string, jti string) (bool, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.session.isrevoked")
+	defer span.End()
+
+	const q = `
+	SELECT EXISTS (
+		SELECT 1 FROM revoked_tokens WHERE jti = $1
+	)`
+
+	s.log.Printf("%s: %s: %s", traceID, "session.IsRevoked",
+		database.Log(q, jti),
+	)
+
+	var revoked bool
+	if err := s.db.GetContext(ctx, &revoked, q, jti); err != nil {
+		return false, errors.Wrapf(err, "checking revocation of %q", jti)
+	}
+
+	return revoked, nil
+}
+
+// QueryByToken gets the session a refresh token is valid for, without
+// rotating it. This lets callers check everything they need before the
+// token is used up by Rotate.
+func (s Session) QueryByToken(ctx context.Context, traceID string, token string, now time.Time) (Info, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.session.querybytoken")
+	defer span.End()
+
+	const q = `
+	SELECT
+		*
+	FROM
+		sessions
+	WHERE
+		token_hash = $1 AND date_revoked IS NULL AND date_expires > $2`
+
+	hash := hashToken(token)
+
+	s.log.Printf("%s: %s: %s", traceID, "session.QueryByToken",
+		database.Log(q, hash, now.UTC()),
+	)
+
+	var ses Info
+	if err := s.db.GetContext(ctx, &ses, q, hash, now.UTC()); err != nil {
+		if err == sql.ErrNoRows {
+			return Info{}, ErrInvalidToken
+		}
+		return Info{}, errors.Wrap(err, "selecting session")
+	}
+
+	return ses, nil
+}
+
+// Prune removes the revoked access tokens that have expired, since an
+// expired token is rejected anyway. It returns the number of tokens removed.
+func (s Session) Prune(ctx context.Context, traceID string, now time.Time) (int, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.session.prune")
+	defer span.End()
+
+	const q = `
+	DELETE FROM
+		revoked_tokens
+	WHERE
+		date_expires <= $1`
+
+	s.log.Printf("%s: %s: %s", traceID, "session.Prune",
+		database.Log(q, now.UTC()),
+	)
+
+	res, err := s.db.ExecContext(ctx, q, now.UTC())
+	if err != nil {
+		return 0, errors.Wrap(err, "deleting expired revoked tokens")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "counting pruned tokens")
+	}
+
+	return int(n), nil
+}
+
+// QueryByID gets the specified session from the database.
+func (s Session) QueryByID(ctx context.Context, traceID string, sessionID string) (Info, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.session.querybyid")
+	defer span.End()
+
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return Info{}, ErrInvalidID
+	}
+
+	const q = `
+	SELECT
+		*
+	FROM
+		sessions
+	WHERE
+		session_id = $1`
+
+	s.log.Printf("%s: %s: %s", traceID, "session.QueryByID",
+		database.Log(q, sessionID),
+	)
+
+	var ses Info
+	if err := s.db.GetContext(ctx, &ses, q, sessionID); err != nil {
+		if err == sql.ErrNoRows {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, errors.Wrapf(err, "selecting session %q", sessionID)
+	}
+
+	return ses, nil
+}
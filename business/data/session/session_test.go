@@ -0,0 +1,133 @@
+package session_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/schema"
+	"github.com/appinesshq/bpi/business/data/session"
+	"github.com/appinesshq/bpi/business/tests"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+func TestSession(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	if err := schema.Seed(db); err != nil {
+		t.Fatalf("Couldn't seed database: %v", err)
+	}
+
+	s := session.New(log, db)
+
+	t.Log("Given the need to work with Session records.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen handling a single Session.", testID)
+		{
+			ctx := tests.Context()
+			now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			ns := session.NewSession{
+				UserID:   tests.UserID,
+				Device:   "test",
+				AccessID: "0f0bb3aa-d2b3-4e0b-9a47-0e0bf27a46d0",
+			}
+
+			ses, token, err := s.Create(ctx, traceID, ns, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a session : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create a session.", tests.Success, testID)
+
+			if ses.TokenHash == token {
+				t.Fatalf("\t%s\tTest %d:\tShould not store the refresh token in plain text.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not store the refresh token in plain text.", tests.Success, testID)
+
+			later := now.Add(time.Hour)
+			accessID := "3b1f3a5e-8d53-4f1c-b3a6-ff1f2a8c4a71"
+
+			if found, err := s.QueryByToken(ctx, traceID, token, later); err != nil || found.ID != ses.ID {
+				t.Fatalf("\t%s\tTest %d:\tShould find the session of the refresh token : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould find the session of the refresh token.", tests.Success, testID)
+
+			rotated, next, err := s.Rotate(ctx, traceID, token, accessID, later)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to rotate the refresh token : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to rotate the refresh token.", tests.Success, testID)
+
+			if rotated.ID != ses.ID || rotated.AccessID != accessID || next == token {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the same session with a new token.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the same session with a new token.", tests.Success, testID)
+
+			if revoked, err := s.IsRevoked(ctx, traceID, ses.AccessID); err != nil || !revoked {
+				t.Fatalf("\t%s\tTest %d:\tShould revoke the access token issued before the rotation : %v, %v.", tests.Failed, testID, revoked, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould revoke the access token issued before the rotation.", tests.Success, testID)
+
+			if _, _, err := s.Rotate(ctx, traceID, token, accessID, later); errors.Cause(err) != session.ErrInvalidToken {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to reuse a rotated refresh token : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to reuse a rotated refresh token.", tests.Success, testID)
+
+			if _, _, err := s.Rotate(ctx, traceID, next, accessID, later.Add(session.TTL+time.Second)); errors.Cause(err) != session.ErrInvalidToken {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to use an expired refresh token : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to use an expired refresh token.", tests.Success, testID)
+
+			claims := auth.Claims{
+				StandardClaims: jwt.StandardClaims{
+					Issuer:    "MB Appiness Solutions",
+					Subject:   tests.UserID,
+					Audience:  "users",
+					ExpiresAt: later.Add(time.Hour).Unix(),
+					IssuedAt:  later.Unix(),
+					Id:        accessID,
+				},
+				Roles: []string{auth.RoleUser},
+			}
+
+			if err := s.Revoke(ctx, traceID, claims, later); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to revoke the session : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to revoke the session.", tests.Success, testID)
+
+			revoked, err := s.IsRevoked(ctx, traceID, accessID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to check the revocation : %s.", tests.Failed, testID, err)
+			}
+			if !revoked {
+				t.Fatalf("\t%s\tTest %d:\tShould see the access token as revoked.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould see the access token as revoked.", tests.Success, testID)
+
+			if _, _, err := s.Rotate(ctx, traceID, next, accessID, later); errors.Cause(err) != session.ErrInvalidToken {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to refresh a revoked session : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to refresh a revoked session.", tests.Success, testID)
+
+			if _, err := s.QueryByToken(ctx, traceID, next, later); errors.Cause(err) != session.ErrInvalidToken {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT find the session of a revoked refresh token : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT find the session of a revoked refresh token.", tests.Success, testID)
+
+			if n, err := s.Prune(ctx, traceID, later); err != nil || n != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould keep revoked tokens until they expire : %d, %v.", tests.Failed, testID, n, err)
+			}
+			if n, err := s.Prune(ctx, traceID, later.Add(session.TTL+time.Hour)); err != nil || n != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould prune expired revoked tokens : %d, %v.", tests.Failed, testID, n, err)
+			}
+			if revoked, err := s.IsRevoked(ctx, traceID, accessID); err != nil || revoked {
+				t.Fatalf("\t%s\tTest %d:\tShould forget pruned tokens : %v, %v.", tests.Failed, testID, revoked, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould prune expired revoked tokens.", tests.Success, testID)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package user
+
+import (
+	"context"
+
+	"github.com/appinesshq/bpi/foundation/database"
+	"github.com/appinesshq/bpi/foundation/envelope"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+// rotateBatch is the number of users re-encrypted per query while rotating
+// the wrapping key.
+const rotateBatch = 100
+
+// sealEmail sets the email address of the user, encrypting it for storage
+// and hashing it for lookups. The address is bound to the id of the user, so
+// it can't be copied to another user.
+func (u User) sealEmail(usr *Info, email string) error {
+	s, err := u.emails.Seal([]byte(email), []byte(usr.ID))
+	if err != nil {
+		return errors.Wrap(err, "encrypting email")
+	}
+
+	usr.Email = email
+	usr.EmailHash = hashEmail(email)
+	usr.EmailKeyID = s.KeyID
+	usr.EmailKey = s.DataKey
+	usr.EmailCiphertext = s.Ciphertext
+	return nil
+}
+
+// openEmail decrypts the stored email address of the user.
+func (u User) openEmail(usr *Info) error {
+	if len(usr.EmailCiphertext) == 0 {
+		return nil
+	}
+
+	s := envelope.Sealed{
+		KeyID:      usr.EmailKeyID,
+		DataKey:    usr.EmailKey,
+		Ciphertext: usr.EmailCiphertext,
+	}
+	email, err := u.emails.Open(s, []byte(usr.ID))
+	if err != nil {
+		return errors.Wrapf(err, "decrypting email of user %s", usr.ID)
+	}
+
+	usr.Email = string(email)
+	return nil
+}
+
+// RotateEmailKey encrypts the email address of every user again with a new
+// data key, wrapped by the active key of the keyring. Authenticator app
+// secrets are encrypted with the same keyring, so they are encrypted again as
+// well. Once it completes, the other keys can be removed from the keyring. It
+// returns the number of users whose email address was updated.
+func (u User) RotateEmailKey(ctx context.Context, traceID string) (int, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.rotateemailkey")
+	defer span.End()
+
+	const sel = `
+	SELECT
+		user_id, email_key_id, email_key, email_ciphertext
+	FROM
+		users
+	WHERE
+		email_ciphertext IS NOT NULL AND user_id > $1
+	ORDER BY
+		user_id
+	LIMIT $2`
+
+	// The update only applies when the data key is still the one read, so an
+	// address changed in the meantime isn't overwritten with the old one.
+	const upd = `
+	UPDATE
+		users
+	SET
+		"email_key_id" = $2,
+		"email_key" = $3,
+		"email_ciphertext" = $4
+	WHERE
+		user_id = $1 AND email_key = $5`
+
+	var rotated int
+	after := "00000000-0000-0000-0000-000000000000"
+	for {
+		u.log.Printf("%s: %s: %s", traceID, "user.RotateEmailKey",
+			database.Log(sel, after, rotateBatch),
+		)
+
+		var users []Info
+		if err := u.db.SelectContext(ctx, &users, sel, after, rotateBatch); err != nil {
+			return rotated, errors.Wrap(err, "selecting users")
+		}
+
+		for _, usr := range users {
+			s := envelope.Sealed{
+				KeyID:      usr.EmailKeyID,
+				DataKey:    usr.EmailKey,
+				Ciphertext: usr.EmailCiphertext,
+			}
+			rs, err := u.emails.Reseal(s, []byte(usr.ID))
+			if err != nil {
+				return rotated, errors.Wrapf(err, "re-encrypting email of user %s", usr.ID)
+			}
+
+			u.log.Printf("%s: %s: %s", traceID, "user.RotateEmailKey",
+				database.Log(upd, usr.ID, rs.KeyID, rs.DataKey, rs.Ciphertext, usr.EmailKey),
+			)
+
+			res, err := u.db.ExecContext(ctx, upd, usr.ID, rs.KeyID, rs.DataKey, rs.Ciphertext, usr.EmailKey)
+			if err != nil {
+				return rotated, errors.Wrapf(err, "updating email of user %s", usr.ID)
+			}
+			if n, err := res.RowsAffected(); err == nil && n > 0 {
+				rotated++
+			}
+		}
+
+		if len(users) < rotateBatch {
+			break
+		}
+		after = users[len(users)-1].ID
+	}
+
+	if err := u.rotateSecrets(ctx, traceID); err != nil {
+		return rotated, err
+	}
+
+	return rotated, nil
+}
+
+// rotateSecrets encrypts the authenticator app secret of every user again
+// with a new data key, wrapped by the active key of the keyring. Secrets
+// still stored in plain text are encrypted for the first time.
+func (u User) rotateSecrets(ctx context.Context, traceID string) error {
+	const sel = `
+	SELECT
+		*
+	FROM
+		user_totp
+	WHERE
+		user_id > $1
+	ORDER BY
+		user_id
+	LIMIT $2`
+
+	// As with email addresses, a secret replaced in the meantime isn't
+	// overwritten with the old one.
+	const upd = `
+	UPDATE
+		user_totp
+	SET
+		"secret" = NULL,
+		"secret_key_id" = $2,
+		"secret_key" = $3,
+		"secret_ciphertext" = $4
+	WHERE
+		user_id = $1 AND secret_key IS NOT DISTINCT FROM $5`
+
+	after := "00000000-0000-0000-0000-000000000000"
+	for {
+		u.log.Printf("%s: %s: %s", traceID, "user.rotateSecrets",
+			database.Log(sel, after, rotateBatch),
+		)
+
+		var secrets []totpInfo
+		if err := u.db.SelectContext(ctx, &secrets, sel, after, rotateBatch); err != nil {
+			return errors.Wrap(err, "selecting totp secrets")
+		}
+
+		for _, t := range secrets {
+			s := envelope.Sealed{
+				KeyID:      t.SecretKeyID,
+				DataKey:    t.SecretKey,
+				Ciphertext: t.SecretCiphertext,
+			}
+			var rs envelope.Sealed
+			var err error
+			if len(t.SecretCiphertext) == 0 {
+				rs, err = u.emails.Seal([]byte(t.PlainSecret.String), []byte(t.UserID))
+			} else {
+				rs, err = u.emails.Reseal(s, []byte(t.UserID))
+			}
+			if err != nil {
+				return errors.Wrapf(err, "re-encrypting totp secret of user %s", t.UserID)
+			}
+
+			u.log.Printf("%s: %s: %s", traceID, "user.rotateSecrets",
+				database.Log(upd, t.UserID, rs.KeyID, rs.DataKey, rs.Ciphertext, t.SecretKey),
+			)
+
+			if _, err := u.db.ExecContext(ctx, upd, t.UserID, rs.KeyID, rs.DataKey, rs.Ciphertext, t.SecretKey); err != nil {
+				return errors.Wrapf(err, "updating totp secret of user %s", t.UserID)
+			}
+		}
+
+		if len(secrets) < rotateBatch {
+			return nil
+		}
+		after = secrets[len(secrets)-1].UserID
+	}
+}
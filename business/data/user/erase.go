@@ -0,0 +1,229 @@
+package user
+
+import (
+	"context"
+	"time"
+
+	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/audit"
+	"github.com/appinesshq/bpi/foundation/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+// anonymous is the user id records are transferred to when their owner is
+// erased but the records are shared with others.
+const anonymous = "00000000-0000-0000-0000-000000000000"
+
+// Erase removes the user in the claims along with their personal data, as
+// the right to erasure requires. Profiles of the user are deleted. Products
+// and categories are shared with others, through sales and children created
+// by others, so those are kept but no longer linked to the user. Products are
+// deleted softly as well, since nobody offers them anymore. The values of the
+// changes recorded in the audit log about the user and their records are
+// redacted. Access tokens of the user are revoked, and the erasure is
+// recorded in the audit log. Everything happens in a single transaction.
+func (u User) Erase(ctx context.Context, traceID string, claims auth.Claims, now time.Time) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.erase")
+	defer span.End()
+
+	userID := claims.Subject
+	if _, err := uuid.Parse(userID); err != nil {
+		return ErrInvalidID
+	}
+
+	tx, err := u.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	// entities holds the ids of the records of the user by the entity type
+	// they are recorded as in the audit log.
+	entities := map[string][]string{
+		"user":       {userID},
+		"two_factor": {userID},
+	}
+	collect := func(entityType string, q string, args ...interface{}) error {
+		u.log.Printf("%s: %s: %s", traceID, "user.Erase",
+			database.Log(q, args...),
+		)
+
+		var ids []string
+		if err := tx.SelectContext(ctx, &ids, q, args...); err != nil {
+			return errors.Wrapf(err, "erasing %s records of user %s", entityType, userID)
+		}
+		entities[entityType] = ids
+		return nil
+	}
+
+	if err := collect("apikey", `SELECT key_id FROM api_keys WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if err := collect("identity", `SELECT provider || '/' || subject FROM user_identities WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if err := collect("quote", `SELECT quote_id FROM quotes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if err := collect("review", `SELECT review_id FROM reviews WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if err := collect("profile", `SELECT name FROM profiles WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	// Products are detached from the profiles first, since deleting a profile
+	// deletes its products and with them the sales of others.
+	q := `
+	UPDATE
+		products
+	SET
+		"user_id" = $3,
+		"profile_name" = NULL,
+		"deleted_at" = COALESCE(deleted_at, $4),
+		"date_updated" = $4
+	WHERE
+		user_id = $1 OR profile_name = ANY($2)
+	RETURNING
+		product_id`
+
+	if err := collect("product", q, userID, pq.Array(entities["profile"]), anonymous, now.UTC()); err != nil {
+		return err
+	}
+
+	q = `
+	UPDATE
+		sales
+	SET
+		"user_id" = $2
+	WHERE
+		user_id = $1`
+
+	u.log.Printf("%s: %s: %s", traceID, "user.Erase",
+		database.Log(q, userID, anonymous),
+	)
+
+	if _, err := tx.ExecContext(ctx, q, userID, anonymous); err != nil {
+		return errors.Wrapf(err, "anonymizing sales of user %s", userID)
+	}
+
+	q = `
+	DELETE FROM
+		profiles
+	WHERE
+		user_id = $1`
+
+	u.log.Printf("%s: %s: %s", traceID, "user.Erase",
+		database.Log(q, userID),
+	)
+
+	if _, err := tx.ExecContext(ctx, q, userID); err != nil {
+		return errors.Wrapf(err, "deleting profiles of user %s", userID)
+	}
+
+	q = `
+	UPDATE
+		categories
+	SET
+		"user_id" = $2,
+		"date_updated" = $3
+	WHERE
+		user_id = $1
+	RETURNING
+		category_id`
+
+	if err := collect("category", q, userID, anonymous, now.UTC()); err != nil {
+		return err
+	}
+
+	// Sessions are removed with the user, so their access tokens are revoked
+	// first. Earlier access tokens of a session were revoked when it was
+	// rotated. The token used for the erasure is revoked as well, in case it
+	// wasn't issued for a session.
+	q = `
+	INSERT INTO revoked_tokens
+		(jti, user_id, date_expires, date_revoked)
+	SELECT
+		access_jti, user_id, date_expires, $2
+	FROM
+		sessions
+	WHERE
+		user_id = $1 AND date_revoked IS NULL AND access_jti <> ''
+	ON CONFLICT DO NOTHING`
+
+	u.log.Printf("%s: %s: %s", traceID, "user.Erase",
+		database.Log(q, userID, now.UTC()),
+	)
+
+	if _, err := tx.ExecContext(ctx, q, userID, now.UTC()); err != nil {
+		return errors.Wrapf(err, "revoking access tokens of user %s", userID)
+	}
+
+	if claims.Id != "" {
+		q = `
+		INSERT INTO revoked_tokens
+			(jti, user_id, date_expires, date_revoked)
+		VALUES
+			($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING`
+
+		expires := time.Unix(claims.ExpiresAt, 0).UTC()
+
+		u.log.Printf("%s: %s: %s", traceID, "user.Erase",
+			database.Log(q, claims.Id, userID, expires, now.UTC()),
+		)
+
+		if _, err := tx.ExecContext(ctx, q, claims.Id, userID, expires, now.UTC()); err != nil {
+			return errors.Wrap(err, "revoking access token")
+		}
+	}
+
+	// Everything else stored about the user, like sessions, API keys and
+	// linked identities, is removed along with the user.
+	q = `
+	DELETE FROM
+		users
+	WHERE
+		user_id = $1`
+
+	u.log.Printf("%s: %s: %s", traceID, "user.Erase",
+		database.Log(q, userID),
+	)
+
+	res, err := tx.ExecContext(ctx, q, userID)
+	if err != nil {
+		return errors.Wrapf(err, "deleting user %s", userID)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrapf(err, "deleting user %s", userID)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	for entityType, ids := range entities {
+		if err := audit.Redact(ctx, u.log, tx, traceID, entityType, ids); err != nil {
+			return err
+		}
+	}
+
+	ne := audit.NewEvent{
+		ActorID:    userID,
+		Action:     audit.ActionErase,
+		EntityType: "user",
+		EntityID:   userID,
+	}
+	if err := audit.Record(ctx, u.log, tx, traceID, ne, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing erasure")
+	}
+
+	return nil
+}
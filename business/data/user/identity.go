@@ -0,0 +1,255 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/audit"
+	"github.com/appinesshq/bpi/foundation/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+// LoginTTL is how long a user has to complete signing in with a provider.
+var LoginTTL = 10 * time.Minute
+
+var (
+	// ErrInvalidLoginState occurs when the callback of a provider doesn't
+	// belong to a login that was started, or the login took too long.
+	ErrInvalidLoginState = errors.New("login state is invalid")
+
+	// ErrIdentityNotLinked occurs when a user signs in with an account at a
+	// provider for the first time while a user with the same email address
+	// exists. That user has to sign in and link the account first.
+	ErrIdentityNotLinked = errors.New("account is not linked, sign in and link it first")
+
+	// ErrIdentityExists occurs when an account at a provider is linked while
+	// it is linked to a user already.
+	ErrIdentityExists = errors.New("account is already linked")
+)
+
+// StartFederatedLogin records a login with a provider so its callback can be
+// matched to it.
+func (u User) StartFederatedLogin(ctx context.Context, traceID string, fl FederatedLogin, now time.Time) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.startfederatedlogin")
+	defer span.End()
+
+	const q = `
+	INSERT INTO federated_logins
+		(state, provider, nonce, verifier, user_id, date_expires)
+	VALUES
+		($1, $2, $3, $4, $5, $6)`
+
+	expires := now.Add(LoginTTL).UTC()
+
+	u.log.Printf("%s: %s: %s", traceID, "user.StartFederatedLogin",
+		database.Log(q, fl.State, fl.Provider, fl.Nonce, "***", fl.UserID, expires),
+	)
+
+	if _, err := u.db.ExecContext(ctx, q, fl.State, fl.Provider, fl.Nonce, fl.Verifier, fl.UserID, expires); err != nil {
+		return errors.Wrap(err, "inserting federated login")
+	}
+
+	return nil
+}
+
+// CompleteFederatedLogin returns the login the state was issued for. The
+// state can't be used again.
+func (u User) CompleteFederatedLogin(ctx context.Context, traceID string, provider string, state string, now time.Time) (FederatedLogin, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.completefederatedlogin")
+	defer span.End()
+
+	// Deleting the login in the same statement as the lookup ensures two
+	// callbacks racing with the same state can't both succeed.
+	const q = `
+	DELETE FROM
+		federated_logins
+	WHERE
+		state = $1
+	RETURNING
+		*`
+
+	u.log.Printf("%s: %s: %s", traceID, "user.CompleteFederatedLogin",
+		database.Log(q, state),
+	)
+
+	var fl FederatedLogin
+	if err := u.db.GetContext(ctx, &fl, q, state); err != nil {
+		if err == sql.ErrNoRows {
+			return FederatedLogin{}, ErrInvalidLoginState
+		}
+		return FederatedLogin{}, errors.Wrap(err, "selecting federated login")
+	}
+
+	if fl.Provider != provider || !fl.DateExpires.After(now) {
+		return FederatedLogin{}, ErrInvalidLoginState
+	}
+
+	return fl, nil
+}
+
+// AuthenticateIdentity finds the user linked to an account at a provider and
+// returns the claims for that user. Users enrolled for two-factor
+// authentication need to provide a code as well, as they do when signing in
+// with a password. An account that isn't linked yet is linked to a new user.
+// Accounts are never linked to an existing user this way, since that would
+// hand the user to whoever controls the address at the provider. Email
+// addresses are only trusted when the provider verified them.
+func (u User) AuthenticateIdentity(ctx context.Context, traceID string, now time.Time, ni NewIdentity, code string) (auth.Claims, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.authenticateidentity")
+	defer span.End()
+
+	q := `
+	SELECT
+		u.*
+	FROM
+		users AS u
+	JOIN
+		user_identities AS i ON i.user_id = u.user_id
+	WHERE
+		i.provider = $1 AND i.subject = $2 AND u.deleted_at IS NULL`
+
+	u.log.Printf("%s: %s: %s", traceID, "user.AuthenticateIdentity",
+		database.Log(q, ni.Provider, ni.Subject),
+	)
+
+	var usr Info
+	err := u.db.GetContext(ctx, &usr, q, ni.Provider, ni.Subject)
+	switch {
+	case err == nil:
+		amr, err := u.secondFactor(ctx, traceID, usr.ID, code, []string{auth.MethodFederated}, now)
+		if err != nil {
+			return auth.Claims{}, err
+		}
+		return u.newClaims(ctx, traceID, usr, amr, now)
+	case err != sql.ErrNoRows:
+		return auth.Claims{}, errors.Wrap(err, "selecting linked user")
+	}
+
+	if ni.Email == "" || !ni.EmailVerified {
+		return auth.Claims{}, ErrNotVerified
+	}
+
+	// Users signing in with a provider don't have a password. A random one
+	// keeps the account usable, a password can be set by resetting it.
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return auth.Claims{}, errors.Wrap(err, "generating password")
+	}
+
+	userID := uuid.New().String()
+	usr, err = u.insert(ctx, traceID, userID, userID, ni.Email, base64.RawURLEncoding.EncodeToString(b), []string{auth.RoleUser}, true, now)
+	if err != nil {
+		if err == ErrEmailExists {
+			return auth.Claims{}, ErrIdentityNotLinked
+		}
+		return auth.Claims{}, err
+	}
+
+	if err := u.LinkIdentity(ctx, traceID, usr.ID, ni, now); err != nil {
+		return auth.Claims{}, err
+	}
+
+	return u.newClaims(ctx, traceID, usr, []string{auth.MethodFederated}, now)
+}
+
+// LinkIdentity links an account at a provider to the user. Only the user
+// can link an account, by signing in at the provider from a login they
+// started while signed in.
+func (u User) LinkIdentity(ctx context.Context, traceID string, userID string, ni NewIdentity, now time.Time) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.linkidentity")
+	defer span.End()
+
+	const q = `
+	INSERT INTO user_identities
+		(provider, subject, user_id, date_created)
+	VALUES
+		($1, $2, $3, $4)`
+
+	u.log.Printf("%s: %s: %s", traceID, "user.LinkIdentity",
+		database.Log(q, ni.Provider, ni.Subject, userID, now.UTC()),
+	)
+
+	tx, err := u.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, q, ni.Provider, ni.Subject, userID, now.UTC()); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			return ErrIdentityExists
+		}
+		return errors.Wrap(err, "linking identity")
+	}
+
+	id := Identity{
+		Provider:    ni.Provider,
+		Subject:     ni.Subject,
+		UserID:      userID,
+		DateCreated: now.UTC(),
+	}
+	ne := audit.NewEvent{
+		ActorID:    userID,
+		Action:     audit.ActionCreate,
+		EntityType: "identity",
+		EntityID:   ni.Provider + "/" + ni.Subject,
+		After:      id,
+	}
+	if err := audit.Record(ctx, u.log, tx, traceID, ne, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing identity")
+	}
+
+	return nil
+}
+
+// QueryIdentities retrieves the accounts at providers linked to the user. The
+// id "me" refers to the user in the claims.
+func (u User) QueryIdentities(ctx context.Context, traceID string, claims auth.Claims, userID string) ([]Identity, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.queryidentities")
+	defer span.End()
+
+	if strings.ToLower(userID) == "me" {
+		userID = claims.Subject
+	}
+
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	if !u.policy.AllowedFor(claims, auth.PermissionUserRead, userID) {
+		return nil, ErrForbidden
+	}
+
+	const q = `
+	SELECT
+		*
+	FROM
+		user_identities
+	WHERE
+		user_id = $1
+	ORDER BY
+		date_created`
+
+	u.log.Printf("%s: %s: %s", traceID, "user.QueryIdentities",
+		database.Log(q, userID),
+	)
+
+	ids := []Identity{}
+	if err := u.db.SelectContext(ctx, &ids, q, userID); err != nil {
+		return nil, errors.Wrapf(err, "selecting identities of user %q", userID)
+	}
+
+	return ids, nil
+}
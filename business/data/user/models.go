@@ -1,19 +1,29 @@
 package user
 
 import (
+	"database/sql"
 	"time"
 
 	"github.com/lib/pq"
 )
 
-// Info represents an individual user.
+// Info represents an individual user. The email address is stored encrypted,
+// along with a salted hash of it for looking users up by address. Users
+// stored before addresses were encrypted only have the hash, so their Email
+// is empty.
 type Info struct {
-	ID           string         `db:"user_id" json:"id"`
-	Email        string         `db:"email" json:"email"`
-	Roles        pq.StringArray `db:"roles" json:"roles"`
-	PasswordHash []byte         `db:"password_hash" json:"-"`
-	DateCreated  time.Time      `db:"date_created" json:"date_created"`
-	DateUpdated  time.Time      `db:"date_updated" json:"date_updated"`
+	ID              string         `db:"user_id" json:"id"`
+	Email           string         `db:"-" json:"email"`
+	EmailHash       string         `db:"email" json:"-"`
+	EmailKeyID      string         `db:"email_key_id" json:"-"`
+	EmailKey        []byte         `db:"email_key" json:"-"`
+	EmailCiphertext []byte         `db:"email_ciphertext" json:"-"`
+	Roles           pq.StringArray `db:"roles" json:"roles"`
+	PasswordHash    []byte         `db:"password_hash" json:"-"`
+	DateCreated     time.Time      `db:"date_created" json:"date_created"`
+	DateUpdated     time.Time      `db:"date_updated" json:"date_updated"`
+	Verified        bool           `db:"verified" json:"verified"`
+	DeletedAt       *time.Time     `db:"deleted_at" json:"deleted_at,omitempty"`
 }
 
 // NewUser contains information needed to create a new User.
@@ -24,6 +34,50 @@ type NewUser struct {
 	PasswordConfirm string   `json:"password_confirm" validate:"eqfield=Password"`
 }
 
+// NewSignup contains information needed for a visitor to sign up as a new
+// User. Users signing up always get the USER role.
+type NewSignup struct {
+	Email           string `json:"email" validate:"required,email"`
+	Password        string `json:"password" validate:"required,min=8"`
+	PasswordConfirm string `json:"password_confirm" validate:"eqfield=Password"`
+}
+
+// ResendVerification contains the information needed to send the mail for
+// verifying an email address again.
+type ResendVerification struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// ForgotPassword contains the information needed to request a password reset.
+type ForgotPassword struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// ResetPassword contains the information needed to reset a password with a
+// reset token.
+type ResetPassword struct {
+	Token           string `json:"token" validate:"required"`
+	Password        string `json:"password" validate:"required,min=8"`
+	PasswordConfirm string `json:"password_confirm" validate:"eqfield=Password"`
+}
+
+// Enrollment contains what a user needs to add their account to an
+// authenticator app. The URI is meant to be shown as a QR code.
+type Enrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// SecondFactor contains a code from an authenticator app or a recovery code.
+type SecondFactor struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// RoleTwoFactor defines whether users need a second factor to act with a role.
+type RoleTwoFactor struct {
+	Required bool `json:"required"`
+}
+
 // UpdateUser defines what information may be provided to modify an existing
 // User. All fields are optional so clients can send just the fields they want
 // changed. It uses pointer fields so we can differentiate between a field that
@@ -36,3 +90,32 @@ type UpdateUser struct {
 	Password        *string  `json:"password"`
 	PasswordConfirm *string  `json:"password_confirm" validate:"omitempty,eqfield=Password"`
 }
+
+// Identity represents an account at an OpenID provider linked to a User.
+type Identity struct {
+	Provider    string    `db:"provider" json:"provider"`         // Name of the provider.
+	Subject     string    `db:"subject" json:"subject"`           // ID of the account at the provider.
+	UserID      string    `db:"user_id" json:"user_id"`           // ID of the user the account is linked to.
+	DateCreated time.Time `db:"date_created" json:"date_created"` // When the account was linked.
+}
+
+// NewIdentity contains the verified claims of a provider about a user signing
+// in with their account at the provider.
+type NewIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// FederatedLogin contains the values tying the callback of a provider to the
+// login it was started for. Logins started by a signed in user link the
+// account at the provider to that user instead of signing in.
+type FederatedLogin struct {
+	State       string         `db:"state"`
+	Provider    string         `db:"provider"`
+	Nonce       string         `db:"nonce"`
+	Verifier    string         `db:"verifier"`
+	UserID      sql.NullString `db:"user_id"`
+	DateExpires time.Time      `db:"date_expires"`
+}
@@ -0,0 +1,199 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/appinesshq/bpi/business/data/audit"
+	"github.com/appinesshq/bpi/foundation/database"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+// ResetTTL is how long a password reset token remains valid.
+var ResetTTL = time.Hour
+
+// ErrInvalidResetToken occurs when a password reset token is unknown, expired
+// or has been used before.
+var ErrInvalidResetToken = errors.New("reset token is invalid")
+
+// hashResetToken hashes a reset token for storage. Reset tokens are random
+// values of sufficient length, so an unsalted hash is enough.
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return fmt.Sprintf("%x", sum)
+}
+
+// ForgotPassword issues a single use password reset token for the user with
+// the specified email address. The token is returned so it can be sent to the
+// user, only its hash is stored.
+func (u User) ForgotPassword(ctx context.Context, traceID string, fp ForgotPassword, now time.Time) (string, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.forgotpassword")
+	defer span.End()
+
+	email := hashEmail(fp.Email)
+
+	q := `
+	SELECT
+		user_id
+	FROM
+		users
+	WHERE
+		email = $1 AND deleted_at IS NULL`
+
+	u.log.Printf("%s: %s: %s", traceID, "user.ForgotPassword",
+		database.Log(q, email),
+	)
+
+	var userID string
+	if err := u.db.GetContext(ctx, &userID, q, email); err != nil {
+		if err == sql.ErrNoRows {
+			return "", ErrNotFound
+		}
+		return "", errors.Wrap(err, "selecting user")
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "generating reset token")
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	q = `
+	INSERT INTO password_resets
+		(reset_id, user_id, token_hash, date_created, date_expires)
+	VALUES
+		($1, $2, $3, $4, $5)`
+
+	resetID := uuid.New().String()
+	hash := hashResetToken(token)
+	expires := now.Add(ResetTTL).UTC()
+
+	u.log.Printf("%s: %s: %s", traceID, "user.ForgotPassword",
+		database.Log(q, resetID, userID, hash, now.UTC(), expires),
+	)
+
+	if _, err := u.db.ExecContext(ctx, q, resetID, userID, hash, now.UTC(), expires); err != nil {
+		return "", errors.Wrap(err, "inserting password reset")
+	}
+
+	return token, nil
+}
+
+// ResetPassword replaces the password of the user the reset token was issued
+// for and returns the id of that user. The token can't be used again. Since
+// the token was delivered by email, the email address is verified as well.
+func (u User) ResetPassword(ctx context.Context, traceID string, rp ResetPassword, now time.Time) (string, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.resetpassword")
+	defer span.End()
+
+	pw, err := u.passwords.Hash(rp.Password)
+	if err != nil {
+		return "", errors.Wrap(err, "generating password hash")
+	}
+
+	tx, err := u.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	// Marking the token as used in the same statement as the lookup ensures
+	// two requests racing with the same token can't both succeed.
+	q := `
+	UPDATE
+		password_resets
+	SET
+		"date_used" = $2
+	WHERE
+		token_hash = $1 AND date_used IS NULL AND date_expires > $2
+	RETURNING
+		user_id`
+
+	hash := hashResetToken(rp.Token)
+
+	u.log.Printf("%s: %s: %s", traceID, "user.ResetPassword",
+		database.Log(q, hash, now.UTC()),
+	)
+
+	var userID string
+	if err := tx.GetContext(ctx, &userID, q, hash, now.UTC()); err != nil {
+		if err == sql.ErrNoRows {
+			return "", ErrInvalidResetToken
+		}
+		return "", errors.Wrap(err, "using reset token")
+	}
+
+	// Tokens of users deleted after requesting a reset are rejected like any
+	// other invalid token.
+	q = `
+	SELECT
+		*
+	FROM
+		users
+	WHERE
+		user_id = $1 AND deleted_at IS NULL
+	FOR UPDATE`
+
+	u.log.Printf("%s: %s: %s", traceID, "user.ResetPassword",
+		database.Log(q, userID),
+	)
+
+	var usr Info
+	if err := tx.GetContext(ctx, &usr, q, userID); err != nil {
+		if err == sql.ErrNoRows {
+			return "", ErrInvalidResetToken
+		}
+		return "", errors.Wrapf(err, "selecting user %s", userID)
+	}
+
+	before := usr
+	usr.PasswordHash = pw
+	usr.Verified = true
+	usr.DateUpdated = now
+
+	q = `
+	UPDATE
+		users
+	SET
+		"password_hash" = $2,
+		"verified" = TRUE,
+		"date_updated" = $3
+	WHERE
+		user_id = $1 AND deleted_at IS NULL`
+
+	u.log.Printf("%s: %s: %s", traceID, "user.ResetPassword",
+		database.Log(q, userID, pw, now.UTC()),
+	)
+
+	if _, err := tx.ExecContext(ctx, q, userID, pw, now.UTC()); err != nil {
+		return "", errors.Wrapf(err, "updating password of user %s", userID)
+	}
+
+	// The password hash isn't part of the recorded changes, but the event
+	// shows when the password was reset.
+	ne := audit.NewEvent{
+		ActorID:    userID,
+		Action:     audit.ActionUpdate,
+		EntityType: "user",
+		EntityID:   userID,
+		Before:     before,
+		After:      usr,
+		Sensitive:  sensitive,
+	}
+	if err := audit.Record(ctx, u.log, tx, traceID, ne, now); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", errors.Wrap(err, "committing password reset")
+	}
+
+	return userID, nil
+}
@@ -0,0 +1,549 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/audit"
+	"github.com/appinesshq/bpi/foundation/database"
+	"github.com/appinesshq/bpi/foundation/envelope"
+	"github.com/appinesshq/bpi/foundation/totp"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+// RecoveryCodes is the number of recovery codes issued when a user enrolls
+// for two-factor authentication.
+const RecoveryCodes = 10
+
+var (
+	// ErrSecondFactorRequired occurs when a user enrolled for two-factor
+	// authentication authenticates without providing a second factor.
+	ErrSecondFactorRequired = errors.New("second factor required")
+
+	// ErrInvalidCode occurs when a second factor is wrong, expired or has
+	// been used before.
+	ErrInvalidCode = errors.New("code is invalid")
+
+	// ErrAlreadyEnrolled occurs when a user enrolls for two-factor
+	// authentication a second time.
+	ErrAlreadyEnrolled = errors.New("two-factor authentication is already enabled")
+
+	// ErrNotEnrolled occurs when a user acts on a two-factor enrollment that
+	// doesn't exist.
+	ErrNotEnrolled = errors.New("two-factor authentication is not enabled")
+
+	// ErrSecondFactorSession occurs when a user disables two-factor
+	// authentication in a session that wasn't started with a second factor.
+	ErrSecondFactorSession = errors.New("sign in with a second factor first")
+)
+
+// totpInfo represents the authenticator app secret of a user. The secret is
+// stored encrypted with a key from the same keyring as email addresses.
+// Secrets enrolled before they were encrypted are kept in plain text until
+// the keyring is rotated.
+type totpInfo struct {
+	UserID           string         `db:"user_id"`
+	Secret           string         `db:"-"`
+	PlainSecret      sql.NullString `db:"secret"`
+	SecretKeyID      string         `db:"secret_key_id"`
+	SecretKey        []byte         `db:"secret_key"`
+	SecretCiphertext []byte         `db:"secret_ciphertext"`
+	LastStep         int64          `db:"last_step"`
+	DateCreated      time.Time      `db:"date_created"`
+	DateConfirmed    sql.NullTime   `db:"date_confirmed"`
+}
+
+// enrollmentEvent is how a two-factor enrollment is recorded in the audit
+// log, without its secret.
+type enrollmentEvent struct {
+	Confirmed bool `json:"confirmed"`
+}
+
+// sealSecret sets the authenticator app secret, encrypting it for storage.
+// The secret is bound to the id of the user, so it can't be copied to
+// another user.
+func (u User) sealSecret(t *totpInfo, secret string) error {
+	s, err := u.emails.Seal([]byte(secret), []byte(t.UserID))
+	if err != nil {
+		return errors.Wrap(err, "encrypting totp secret")
+	}
+
+	t.Secret = secret
+	t.SecretKeyID = s.KeyID
+	t.SecretKey = s.DataKey
+	t.SecretCiphertext = s.Ciphertext
+	return nil
+}
+
+// openSecret decrypts the stored authenticator app secret.
+func (u User) openSecret(t *totpInfo) error {
+	if len(t.SecretCiphertext) == 0 {
+		t.Secret = t.PlainSecret.String
+		return nil
+	}
+
+	s := envelope.Sealed{
+		KeyID:      t.SecretKeyID,
+		DataKey:    t.SecretKey,
+		Ciphertext: t.SecretCiphertext,
+	}
+	secret, err := u.emails.Open(s, []byte(t.UserID))
+	if err != nil {
+		return errors.Wrapf(err, "decrypting totp secret of user %s", t.UserID)
+	}
+
+	t.Secret = string(secret)
+	return nil
+}
+
+// hashRecoveryCode hashes a recovery code for storage. Dashes and case are
+// ignored so codes can be typed in any way.
+func hashRecoveryCode(code string) string {
+	code = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return fmt.Sprintf("%x", sum)
+}
+
+// generateRecoveryCode returns a new random recovery code.
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := base32.StdEncoding.EncodeToString(b)
+	return code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16], nil
+}
+
+// EnrollTwoFactor starts the enrollment of the user in the claims for
+// two-factor authentication. Second factors are only required once the
+// enrollment is confirmed. Starting again replaces an unconfirmed enrollment.
+func (u User) EnrollTwoFactor(ctx context.Context, traceID string, claims auth.Claims, now time.Time) (Enrollment, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.enrolltwofactor")
+	defer span.End()
+
+	t, err := u.queryTOTP(ctx, traceID, u.db, claims.Subject)
+	switch {
+	case err == nil && t.DateConfirmed.Valid:
+		return Enrollment{}, ErrAlreadyEnrolled
+	case err != nil && err != ErrNotEnrolled:
+		return Enrollment{}, err
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return Enrollment{}, err
+	}
+
+	t = totpInfo{UserID: claims.Subject}
+	if err := u.sealSecret(&t, secret); err != nil {
+		return Enrollment{}, err
+	}
+
+	const q = `
+	INSERT INTO user_totp
+		(user_id, secret_key_id, secret_key, secret_ciphertext, last_step, date_created)
+	VALUES
+		($1, $2, $3, $4, 0, $5)
+	ON CONFLICT (user_id) DO UPDATE SET
+		"secret" = NULL,
+		"secret_key_id" = $2,
+		"secret_key" = $3,
+		"secret_ciphertext" = $4,
+		"last_step" = 0,
+		"date_created" = $5`
+
+	u.log.Printf("%s: %s: %s", traceID, "user.EnrollTwoFactor",
+		database.Log(q, t.UserID, t.SecretKeyID, t.SecretKey, t.SecretCiphertext, now.UTC()),
+	)
+
+	tx, err := u.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return Enrollment{}, errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, q, t.UserID, t.SecretKeyID, t.SecretKey, t.SecretCiphertext, now.UTC()); err != nil {
+		return Enrollment{}, errors.Wrap(err, "inserting totp secret")
+	}
+
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionCreate,
+		EntityType: "two_factor",
+		EntityID:   claims.Subject,
+		After:      enrollmentEvent{},
+	}
+	if err := audit.Record(ctx, u.log, tx, traceID, ne, now); err != nil {
+		return Enrollment{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Enrollment{}, errors.Wrap(err, "committing enrollment")
+	}
+
+	e := Enrollment{
+		Secret: secret,
+		URI:    totp.URI(Issuer, claims.Subject, secret),
+	}
+
+	return e, nil
+}
+
+// ConfirmTwoFactor completes the enrollment of the user in the claims with a
+// code from their authenticator app. It returns the recovery codes of the
+// user, which are only ever available here since just their hashes are stored.
+func (u User) ConfirmTwoFactor(ctx context.Context, traceID string, claims auth.Claims, sf SecondFactor, now time.Time) ([]string, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.confirmtwofactor")
+	defer span.End()
+
+	tx, err := u.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	t, err := u.queryTOTP(ctx, traceID, tx, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if t.DateConfirmed.Valid {
+		return nil, ErrAlreadyEnrolled
+	}
+
+	step, ok := totp.Validate(t.Secret, sf.Code, now)
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	q := `
+	UPDATE
+		user_totp
+	SET
+		"last_step" = $2,
+		"date_confirmed" = $3
+	WHERE
+		user_id = $1`
+
+	u.log.Printf("%s: %s: %s", traceID, "user.ConfirmTwoFactor",
+		database.Log(q, claims.Subject, step, now.UTC()),
+	)
+
+	if _, err := tx.ExecContext(ctx, q, claims.Subject, step, now.UTC()); err != nil {
+		return nil, errors.Wrap(err, "confirming totp secret")
+	}
+
+	q = `
+	DELETE FROM
+		recovery_codes
+	WHERE
+		user_id = $1`
+
+	u.log.Printf("%s: %s: %s", traceID, "user.ConfirmTwoFactor",
+		database.Log(q, claims.Subject),
+	)
+
+	if _, err := tx.ExecContext(ctx, q, claims.Subject); err != nil {
+		return nil, errors.Wrap(err, "deleting recovery codes")
+	}
+
+	q = `
+	INSERT INTO recovery_codes
+		(code_hash, user_id, date_created)
+	VALUES
+		($1, $2, $3)`
+
+	codes := make([]string, RecoveryCodes)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, errors.Wrap(err, "generating recovery code")
+		}
+		codes[i] = code
+
+		hash := hashRecoveryCode(code)
+
+		u.log.Printf("%s: %s: %s", traceID, "user.ConfirmTwoFactor",
+			database.Log(q, hash, claims.Subject, now.UTC()),
+		)
+
+		if _, err := tx.ExecContext(ctx, q, hash, claims.Subject, now.UTC()); err != nil {
+			return nil, errors.Wrap(err, "inserting recovery code")
+		}
+	}
+
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionUpdate,
+		EntityType: "two_factor",
+		EntityID:   claims.Subject,
+		Before:     enrollmentEvent{},
+		After:      enrollmentEvent{Confirmed: true},
+	}
+	if err := audit.Record(ctx, u.log, tx, traceID, ne, now); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "committing enrollment")
+	}
+
+	return codes, nil
+}
+
+// DisableTwoFactor removes the two-factor enrollment of the user in the
+// claims. The user has to be signed in with a second factor and provide a
+// valid one again to do so, so a stolen password alone can't remove it.
+func (u User) DisableTwoFactor(ctx context.Context, traceID string, claims auth.Claims, sf SecondFactor, now time.Time) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.disabletwofactor")
+	defer span.End()
+
+	mfa := false
+	for _, method := range claims.AMR {
+		if method == auth.MethodMFA {
+			mfa = true
+		}
+	}
+	if !mfa {
+		return ErrSecondFactorSession
+	}
+
+	if _, err := u.verifySecondFactor(ctx, traceID, claims.Subject, sf.Code, now); err != nil {
+		return err
+	}
+
+	tx, err := u.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	for _, q := range []string{
+		`DELETE FROM recovery_codes WHERE user_id = $1`,
+		`DELETE FROM user_totp WHERE user_id = $1`,
+	} {
+		u.log.Printf("%s: %s: %s", traceID, "user.DisableTwoFactor",
+			database.Log(q, claims.Subject),
+		)
+
+		if _, err := tx.ExecContext(ctx, q, claims.Subject); err != nil {
+			return errors.Wrap(err, "removing two-factor enrollment")
+		}
+	}
+
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionDelete,
+		EntityType: "two_factor",
+		EntityID:   claims.Subject,
+		Before:     enrollmentEvent{Confirmed: true},
+	}
+	if err := audit.Record(ctx, u.log, tx, traceID, ne, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing removal")
+	}
+
+	return nil
+}
+
+// RequireTwoFactor sets whether users need to authenticate with a second
+// factor to get the specified role in their claims. Only roles with settings
+// exist, requiring a second factor for any other role is an ErrNotFound.
+func (u User) RequireTwoFactor(ctx context.Context, traceID string, claims auth.Claims, role string, rt RoleTwoFactor, now time.Time) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.requiretwofactor")
+	defer span.End()
+
+	tx, err := u.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	q := `
+	SELECT
+		require_2fa
+	FROM
+		role_settings
+	WHERE
+		role = $1
+	FOR UPDATE`
+
+	u.log.Printf("%s: %s: %s", traceID, "user.RequireTwoFactor",
+		database.Log(q, role),
+	)
+
+	var prev RoleTwoFactor
+	if err := tx.GetContext(ctx, &prev.Required, q, role); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return errors.Wrapf(err, "selecting settings of role %s", role)
+	}
+
+	q = `
+	UPDATE
+		role_settings
+	SET
+		"require_2fa" = $2,
+		"date_updated" = $3
+	WHERE
+		role = $1`
+
+	u.log.Printf("%s: %s: %s", traceID, "user.RequireTwoFactor",
+		database.Log(q, role, rt.Required, now.UTC()),
+	)
+
+	if _, err := tx.ExecContext(ctx, q, role, rt.Required, now.UTC()); err != nil {
+		return errors.Wrapf(err, "updating settings of role %s", role)
+	}
+
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionUpdate,
+		EntityType: "role_settings",
+		EntityID:   role,
+		Before:     prev,
+		After:      rt,
+	}
+	if err := audit.Record(ctx, u.log, tx, traceID, ne, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing role settings")
+	}
+
+	return nil
+}
+
+// queryTOTP gets the authenticator app secret of the user.
+func (u User) queryTOTP(ctx context.Context, traceID string, db sqlx.QueryerContext, userID string) (totpInfo, error) {
+	const q = `
+	SELECT
+		*
+	FROM
+		user_totp
+	WHERE
+		user_id = $1`
+
+	u.log.Printf("%s: %s: %s", traceID, "user.queryTOTP",
+		database.Log(q, userID),
+	)
+
+	var t totpInfo
+	if err := sqlx.GetContext(ctx, db, &t, q, userID); err != nil {
+		if err == sql.ErrNoRows {
+			return totpInfo{}, ErrNotEnrolled
+		}
+		return totpInfo{}, errors.Wrapf(err, "selecting totp secret of user %q", userID)
+	}
+
+	if err := u.openSecret(&t); err != nil {
+		return totpInfo{}, err
+	}
+
+	return t, nil
+}
+
+// verifySecondFactor checks a code from an authenticator app or a recovery
+// code for a user with a confirmed enrollment. Codes are accepted only once.
+// It returns the authentication method the code represents.
+func (u User) verifySecondFactor(ctx context.Context, traceID string, userID string, code string, now time.Time) (string, error) {
+	t, err := u.queryTOTP(ctx, traceID, u.db, userID)
+	if err != nil {
+		return "", err
+	}
+	if !t.DateConfirmed.Valid {
+		return "", ErrNotEnrolled
+	}
+
+	if step, ok := totp.Validate(t.Secret, code, now); ok {
+
+		// Only a code newer than the last one accepted can be used, so a code
+		// can't be replayed while it is still valid.
+		const q = `
+		UPDATE
+			user_totp
+		SET
+			"last_step" = $2
+		WHERE
+			user_id = $1 AND last_step < $2`
+
+		u.log.Printf("%s: %s: %s", traceID, "user.verifySecondFactor",
+			database.Log(q, userID, step),
+		)
+
+		res, err := u.db.ExecContext(ctx, q, userID, step)
+		if err != nil {
+			return "", errors.Wrap(err, "recording totp code")
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return "", ErrInvalidCode
+		}
+
+		return auth.MethodOTP, nil
+	}
+
+	const q = `
+	UPDATE
+		recovery_codes
+	SET
+		"date_used" = $3
+	WHERE
+		code_hash = $1 AND user_id = $2 AND date_used IS NULL`
+
+	hash := hashRecoveryCode(code)
+
+	u.log.Printf("%s: %s: %s", traceID, "user.verifySecondFactor",
+		database.Log(q, hash, userID, now.UTC()),
+	)
+
+	res, err := u.db.ExecContext(ctx, q, hash, userID, now.UTC())
+	if err != nil {
+		return "", errors.Wrap(err, "using recovery code")
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return "", ErrInvalidCode
+	}
+
+	return auth.MethodRecoveryCode, nil
+}
+
+// rolesRequiringTwoFactor returns the roles users only get after
+// authenticating with a second factor.
+func (u User) rolesRequiringTwoFactor(ctx context.Context, traceID string) (map[string]bool, error) {
+	const q = `
+	SELECT
+		role
+	FROM
+		role_settings
+	WHERE
+		require_2fa`
+
+	u.log.Printf("%s: %s: %s", traceID, "user.rolesRequiringTwoFactor",
+		database.Log(q),
+	)
+
+	var roles []string
+	if err := u.db.SelectContext(ctx, &roles, q); err != nil {
+		return nil, errors.Wrap(err, "selecting role settings")
+	}
+
+	required := make(map[string]bool, len(roles))
+	for _, role := range roles {
+		required[role] = true
+	}
+
+	return required, nil
+}
@@ -11,17 +11,23 @@ import (
 	"time"
 
 	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/audit"
 	"github.com/appinesshq/bpi/foundation/database"
+	"github.com/appinesshq/bpi/foundation/envelope"
+	"github.com/appinesshq/bpi/foundation/passwd"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 	"go.opentelemetry.io/otel/api/trace"
-	"golang.org/x/crypto/bcrypt"
 )
 
 var Issuer = "MB Appiness Solutions"
 
+// VerificationTTL is how long an email verification link remains valid.
+var VerificationTTL = 24 * time.Hour
+
 var (
 	// ErrNotFound is used when a specific User is requested but does not exist.
 	ErrNotFound = errors.New("not found")
@@ -33,17 +39,26 @@ var (
 	// anything goes wrong.
 	ErrAuthenticationFailure = errors.New("authentication failed")
 
+	// ErrNotVerified occurs when a user authenticates with valid credentials
+	// before verifying their email address.
+	ErrNotVerified = errors.New("email address has not been verified")
+
+	// ErrEmailExists occurs when a user is created, updated or restored with
+	// an email address that is already in use by another active user.
+	ErrEmailExists = errors.New("email address is already in use")
+
 	// ErrForbidden occurs when a user tries to do something that is forbidden to them according to our access control policies.
 	ErrForbidden = errors.New("attempted action is not allowed")
 
-	// PasswordSalt is the salt value which will be addedd to passwords during the hashing process for extra security.
-	PasswordSalt = "joireu98ytu98grHROIHGWJREOIJOIJroJ5Y09JRATHJOIHJj5y09aeoirjroiejjrtjhJROIJIJyjHJroisjh509e5e0jte0jhreoijtkjrtrej9yg"
-
 	// EmailSalt is the salt value which will be addedd to emails during the hashing process for extra security.
 	// Emails are hashed for GDPR compliance.
 	EmailSalt = "nbkjvnKJNBKJNFNKFbnkfnte80bnfdb5e5090hetaoijknbnjvNKSFBfnkjneinF8I*H$%IHIGRiuhgIUNGEibus8b8s9rnbnrwengiubi4w9898U8H"
 )
 
+// sensitive lists the fields of users recorded in the audit log without
+// their values, so the log doesn't hold email addresses in the clear.
+var sensitive = []string{"email"}
+
 // HashEmail hashes the provided email address for GDPR compliance.
 func hashEmail(email string) string {
 	sum := sha256.Sum256([]byte(email+EmailSalt))
@@ -52,51 +67,180 @@ func hashEmail(email string) string {
 
 // User manages the set of API's for user access.
 type User struct {
-	log *log.Logger
-	db  *sqlx.DB
+	log       *log.Logger
+	db        *sqlx.DB
+	passwords *passwd.Hasher
+	emails    *envelope.Keyring
+	policy    *auth.Policy
 }
 
-// New constructs a User for api access.
-func New(log *log.Logger, db *sqlx.DB) User {
+// New constructs a User for api access. Passwords are hashed and verified
+// with the provided hasher, email addresses are encrypted with keys from the
+// keyring. The policy decides which actions the claims passed to its methods
+// allow.
+func New(log *log.Logger, db *sqlx.DB, passwords *passwd.Hasher, emails *envelope.Keyring, policy *auth.Policy) User {
 	return User{
-		log: log,
-		db:  db,
+		log:       log,
+		db:        db,
+		passwords: passwords,
+		emails:    emails,
+		policy:    policy,
 	}
 }
 
-// Create inserts a new user into the database.
-func (u User) Create(ctx context.Context, traceID string, nu NewUser, now time.Time) (Info, error) {
+// Create inserts a new user into the database on behalf of the user in the
+// claims. Users created this way are considered verified.
+func (u User) Create(ctx context.Context, traceID string, claims auth.Claims, nu NewUser, now time.Time) (Info, error) {
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "internal.data.user.create")
 	defer span.End()
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(nu.Password+PasswordSalt), bcrypt.DefaultCost)
+	return u.insert(ctx, traceID, claims.Subject, uuid.New().String(), nu.Email, nu.Password, nu.Roles, true, now)
+}
+
+// Signup inserts a new user with the USER role into the database. The user
+// can't authenticate until their email address has been verified.
+func (u User) Signup(ctx context.Context, traceID string, ns NewSignup, now time.Time) (Info, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.signup")
+	defer span.End()
+
+	// Users signing up create themselves.
+	userID := uuid.New().String()
+	return u.insert(ctx, traceID, userID, userID, ns.Email, ns.Password, []string{auth.RoleUser}, false, now)
+}
+
+// insert stores a new user in the database, recording the actor creating
+// them in the audit log.
+func (u User) insert(ctx context.Context, traceID string, actorID string, userID string, email string, password string, roles []string, verified bool, now time.Time) (Info, error) {
+	hash, err := u.passwords.Hash(password)
 	if err != nil {
 		return Info{}, errors.Wrap(err, "generating password hash")
 	}
 
 	usr := Info{
-		ID:           uuid.New().String(),
-		Email:        hashEmail(nu.Email),
+		ID:           userID,
 		PasswordHash: hash,
-		Roles:        nu.Roles,
+		Roles:        roles,
 		DateCreated:  now.UTC(),
 		DateUpdated:  now.UTC(),
+		Verified:     verified,
+	}
+	if err := u.sealEmail(&usr, email); err != nil {
+		return Info{}, err
 	}
 
 	const q = `
 	INSERT INTO users
-		(user_id, email, password_hash, roles, date_created, date_updated)
+		(user_id, email, email_key_id, email_key, email_ciphertext, password_hash, roles, date_created, date_updated, verified)
 	VALUES
-		($1, $2, $3, $4, $5, $6)`
+		($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
 
 	u.log.Printf("%s: %s: %s", traceID, "user.Create",
-		database.Log(q, usr.ID, usr.Email, usr.PasswordHash, usr.Roles, usr.DateCreated, usr.DateUpdated),
+		database.Log(q, usr.ID, usr.EmailHash, usr.EmailKeyID, usr.EmailKey, usr.EmailCiphertext, usr.PasswordHash, usr.Roles, usr.DateCreated, usr.DateUpdated, usr.Verified),
 	)
 
-	if _, err = u.db.ExecContext(ctx, q, usr.ID, usr.Email, usr.PasswordHash, usr.Roles, usr.DateCreated, usr.DateUpdated); err != nil {
+	tx, err := u.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return Info{}, errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, q, usr.ID, usr.EmailHash, usr.EmailKeyID, usr.EmailKey, usr.EmailCiphertext, usr.PasswordHash, usr.Roles, usr.DateCreated, usr.DateUpdated, usr.Verified); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			return Info{}, ErrEmailExists
+		}
 		return Info{}, errors.Wrap(err, "inserting user")
 	}
 
+	ne := audit.NewEvent{
+		ActorID:    actorID,
+		Action:     audit.ActionCreate,
+		EntityType: "user",
+		EntityID:   usr.ID,
+		After:      usr,
+		Sensitive:  sensitive,
+	}
+	if err := audit.Record(ctx, u.log, tx, traceID, ne, now); err != nil {
+		return Info{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Info{}, errors.Wrap(err, "committing user")
+	}
+
+	return usr, nil
+}
+
+// Verify marks the email address of the specified user as verified.
+func (u User) Verify(ctx context.Context, traceID string, userID string, now time.Time) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.verify")
+	defer span.End()
+
+	if _, err := uuid.Parse(userID); err != nil {
+		return ErrInvalidID
+	}
+
+	const q = `
+	UPDATE
+		users
+	SET
+		"verified" = TRUE,
+		"date_updated" = $2
+	WHERE
+		user_id = $1`
+
+	u.log.Printf("%s: %s: %s", traceID, "user.Verify",
+		database.Log(q, userID, now.UTC()),
+	)
+
+	res, err := u.db.ExecContext(ctx, q, userID, now.UTC())
+	if err != nil {
+		return errors.Wrapf(err, "verifying user %s", userID)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrapf(err, "verifying user %s", userID)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// QueryUnverified gets the user with the specified email address as long as
+// the address still needs to be verified, so the verification mail can be
+// sent again. It returns ErrNotFound for unknown and verified addresses alike.
+func (u User) QueryUnverified(ctx context.Context, traceID string, rv ResendVerification) (Info, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.queryunverified")
+	defer span.End()
+
+	email := hashEmail(rv.Email)
+
+	const q = `
+	SELECT
+		*
+	FROM
+		users
+	WHERE
+		email = $1 AND verified = FALSE AND deleted_at IS NULL`
+
+	u.log.Printf("%s: %s: %s", traceID, "user.QueryUnverified",
+		database.Log(q, email),
+	)
+
+	var usr Info
+	if err := u.db.GetContext(ctx, &usr, q, email); err != nil {
+		if err == sql.ErrNoRows {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, errors.Wrapf(err, "selecting user %q", email)
+	}
+
+	if err := u.openEmail(&usr); err != nil {
+		return Info{}, err
+	}
+
 	return usr, nil
 }
 
@@ -110,14 +254,17 @@ func (u User) Update(ctx context.Context, traceID string, claims auth.Claims, us
 		return err
 	}
 
+	before := usr
 	if uu.Email != nil {
-		usr.Email = hashEmail(*uu.Email)
+		if err := u.sealEmail(&usr, *uu.Email); err != nil {
+			return err
+		}
 	}
 	if uu.Roles != nil {
 		usr.Roles = uu.Roles
 	}
 	if uu.Password != nil {
-		pw, err := bcrypt.GenerateFromPassword([]byte(*uu.Password), bcrypt.DefaultCost)
+		pw, err := u.passwords.Hash(*uu.Password)
 		if err != nil {
 			return errors.Wrap(err, "generating password hash")
 		}
@@ -130,49 +277,228 @@ func (u User) Update(ctx context.Context, traceID string, claims auth.Claims, us
 		users
 	SET 
 		"email" = $2,
-		"roles" = $3,
-		"password_hash" = $4,
-		"date_updated" = $5
+		"email_key_id" = $3,
+		"email_key" = $4,
+		"email_ciphertext" = $5,
+		"roles" = $6,
+		"password_hash" = $7,
+		"date_updated" = $8
 	WHERE
 		user_id = $1`
 
 	u.log.Printf("%s: %s: %s", traceID, "user.Update",
-		database.Log(q, usr.ID, usr.Email, usr.Roles, usr.PasswordHash, usr.DateCreated, usr.DateUpdated),
+		database.Log(q, usr.ID, usr.EmailHash, usr.EmailKeyID, usr.EmailKey, usr.EmailCiphertext, usr.Roles, usr.PasswordHash, usr.DateUpdated),
 	)
 
-	if _, err = u.db.ExecContext(ctx, q, userID, usr.Email, usr.Roles, usr.PasswordHash, usr.DateUpdated); err != nil {
+	tx, err := u.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, q, usr.ID, usr.EmailHash, usr.EmailKeyID, usr.EmailKey, usr.EmailCiphertext, usr.Roles, usr.PasswordHash, usr.DateUpdated); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			return ErrEmailExists
+		}
 		return errors.Wrap(err, "updating user")
 	}
 
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionUpdate,
+		EntityType: "user",
+		EntityID:   usr.ID,
+		Before:     before,
+		After:      usr,
+		Sensitive:  sensitive,
+	}
+	if err := audit.Record(ctx, u.log, tx, traceID, ne, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing user")
+	}
+
 	return nil
 }
 
-// Delete removes a user from the database.
-func (u User) Delete(ctx context.Context, traceID string, userID string) error {
+// Delete marks a user as deleted. Deleted users can't sign in and are left
+// out of queries, until they are restored or purged. Their email address is
+// released and can be used to sign up again. Deleting a user that does not
+// exist is not an error.
+func (u User) Delete(ctx context.Context, traceID string, claims auth.Claims, userID string, now time.Time) error {
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.delete")
 	defer span.End()
 
-	if _, err := uuid.Parse(userID); err != nil {
-		return ErrInvalidID
+	usr, err := u.QueryByID(ctx, traceID, claims, userID)
+	if err != nil {
+		if err == ErrNotFound {
+			return nil
+		}
+		return err
 	}
 
 	const q = `
-	DELETE FROM
+	UPDATE
 		users
+	SET
+		"deleted_at" = $2
 	WHERE
-		user_id = $1`
+		user_id = $1 AND deleted_at IS NULL`
+
+	deleted := now.UTC()
 
 	u.log.Printf("%s: %s: %s", traceID, "user.Delete",
+		database.Log(q, usr.ID, deleted),
+	)
+
+	tx, err := u.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, q, usr.ID, deleted); err != nil {
+		return errors.Wrapf(err, "deleting user %s", usr.ID)
+	}
+
+	after := usr
+	after.DeletedAt = &deleted
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionDelete,
+		EntityType: "user",
+		EntityID:   usr.ID,
+		Before:     usr,
+		After:      after,
+		Sensitive:  sensitive,
+	}
+	if err := audit.Record(ctx, u.log, tx, traceID, ne, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing user")
+	}
+
+	return nil
+}
+
+// Restore undoes the deletion of a user. It fails with ErrEmailExists when
+// the email address has been taken by another user in the meantime.
+func (u User) Restore(ctx context.Context, traceID string, claims auth.Claims, userID string, now time.Time) error {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.restore")
+	defer span.End()
+
+	if _, err := uuid.Parse(userID); err != nil {
+		return ErrInvalidID
+	}
+
+	if !u.policy.Allowed(claims, auth.PermissionRecordRestore) {
+		return ErrForbidden
+	}
+
+	tx, err := u.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	q := `
+	SELECT
+		*
+	FROM
+		users
+	WHERE
+		user_id = $1 AND deleted_at IS NOT NULL
+	FOR UPDATE`
+
+	u.log.Printf("%s: %s: %s", traceID, "user.Restore",
 		database.Log(q, userID),
 	)
 
-	if _, err := u.db.ExecContext(ctx, q, userID); err != nil {
-		return errors.Wrapf(err, "deleting user %s", userID)
+	var usr Info
+	if err := tx.GetContext(ctx, &usr, q, userID); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return errors.Wrapf(err, "selecting deleted user %q", userID)
+	}
+
+	q = `
+	UPDATE
+		users
+	SET
+		"deleted_at" = NULL,
+		"date_updated" = $2
+	WHERE
+		user_id = $1`
+
+	u.log.Printf("%s: %s: %s", traceID, "user.Restore",
+		database.Log(q, userID, now.UTC()),
+	)
+
+	if _, err := tx.ExecContext(ctx, q, userID, now.UTC()); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			return ErrEmailExists
+		}
+		return errors.Wrapf(err, "restoring user %s", userID)
+	}
+
+	after := usr
+	after.DeletedAt = nil
+	after.DateUpdated = now.UTC()
+	ne := audit.NewEvent{
+		ActorID:    claims.Subject,
+		Action:     audit.ActionRestore,
+		EntityType: "user",
+		EntityID:   userID,
+		Before:     usr,
+		After:      after,
+		Sensitive:  sensitive,
+	}
+	if err := audit.Record(ctx, u.log, tx, traceID, ne, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing user")
 	}
 
 	return nil
 }
 
+// Purge permanently removes the users deleted before the specified time,
+// along with everything stored about them. It returns the number of users
+// removed.
+func (u User) Purge(ctx context.Context, traceID string, before time.Time) (int, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.purge")
+	defer span.End()
+
+	const q = `
+	DELETE FROM
+		users
+	WHERE
+		deleted_at < $1`
+
+	u.log.Printf("%s: %s: %s", traceID, "user.Purge",
+		database.Log(q, before.UTC()),
+	)
+
+	res, err := u.db.ExecContext(ctx, q, before.UTC())
+	if err != nil {
+		return 0, errors.Wrap(err, "purging users")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "purging users")
+	}
+
+	return int(n), nil
+}
+
 // Query retrieves a list of existing users from the database.
 func (u User) Query(ctx context.Context, traceID string, pageNumber int, rowsPerPage int) ([]Info, error) {
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.query")
@@ -183,6 +509,8 @@ func (u User) Query(ctx context.Context, traceID string, pageNumber int, rowsPer
 		*
 	FROM
 		users
+	WHERE
+		deleted_at IS NULL
 	ORDER BY
 		user_id
 	OFFSET $1 ROWS FETCH NEXT $2 ROWS ONLY`
@@ -198,6 +526,12 @@ func (u User) Query(ctx context.Context, traceID string, pageNumber int, rowsPer
 		return nil, errors.Wrap(err, "selecting users")
 	}
 
+	for i := range users {
+		if err := u.openEmail(&users[i]); err != nil {
+			return nil, err
+		}
+	}
+
 	return users, nil
 }
 
@@ -214,8 +548,7 @@ func (u User) QueryByID(ctx context.Context, traceID string, claims auth.Claims,
 		return Info{}, ErrInvalidID
 	}
 
-	// If you are not an admin and looking to retrieve someone other than yourself.
-	if !claims.Authorized(auth.RoleAdmin) && claims.Subject != userID {
+	if !u.policy.AllowedFor(claims, auth.PermissionUserRead, userID) {
 		return Info{}, ErrForbidden
 	}
 
@@ -225,7 +558,7 @@ func (u User) QueryByID(ctx context.Context, traceID string, claims auth.Claims,
 	FROM
 		users
 	WHERE 
-		user_id = $1`
+		user_id = $1 AND deleted_at IS NULL`
 
 	u.log.Printf("%s: %s: %s", traceID, "user.QueryByID",
 		database.Log(q, userID),
@@ -239,6 +572,10 @@ func (u User) QueryByID(ctx context.Context, traceID string, claims auth.Claims,
 		return Info{}, errors.Wrapf(err, "selecting user %q", userID)
 	}
 
+	if err := u.openEmail(&usr); err != nil {
+		return Info{}, err
+	}
+
 	return usr, nil
 }
 
@@ -255,7 +592,7 @@ func (u User) QueryByEmail(ctx context.Context, traceID string, claims auth.Clai
 	FROM
 		users
 	WHERE
-		email = $1`
+		email = $1 AND deleted_at IS NULL`
 
 	u.log.Printf("%s: %s: %s", traceID, "user.QueryByEmail",
 		database.Log(q, email),
@@ -269,18 +606,23 @@ func (u User) QueryByEmail(ctx context.Context, traceID string, claims auth.Clai
 		return Info{}, errors.Wrapf(err, "selecting user %q", email)
 	}
 
-	// If you are not an admin and looking to retrieve someone other than yourself.
-	if !claims.Authorized(auth.RoleAdmin) && claims.Subject != usr.ID {
+	if !u.policy.AllowedFor(claims, auth.PermissionUserRead, usr.ID) {
 		return Info{}, ErrForbidden
 	}
 
+	if err := u.openEmail(&usr); err != nil {
+		return Info{}, err
+	}
+
 	return usr, nil
 }
 
-// Authenticate finds a user by their email and verifies their password. On
-// success it returns a Claims Info representing this user. The claims can be
-// used to generate a token for future authentication.
-func (u User) Authenticate(ctx context.Context, traceID string, now time.Time, email, password string) (auth.Claims, error) {
+// Authenticate finds a user by their email and verifies their password. Users
+// enrolled for two-factor authentication need to provide a code from their
+// authenticator app or a recovery code as well. On success it returns a
+// Claims Info representing this user. The claims can be used to generate a
+// token for future authentication.
+func (u User) Authenticate(ctx context.Context, traceID string, now time.Time, email, password, code string) (auth.Claims, error) {
 	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.authenticate")
 	defer span.End()
 
@@ -292,7 +634,7 @@ func (u User) Authenticate(ctx context.Context, traceID string, now time.Time, e
 	FROM
 		users
 	WHERE
-		email = $1`
+		email = $1 AND deleted_at IS NULL`
 
 	u.log.Printf("%s: %s: %s", traceID, "user.Authenticate",
 		database.Log(q, email),
@@ -310,24 +652,174 @@ func (u User) Authenticate(ctx context.Context, traceID string, now time.Time, e
 		return auth.Claims{}, errors.Wrap(err, "selecting single user")
 	}
 
-	// Compare the provided password with the saved hash. Use the bcrypt
-	// comparison function so it is cryptographically secure.
-	if err := bcrypt.CompareHashAndPassword(usr.PasswordHash, []byte(password+PasswordSalt)); err != nil {
-		return auth.Claims{}, ErrAuthenticationFailure
+	// Compare the provided password with the saved hash. The hasher uses a
+	// comparison function that is cryptographically secure.
+	rehash, err := u.passwords.Verify(usr.PasswordHash, password)
+	if err != nil {
+		if err == passwd.ErrMismatch {
+			return auth.Claims{}, ErrAuthenticationFailure
+		}
+		return auth.Claims{}, errors.Wrap(err, "verifying password")
+	}
+
+	// The hash was created with an outdated algorithm or cost. Now that the
+	// password is known it can be upgraded. Failing to do so must not prevent
+	// the user from logging in, the next login will try again.
+	if rehash {
+		if err := u.rehash(ctx, traceID, usr.ID, password, now); err != nil {
+			u.log.Printf("%s: %s: rehashing password of user %s: %v", traceID, "user.Authenticate", usr.ID, err)
+		}
+	}
+
+	// The credentials are valid but the user has to prove they own the email
+	// address first.
+	if !usr.Verified {
+		return auth.Claims{}, ErrNotVerified
+	}
+
+	amr, err := u.secondFactor(ctx, traceID, usr.ID, code, []string{auth.MethodPassword}, now)
+	if err != nil {
+		return auth.Claims{}, err
 	}
 
 	// If we are this far the request is valid. Create some claims for the user
 	// and generate their token.
+	return u.newClaims(ctx, traceID, usr, amr, now)
+}
+
+// secondFactor checks the code of a user enrolled for two-factor
+// authentication and returns amr with the methods the code represents added.
+// Users who aren't enrolled don't need a code.
+func (u User) secondFactor(ctx context.Context, traceID string, userID string, code string, amr []string, now time.Time) ([]string, error) {
+	method, err := u.verifySecondFactor(ctx, traceID, userID, code, now)
+	switch {
+	case err == ErrNotEnrolled:
+		return amr, nil
+	case err == ErrInvalidCode && code == "":
+		return nil, ErrSecondFactorRequired
+	case err == ErrInvalidCode:
+		return nil, ErrAuthenticationFailure
+	case err != nil:
+		return nil, err
+	}
+
+	return append(amr, method, auth.MethodMFA), nil
+}
+
+// rehash replaces the password hash of the user with one created by the
+// current algorithm and cost.
+func (u User) rehash(ctx context.Context, traceID string, userID string, password string, now time.Time) error {
+	hash, err := u.passwords.Hash(password)
+	if err != nil {
+		return errors.Wrap(err, "generating password hash")
+	}
+
+	const q = `
+	UPDATE
+		users
+	SET
+		"password_hash" = $2,
+		"date_updated" = $3
+	WHERE
+		user_id = $1`
+
+	u.log.Printf("%s: %s: %s", traceID, "user.rehash",
+		database.Log(q, userID, hash, now.UTC()),
+	)
+
+	if _, err := u.db.ExecContext(ctx, q, userID, hash, now.UTC()); err != nil {
+		return errors.Wrapf(err, "updating password hash of user %s", userID)
+	}
+
+	return nil
+}
+
+// Claims returns a fresh set of claims for the specified user without
+// verifying any credentials. Callers must have established the identity of
+// the user by other means, such as a valid refresh token, and provide the
+// methods (amr) that were used to do so.
+func (u User) Claims(ctx context.Context, traceID string, now time.Time, userID string, amr []string) (auth.Claims, error) {
+	ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.data.user.claims")
+	defer span.End()
+
+	if _, err := uuid.Parse(userID); err != nil {
+		return auth.Claims{}, ErrInvalidID
+	}
+
+	const q = `
+	SELECT
+		*
+	FROM
+		users
+	WHERE
+		user_id = $1 AND deleted_at IS NULL`
+
+	u.log.Printf("%s: %s: %s", traceID, "user.Claims",
+		database.Log(q, userID),
+	)
+
+	var usr Info
+	if err := u.db.GetContext(ctx, &usr, q, userID); err != nil {
+		if err == sql.ErrNoRows {
+			return auth.Claims{}, ErrNotFound
+		}
+		return auth.Claims{}, errors.Wrapf(err, "selecting user %q", userID)
+	}
+
+	return u.newClaims(ctx, traceID, usr, amr, now)
+}
+
+// newClaims constructs the claims for an authenticated user. Roles that
+// require a second factor are left out unless one was used, so users can
+// still log in to enroll.
+func (u User) newClaims(ctx context.Context, traceID string, usr Info, amr []string, now time.Time) (auth.Claims, error) {
+	mfa := false
+	for _, method := range amr {
+		if method == auth.MethodMFA {
+			mfa = true
+		}
+	}
+
+	roles := []string(usr.Roles)
+	if !mfa {
+		required, err := u.rolesRequiringTwoFactor(ctx, traceID)
+		if err != nil {
+			return auth.Claims{}, err
+		}
+
+		roles = nil
+		for _, role := range usr.Roles {
+			if !required[role] {
+				roles = append(roles, role)
+			}
+		}
+	}
+
 	claims := auth.Claims{
 		StandardClaims: jwt.StandardClaims{
 			Issuer:    Issuer,
 			Subject:   usr.ID,
-			Audience:  "users",
+			Audience:  auth.AudienceUsers,
 			ExpiresAt: now.Add(time.Hour).Unix(),
 			IssuedAt:  now.Unix(),
 		},
-		Roles: usr.Roles,
+		Roles: roles,
+		AMR:   amr,
 	}
 
 	return claims, nil
 }
+
+// VerificationClaims constructs the claims for a token verifying the email
+// address of the user. The token can't be used as an access token.
+func VerificationClaims(usr Info, now time.Time) auth.Claims {
+	return auth.Claims{
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    Issuer,
+			Subject:   usr.ID,
+			Audience:  auth.AudienceVerifyEmail,
+			ExpiresAt: now.Add(VerificationTTL).Unix(),
+			IssuedAt:  now.Unix(),
+		},
+	}
+}
@@ -1,23 +1,29 @@
 package user_test
 
 import (
+	"encoding/base64"
 	"testing"
 	"time"
 
 	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/audit"
 	"github.com/appinesshq/bpi/business/data/schema"
 	"github.com/appinesshq/bpi/business/data/user"
 	"github.com/appinesshq/bpi/business/tests"
+	"github.com/appinesshq/bpi/foundation/envelope"
+	"github.com/appinesshq/bpi/foundation/passwd"
+	"github.com/appinesshq/bpi/foundation/totp"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/google/go-cmp/cmp"
 	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestUser(t *testing.T) {
 	log, db, teardown := tests.NewUnit(t)
 	t.Cleanup(teardown)
 
-	u := user.New(log, db)
+	u := user.New(log, db, tests.Passwords(), tests.Emails(), tests.Policy())
 
 	t.Log("Given the need to work with User records.")
 	{
@@ -35,7 +41,7 @@ func TestUser(t *testing.T) {
 				PasswordConfirm: "gophers",
 			}
 
-			usr, err := u.Create(ctx, traceID, nu, now)
+			usr, err := u.Create(ctx, traceID, auth.Claims{}, nu, now)
 			if err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to create user : %s.", tests.Failed, testID, err)
 			}
@@ -88,15 +94,33 @@ func TestUser(t *testing.T) {
 			}
 			t.Logf("\t%s\tTest %d:\tShould be able to retrieve user by Email.", tests.Success, testID)
 
-			if saved.Email != "8e399820c133d2bc35bd94b30610e02e2891f5053a430b74fa32bf41f1de1d57" {
+			if saved.Email != *upd.Email {
 				t.Errorf("\t%s\tTest %d:\tShould be able to see updates to Email.", tests.Failed, testID)
 				t.Logf("\t\tTest %d:\tGot: %v", testID, saved.Email)
-				t.Logf("\t\tTest %d:\tExp: %v", testID, "8e399820c133d2bc35bd94b30610e02e2891f5053a430b74fa32bf41f1de1d57")
+				t.Logf("\t\tTest %d:\tExp: %v", testID, *upd.Email)
 			} else {
 				t.Logf("\t%s\tTest %d:\tShould be able to see updates to Email.", tests.Success, testID)
 			}
 
-			if err := u.Delete(ctx, traceID, usr.ID); err != nil {
+			nu2 := user.NewUser{
+				Email:           "jane@example.com",
+				Roles:           []string{auth.RoleUser},
+				Password:        "gophers",
+				PasswordConfirm: "gophers",
+			}
+			if _, err := u.Create(ctx, traceID, auth.Claims{}, nu2, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a second user : %s.", tests.Failed, testID, err)
+			}
+
+			taken := user.UpdateUser{
+				Email: tests.StringPointer(nu2.Email),
+			}
+			if err := u.Update(ctx, traceID, claims, usr.ID, taken, now); errors.Cause(err) != user.ErrEmailExists {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to take the email of another user : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to take the email of another user.", tests.Success, testID)
+
+			if err := u.Delete(ctx, traceID, claims, usr.ID, now); err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to delete user : %s.", tests.Failed, testID, err)
 			}
 			t.Logf("\t%s\tTest %d:\tShould be able to delete user.", tests.Success, testID)
@@ -106,6 +130,17 @@ func TestUser(t *testing.T) {
 				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to retrieve user : %s.", tests.Failed, testID, err)
 			}
 			t.Logf("\t%s\tTest %d:\tShould NOT be able to retrieve user.", tests.Success, testID)
+
+			nu.Email = *upd.Email
+			if _, err := u.Create(ctx, traceID, auth.Claims{}, nu, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to reuse the email of a deleted user : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to reuse the email of a deleted user.", tests.Success, testID)
+
+			if err := u.Restore(ctx, traceID, claims, usr.ID, now); errors.Cause(err) != user.ErrEmailExists {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to restore a user whose email was taken : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to restore a user whose email was taken.", tests.Success, testID)
 		}
 	}
 }
@@ -116,7 +151,7 @@ func TestUserPaging(t *testing.T) {
 
 	schema.Seed(db)
 
-	u := user.New(log, db)
+	u := user.New(log, db, tests.Passwords(), tests.Emails(), tests.Policy())
 
 	t.Log("Given the need to page through User records.")
 	{
@@ -162,7 +197,7 @@ func TestAuthenticate(t *testing.T) {
 	log, db, teardown := tests.NewUnit(t)
 	t.Cleanup(teardown)
 
-	u := user.New(log, db)
+	u := user.New(log, db, tests.Passwords(), tests.Emails(), tests.Policy())
 
 	t.Log("Given the need to authenticate users")
 	{
@@ -180,13 +215,13 @@ func TestAuthenticate(t *testing.T) {
 				PasswordConfirm: "goroutines",
 			}
 
-			usr, err := u.Create(ctx, traceID, nu, now)
+			usr, err := u.Create(ctx, traceID, auth.Claims{}, nu, now)
 			if err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to create user : %s.", tests.Failed, testID, err)
 			}
 			t.Logf("\t%s\tTest %d:\tShould be able to create user.", tests.Success, testID)
 
-			claims, err := u.Authenticate(ctx, traceID, now, "jane@example.com", "goroutines")
+			claims, err := u.Authenticate(ctx, traceID, now, "jane@example.com", "goroutines", "")
 			if err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to generate claims : %s.", tests.Failed, testID, err)
 			}
@@ -201,6 +236,7 @@ func TestAuthenticate(t *testing.T) {
 					ExpiresAt: now.Add(time.Hour).Unix(),
 					IssuedAt:  now.Unix(),
 				},
+				AMR: []string{auth.MethodPassword},
 			}
 
 			if diff := cmp.Diff(want, claims); diff != "" {
@@ -219,10 +255,564 @@ func TestAuthenticate(t *testing.T) {
 			}
 			t.Logf("\t%s\tTest %d:\tShould get back the same user.", tests.Success, testID)
 
-			if _, err := u.Authenticate(ctx, traceID, now, "jane@example.com", "blahblah"); err == nil {
+			if _, err := u.Authenticate(ctx, traceID, now, "jane@example.com", "blahblah", ""); err == nil {
 				t.Fatalf("\t%s\tTest %d:\tShould not be able to login with a wrong password.", tests.Failed, testID)
 			}
 			t.Logf("\t%s\tTest %d:\tShould not be able to login with a wrong password.", tests.Success, testID)
 		}
 	}
 }
+
+func TestSignup(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	u := user.New(log, db, tests.Passwords(), tests.Emails(), tests.Policy())
+
+	t.Log("Given the need to sign up users")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen signing up a single User.", testID)
+		{
+			ctx := tests.Context()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			ns := user.NewSignup{
+				Email:           "joe@example.com",
+				Password:        "goroutines",
+				PasswordConfirm: "goroutines",
+			}
+
+			usr, err := u.Signup(ctx, traceID, ns, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to sign up : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to sign up.", tests.Success, testID)
+
+			if diff := cmp.Diff([]string{auth.RoleUser}, []string(usr.Roles)); diff != "" || usr.Verified {
+				t.Fatalf("\t%s\tTest %d:\tShould get an unverified user with the USER role only : %+v.", tests.Failed, testID, usr)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get an unverified user with the USER role only.", tests.Success, testID)
+
+			if _, err := u.Signup(ctx, traceID, ns, now); errors.Cause(err) != user.ErrEmailExists {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to sign up twice : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to sign up twice.", tests.Success, testID)
+
+			if _, err := u.Authenticate(ctx, traceID, now, "joe@example.com", "goroutines", ""); errors.Cause(err) != user.ErrNotVerified {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to login before verification : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to login before verification.", tests.Success, testID)
+
+			if err := u.Verify(ctx, traceID, usr.ID, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to verify the user : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to verify the user.", tests.Success, testID)
+
+			if _, err := u.Authenticate(ctx, traceID, now, "joe@example.com", "goroutines", ""); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to login after verification : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to login after verification.", tests.Success, testID)
+		}
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	u := user.New(log, db, tests.Passwords(), tests.Emails(), tests.Policy())
+
+	t.Log("Given the need to reset forgotten passwords")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen resetting the password of a single User.", testID)
+		{
+			ctx := tests.Context()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			nu := user.NewUser{
+				Email:           "jane@example.com",
+				Roles:           []string{auth.RoleUser},
+				Password:        "goroutines",
+				PasswordConfirm: "goroutines",
+			}
+
+			usr, err := u.Create(ctx, traceID, auth.Claims{}, nu, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create user : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create user.", tests.Success, testID)
+
+			if _, err := u.ForgotPassword(ctx, traceID, user.ForgotPassword{Email: "unknown@example.com"}, now); errors.Cause(err) != user.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT get a reset token for an unknown email : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT get a reset token for an unknown email.", tests.Success, testID)
+
+			token, err := u.ForgotPassword(ctx, traceID, user.ForgotPassword{Email: nu.Email}, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to get a reset token : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to get a reset token.", tests.Success, testID)
+
+			rp := user.ResetPassword{
+				Token:           token,
+				Password:        "channels",
+				PasswordConfirm: "channels",
+			}
+
+			if _, err := u.ResetPassword(ctx, traceID, rp, now.Add(user.ResetTTL+time.Second)); errors.Cause(err) != user.ErrInvalidResetToken {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to use an expired reset token : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to use an expired reset token.", tests.Success, testID)
+
+			userID, err := u.ResetPassword(ctx, traceID, rp, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to reset the password : %s.", tests.Failed, testID, err)
+			}
+			if userID != usr.ID {
+				t.Fatalf("\t%s\tTest %d:\tShould reset the password of the user : got %s.", tests.Failed, testID, userID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to reset the password.", tests.Success, testID)
+
+			if _, err := u.ResetPassword(ctx, traceID, rp, now); errors.Cause(err) != user.ErrInvalidResetToken {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to use a reset token twice : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to use a reset token twice.", tests.Success, testID)
+
+			if _, err := u.Authenticate(ctx, traceID, now, nu.Email, "channels", ""); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to login with the new password : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to login with the new password.", tests.Success, testID)
+
+			if _, err := u.Authenticate(ctx, traceID, now, nu.Email, "goroutines", ""); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to login with the old password.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to login with the old password.", tests.Success, testID)
+		}
+	}
+}
+
+func TestPasswordHashing(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	cheap, err := passwd.NewBcrypt(bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := user.New(log, db, passwd.New("pepper", cheap), tests.Emails(), tests.Policy())
+
+	t.Log("Given the need to hash passwords consistently")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen changing the password and the hashing cost.", testID)
+		{
+			ctx := tests.Context()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			nu := user.NewUser{
+				Email:           "jane@example.com",
+				Roles:           []string{auth.RoleUser},
+				Password:        "goroutines",
+				PasswordConfirm: "goroutines",
+			}
+
+			usr, err := u.Create(ctx, traceID, auth.Claims{}, nu, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create user : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create user.", tests.Success, testID)
+
+			claims := auth.Claims{
+				StandardClaims: jwt.StandardClaims{
+					Subject: usr.ID,
+				},
+				Roles: []string{auth.RoleAdmin},
+			}
+
+			upd := user.UpdateUser{
+				Password:        tests.StringPointer("channels"),
+				PasswordConfirm: tests.StringPointer("channels"),
+			}
+
+			if err := u.Update(ctx, traceID, claims, usr.ID, upd, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to update the password : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to update the password.", tests.Success, testID)
+
+			if _, err := u.Authenticate(ctx, traceID, now, nu.Email, "channels", ""); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to login with the updated password : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to login with the updated password.", tests.Success, testID)
+
+			stronger, err := passwd.NewBcrypt(bcrypt.MinCost + 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			u = user.New(log, db, passwd.New("pepper", stronger), tests.Emails(), tests.Policy())
+
+			if _, err := u.Authenticate(ctx, traceID, now, nu.Email, "channels", ""); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to login after the cost changed : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to login after the cost changed.", tests.Success, testID)
+
+			saved, err := u.QueryByID(ctx, traceID, claims, usr.ID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve user by ID : %s.", tests.Failed, testID, err)
+			}
+
+			if cost, err := bcrypt.Cost(saved.PasswordHash); err != nil || cost != bcrypt.MinCost+1 {
+				t.Fatalf("\t%s\tTest %d:\tShould have rehashed the password with the new cost : %d %v.", tests.Failed, testID, cost, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould have rehashed the password with the new cost.", tests.Success, testID)
+		}
+	}
+}
+
+func TestEmailKeyRotation(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	keys := map[string]string{
+		"old": base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef")),
+		"new": base64.StdEncoding.EncodeToString([]byte("fedcba9876543210fedcba9876543210")),
+	}
+	old, err := envelope.Parse("old", map[string]string{"old": keys["old"]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := user.New(log, db, tests.Passwords(), old, tests.Policy())
+
+	t.Log("Given the need to rotate the key email addresses are encrypted with.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen making a new key active and rotating.", testID)
+		{
+			ctx := tests.Context()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			nu := user.NewUser{
+				Email:           "jane@example.com",
+				Roles:           []string{auth.RoleUser},
+				Password:        "goroutines",
+				PasswordConfirm: "goroutines",
+			}
+
+			usr, err := u.Create(ctx, traceID, auth.Claims{}, nu, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create user : %s.", tests.Failed, testID, err)
+			}
+			if usr.EmailKeyID != "old" {
+				t.Fatalf("\t%s\tTest %d:\tShould encrypt the email with the active key : got %q.", tests.Failed, testID, usr.EmailKeyID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould encrypt the email with the active key.", tests.Success, testID)
+
+			both, err := envelope.Parse("new", keys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			u = user.New(log, db, tests.Passwords(), both, tests.Policy())
+
+			n, err := u.RotateEmailKey(ctx, traceID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to rotate the key : %s.", tests.Failed, testID, err)
+			}
+			if n != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould re-encrypt the email of every user : got %d.", tests.Failed, testID, n)
+			}
+			t.Logf("\t%s\tTest %d:\tShould re-encrypt the email of every user.", tests.Success, testID)
+
+			current, err := envelope.Parse("new", map[string]string{"new": keys["new"]})
+			if err != nil {
+				t.Fatal(err)
+			}
+			u = user.New(log, db, tests.Passwords(), current, tests.Policy())
+
+			claims := auth.Claims{
+				StandardClaims: jwt.StandardClaims{
+					Subject: usr.ID,
+				},
+				Roles: []string{auth.RoleUser},
+			}
+
+			saved, err := u.QueryByID(ctx, traceID, claims, usr.ID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve the user without the old key : %s.", tests.Failed, testID, err)
+			}
+			if saved.Email != nu.Email || saved.EmailKeyID != "new" {
+				t.Fatalf("\t%s\tTest %d:\tShould decrypt the email with the new key : got %q with %q.", tests.Failed, testID, saved.Email, saved.EmailKeyID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould decrypt the email with the new key.", tests.Success, testID)
+
+			if _, err := u.Authenticate(ctx, traceID, now, nu.Email, nu.Password, ""); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould still find the user by email : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould still find the user by email.", tests.Success, testID)
+		}
+	}
+}
+
+func TestTwoFactor(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	u := user.New(log, db, tests.Passwords(), tests.Emails(), tests.Policy())
+
+	t.Log("Given the need to protect accounts with a second factor")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen enrolling a single User for two-factor authentication.", testID)
+		{
+			ctx := tests.Context()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			nu := user.NewUser{
+				Email:           "jane@example.com",
+				Roles:           []string{auth.RoleAdmin, auth.RoleUser},
+				Password:        "gophers",
+				PasswordConfirm: "gophers",
+			}
+
+			usr, err := u.Create(ctx, traceID, auth.Claims{}, nu, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create user : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create user.", tests.Success, testID)
+
+			claims, err := u.Authenticate(ctx, traceID, now, nu.Email, nu.Password, "")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to authenticate user : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to authenticate user.", tests.Success, testID)
+
+			e, err := u.EnrollTwoFactor(ctx, traceID, claims, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to enroll : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to enroll.", tests.Success, testID)
+
+			if _, err := u.ConfirmTwoFactor(ctx, traceID, claims, user.SecondFactor{Code: "000000"}, now); errors.Cause(err) != user.ErrInvalidCode {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to confirm with an invalid code : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to confirm with an invalid code.", tests.Success, testID)
+
+			code := otp(t, e.Secret, now)
+			codes, err := u.ConfirmTwoFactor(ctx, traceID, claims, user.SecondFactor{Code: code}, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to confirm : %s.", tests.Failed, testID, err)
+			}
+			if len(codes) != user.RecoveryCodes {
+				t.Fatalf("\t%s\tTest %d:\tShould get %d recovery codes : got %d.", tests.Failed, testID, user.RecoveryCodes, len(codes))
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to confirm.", tests.Success, testID)
+
+			if _, err := u.Authenticate(ctx, traceID, now, nu.Email, nu.Password, ""); errors.Cause(err) != user.ErrSecondFactorRequired {
+				t.Fatalf("\t%s\tTest %d:\tShould require a second factor : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould require a second factor.", tests.Success, testID)
+
+			// The code used to confirm can't be replayed within its period.
+			if _, err := u.Authenticate(ctx, traceID, now, nu.Email, nu.Password, code); errors.Cause(err) != user.ErrAuthenticationFailure {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to replay a code : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to replay a code.", tests.Success, testID)
+
+			later := now.Add(totp.Period)
+			claims, err = u.Authenticate(ctx, traceID, later, nu.Email, nu.Password, otp(t, e.Secret, later))
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to authenticate with a code : %s.", tests.Failed, testID, err)
+			}
+			want := []string{auth.MethodPassword, auth.MethodOTP, auth.MethodMFA}
+			if diff := cmp.Diff(want, claims.AMR); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould record the authentication methods. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to authenticate with a code.", tests.Success, testID)
+
+			if _, err := u.Authenticate(ctx, traceID, later, nu.Email, nu.Password, codes[0]); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to authenticate with a recovery code : %s.", tests.Failed, testID, err)
+			}
+			if _, err := u.Authenticate(ctx, traceID, later, nu.Email, nu.Password, codes[0]); errors.Cause(err) != user.ErrAuthenticationFailure {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to use a recovery code twice : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to use a recovery code once.", tests.Success, testID)
+
+			if err := u.RequireTwoFactor(ctx, traceID, claims, auth.RoleAdmin, user.RoleTwoFactor{Required: true}, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to require 2FA for a role : %s.", tests.Failed, testID, err)
+			}
+			events, err := audit.New(log, db).Query(ctx, traceID, audit.Filter{EntityType: "role_settings", Action: audit.ActionUpdate}, 1, 10)
+			if err != nil || len(events) != 1 || events[0].EntityID != auth.RoleAdmin {
+				t.Fatalf("\t%s\tTest %d:\tShould record requiring 2FA in the audit log : %+v, %v.", tests.Failed, testID, events, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to require 2FA for a role.", tests.Success, testID)
+
+			if err := u.RequireTwoFactor(ctx, traceID, claims, "UNKNOWN", user.RoleTwoFactor{Required: true}, now); errors.Cause(err) != user.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to require 2FA for an unknown role : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to require 2FA for an unknown role.", tests.Success, testID)
+
+			claims, err = u.Claims(ctx, traceID, now, usr.ID, []string{auth.MethodPassword})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to get claims : %s.", tests.Failed, testID, err)
+			}
+			if claims.Authorized(auth.RoleAdmin) {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT grant a role requiring 2FA without a second factor.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT grant a role requiring 2FA without a second factor.", tests.Success, testID)
+
+			claims, err = u.Claims(ctx, traceID, now, usr.ID, want)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to get claims : %s.", tests.Failed, testID, err)
+			}
+			if !claims.Authorized(auth.RoleAdmin) {
+				t.Fatalf("\t%s\tTest %d:\tShould grant a role requiring 2FA with a second factor.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould grant a role requiring 2FA with a second factor.", tests.Success, testID)
+
+			later = later.Add(totp.Period)
+			password := claims
+			password.AMR = []string{auth.MethodPassword}
+			if err := u.DisableTwoFactor(ctx, traceID, password, user.SecondFactor{Code: otp(t, e.Secret, later)}, later); errors.Cause(err) != user.ErrSecondFactorSession {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to disable 2FA without signing in with it : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT be able to disable 2FA without signing in with it.", tests.Success, testID)
+
+			if err := u.DisableTwoFactor(ctx, traceID, claims, user.SecondFactor{Code: otp(t, e.Secret, later)}, later); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to disable 2FA : %s.", tests.Failed, testID, err)
+			}
+			if _, err := u.Authenticate(ctx, traceID, later, nu.Email, nu.Password, ""); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to authenticate without a code : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to disable 2FA.", tests.Success, testID)
+		}
+	}
+}
+
+// otp generates the code an authenticator app would show at the given time.
+func otp(t *testing.T, secret string, at time.Time) string {
+	code, err := totp.Code(secret, totp.Step(at))
+	if err != nil {
+		t.Fatalf("generating totp code : %s", err)
+	}
+	return code
+}
+
+func TestIdentity(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	if err := schema.Seed(db); err != nil {
+		t.Fatalf("Couldn't seed database: %v", err)
+	}
+
+	u := user.New(log, db, tests.Passwords(), tests.Emails(), tests.Policy())
+
+	t.Log("Given the need to sign in users with OpenID providers.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen linking accounts at a provider to users.", testID)
+		{
+			ctx := tests.Context()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+			traceID := "00000000-0000-0000-0000-000000000000"
+
+			fl := user.FederatedLogin{
+				State:    "state",
+				Provider: "google",
+				Nonce:    "nonce",
+				Verifier: "verifier",
+			}
+			if err := u.StartFederatedLogin(ctx, traceID, fl, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to start a login : %s.", tests.Failed, testID, err)
+			}
+			got, err := u.CompleteFederatedLogin(ctx, traceID, "google", "state", now)
+			if err != nil || got.Nonce != fl.Nonce || got.Verifier != fl.Verifier {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to complete the login : %v.", tests.Failed, testID, err)
+			}
+			if _, err := u.CompleteFederatedLogin(ctx, traceID, "google", "state", now); errors.Cause(err) != user.ErrInvalidLoginState {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to complete a login twice : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to complete a login once.", tests.Success, testID)
+
+			ni := user.NewIdentity{
+				Provider: "google",
+				Subject:  "1234567890",
+				Email:    "user@example.com",
+			}
+			if _, err := u.AuthenticateIdentity(ctx, traceID, now, ni, ""); errors.Cause(err) != user.ErrNotVerified {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT trust an unverified email address : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT trust an unverified email address.", tests.Success, testID)
+
+			ni.EmailVerified = true
+			if _, err := u.AuthenticateIdentity(ctx, traceID, now, ni, ""); errors.Cause(err) != user.ErrIdentityNotLinked {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT link the account to the user with the same email : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT link the account to the user with the same email.", tests.Success, testID)
+
+			if err := u.LinkIdentity(ctx, traceID, tests.UserID, ni, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to link the account : %s.", tests.Failed, testID, err)
+			}
+			if err := u.LinkIdentity(ctx, traceID, tests.AdminID, ni, now); errors.Cause(err) != user.ErrIdentityExists {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT be able to link the account twice : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to link the account once.", tests.Success, testID)
+
+			claims, err := u.AuthenticateIdentity(ctx, traceID, now, ni, "")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to sign in : %s.", tests.Failed, testID, err)
+			}
+			if claims.Subject != tests.UserID {
+				t.Fatalf("\t%s\tTest %d:\tShould sign in as the linked user : got %s.", tests.Failed, testID, claims.Subject)
+			}
+			t.Logf("\t%s\tTest %d:\tShould sign in as the linked user.", tests.Success, testID)
+
+			e, err := u.EnrollTwoFactor(ctx, traceID, claims, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to enroll for 2FA : %s.", tests.Failed, testID, err)
+			}
+			if _, err := u.ConfirmTwoFactor(ctx, traceID, claims, user.SecondFactor{Code: otp(t, e.Secret, now)}, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to confirm 2FA : %s.", tests.Failed, testID, err)
+			}
+			if _, err := u.AuthenticateIdentity(ctx, traceID, now, ni, ""); errors.Cause(err) != user.ErrSecondFactorRequired {
+				t.Fatalf("\t%s\tTest %d:\tShould require a second factor for an enrolled user : %v.", tests.Failed, testID, err)
+			}
+			later := now.Add(totp.Period)
+			claims, err = u.AuthenticateIdentity(ctx, traceID, later, ni, otp(t, e.Secret, later))
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to sign in with a second factor : %s.", tests.Failed, testID, err)
+			}
+			want := []string{auth.MethodFederated, auth.MethodOTP, auth.MethodMFA}
+			if diff := cmp.Diff(want, claims.AMR); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould record the authentication methods. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould require a second factor for an enrolled user.", tests.Success, testID)
+
+			ids, err := u.QueryIdentities(ctx, traceID, claims, "me")
+			if err != nil || len(ids) != 1 || ids[0].Subject != ni.Subject {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to list the linked accounts : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to list the linked accounts.", tests.Success, testID)
+
+			ni = user.NewIdentity{
+				Provider:      "google",
+				Subject:       "0987654321",
+				Email:         "new@example.com",
+				EmailVerified: true,
+			}
+			claims, err = u.AuthenticateIdentity(ctx, traceID, now, ni, "")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to sign up : %s.", tests.Failed, testID, err)
+			}
+			if claims.Subject == tests.UserID || !claims.Authorized(auth.RoleUser) {
+				t.Fatalf("\t%s\tTest %d:\tShould create a new user : %+v.", tests.Failed, testID, claims)
+			}
+			t.Logf("\t%s\tTest %d:\tShould create a new user for an unknown email.", tests.Success, testID)
+		}
+	}
+}
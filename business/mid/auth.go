@@ -12,8 +12,11 @@ import (
 	"go.opentelemetry.io/otel/api/trace"
 )
 
-// Authenticate validates a JWT from the `Authorization` header.
-func Authenticate(a *auth.Auth) web.Middleware {
+// Authenticate validates a JWT from the `Authorization` header. Tokens carrying
+// an id (jti) are rejected when the revoked lookup reports them as revoked.
+// When an API key lookup is provided, an API key is accepted as well, either
+// from the `X-API-Key` header or as `Authorization: ApiKey <key>`.
+func Authenticate(a *auth.Auth, revoked auth.RevocationLookup, keys auth.APIKeyLookup) web.Middleware {
 
 	// This is the actual middleware function to be executed.
 	m := func(handler web.Handler) web.Handler {
@@ -23,22 +26,63 @@ func Authenticate(a *auth.Auth) web.Middleware {
 			ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.mid.authenticate")
 			defer span.End()
 
-			// Expecting: bearer <token>
+			// If the context is missing this value, request the service
+			// to be shutdown gracefully.
+			v, ok := ctx.Value(web.KeyValues).(*web.Values)
+			if !ok {
+				return web.NewShutdownError("web value missing from context")
+			}
+
+			// Expecting: bearer <token> or apikey <key>
 			authStr := r.Header.Get("authorization")
 
 			// Parse the authorization header.
 			parts := strings.Split(authStr, " ")
-			if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+			scheme := strings.ToLower(parts[0])
+
+			var claims auth.Claims
+			switch key := r.Header.Get("x-api-key"); {
+			case keys != nil && (key != "" || (len(parts) == 2 && scheme == "apikey")):
+				if key == "" {
+					key = parts[1]
+				}
+
+				// Find the claims the key grants.
+				var err error
+				claims, err = keys(ctx, v.TraceID, key, v.Now)
+				if err != nil {
+					if err == auth.ErrInvalidAPIKey {
+						return web.NewRequestError(err, http.StatusUnauthorized)
+					}
+					return errors.Wrap(err, "checking api key")
+				}
+
+			case len(parts) == 2 && scheme == "bearer":
+
+				// Validate the token is signed by us.
+				var err error
+				claims, err = a.ValidateToken(parts[1])
+				if err != nil {
+					return web.NewRequestError(err, http.StatusUnauthorized)
+				}
+
+				// Reject tokens that were revoked before they expired.
+				if claims.Id != "" && revoked != nil {
+					isRevoked, err := revoked(ctx, v.TraceID, claims.Id)
+					if err != nil {
+						return errors.Wrap(err, "checking token revocation")
+					}
+					if isRevoked {
+						err := errors.New("token has been revoked")
+						return web.NewRequestError(err, http.StatusUnauthorized)
+					}
+				}
+
+			default:
 				err := errors.New("expected authorization header format: bearer <token>")
 				return web.NewRequestError(err, http.StatusUnauthorized)
 			}
 
-			// Validate the token is signed by us.
-			claims, err := a.ValidateToken(parts[1])
-			if err != nil {
-				return web.NewRequestError(err, http.StatusUnauthorized)
-			}
-
 			// Add claims to the context so they can be retrieved later.
 			ctx = context.WithValue(ctx, auth.Key, claims)
 
@@ -85,3 +129,37 @@ func Authorize(roles ...string) web.Middleware {
 
 	return m
 }
+
+// RequirePermission validates that the roles of an authenticated user grant
+// the specified permission according to the policy.
+func RequirePermission(policy *auth.Policy, permission string) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.mid.requirepermission")
+			defer span.End()
+
+			// If the context is missing this value return failure.
+			claims, ok := ctx.Value(auth.Key).(auth.Claims)
+			if !ok {
+				return errors.New("claims missing from context")
+			}
+
+			if !policy.Allowed(claims, permission) {
+				return web.NewRequestError(
+					fmt.Errorf("you are not authorized for that action: claims: %v requires: %v", claims.Roles, permission),
+					http.StatusForbidden,
+				)
+			}
+
+			return handler(ctx, w, r)
+		}
+
+		return h
+	}
+
+	return m
+}
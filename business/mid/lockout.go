@@ -0,0 +1,113 @@
+package mid
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+
+	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/lockout"
+	"github.com/appinesshq/bpi/business/data/user"
+	"github.com/appinesshq/bpi/foundation/web"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+// Throttle protects handlers verifying Basic auth credentials or second
+// factors against brute force attacks. Failed attempts are recorded per
+// account and per address, where the account is the one in the Basic auth
+// credentials or the signed in user. Requests for a locked account or from a
+// locked address are refused with a 429 until the lock expires. A successful
+// attempt clears the failures of the account, the failures of the address
+// are kept.
+func Throttle(store lockout.Store) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.mid.throttle")
+			defer span.End()
+
+			// If the context is missing this value, request the service
+			// to be shutdown gracefully.
+			v, ok := ctx.Value(web.KeyValues).(*web.Values)
+			if !ok {
+				return web.NewShutdownError("web value missing from context")
+			}
+
+			var account string
+			if email, _, ok := r.BasicAuth(); ok {
+				account = lockout.AccountKey(email)
+			} else if claims, ok := ctx.Value(auth.Key).(auth.Claims); ok {
+				account = lockout.UserKey(claims.Subject)
+			}
+
+			keys := []string{lockout.AddressKey(remoteIP(r))}
+			if account != "" {
+				keys = append(keys, account)
+			}
+
+			for _, key := range keys {
+				info, err := store.Get(ctx, v.TraceID, key)
+				if err != nil {
+					return errors.Wrap(err, "checking lockout")
+				}
+				if info.Locked(v.Now) {
+					retry := int(math.Ceil(info.LockedUntil.Time.Sub(v.Now).Seconds()))
+					w.Header().Set("Retry-After", fmt.Sprint(retry))
+					err := errors.New("too many failed attempts, try again later")
+					return web.NewRequestError(err, http.StatusTooManyRequests)
+				}
+			}
+
+			err := handler(ctx, w, r)
+
+			// Only rejected credentials and codes count as a failed attempt.
+			// Asking for the second factor means the password was right, so
+			// it doesn't.
+			if webErr, ok := errors.Cause(err).(*web.Error); ok && failed(webErr) {
+				for _, key := range keys {
+					if _, err := store.Fail(ctx, v.TraceID, key, v.Now); err != nil {
+						return errors.Wrap(err, "recording failed attempt")
+					}
+				}
+				return err
+			}
+
+			if err == nil && account != "" {
+				if err := store.Clear(ctx, v.TraceID, account, v.Now); err != nil && err != lockout.ErrNotFound {
+					return errors.Wrap(err, "clearing failed attempts")
+				}
+			}
+
+			return err
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// failed reports whether a request error means the credentials or code were
+// wrong.
+func failed(webErr *web.Error) bool {
+	if webErr.Err == user.ErrInvalidCode {
+		return true
+	}
+	return webErr.Status == http.StatusUnauthorized && webErr.Err != user.ErrSecondFactorRequired
+}
+
+// remoteIP returns the address of the client. Headers set by proxies are not
+// trusted since clients can set them as well.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
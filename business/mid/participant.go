@@ -0,0 +1,58 @@
+package mid
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/foundation/web"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/trace"
+)
+
+// Participant validates that an authenticated user takes part in the
+// conversation identified by the id route parameter. The name of the profile
+// they take part as is added to the context for the handler.
+func Participant(lookup auth.ParticipantLookup) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			ctx, span := trace.SpanFromContext(ctx).Tracer().Start(ctx, "business.mid.participant")
+			defer span.End()
+
+			// If the context is missing this value, request the service
+			// to be shutdown gracefully.
+			v, ok := ctx.Value(web.KeyValues).(*web.Values)
+			if !ok {
+				return web.NewShutdownError("web value missing from context")
+			}
+
+			// If the context is missing this value return failure.
+			claims, ok := ctx.Value(auth.Key).(auth.Claims)
+			if !ok {
+				return errors.New("claims missing from context")
+			}
+
+			name, err := lookup(ctx, v.TraceID, claims, web.Params(r)["id"])
+			if err != nil {
+				if err == auth.ErrNotParticipant {
+					return web.NewRequestError(err, http.StatusForbidden)
+				}
+				return errors.Wrap(err, "checking participant")
+			}
+
+			// Add the participating profile to the context so it can be
+			// retrieved later.
+			ctx = context.WithValue(ctx, auth.ParticipantKey, name)
+
+			return handler(ctx, w, r)
+		}
+
+		return h
+	}
+
+	return m
+}
@@ -0,0 +1,37 @@
+package tests
+
+import (
+	"context"
+	"sync"
+
+	"github.com/appinesshq/bpi/foundation/mail"
+)
+
+// Mailer is an in memory stand-in for a mailer. It keeps every message sent
+// so tests can inspect them.
+type Mailer struct {
+	mu       sync.Mutex
+	messages []mail.Message
+}
+
+// Send implements the mail.Mailer interface.
+func (m *Mailer) Send(ctx context.Context, msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Last returns the last message sent to the specified address.
+func (m *Mailer) Last(to string) (mail.Message, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].To == to {
+			return m.messages[i], true
+		}
+	}
+	return mail.Message{}, false
+}
@@ -5,19 +5,24 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/rsa"
-	"fmt"
+	"encoding/base64"
 	"log"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/appinesshq/bpi/business/auth"
+	"github.com/appinesshq/bpi/business/data/lockout"
+	"github.com/appinesshq/bpi/business/data/permission"
 	"github.com/appinesshq/bpi/business/data/schema"
 	"github.com/appinesshq/bpi/business/data/user"
 	"github.com/appinesshq/bpi/foundation/database"
+	"github.com/appinesshq/bpi/foundation/envelope"
+	"github.com/appinesshq/bpi/foundation/passwd"
 	"github.com/appinesshq/bpi/foundation/web"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // Success and failure markers.
@@ -33,6 +38,7 @@ var (
 	dbArgs  = []string{"-e", "POSTGRES_PASSWORD=postgres"}
 	AdminID = "5cf37266-3473-4006-984f-9325122678b7"
 	UserID  = "45b5fbd3-755f-4379-8f07-a58d4a30fa2f"
+	pepper  = "joireu98ytu98grHROIHGWJREOIJOIJroJ5Y09JRATHJOIHJj5y09aeoirjroiejjrtjhJROIJIJyjHJroisjh509e5e0jte0jhreoijtkjrtrej9yg"
 )
 
 // NewUnit creates a test database inside a Docker container. It creates the
@@ -101,6 +107,31 @@ func Context() context.Context {
 	return context.WithValue(context.Background(), web.KeyValues, &values)
 }
 
+// Passwords returns a password hasher matching the one the passwords of the
+// seeded users were hashed with.
+func Passwords() *passwd.Hasher {
+	alg, err := passwd.NewBcrypt(bcrypt.DefaultCost)
+	if err != nil {
+		panic(err)
+	}
+	return passwd.New(pepper, alg)
+}
+
+// Emails returns a keyring for encrypting email addresses with a fixed key.
+func Emails() *envelope.Keyring {
+	key := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	kr, err := envelope.Parse("test", map[string]string{"test": key})
+	if err != nil {
+		panic(err)
+	}
+	return kr
+}
+
+// Policy returns a policy granting the permissions the migrations grant.
+func Policy() *auth.Policy {
+	return auth.NewPolicy(auth.DefaultGrants)
+}
+
 // StringPointer is a helper to get a *string from a string. It is in the tests
 // package because we normally don't want to deal with pointers to basic types
 // but it's useful in some tests.
@@ -117,11 +148,16 @@ func IntPointer(i int) *int {
 
 // Test owns state for running and shutting down tests.
 type Test struct {
-	TraceID string
-	DB      *sqlx.DB
-	Log     *log.Logger
-	Auth    *auth.Auth
-	KID     string
+	TraceID   string
+	DB        *sqlx.DB
+	Log       *log.Logger
+	Auth      *auth.Auth
+	KID       string
+	Passwords *passwd.Hasher
+	Emails    *envelope.Keyring
+	Policy    *auth.Policy
+	Lockouts  lockout.Store
+	Mailer    *Mailer
 
 	t       *testing.T
 	cleanup func()
@@ -135,36 +171,38 @@ func NewIntegration(t *testing.T) *Test {
 		t.Fatal(err)
 	}
 
+	// Build the policy from the permissions granted in the database.
+	policy := auth.NewPolicy(nil)
+	if err := permission.New(log, db).Load(context.Background(), "", policy); err != nil {
+		t.Fatal(err)
+	}
+
 	// Create RSA keys to enable authentication in our service.
 	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// Build an authenticator using this key lookup function to retrieve
-	// the corresponding public key.
+	// Build an authenticator using an in memory key store holding this key.
 	kidID := "4754d86b-7a6d-4df5-9c65-224741361492"
-	lookup := func(kid string) (*rsa.PublicKey, error) {
-		switch kid {
-		case kidID:
-			return &privateKey.PublicKey, nil
-		}
-		return nil, fmt.Errorf("no public key found for the specified kid: %s", kid)
-	}
-
-	auth, err := auth.New("RS256", lookup, auth.Keys{kidID: privateKey})
+	auth, err := auth.New("RS256", kidID, auth.Keys{kidID: privateKey})
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	test := Test{
-		TraceID: "00000000-0000-0000-0000-000000000000",
-		DB:      db,
-		Log:     log,
-		Auth:    auth,
-		KID:     kidID,
-		t:       t,
-		cleanup: cleanup,
+		TraceID:   "00000000-0000-0000-0000-000000000000",
+		DB:        db,
+		Log:       log,
+		Auth:      auth,
+		KID:       kidID,
+		Passwords: Passwords(),
+		Emails:    Emails(),
+		Policy:    policy,
+		Lockouts:  lockout.NewMemory(lockout.DefaultPolicy),
+		Mailer:    &Mailer{},
+		t:         t,
+		cleanup:   cleanup,
 	}
 
 	return &test
@@ -177,8 +215,8 @@ func (test *Test) Teardown() {
 
 // Token generates an authenticated token for a user.
 func (test *Test) Token(kid string, email, pass string) string {
-	u := user.New(test.Log, test.DB)
-	claims, err := u.Authenticate(context.Background(), test.TraceID, time.Now(), email, pass)
+	u := user.New(test.Log, test.DB, test.Passwords, test.Emails, test.Policy)
+	claims, err := u.Authenticate(context.Background(), test.TraceID, time.Now(), email, pass, "")
 	if err != nil {
 		test.t.Fatal(err)
 	}
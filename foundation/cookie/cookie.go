@@ -0,0 +1,98 @@
+// Package cookie stores values in cookies encrypted with AES-GCM, so clients
+// can neither read nor alter them.
+package cookie
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// KeySize is the size of the keys cookies are encrypted with, selecting
+// AES-256.
+const KeySize = 32
+
+// ErrInvalid occurs when a cookie can't be decrypted, because it was altered,
+// encrypted with another key or belongs to another cookie name.
+var ErrInvalid = errors.New("cookie is invalid")
+
+// Codec encrypts and decrypts cookie values.
+type Codec struct {
+	aead cipher.AEAD
+}
+
+// New constructs a Codec for the specified key, which must be KeySize bytes.
+func New(key []byte) (*Codec, error) {
+	if len(key) != KeySize {
+		return nil, errors.Errorf("key must be %d bytes, got %d", KeySize, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating cipher")
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating gcm")
+	}
+
+	return &Codec{aead: aead}, nil
+}
+
+// GenerateKey returns a random key for use with New.
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, errors.Wrap(err, "generating key")
+	}
+	return key, nil
+}
+
+// Encode marshals the value to JSON and encrypts it. The name of the cookie is
+// authenticated along with the value, so a value can't be moved to another
+// cookie.
+func (c *Codec) Encode(name string, v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", errors.Wrap(err, "marshaling value")
+	}
+
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", errors.Wrap(err, "generating nonce")
+	}
+
+	sealed := c.aead.Seal(nonce, nonce, data, []byte(name))
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Decode decrypts a value created by Encode for the same name and unmarshals
+// it into v.
+func (c *Codec) Decode(name string, value string, v interface{}) error {
+	sealed, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return ErrInvalid
+	}
+
+	ns := c.aead.NonceSize()
+	if len(sealed) < ns {
+		return ErrInvalid
+	}
+
+	data, err := c.aead.Open(nil, sealed[:ns], sealed[ns:], []byte(name))
+	if err != nil {
+		return ErrInvalid
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return errors.Wrap(err, "unmarshaling value")
+	}
+
+	return nil
+}
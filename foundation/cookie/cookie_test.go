@@ -0,0 +1,83 @@
+package cookie_test
+
+import (
+	"testing"
+
+	"github.com/appinesshq/bpi/foundation/cookie"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestCodec(t *testing.T) {
+	type value struct {
+		Token string
+		Roles []string
+	}
+
+	t.Log("Given the need to store values in cookies the client can't read or alter.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen encoding and decoding a value.", testID)
+		{
+			key, err := cookie.GenerateKey()
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to generate a key: %v", failed, testID, err)
+			}
+			c, err := cookie.New(key)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to construct a codec: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to construct a codec.", success, testID)
+
+			in := value{Token: "secret", Roles: []string{"ADMIN"}}
+			enc, err := c.Encode("session", in)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to encode a value: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to encode a value.", success, testID)
+
+			var out value
+			if err := c.Decode("session", enc, &out); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to decode the value: %v", failed, testID, err)
+			}
+			if out.Token != in.Token || len(out.Roles) != 1 || out.Roles[0] != "ADMIN" {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the same value, got %+v.", failed, testID, out)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the same value.", success, testID)
+
+			if err := c.Decode("other", enc, &out); err != cookie.ErrInvalid {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT decode the value for another name: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT decode the value for another name.", success, testID)
+
+			b := []byte(enc)
+			i := len(b) / 2
+			if b[i] == 'A' {
+				b[i] = 'B'
+			} else {
+				b[i] = 'A'
+			}
+			if err := c.Decode("session", string(b), &out); err != cookie.ErrInvalid {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT decode an altered value: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT decode an altered value.", success, testID)
+
+			other, err := cookie.GenerateKey()
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to generate a key: %v", failed, testID, err)
+			}
+			oc, err := cookie.New(other)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to construct a codec: %v", failed, testID, err)
+			}
+			if err := oc.Decode("session", enc, &out); err != cookie.ErrInvalid {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT decode the value with another key: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT decode the value with another key.", success, testID)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+// Package envelope provides envelope encryption. Every value is encrypted
+// with its own AES-GCM data key, which is stored next to the value, encrypted
+// by a wrapping key. Wrapping keys are identified by an id, so values sealed
+// with an older key can still be opened after a new key becomes active.
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// KeySize is the size of both wrapping and data keys, selecting AES-256.
+const KeySize = 32
+
+var (
+	// ErrUnknownKey occurs when a value was sealed with a wrapping key that
+	// isn't in the keyring.
+	ErrUnknownKey = errors.New("wrapping key is unknown")
+
+	// ErrDecrypt occurs when a value or its data key fails authentication,
+	// because it was altered or belongs to another context.
+	ErrDecrypt = errors.New("value can't be decrypted")
+)
+
+// Sealed represents an encrypted value along with its wrapped data key.
+type Sealed struct {
+	KeyID      string // ID of the wrapping key the data key is encrypted with.
+	DataKey    []byte // Data key, encrypted with the wrapping key.
+	Ciphertext []byte // Value, encrypted with the data key.
+}
+
+// Keyring holds the wrapping keys. New values are sealed with the active key,
+// values can be opened with any key in the keyring.
+type Keyring struct {
+	active string
+	keys   map[string]cipher.AEAD
+}
+
+// New constructs a Keyring for the wrapping keys, which must be KeySize bytes
+// each. The active key must be one of them.
+func New(activeID string, keys map[string][]byte) (*Keyring, error) {
+	if _, ok := keys[activeID]; !ok {
+		return nil, errors.Errorf("active key %q is not in the keyring", activeID)
+	}
+
+	kr := Keyring{
+		active: activeID,
+		keys:   make(map[string]cipher.AEAD, len(keys)),
+	}
+	for id, key := range keys {
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "key %q", id)
+		}
+		kr.keys[id] = aead
+	}
+
+	return &kr, nil
+}
+
+// Parse constructs a Keyring for base64 encoded wrapping keys, as they appear
+// in configuration.
+func Parse(activeID string, keys map[string]string) (*Keyring, error) {
+	raw := make(map[string][]byte, len(keys))
+	for id, key := range keys {
+		b, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "decoding key %q", id)
+		}
+		raw[id] = b
+	}
+	return New(activeID, raw)
+}
+
+// ActiveID returns the id of the key new values are sealed with.
+func (kr *Keyring) ActiveID() string {
+	return kr.active
+}
+
+// Seal encrypts the value with a new data key and wraps that key with the
+// active key. The context, like the id of the record the value belongs to,
+// is authenticated with the value so it can't be moved to another record.
+func (kr *Keyring) Seal(value []byte, context []byte) (Sealed, error) {
+	dataKey := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return Sealed{}, errors.Wrap(err, "generating data key")
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return Sealed{}, err
+	}
+
+	ciphertext, err := seal(aead, value, context)
+	if err != nil {
+		return Sealed{}, err
+	}
+
+	wrapped, err := seal(kr.keys[kr.active], dataKey, []byte(kr.active))
+	if err != nil {
+		return Sealed{}, err
+	}
+
+	s := Sealed{
+		KeyID:      kr.active,
+		DataKey:    wrapped,
+		Ciphertext: ciphertext,
+	}
+	return s, nil
+}
+
+// Open unwraps the data key and decrypts the value with it. The context must
+// be the same as when the value was sealed.
+func (kr *Keyring) Open(s Sealed, context []byte) ([]byte, error) {
+	wrapper, ok := kr.keys[s.KeyID]
+	if !ok {
+		return nil, errors.Wrap(ErrUnknownKey, s.KeyID)
+	}
+
+	dataKey, err := open(wrapper, s.DataKey, []byte(s.KeyID))
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return open(aead, s.Ciphertext, context)
+}
+
+// Reseal opens the value and seals it again with a new data key wrapped by
+// the active key.
+func (kr *Keyring) Reseal(s Sealed, context []byte) (Sealed, error) {
+	value, err := kr.Open(s, context)
+	if err != nil {
+		return Sealed{}, err
+	}
+	return kr.Seal(value, context)
+}
+
+// GenerateKey returns a random key, base64 encoded for use in configuration.
+func GenerateKey() (string, error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", errors.Wrap(err, "generating key")
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, errors.Errorf("key must be %d bytes, got %d", KeySize, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating cipher")
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts the plaintext, prefixing the result with a random nonce.
+func seal(aead cipher.AEAD, plaintext []byte, context []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrap(err, "generating nonce")
+	}
+	return aead.Seal(nonce, nonce, plaintext, context), nil
+}
+
+// open decrypts a result of seal.
+func open(aead cipher.AEAD, sealed []byte, context []byte) ([]byte, error) {
+	ns := aead.NonceSize()
+	if len(sealed) < ns {
+		return nil, ErrDecrypt
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:ns], sealed[ns:], context)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,98 @@
+package envelope_test
+
+import (
+	"testing"
+
+	"github.com/appinesshq/bpi/foundation/envelope"
+	"github.com/pkg/errors"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestKeyring(t *testing.T) {
+	keys := make(map[string]string)
+	for _, id := range []string{"1", "2"} {
+		key, err := envelope.GenerateKey()
+		if err != nil {
+			t.Fatalf("Should be able to generate a key: %v", err)
+		}
+		keys[id] = key
+	}
+
+	t.Log("Given the need to store values encrypted with rotatable keys.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen sealing a value with the first key.", testID)
+		{
+			old, err := envelope.Parse("1", map[string]string{"1": keys["1"]})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to construct a keyring: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to construct a keyring.", success, testID)
+
+			value := []byte("user@example.com")
+			s, err := old.Seal(value, []byte("record-1"))
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to seal a value: %v", failed, testID, err)
+			}
+			if s.KeyID != "1" {
+				t.Fatalf("\t%s\tTest %d:\tShould seal with the active key, got %q.", failed, testID, s.KeyID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to seal a value with the active key.", success, testID)
+
+			got, err := old.Open(s, []byte("record-1"))
+			if err != nil || string(got) != string(value) {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to open the value: %q, %v", failed, testID, got, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to open the value.", success, testID)
+
+			if _, err := old.Open(s, []byte("record-2")); errors.Cause(err) != envelope.ErrDecrypt {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT open the value in another context: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT open the value in another context.", success, testID)
+
+			testID++
+			t.Logf("\tTest %d:\tWhen rotating to the second key.", testID)
+			{
+				kr, err := envelope.Parse("2", keys)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to construct a keyring: %v", failed, testID, err)
+				}
+
+				got, err := kr.Open(s, []byte("record-1"))
+				if err != nil || string(got) != string(value) {
+					t.Fatalf("\t%s\tTest %d:\tShould open values sealed with the old key: %q, %v", failed, testID, got, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould open values sealed with the old key.", success, testID)
+
+				rs, err := kr.Reseal(s, []byte("record-1"))
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to reseal the value: %v", failed, testID, err)
+				}
+				if rs.KeyID != "2" {
+					t.Fatalf("\t%s\tTest %d:\tShould reseal with the new key, got %q.", failed, testID, rs.KeyID)
+				}
+				t.Logf("\t%s\tTest %d:\tShould reseal with the new key.", success, testID)
+
+				if _, err := old.Open(rs, []byte("record-1")); errors.Cause(err) != envelope.ErrUnknownKey {
+					t.Fatalf("\t%s\tTest %d:\tShould NOT open the resealed value without the new key: %v", failed, testID, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould NOT open the resealed value without the new key.", success, testID)
+
+				current, err := envelope.Parse("2", map[string]string{"2": keys["2"]})
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to construct a keyring: %v", failed, testID, err)
+				}
+				got, err = current.Open(rs, []byte("record-1"))
+				if err != nil || string(got) != string(value) {
+					t.Fatalf("\t%s\tTest %d:\tShould open the resealed value once the old key is gone: %q, %v", failed, testID, got, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould open the resealed value once the old key is gone.", success, testID)
+			}
+		}
+	}
+}
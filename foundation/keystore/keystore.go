@@ -0,0 +1,172 @@
+// Package keystore implements a store of RSA keys loaded from PEM files in a
+// folder. The store can be reloaded at runtime to support key rotation.
+package keystore
+
+import (
+	"crypto/rsa"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// ErrKeyNotFound is returned when no key is known for a key id (kid).
+var ErrKeyNotFound = errors.New("key not found")
+
+// ErrRetiredKey is returned when a private key is requested for a key that is
+// only kept around to verify tokens signed before it was retired.
+var ErrRetiredKey = errors.New("key is retired and can only be used for verification")
+
+// ActiveFile is the name of the file in the folder holding the kid of the key
+// tokens are signed with. Writing another kid to it and reloading the store
+// rotates the signing key.
+const ActiveFile = "active"
+
+// KeyStore holds the set of keys found in a folder. Every file named
+// <kid>.pem is loaded. Files holding a private key can be used for signing
+// and verification. Files holding only a public key represent retired keys,
+// which are used for verification only.
+//
+// The active key is named by the ActiveFile in the folder. Without that file
+// the active key is the one passed to New.
+//
+// The store is safe for concurrent use.
+type KeyStore struct {
+	folder    string
+	activeKID string
+
+	mu      sync.RWMutex
+	active  string
+	private map[string]*rsa.PrivateKey
+	public  map[string]*rsa.PublicKey
+}
+
+// New constructs a KeyStore and loads the keys found in the folder. The
+// activeKID is used to sign tokens as long as the folder has no ActiveFile.
+func New(folder string, activeKID string) (*KeyStore, error) {
+	ks := KeyStore{
+		folder:    folder,
+		activeKID: activeKID,
+	}
+
+	if err := ks.Reload(); err != nil {
+		return nil, err
+	}
+
+	return &ks, nil
+}
+
+// Reload rereads the keys and the active kid from the folder and replaces
+// the current set. When reading any key fails, or the active key can't be
+// used for signing, the current set is kept untouched.
+func (ks *KeyStore) Reload() error {
+	active := ks.activeKID
+	switch data, err := ioutil.ReadFile(filepath.Join(ks.folder, ActiveFile)); {
+	case err == nil:
+		active = strings.TrimSpace(string(data))
+	case !os.IsNotExist(err):
+		return errors.Wrap(err, "reading active key file")
+	}
+
+	files, err := filepath.Glob(filepath.Join(ks.folder, "*.pem"))
+	if err != nil {
+		return errors.Wrap(err, "listing key files")
+	}
+
+	private := make(map[string]*rsa.PrivateKey)
+	public := make(map[string]*rsa.PublicKey)
+
+	for _, file := range files {
+		kid := strings.TrimSuffix(filepath.Base(file), ".pem")
+
+		pemData, err := ioutil.ReadFile(file)
+		if err != nil {
+			return errors.Wrapf(err, "reading key file %s", file)
+		}
+
+		if privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(pemData); err == nil {
+			private[kid] = privateKey
+			public[kid] = &privateKey.PublicKey
+			continue
+		}
+
+		publicKey, err := jwt.ParseRSAPublicKeyFromPEM(pemData)
+		if err != nil {
+			return errors.Wrapf(err, "parsing key file %s", file)
+		}
+		public[kid] = publicKey
+	}
+
+	if len(public) == 0 {
+		return errors.Errorf("no keys found in %s", ks.folder)
+	}
+
+	if _, ok := private[active]; !ok {
+		return errors.Errorf("active key %q has no private key in %s", active, ks.folder)
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	ks.active = active
+	ks.private = private
+	ks.public = public
+
+	return nil
+}
+
+// ActiveKID returns the kid of the key tokens are signed with.
+func (ks *KeyStore) ActiveKID() string {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	return ks.active
+}
+
+// PrivateKey returns the private key for signing tokens with the given kid.
+func (ks *KeyStore) PrivateKey(kid string) (*rsa.PrivateKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	privateKey, ok := ks.private[kid]
+	if !ok {
+		if _, ok := ks.public[kid]; ok {
+			return nil, ErrRetiredKey
+		}
+		return nil, ErrKeyNotFound
+	}
+
+	return privateKey, nil
+}
+
+// PublicKey returns the public key for verifying tokens signed with the
+// given kid.
+func (ks *KeyStore) PublicKey(kid string) (*rsa.PublicKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	publicKey, ok := ks.public[kid]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+
+	return publicKey, nil
+}
+
+// PublicKeys returns a copy of the public keys of every key in the store,
+// retired keys included, indexed by kid.
+func (ks *KeyStore) PublicKeys() map[string]*rsa.PublicKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	keys := make(map[string]*rsa.PublicKey, len(ks.public))
+	for kid, publicKey := range ks.public {
+		keys[kid] = publicKey
+	}
+
+	return keys
+}
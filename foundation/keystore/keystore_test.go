@@ -0,0 +1,143 @@
+package keystore_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/appinesshq/bpi/foundation/keystore"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestKeyStore(t *testing.T) {
+	const (
+		oldKID = "0b1cc5f4-8b3f-4bd2-9fbb-8d6bdc0d3d2c"
+		newKID = "f2d0e7a4-5c6a-4a16-a4b8-0b0a9e1b5a77"
+	)
+
+	t.Log("Given the need to load keys from a folder.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the folder has no keys.", testID)
+		{
+			folder := tempDir(t, testID)
+
+			if _, err := keystore.New(folder, oldKID); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to load an empty folder.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be able to load an empty folder.", success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen rotating the active key.", testID)
+		{
+			folder := tempDir(t, testID)
+			oldKey := writeKey(t, testID, folder, oldKID)
+
+			if _, err := keystore.New(folder, newKID); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to load without a private key for the active key.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be able to load without a private key for the active key.", success, testID)
+
+			ks, err := keystore.New(folder, oldKID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to load the keys: %v", failed, testID, err)
+			}
+			if ks.ActiveKID() != oldKID {
+				t.Fatalf("\t%s\tTest %d:\tShould sign with the configured key without an active file: %s", failed, testID, ks.ActiveKID())
+			}
+			t.Logf("\t%s\tTest %d:\tShould sign with the configured key without an active file.", success, testID)
+
+			// Retire the active key without naming a new one.
+			writeKey(t, testID, folder, newKID)
+			writePublicKey(t, testID, folder, oldKID, &oldKey.PublicKey)
+
+			if err := ks.Reload(); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to reload without a private key for the active key.", failed, testID)
+			}
+			if _, err := ks.PrivateKey(oldKID); err != nil || ks.ActiveKID() != oldKID {
+				t.Fatalf("\t%s\tTest %d:\tShould keep the current keys when reloading fails: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould keep the current keys when reloading fails.", success, testID)
+
+			if err := ioutil.WriteFile(filepath.Join(folder, keystore.ActiveFile), []byte(newKID+"\n"), 0600); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to write the active file: %v", failed, testID, err)
+			}
+			if err := ks.Reload(); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to reload the keys: %v", failed, testID, err)
+			}
+			if ks.ActiveKID() != newKID {
+				t.Fatalf("\t%s\tTest %d:\tShould sign with the key in the active file: %s", failed, testID, ks.ActiveKID())
+			}
+			t.Logf("\t%s\tTest %d:\tShould sign with the key in the active file.", success, testID)
+
+			if _, err := ks.PrivateKey(oldKID); err != keystore.ErrRetiredKey {
+				t.Fatalf("\t%s\tTest %d:\tShould not sign with a retired key: %v", failed, testID, err)
+			}
+			if _, err := ks.PublicKey(oldKID); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould verify with a retired key: %v", failed, testID, err)
+			}
+			if _, err := ks.PrivateKey("unknown"); err != keystore.ErrKeyNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould not find an unknown key: %v", failed, testID, err)
+			}
+			if n := len(ks.PublicKeys()); n != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould publish both keys: %d", failed, testID, n)
+			}
+			t.Logf("\t%s\tTest %d:\tShould only verify with a retired key.", success, testID)
+		}
+	}
+}
+
+// tempDir creates a folder that is removed when the test ends.
+func tempDir(t *testing.T, testID int) string {
+	folder, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatalf("\t%s\tTest %d:\tShould be able to create a keys folder: %v", failed, testID, err)
+	}
+	t.Cleanup(func() { os.RemoveAll(folder) })
+	return folder
+}
+
+// writeKey generates a private key and stores it as <kid>.pem in folder.
+func writeKey(t *testing.T, testID int, folder string, kid string) *rsa.PrivateKey {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("\t%s\tTest %d:\tShould be able to create a private key: %v", failed, testID, err)
+	}
+
+	block := pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+	}
+	if err := ioutil.WriteFile(filepath.Join(folder, kid+".pem"), pem.EncodeToMemory(&block), 0600); err != nil {
+		t.Fatalf("\t%s\tTest %d:\tShould be able to write a private key: %v", failed, testID, err)
+	}
+
+	return privateKey
+}
+
+// writePublicKey stores a public key as <kid>.pem in folder.
+func writePublicKey(t *testing.T, testID int, folder string, kid string, publicKey *rsa.PublicKey) {
+	asn1Bytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatalf("\t%s\tTest %d:\tShould be able to marshal a public key: %v", failed, testID, err)
+	}
+
+	block := pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: asn1Bytes,
+	}
+	if err := ioutil.WriteFile(filepath.Join(folder, kid+".pem"), pem.EncodeToMemory(&block), 0600); err != nil {
+		t.Fatalf("\t%s\tTest %d:\tShould be able to write a public key: %v", failed, testID, err)
+	}
+}
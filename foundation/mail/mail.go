@@ -0,0 +1,101 @@
+// Package mail provides support for sending email messages.
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Message represents a plain text email message.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer declares the behavior required to deliver email messages. It allows
+// the delivery mechanism to be swapped, for example for an in memory mailer
+// in tests.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// =============================================================================
+
+// Config is the required properties to use the SMTP mailer.
+type Config struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	From     string
+}
+
+// SMTP delivers messages through an SMTP server.
+type SMTP struct {
+	cfg Config
+}
+
+// NewSMTP constructs a mailer delivering messages through the configured
+// SMTP server.
+func NewSMTP(cfg Config) *SMTP {
+	return &SMTP{
+		cfg: cfg,
+	}
+}
+
+// Send implements the Mailer interface.
+func (s *SMTP) Send(ctx context.Context, msg Message) error {
+	addr := net.JoinHostPort(s.cfg.Host, fmt.Sprint(s.cfg.Port))
+
+	var a smtp.Auth
+	if s.cfg.User != "" {
+		a = smtp.PlainAuth("", s.cfg.User, s.cfg.Password, s.cfg.Host)
+	}
+
+	if err := smtp.SendMail(addr, a, s.cfg.From, []string{msg.To}, format(s.cfg.From, msg)); err != nil {
+		return errors.Wrapf(err, "sending mail to %s", msg.To)
+	}
+
+	return nil
+}
+
+// format renders the message in the format expected by the SMTP server.
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// =============================================================================
+
+// Log writes messages to a logger instead of delivering them. It is meant
+// for development environments without an SMTP server.
+type Log struct {
+	log *log.Logger
+}
+
+// NewLog constructs a mailer writing messages to the logger.
+func NewLog(log *log.Logger) *Log {
+	return &Log{
+		log: log,
+	}
+}
+
+// Send implements the Mailer interface.
+func (l *Log) Send(ctx context.Context, msg Message) error {
+	l.log.Printf("mail: to[%s] subject[%s]\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
@@ -0,0 +1,344 @@
+// Package oidc implements the relying party side of the OpenID Connect
+// authorization code flow with PKCE, as used to sign in with Google,
+// Microsoft or any other compliant provider.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidToken occurs when an ID token can't be verified.
+var ErrInvalidToken = errors.New("id token is invalid")
+
+// Config contains the settings of a provider.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Metadata represents the parts of the discovery document that are used.
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// IDToken represents the verified claims of an ID token.
+type IDToken struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Provider performs the flow against a single OpenID provider. Its discovery
+// document is fetched on first use, so a provider that is down doesn't keep
+// the service from starting.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu       sync.Mutex
+	metadata *Metadata
+	keys     map[string]*rsa.PublicKey
+}
+
+// New constructs a Provider for the specified configuration. The client is
+// used for every request made to the provider.
+func New(cfg Config, client *http.Client) *Provider {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	return &Provider{
+		cfg:    cfg,
+		client: client,
+	}
+}
+
+// Discover fetches the discovery document of the provider unless it was
+// fetched before.
+func (p *Provider) Discover(ctx context.Context) (Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return *p.metadata, nil
+	}
+
+	var md Metadata
+	u := strings.TrimSuffix(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.get(ctx, u, &md); err != nil {
+		return Metadata{}, errors.Wrap(err, "fetching discovery document")
+	}
+
+	// The issuer in the document must match the one configured, otherwise
+	// tokens of another issuer could be accepted.
+	if strings.TrimSuffix(md.Issuer, "/") != strings.TrimSuffix(p.cfg.Issuer, "/") {
+		return Metadata{}, errors.Errorf("discovery document is for issuer %q", md.Issuer)
+	}
+
+	p.metadata = &md
+	return md, nil
+}
+
+// AuthCodeURL returns the URL to send the user to for signing in. The state
+// protects against forged callbacks, the nonce against replayed ID tokens and
+// the challenge is derived from the PKCE verifier.
+func (p *Provider) AuthCodeURL(ctx context.Context, state string, nonce string, verifier string) (string, error) {
+	md, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	v := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(md.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return md.AuthorizationEndpoint + sep + v.Encode(), nil
+}
+
+// Exchange trades the authorization code for tokens and returns the verified
+// ID token.
+func (p *Provider) Exchange(ctx context.Context, code string, verifier string, nonce string, now time.Time) (IDToken, error) {
+	md, err := p.Discover(ctx)
+	if err != nil {
+		return IDToken{}, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"code_verifier": {verifier},
+	}
+	if p.cfg.ClientSecret != "" {
+		form.Set("client_secret", p.cfg.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, md.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return IDToken{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return IDToken{}, errors.Wrap(err, "requesting tokens")
+	}
+	defer resp.Body.Close()
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return IDToken{}, errors.Wrap(err, "decoding token response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return IDToken{}, errors.Errorf("token endpoint: %d %s", resp.StatusCode, tokens.Error)
+	}
+	if tokens.IDToken == "" {
+		return IDToken{}, errors.New("token response lacks an id token")
+	}
+
+	return p.Verify(ctx, tokens.IDToken, nonce, now)
+}
+
+// Verify checks the signature, issuer, audience, expiry and nonce of an ID
+// token and returns its claims.
+func (p *Provider) Verify(ctx context.Context, raw string, nonce string, now time.Time) (IDToken, error) {
+	md, err := p.Discover(ctx)
+	if err != nil {
+		return IDToken{}, err
+	}
+
+	// Expiry is checked below against the provided time.
+	parser := jwt.Parser{
+		ValidMethods:         []string{"RS256"},
+		SkipClaimsValidation: true,
+	}
+
+	var claims jwt.MapClaims
+	keyFunc := func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, md.JWKSURI, kid)
+	}
+	if _, err := parser.ParseWithClaims(raw, &claims, keyFunc); err != nil {
+		return IDToken{}, errors.Wrap(ErrInvalidToken, err.Error())
+	}
+
+	iss, _ := claims["iss"].(string)
+	if iss != md.Issuer {
+		return IDToken{}, errors.Wrapf(ErrInvalidToken, "issuer %q", iss)
+	}
+
+	if !audience(claims["aud"], p.cfg.ClientID) {
+		return IDToken{}, errors.Wrap(ErrInvalidToken, "audience")
+	}
+
+	exp, _ := claims["exp"].(float64)
+	if now.Unix() >= int64(exp) {
+		return IDToken{}, errors.Wrap(ErrInvalidToken, "expired")
+	}
+
+	if n, _ := claims["nonce"].(string); n != nonce {
+		return IDToken{}, errors.Wrap(ErrInvalidToken, "nonce")
+	}
+
+	tok := IDToken{Issuer: iss}
+	tok.Subject, _ = claims["sub"].(string)
+	tok.Email, _ = claims["email"].(string)
+	tok.Name, _ = claims["name"].(string)
+
+	// Some providers send email_verified as a string.
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		tok.EmailVerified = v
+	case string:
+		tok.EmailVerified = v == "true"
+	}
+
+	if tok.Subject == "" {
+		return IDToken{}, errors.Wrap(ErrInvalidToken, "subject")
+	}
+
+	return tok, nil
+}
+
+// key returns the public key for the kid, fetching the key set again when
+// the kid is unknown since providers rotate their keys.
+func (p *Provider) key(ctx context.Context, jwksURI string, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	var set struct {
+		Keys []struct {
+			KeyType  string `json:"kty"`
+			KeyID    string `json:"kid"`
+			Modulus  string `json:"n"`
+			Exponent string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.get(ctx, jwksURI, &set); err != nil {
+		return nil, errors.Wrap(err, "fetching key set")
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.KeyType != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.Modulus)
+		if err != nil {
+			return nil, errors.Wrapf(err, "decoding modulus of key %q", k.KeyID)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.Exponent)
+		if err != nil {
+			return nil, errors.Wrapf(err, "decoding exponent of key %q", k.KeyID)
+		}
+		keys[k.KeyID] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	p.keys = keys
+
+	key, ok := p.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	return key, nil
+}
+
+// get fetches a JSON document from the provider.
+func (p *Provider) get(ctx context.Context, u string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("%s: %s", u, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// audience reports whether the aud claim, a string or a list of strings,
+// contains the client id.
+func audience(aud interface{}, clientID string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == clientID
+	case []interface{}:
+		for _, a := range v {
+			if s, ok := a.(string); ok && s == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Random returns a random URL safe value, suitable for states, nonces and
+// PKCE verifiers.
+func Random() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "generating random value")
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Challenge derives the S256 PKCE challenge from a verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,108 @@
+package oidc_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/appinesshq/bpi/foundation/oidc"
+	"github.com/appinesshq/bpi/foundation/oidc/oidctest"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestFlow(t *testing.T) {
+	srv, err := oidctest.NewServer()
+	if err != nil {
+		t.Fatalf("starting provider: %v", err)
+	}
+	t.Cleanup(srv.Close)
+
+	srv.SignIn(oidctest.User{
+		Subject:       "1234567890",
+		Email:         "jane@example.com",
+		EmailVerified: true,
+	})
+
+	// Redirects are followed manually, the callback isn't served anywhere.
+	client := http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	p := oidc.New(srv.Config("http://localhost/callback"), &client)
+
+	t.Log("Given the need to sign in users with an OpenID provider.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen completing the authorization code flow.", testID)
+		{
+			ctx := context.Background()
+
+			state, _ := oidc.Random()
+			nonce, _ := oidc.Random()
+			verifier, _ := oidc.Random()
+
+			authURL, err := p.AuthCodeURL(ctx, state, nonce, verifier)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to build the authorization URL : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to build the authorization URL.", success, testID)
+
+			resp, err := client.Get(authURL)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to sign in : %v", failed, testID, err)
+			}
+			resp.Body.Close()
+
+			loc, err := url.Parse(resp.Header.Get("Location"))
+			if err != nil || loc.Query().Get("state") != state {
+				t.Fatalf("\t%s\tTest %d:\tShould be redirected back with the state : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be redirected back with the state.", success, testID)
+
+			code := loc.Query().Get("code")
+			if _, err := p.Exchange(ctx, code, verifier, "other", time.Now()); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT accept an ID token with another nonce.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT accept an ID token with another nonce.", success, testID)
+
+			// Codes are single use, so sign in again.
+			resp, err = client.Get(authURL)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to sign in : %v", failed, testID, err)
+			}
+			resp.Body.Close()
+			loc, _ = url.Parse(resp.Header.Get("Location"))
+			code = loc.Query().Get("code")
+
+			if _, err := p.Exchange(ctx, code, "wrong", nonce, time.Now()); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould NOT get tokens with the wrong PKCE verifier.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould NOT get tokens with the wrong PKCE verifier.", success, testID)
+
+			resp, err = client.Get(authURL)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to sign in : %v", failed, testID, err)
+			}
+			resp.Body.Close()
+			loc, _ = url.Parse(resp.Header.Get("Location"))
+			code = loc.Query().Get("code")
+
+			tok, err := p.Exchange(ctx, code, verifier, nonce, time.Now())
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to exchange the code : %v", failed, testID, err)
+			}
+			if tok.Subject != "1234567890" || tok.Email != "jane@example.com" || !tok.EmailVerified {
+				t.Fatalf("\t%s\tTest %d:\tShould get the claims of the user : %+v", failed, testID, tok)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to exchange the code.", success, testID)
+		}
+	}
+}
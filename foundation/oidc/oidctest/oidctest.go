@@ -0,0 +1,199 @@
+// Package oidctest provides a local OpenID provider for tests. It signs in
+// whichever user was set last without showing a login page.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/appinesshq/bpi/foundation/oidc"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// ClientID is the only client the server accepts.
+const ClientID = "bpi-test"
+
+// kid identifies the key ID tokens are signed with.
+const kid = "oidctest"
+
+// User represents the user signed in at the provider.
+type User struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// grant represents an issued authorization code.
+type grant struct {
+	user        User
+	nonce       string
+	challenge   string
+	redirectURI string
+}
+
+// Server is a local OpenID provider.
+type Server struct {
+	*httptest.Server
+
+	key *rsa.PrivateKey
+
+	mu     sync.Mutex
+	user   User
+	grants map[string]grant
+}
+
+// NewServer starts a provider. Callers should call Close when done.
+func NewServer() (*Server, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	s := Server{
+		key:    key,
+		grants: make(map[string]grant),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("/authorize", s.authorize)
+	mux.HandleFunc("/token", s.token)
+	mux.HandleFunc("/jwks", s.jwks)
+	s.Server = httptest.NewServer(mux)
+
+	return &s, nil
+}
+
+// SignIn sets the user signed in at the provider.
+func (s *Server) SignIn(u User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.user = u
+}
+
+// Config returns the configuration to use the server as a provider.
+func (s *Server) Config(redirectURL string) oidc.Config {
+	return oidc.Config{
+		Issuer:      s.URL,
+		ClientID:    ClientID,
+		RedirectURL: redirectURL,
+	}
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	md := oidc.Metadata{
+		Issuer:                s.URL,
+		AuthorizationEndpoint: s.URL + "/authorize",
+		TokenEndpoint:         s.URL + "/token",
+		JWKSURI:               s.URL + "/jwks",
+	}
+	respond(w, md, http.StatusOK)
+}
+
+// authorize immediately redirects back to the client with a code.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != ClientID || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	code, err := oidc.Random()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
+	s.grants[code] = grant{
+		user:        s.user,
+		nonce:       q.Get("nonce"),
+		challenge:   q.Get("code_challenge"),
+		redirectURI: q.Get("redirect_uri"),
+	}
+	s.mu.Unlock()
+
+	v := url.Values{
+		"code":  {code},
+		"state": {q.Get("state")},
+	}
+	http.Redirect(w, r, q.Get("redirect_uri")+"?"+v.Encode(), http.StatusFound)
+}
+
+// token exchanges a code for an ID token once, if the PKCE verifier matches.
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respond(w, map[string]string{"error": "invalid_request"}, http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	g, ok := s.grants[r.PostForm.Get("code")]
+	delete(s.grants, r.PostForm.Get("code"))
+	s.mu.Unlock()
+
+	if !ok || g.redirectURI != r.PostForm.Get("redirect_uri") || g.challenge != oidc.Challenge(r.PostForm.Get("code_verifier")) {
+		respond(w, map[string]string{"error": "invalid_grant"}, http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            s.URL,
+		"aud":            ClientID,
+		"sub":            g.user.Subject,
+		"email":          g.user.Email,
+		"email_verified": g.user.EmailVerified,
+		"name":           g.user.Name,
+		"nonce":          g.nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	}
+
+	tkn := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	tkn.Header["kid"] = kid
+	idToken, err := tkn.SignedString(s.key)
+	if err != nil {
+		respond(w, map[string]string{"error": "server_error"}, http.StatusInternalServerError)
+		return
+	}
+
+	resp := map[string]string{
+		"access_token": "unused",
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	}
+	respond(w, resp, http.StatusOK)
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := s.key.PublicKey
+	set := map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA",
+				"use": "sig",
+				"alg": "RS256",
+				"kid": kid,
+				"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			},
+		},
+	}
+	respond(w, set, http.StatusOK)
+}
+
+func respond(w http.ResponseWriter, v interface{}, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
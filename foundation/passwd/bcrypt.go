@@ -0,0 +1,58 @@
+package passwd
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Bcrypt hashes passwords with bcrypt at the configured cost.
+type Bcrypt struct {
+	cost int
+}
+
+// NewBcrypt constructs the bcrypt algorithm with the given cost.
+func NewBcrypt(cost int) (Bcrypt, error) {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return Bcrypt{}, errors.Errorf("bcrypt cost %d outside of range %d-%d", cost, bcrypt.MinCost, bcrypt.MaxCost)
+	}
+
+	return Bcrypt{cost: cost}, nil
+}
+
+// Hash implements the Algorithm interface.
+func (b Bcrypt) Hash(password []byte) ([]byte, error) {
+	return bcrypt.GenerateFromPassword(password, b.cost)
+}
+
+// Compare implements the Algorithm interface.
+func (b Bcrypt) Compare(hash []byte, password []byte) error {
+	if err := bcrypt.CompareHashAndPassword(hash, password); err != nil {
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return ErrMismatch
+		}
+		return errors.Wrap(err, "comparing bcrypt hash")
+	}
+
+	return nil
+}
+
+// Owns implements the Algorithm interface.
+func (b Bcrypt) Owns(hash []byte) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if bytes.HasPrefix(hash, []byte(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Outdated implements the Algorithm interface.
+func (b Bcrypt) Outdated(hash []byte) bool {
+	cost, err := bcrypt.Cost(hash)
+	if err != nil {
+		return true
+	}
+	return cost != b.cost
+}
@@ -0,0 +1,82 @@
+// Package passwd provides support for hashing and verifying passwords.
+package passwd
+
+import (
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrMismatch occurs when a password does not match a hash.
+	ErrMismatch = errors.New("password does not match")
+
+	// ErrUnknownAlgorithm occurs when a hash was created with an algorithm
+	// the Hasher doesn't know about.
+	ErrUnknownAlgorithm = errors.New("hash was created with an unknown algorithm")
+)
+
+// Algorithm declares the behavior required from a password hashing
+// algorithm.
+type Algorithm interface {
+
+	// Hash returns a hash of the password, encoded with its parameters.
+	Hash(password []byte) ([]byte, error)
+
+	// Compare returns ErrMismatch if the password does not match the hash.
+	Compare(hash []byte, password []byte) error
+
+	// Owns reports whether the hash was created by this algorithm.
+	Owns(hash []byte) bool
+
+	// Outdated reports whether the hash was created with other parameters
+	// than the ones currently configured for the algorithm.
+	Outdated(hash []byte) bool
+}
+
+// Hasher hashes and verifies passwords. Every password is combined with a
+// secret pepper before it is hashed. New hashes are created with the current
+// algorithm, hashes created with a legacy algorithm can still be verified.
+type Hasher struct {
+	pepper     string
+	current    Algorithm
+	algorithms []Algorithm
+}
+
+// New constructs a Hasher creating new hashes with the current algorithm.
+func New(pepper string, current Algorithm, legacy ...Algorithm) *Hasher {
+	h := Hasher{
+		pepper:     pepper,
+		current:    current,
+		algorithms: append([]Algorithm{current}, legacy...),
+	}
+
+	return &h
+}
+
+// Hash returns a hash of the password created with the current algorithm.
+func (h *Hasher) Hash(password string) ([]byte, error) {
+	hash, err := h.current.Hash([]byte(password + h.pepper))
+	if err != nil {
+		return nil, errors.Wrap(err, "hashing password")
+	}
+
+	return hash, nil
+}
+
+// Verify checks the password against the hash. When the password matches, it
+// reports whether the hash should be replaced because it was created with an
+// older algorithm or other parameters.
+func (h *Hasher) Verify(hash []byte, password string) (bool, error) {
+	for _, alg := range h.algorithms {
+		if !alg.Owns(hash) {
+			continue
+		}
+
+		if err := alg.Compare(hash, []byte(password+h.pepper)); err != nil {
+			return false, err
+		}
+
+		return alg != h.current || alg.Outdated(hash), nil
+	}
+
+	return false, ErrUnknownAlgorithm
+}
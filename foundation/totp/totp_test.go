@@ -0,0 +1,61 @@
+package totp_test
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"github.com/appinesshq/bpi/foundation/totp"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestCode(t *testing.T) {
+
+	// Test vectors from RFC 6238 appendix B for SHA1, truncated to 6 digits.
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	t.Log("Given the need to generate codes compatible with authenticator apps.")
+	{
+		for testID, v := range vectors {
+			t.Logf("\tTest %d:\tWhen generating the code at %d.", testID, v.unix)
+			{
+				code, err := totp.Code(secret, totp.Step(time.Unix(v.unix, 0)))
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to generate a code: %v", failed, testID, err)
+				}
+				if code != v.code {
+					t.Fatalf("\t%s\tTest %d:\tShould get code %s, got %s.", failed, testID, v.code, code)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get code %s.", success, testID, v.code)
+
+				now := time.Unix(v.unix, 0).Add(totp.Period)
+				if _, ok := totp.Validate(secret, code, now); !ok {
+					t.Fatalf("\t%s\tTest %d:\tShould accept the code one period later.", failed, testID)
+				}
+				t.Logf("\t%s\tTest %d:\tShould accept the code one period later.", success, testID)
+
+				now = time.Unix(v.unix, 0).Add(3 * totp.Period)
+				if _, ok := totp.Validate(secret, code, now); ok {
+					t.Fatalf("\t%s\tTest %d:\tShould NOT accept the code three periods later.", failed, testID)
+				}
+				t.Logf("\t%s\tTest %d:\tShould NOT accept the code three periods later.", success, testID)
+			}
+		}
+	}
+}
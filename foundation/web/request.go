@@ -5,6 +5,7 @@ import (
 	"errors"
 	"net/http"
 	"reflect"
+	"strconv"
 	"strings"
 
 	"github.com/dimfeld/httptreemux/v5"
@@ -51,6 +52,62 @@ func Params(r *http.Request) map[string]string {
 	return httptreemux.ContextParams(r.Context())
 }
 
+// DefaultLanguage is the language used when a request asks for none of the
+// languages Language understands.
+const DefaultLanguage = "en"
+
+// Language returns the ISO 639-1 code of the language the client prefers. The
+// lang query parameter goes before the Accept-Language header, a request
+// asking for neither gets the default language.
+func Language(r *http.Request) string {
+	if lang, ok := languageCode(r.URL.Query().Get("lang")); ok {
+		return lang
+	}
+
+	best, bestQ := DefaultLanguage, 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		fields := strings.Split(part, ";")
+
+		lang, ok := languageCode(fields[0])
+		if !ok {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+			v, err := strconv.ParseFloat(param[2:], 64)
+			if err != nil {
+				v = 0
+			}
+			q = v
+		}
+
+		// Languages with an equal weight keep the order of the header.
+		if q > bestQ {
+			best, bestQ = lang, q
+		}
+	}
+
+	return best
+}
+
+// languageCode returns the lower case primary subtag of a language tag like
+// "nl-BE" when it is a two letter ISO 639-1 code.
+func languageCode(tag string) (string, bool) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	if len(tag) != 2 || tag[0] < 'a' || tag[0] > 'z' || tag[1] < 'a' || tag[1] > 'z' {
+		return "", false
+	}
+	return tag, true
+}
+
 // Decode reads the body of an HTTP request looking for a JSON document. The
 // body is decoded into the provided value.
 //
@@ -0,0 +1,51 @@
+package web_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/appinesshq/bpi/foundation/web"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestLanguage(t *testing.T) {
+	tt := []struct {
+		name   string
+		target string
+		accept string
+		want   string
+	}{
+		{"nothing", "/", "", "en"},
+		{"query", "/?lang=NL", "de", "nl"},
+		{"query region", "/?lang=pt-BR", "", "pt"},
+		{"invalid query", "/?lang=dutch", "fr", "fr"},
+		{"header", "/", "nl-BE", "nl"},
+		{"weights", "/", "en;q=0.5, de-DE;q=0.9, fr;q=0.7", "de"},
+		{"header order", "/", "it, fr", "it"},
+		{"wildcard", "/", "*, es;q=0.1", "es"},
+		{"unknown", "/", "*", "en"},
+	}
+
+	t.Log("Given the need to pick the language of a response.")
+	{
+		for testID, tc := range tt {
+			t.Logf("\tTest %d:\tWhen asking for %q with %q.", testID, tc.target, tc.accept)
+			{
+				r := httptest.NewRequest("GET", tc.target, nil)
+				if tc.accept != "" {
+					r.Header.Set("Accept-Language", tc.accept)
+				}
+
+				if got := web.Language(r); got != tc.want {
+					t.Fatalf("\t%s\tTest %d:\tShould get %q for %s, got %q.", failed, testID, tc.want, tc.name, got)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get %q for %s.", success, testID, tc.want, tc.name)
+			}
+		}
+	}
+}